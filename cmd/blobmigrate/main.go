@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gocart/pkg/blobstore"
+	"gocart/pkg/config"
+)
+
+const usage = `Usage: go run ./cmd/blobmigrate [-from-dir DIR] [-prefix PREFIX] [-delete-source] [-dry-run] [config flags]
+
+Copies uploaded files from a local directory (by default uploads.dir) into
+the configured storage backend, keeping their keys, so the URLs stored in
+the database keep working. Files the destination already holds with the
+same size are skipped, so an interrupted run can simply be repeated.
+`
+
+func main() {
+	fromDir := flag.String("from-dir", "", "directory to copy files from (default uploads.dir)")
+	prefix := flag.String("prefix", "", "only copy keys starting with this prefix, e.g. products/")
+	deleteSource := flag.Bool("delete-source", false, "delete each file once it has been copied")
+	dryRun := flag.Bool("dry-run", false, "list the files that would be copied without copying them")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+	if _, err := cfg.ResolveSecrets(context.Background(), cfg.SecretResolver()); err != nil {
+		log.Fatalf("failed to resolve secrets: %v", err)
+	}
+	ctx := context.Background()
+
+	if *fromDir == "" {
+		*fromDir = cfg.Uploads.Dir
+	}
+	if cfg.Storage.Backend == blobstore.BackendLocal && sameDir(*fromDir, cfg.Uploads.Dir) {
+		log.Fatalf("source and destination are both %s; set storage.backend or -uploads.dir to the destination", *fromDir)
+	}
+	src := blobstore.NewLocal(*fromDir, "/uploads/", nil)
+	dst, err := blobstore.New(cfg.Storage, cfg.Uploads.Dir, "/uploads/")
+	if err != nil {
+		log.Fatalf("failed to create blob store: %v", err)
+	}
+	if err := dst.Ping(ctx); err != nil {
+		log.Fatalf("blob store unavailable: %v", err)
+	}
+
+	if *dryRun {
+		count := 0
+		err := src.List(ctx, *prefix, func(object blobstore.Object) error {
+			fmt.Printf("%s\t%d bytes\n", object.Key, object.Size)
+			count++
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("failed to list files: %v", err)
+		}
+		log.Printf("Found %d file(s) in %s", count, *fromDir)
+		return
+	}
+
+	copied, err := blobstore.Copy(ctx, src, dst, *prefix, *deleteSource, func(object blobstore.Object, skipped bool) {
+		if skipped {
+			log.Printf("Skipped %s (already copied)", object.Key)
+			return
+		}
+		log.Printf("Copied %s", object.Key)
+	})
+	if err != nil {
+		log.Fatalf("copy failed after %d file(s): %v", copied, err)
+	}
+	log.Printf("Copied %d file(s) to the %s backend", copied, cfg.Storage.Backend)
+}
+
+// sameDir reports whether a and b name the same directory.
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
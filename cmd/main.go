@@ -2,42 +2,98 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	orderHandler "gocart/internal/order-management-service/handler"
-	orderModels "gocart/internal/order-management-service/models"
 	orderRepository "gocart/internal/order-management-service/repository"
 	orderServer "gocart/internal/order-management-service/server"
 	productHandler "gocart/internal/product-service/handler"
-	productModels "gocart/internal/product-service/models"
 	productRepository "gocart/internal/product-service/repository"
 	productServer "gocart/internal/product-service/server"
 	userHandler "gocart/internal/user-service/handler"
-	userModels "gocart/internal/user-service/models"
 	userRepository "gocart/internal/user-service/repository"
 	userServer "gocart/internal/user-service/server"
+	"gocart/pkg/auth"
+	"gocart/pkg/blobstore"
+	"gocart/pkg/cache"
+	"gocart/pkg/config"
 	db "gocart/pkg/db"
+	"gocart/pkg/health"
+	"gocart/pkg/mailer"
+	"gocart/pkg/metrics"
+	"gocart/pkg/purge"
+	"gocart/pkg/ratelimit"
+	"gocart/pkg/secrets"
 	"gocart/pkg/seeder"
+	"gocart/pkg/tracing"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
+// serviceMount is a placeholder for a service router that is only available
+// once the database is connected. Routes must be registered on the main router
+// before it starts serving, so the real router is swapped in atomically later.
+type serviceMount struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (m *serviceMount) Set(h http.Handler) {
+	m.handler.Store(&h)
+}
+
+func (m *serviceMount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := m.handler.Load(); h != nil {
+		(*h).ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(`{"status":"limited","message":"Database connection unavailable"}`))
+}
+
+type serviceMounts struct {
+	products, users, orders serviceMount
+	// userHandler sends password reset mail after responding, which must
+	// finish before the database is closed
+	userHandler *userHandler.UserHandler
+}
+
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	port := cfg.Server.Port
+
+	// Resolve secret references (file://, local://, gcp-sm://) before anything
+	// uses the values
+	secretValues, err := cfg.ResolveSecrets(context.Background(), cfg.SecretResolver())
+	if err != nil {
+		log.Fatalf("Failed to resolve secrets: %v", err)
+	}
+	cfg.Database.PasswordFunc = secretValues["database.password"].Value
 
 	log.Printf("Starting GoCart E-commerce API on port %s...", port)
+	log.Printf("Effective configuration:\n%s", cfg)
+
+	// Initialize tracing before anything creates spans
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 
 	// Initialize main router
 	mainRouter := mux.NewRouter()
+	mainRouter.Use(metrics.RouteTagger, tracing.RouteTagger)
 
 	// Health check endpoints
 	mainRouter.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -50,82 +106,115 @@ func main() {
 		w.Write([]byte("Healthy"))
 	}).Methods("GET")
 
-	// Serve uploaded files (e.g. product images)
-	mainRouter.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
-
-	// Initialize database connection
-	_, err := db.Connect(db.DefaultConfig())
+	// Liveness and readiness probes
+	checker := health.NewChecker(2 * time.Second)
+	store, err := blobstore.New(cfg.Storage, cfg.Uploads.Dir, "/uploads/")
 	if err != nil {
-		log.Printf("Warning: Could not connect to database: %v", err)
-		log.Println("Starting in limited mode without database...")
+		log.Fatalf("Failed to create blob store: %v", err)
+	}
+	checker.AddCheck("storage", true, storageCheck(store))
+	checker.AddCheck("database", true, health.Unavailable("database connection unavailable"))
+	mainRouter.HandleFunc("/livez", checker.Livez).Methods("GET")
+	mainRouter.HandleFunc("/readyz", checker.Readyz).Methods("GET")
 
-		// Add a status endpoint to indicate limited mode
-		mainRouter.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
+	// Status endpoint reflecting whether the services are mounted
+	var servicesReady atomic.Bool
+	mainRouter.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !servicesReady.Load() {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			w.Write([]byte(`{"status":"limited","message":"Database connection unavailable"}`))
-		}).Methods("GET")
-	} else {
-		// DATABASE CONNECTION SUCCESSFUL - Set up all services
-
-		// Migrate database
-		db.Migrate(&productModels.Product{})
-		db.Migrate(&userModels.User{})
-		db.Migrate(&orderModels.Order{})
-		db.Migrate(&orderModels.OrderItem{})
-
-		// Initialize repositories
-		productRepo := productRepository.NewProductRepository(db.DB)
-		userRepo := userRepository.NewUserRepository(db.DB)
-		orderRepo := orderRepository.NewOrderRepository(db.DB)
-
-		// Initialize handlers
-		productHandler := productHandler.NewProductHandler(productRepo)
-		userHandler := userHandler.NewUserHandler(userRepo)
-		orderHandler := orderHandler.NewOrderHandler(orderRepo)
-
-		// Initialize servers
-		productSrv := productServer.NewServer(productHandler)
-		userSrv := userServer.NewServer(userHandler)
-		orderSrv := orderServer.NewServer(orderHandler)
-
-		// Mount service routers - ONLY when DB is available
-		mainRouter.PathPrefix("/products").Handler(productSrv.GetRouter())
-		mainRouter.PathPrefix("/users").Handler(userSrv.GetRouter())
-		mainRouter.PathPrefix("/orders").Handler(orderSrv.GetRouter())
-
-		// Seed database with sample data
-		seederInstance := seeder.NewSeeder(productRepo, userRepo)
-		if err := seederInstance.SeedAll(); err != nil {
-			log.Printf("⚠️  Warning: Failed to seed database: %v", err)
-		} else {
-			seederInstance.PrintSeedingSummary()
-		}
-
-		// Add a status endpoint showing full functionality
-		mainRouter.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(`{"status":"ready","message":"All services operational"}`))
-		}).Methods("GET")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ready","message":"All services operational"}`))
+	}).Methods("GET")
+
+	// Prometheus metrics
+	mainRouter.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Serve uploaded files (e.g. product images). The S3 backend redirects to
+	// the bucket rather than proxying.
+	mainRouter.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", store))
+
+	// Service routers answer 503 until the database is available
+	var mounts serviceMounts
+	mainRouter.PathPrefix("/products").Handler(&mounts.products)
+	mainRouter.PathPrefix("/users").Handler(&mounts.users)
+	mainRouter.PathPrefix("/orders").Handler(&mounts.orders)
+
+	// Connect to the database in the background and bring the services up as
+	// soon as it is reachable. Until then the server runs in limited mode.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Re-read secret references periodically so rotated credentials are used
+	// for new database connections without a restart
+	if cfg.Secrets.RefreshInterval > 0 {
+		go secrets.Watch(ctx, cfg.Secrets.RefreshInterval, secretValues, nil)
+	}
+	// Cache product and order reads when a cache backend is configured
+	appCache, err := cache.New(cfg.Cache)
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+	if appCache != nil {
+		checker.AddCheck("cache", false, cacheCheck(appCache))
+	}
+
+	database := db.New(cfg.Database)
+	startupDone := make(chan struct{})
+	go func() {
+		defer close(startupDone)
+		if err := database.ConnectWithRetry(ctx, db.DefaultRetryPolicy()); err != nil {
+			log.Printf("Stopped connecting to database: %v", err)
+			return
+		}
+		if err := startServices(ctx, cfg, database, appCache, store, checker, &mounts); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Service startup interrupted by shutdown: %v", err)
+				return
+			}
+			log.Fatalf("Failed to start services: %v", err)
+		}
+		servicesReady.Store(true)
 
 		log.Println("📚 Full API Documentation: https://wasifsarwar.github.io/gocart/")
 		log.Printf("🛍️  Product API: http://0.0.0.0:%s/products", port)
 		log.Printf("👥 User API: http://0.0.0.0:%s/users", port)
 		log.Printf("📦 Order API: http://0.0.0.0:%s/orders", port)
+	}()
+
+	// Rate limit inside CORS so rejections still carry CORS headers and
+	// browsers can read the 429
+	var apiHandler http.Handler = mainRouter
+	var closeRateLimitStore func() error
+	if cfg.RateLimit.Enabled {
+		limiter, closeStore, err := newRateLimiter(cfg)
+		if err != nil {
+			log.Fatalf("Failed to create rate limiter: %v", err)
+		}
+		apiHandler, closeRateLimitStore = limiter.Middleware(apiHandler), closeStore
 	}
 
 	// Add CORS middleware to main router
 	corsRouter := handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.AllowedOrigins(cfg.CORS.AllowedOrigins),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
-	)(mainRouter)
+		handlers.ExposedHeaders([]string{"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"}),
+	)(apiHandler)
+
+	// Keep clients that just wrote on the primary while replicas catch up
+	var handler http.Handler = corsRouter
+	if len(cfg.Database.Replicas) > 0 {
+		handler = db.StickyMiddleware(cfg.Database.StickyWindow)(handler)
+	}
 
 	// Create HTTP server
 	server := &http.Server{
 		Addr:    "0.0.0.0:" + port,
-		Handler: corsRouter,
+		Handler: metrics.Middleware(tracing.Middleware(handler)),
 	}
 
 	log.Printf("🚀 Server starting on http://0.0.0.0:%s", port)
@@ -146,9 +235,267 @@ func main() {
 	<-quit
 	log.Println("🛑 Shutting down servers...")
 
+	// Stop reconnecting to the database and reloading secrets
+	cancel()
+
+	// Fail readiness first so load balancers stop sending new requests,
+	// then give them time to notice before closing listeners.
+	checker.SetShuttingDown()
+	if delay := cfg.Server.ShutdownDrainDelay; delay > 0 {
+		log.Printf("Waiting %s for load balancers to drain...", delay)
+		time.Sleep(delay)
+	}
+
 	// Graceful shutdown
 	if err := server.Shutdown(context.Background()); err != nil {
 		log.Printf("Error during server shutdown: %v", err)
 	}
+
+	// No request can use the database any more; wait for a startup still in
+	// progress to notice the cancellation, then release the connection pools
+	<-startupDone
+	if mounts.userHandler != nil {
+		mounts.userHandler.Close()
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("Error closing database: %v", err)
+	}
+	if appCache != nil {
+		if err := appCache.Close(); err != nil {
+			log.Printf("Error closing cache: %v", err)
+		}
+	}
+	if closeRateLimitStore != nil {
+		if err := closeRateLimitStore(); err != nil {
+			log.Printf("Error closing rate limit store: %v", err)
+		}
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Printf("Error flushing traces: %v", err)
+	}
 	log.Println("✅ Servers stopped gracefully")
 }
+
+// startServices checks the schema version, wires repositories, handlers and routers
+// for every service on top of database and mounts them on the main router.
+// Product and order reads go through appCache unless it is nil, and uploads
+// are kept in store.
+func startServices(ctx context.Context, cfg config.Config, database *db.Database, appCache cache.Cache, store blobstore.BlobStore, checker *health.Checker, mounts *serviceMounts) error {
+	sqlDB := database.SQL()
+
+	// Expose connection pool statistics and dependency checks
+	if err := metrics.RegisterDB(sqlDB, "gocart"); err != nil {
+		log.Printf("Warning: Could not register database metrics: %v", err)
+	}
+	checker.AddCheck("database", true, health.DatabaseCheck(sqlDB))
+	checker.AddCheck("database_pool", false, health.PoolCheck(sqlDB, 0.9))
+	if replicas := database.Replicas(); replicas != nil {
+		checker.AddCheck("database_replicas", false, replicaCheck(replicas))
+	}
+
+	// Apply or verify schema migrations
+	migrator, err := database.Migrator()
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if cfg.Migrations.OnStart {
+		if _, err := migrator.Up(ctx); err != nil {
+			return fmt.Errorf("database migration failed: %w", err)
+		}
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check migration status: %w", err)
+	}
+	if pending > 0 {
+		if !cfg.Migrations.AllowPending {
+			return fmt.Errorf("refusing to start with %d pending migration(s); run `go run ./cmd/migrate up`, "+
+				"set MIGRATE_ON_START=true or ALLOW_PENDING_MIGRATIONS=true", pending)
+		}
+		log.Printf("⚠️  Warning: Starting with %d pending migration(s)", pending)
+	}
+	checker.AddCheck("migrations", true, health.MigrationsCheck(migrator.Pending))
+
+	// Initialize repositories
+	gormDB := database.Gorm()
+	productRepo := productRepository.NewProductRepository(gormDB)
+	userRepo := userRepository.NewUserRepository(gormDB)
+	orderRepo := orderRepository.NewOrderRepository(gormDB)
+	if appCache != nil {
+		productRepo = productRepository.NewCachedProductRepository(productRepo, appCache, cfg.Cache.TTL)
+		orderRepo = orderRepository.NewCachedOrderRepository(orderRepo, appCache, cfg.Cache.TTL)
+	}
+
+	// Initialize handlers
+	productHandler := productHandler.NewProductHandlerWithUploads(productRepo, productHandler.UploadConfig{
+		Dir:                  cfg.Uploads.Dir,
+		Store:                store,
+		MaxImageBytes:        cfg.Uploads.MaxImageBytes,
+		MaxImageWidth:        cfg.Uploads.MaxImageWidth,
+		MaxImageHeight:       cfg.Uploads.MaxImageHeight,
+		MaxDirectUploadBytes: cfg.Uploads.MaxDirectUploadBytes,
+		DirectUploadTTL:      cfg.Uploads.DirectUploadTTL,
+	})
+	appMailer, err := mailer.New(cfg.Mail)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mailer: %w", err)
+	}
+	passwordPolicy := userHandler.PasswordPolicy{
+		MinLength:           cfg.Passwords.MinLength,
+		MinCharacterClasses: cfg.Passwords.MinCharacterClasses,
+	}
+	if cfg.Passwords.DenyCommon {
+		passwordPolicy.DenyList = userHandler.CommonPasswords()
+	}
+	if cfg.Passwords.DenyListFile != "" {
+		denied, err := userHandler.LoadDenyList(cfg.Passwords.DenyListFile)
+		if err != nil {
+			return fmt.Errorf("failed to load password deny-list: %w", err)
+		}
+		passwordPolicy.DenyList = append(passwordPolicy.DenyList, denied...)
+	}
+	userHandler := userHandler.NewUserHandlerWithOptions(userRepo, userHandler.Options{
+		Lockout: userHandler.LockoutConfig{
+			MaxFailedAttempts: cfg.Login.MaxFailedAttempts,
+			Duration:          cfg.Login.LockoutDuration,
+			MaxDuration:       cfg.Login.MaxLockoutDuration,
+			IPMaxFailures:     cfg.Login.IPMaxFailures,
+			IPWindow:          cfg.Login.IPWindow,
+			TrustProxy:        cfg.RateLimit.TrustProxy,
+		},
+		Tokens: userHandler.TokenConfig{
+			PasswordResetTTL:     cfg.Accounts.PasswordResetTTL,
+			VerificationTTL:      cfg.Accounts.VerificationTTL,
+			PasswordResetURL:     cfg.Accounts.PasswordResetURL,
+			EmailVerificationURL: cfg.Accounts.EmailVerificationURL,
+		},
+		Passwords:  passwordPolicy,
+		BcryptCost: cfg.Passwords.BcryptCost,
+		Mailer:     appMailer,
+	})
+	orderHandler := orderHandler.NewOrderHandler(orderRepo)
+
+	// Initialize servers
+	requireAdmin := auth.RequireAdmin(cfg.Auth.AdminToken)
+	productSrv := productServer.NewServerWithAdmin(productHandler, requireAdmin)
+	userSrv := userServer.NewServerWithAdmin(userHandler, requireAdmin)
+	orderSrv := orderServer.NewServerWithAdmin(orderHandler, requireAdmin)
+
+	// Report per-route metrics and span names using each service's own route templates
+	productSrv.GetRouter().Use(metrics.RouteTagger, tracing.RouteTagger)
+	userSrv.GetRouter().Use(metrics.RouteTagger, tracing.RouteTagger)
+	orderSrv.GetRouter().Use(metrics.RouteTagger, tracing.RouteTagger)
+
+	// Seed database with sample data before taking traffic
+	seederInstance := seeder.NewSeeder(productRepo, userRepo)
+	if err := seederInstance.SeedAll(ctx); err != nil {
+		log.Printf("⚠️  Warning: Failed to seed database: %v", err)
+	} else {
+		seederInstance.PrintSeedingSummary(ctx)
+	}
+
+	// Orders go first so users, variants and products they held are purged
+	// in the same run
+	go purge.Run(ctx, cfg.Purge, []purge.Target{
+		{Table: "orders", Purger: orderRepo},
+		{Table: "users", Purger: userRepo},
+		{Table: "product_variants", Purger: purge.PurgerFunc(productRepo.PurgeDeletedVariants)},
+		{Table: "products", Purger: productRepo},
+	})
+	go expireUploads(ctx, productHandler, cfg.Uploads.DirectUploadTTL)
+
+	// Mount service routers
+	mounts.products.Set(productSrv.GetRouter())
+	mounts.users.Set(userSrv.GetRouter())
+	mounts.userHandler = userHandler
+	mounts.orders.Set(orderSrv.GetRouter())
+	return nil
+}
+
+// expireUploads removes direct uploads that weren't confirmed in time,
+// checking every interval until ctx is done.
+func expireUploads(ctx context.Context, h *productHandler.ProductHandler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		count, err := h.PurgeExpiredUploads(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Warning: Removing expired uploads failed: %v", err)
+		}
+		if count > 0 {
+			metrics.RowsPurged("product_uploads", count)
+			log.Printf("🧹 Removed %d expired upload(s)", count)
+		}
+	}
+}
+
+// replicaCheck reports read replica health. Reads fall back to the primary,
+// so an ejected replica only warns.
+func replicaCheck(replicas *db.ReplicaRouter) health.CheckFunc {
+	return func(ctx context.Context) health.CheckResult {
+		result := health.CheckResult{Status: health.StatusOK, Details: map[string]interface{}{}}
+		unhealthy := 0
+		for _, status := range replicas.Status() {
+			result.Details[status.Address] = status
+			if !status.Healthy {
+				unhealthy++
+			}
+		}
+		if unhealthy > 0 {
+			result.Status = health.StatusWarn
+			result.Message = fmt.Sprintf("%d read replica(s) ejected, reads fall back to healthy replicas or the primary", unhealthy)
+		}
+		return result
+	}
+}
+
+// newRateLimiter builds the rate limiter from cfg.RateLimit. The Redis store
+// shares the server configured for the cache; the returned function closes
+// its connection.
+func newRateLimiter(cfg config.Config) (*ratelimit.Limiter, func() error, error) {
+	policies, err := cfg.RateLimit.ParsePolicies()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	closeStore := func() error { return nil }
+	if cfg.RateLimit.Store == ratelimit.StoreRedis {
+		client := cache.NewRedisClient(cfg.Cache)
+		store = ratelimit.NewRedisStore(client, cfg.Cache.KeyPrefix+"ratelimit:")
+		closeStore = client.Close
+	}
+
+	limiter := ratelimit.NewLimiter(store, policies)
+	limiter.TrustProxy = cfg.RateLimit.TrustProxy
+	return limiter, closeStore, nil
+}
+
+// storageCheck pings the blob store. Image uploads fail without it.
+func storageCheck(store blobstore.BlobStore) health.CheckFunc {
+	return func(ctx context.Context) health.CheckResult {
+		if err := store.Ping(ctx); err != nil {
+			return health.CheckResult{Status: health.StatusFail, Message: "blob store unavailable: " + err.Error()}
+		}
+		return health.CheckResult{Status: health.StatusOK}
+	}
+}
+
+// cacheCheck pings the cache. Reads fall back to the database when it is
+// unreachable, so a failure only warns.
+func cacheCheck(c cache.Cache) health.CheckFunc {
+	return func(ctx context.Context) health.CheckResult {
+		if err := c.Ping(ctx); err != nil {
+			return health.CheckResult{
+				Status:  health.StatusWarn,
+				Message: "cache unavailable, reads go to the database: " + err.Error(),
+			}
+		}
+		return health.CheckResult{Status: health.StatusOK}
+	}
+}
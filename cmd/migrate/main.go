@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"gocart/pkg/config"
+	"gocart/pkg/db"
+	"gocart/pkg/migrate"
+)
+
+const usage = `Usage: go run ./cmd/migrate [-dir DIR] [config flags] <command>
+
+Commands:
+  up             Apply all pending migrations
+  down [N]       Roll back the last N applied migrations (default 1)
+  status         List migrations and whether they are applied
+  create NAME    Write a new empty up/down migration pair to DIR
+`
+
+func main() {
+	dir := flag.String("dir", migrate.DefaultDir, "directory new migrations are written to")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// create only touches the filesystem, so it works without a database
+	if args[0] == "create" {
+		if len(args) < 2 {
+			log.Fatal("create requires a migration name")
+		}
+		paths, err := migrate.Create(*dir, args[1])
+		if err != nil {
+			log.Fatalf("failed to create migration: %v", err)
+		}
+		for _, p := range paths {
+			log.Printf("Created %s", p)
+		}
+		return
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+	if _, err := cfg.ResolveSecrets(context.Background(), cfg.SecretResolver()); err != nil {
+		log.Fatalf("failed to resolve secrets: %v", err)
+	}
+	ctx := context.Background()
+	database := db.New(cfg.Database)
+	if err := database.Connect(ctx); err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	if err != nil {
+		log.Fatalf("failed to load migrations: %v", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("migration failed: %v", err)
+		}
+		log.Printf("✅ Applied %d migration(s)", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("rollback failed: %v", err)
+		}
+		log.Printf("✅ Reverted %d migration(s)", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("failed to read migration status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
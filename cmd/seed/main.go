@@ -1,14 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
-	orderModels "gocart/internal/order-management-service/models"
-	productModels "gocart/internal/product-service/models"
 	productRepository "gocart/internal/product-service/repository"
-	userModels "gocart/internal/user-service/models"
 	userRepository "gocart/internal/user-service/repository"
+	"gocart/pkg/config"
 	"gocart/pkg/db"
 	"gocart/pkg/seeder"
 )
@@ -17,33 +16,40 @@ func main() {
 	log.Println("🚜 Starting GoCart database seeder...")
 
 	// Allow overriding connection details via env vars like DB_HOST, DB_PORT, etc.
-	cfg := db.DefaultConfig()
-	if _, err := db.Connect(cfg); err != nil {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+	if _, err := cfg.ResolveSecrets(context.Background(), cfg.SecretResolver()); err != nil {
+		log.Fatalf("failed to resolve secrets: %v", err)
+	}
+	policy := db.DefaultRetryPolicy()
+	policy.MaxAttempts = 5
+	database := db.New(cfg.Database)
+	if err := database.ConnectWithRetry(context.Background(), policy); err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
 
 	// Ensure schemas exist before inserting seed data.
-	if err := db.MigrateAll(
-		db.DB,
-		&productModels.Product{},
-		&userModels.User{},
-		&orderModels.Order{},
-		&orderModels.OrderItem{},
-	); err != nil {
+	if _, err := database.Migrate(context.Background()); err != nil {
 		log.Fatalf("database migration failed: %v", err)
 	}
 
-	productRepo := productRepository.NewProductRepository(db.DB)
-	userRepo := userRepository.NewUserRepository(db.DB)
+	productRepo := productRepository.NewProductRepository(database.Gorm())
+	userRepo := userRepository.NewUserRepository(database.Gorm())
 
 	seed := seeder.NewSeeder(productRepo, userRepo)
-	if err := seed.SeedAll(); err != nil {
+	if err := seed.SeedAll(context.Background()); err != nil {
 		log.Fatalf("failed to seed database: %v", err)
 	}
 
-	seed.PrintSeedingSummary()
+	seed.PrintSeedingSummary(context.Background())
 	log.Println("✅ Database seeding completed successfully")
 
+	if err := database.Close(); err != nil {
+		log.Printf("failed to close database: %v", err)
+	}
+
 	// Exit explicitly to make it easy to use in scripts/CI pipelines.
 	os.Exit(0)
 }
@@ -2,9 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gocart/internal/order-management-service/models"
 	"gocart/internal/order-management-service/repository"
+	"gocart/pkg/db"
+	"gocart/pkg/metrics"
 	"log"
 	"net/http"
 	"strconv"
@@ -28,11 +31,17 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	order, err := h.orderRepo.CreateOrder(order)
+	order, err := h.orderRepo.CreateOrder(r.Context(), order)
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	metrics.OrderCreated(order.TotalAmount)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Location", "/orders/"+order.OrderID)
@@ -41,7 +50,7 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 
 func (h *OrderHandler) GetOrderById(w http.ResponseWriter, r *http.Request) {
 	orderId := mux.Vars(r)["id"]
-	order, err := h.orderRepo.GetOrderById(orderId)
+	order, err := h.orderRepo.GetOrderById(r.Context(), orderId)
 	if err != nil {
 		log.Printf("Error fetching order with id: %v and error: %v", orderId, err)
 		if err.Error() == "order not found" {
@@ -63,7 +72,7 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	existingOrder, err := h.orderRepo.GetOrderById(orderId)
+	existingOrder, err := h.orderRepo.GetOrderById(r.Context(), orderId)
 	if err != nil {
 		log.Printf("Error fetching order with id: %v and error: %v", orderId, err)
 		http.Error(w, "Order not found", http.StatusNotFound)
@@ -71,7 +80,15 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	updatedOrder.OrderID = existingOrder.OrderID
 
-	result, err := h.orderRepo.UpdateOrder(updatedOrder)
+	result, err := h.orderRepo.UpdateOrder(r.Context(), updatedOrder)
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, repository.ErrOrderItemNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Error updating order with id: %v and error: %v", orderId, err)
 		http.Error(w, "Unable to update order", http.StatusInternalServerError)
@@ -84,7 +101,7 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 
 func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	orderId := mux.Vars(r)["id"]
-	if err := h.orderRepo.DeleteOrder(orderId); err != nil {
+	if err := h.orderRepo.DeleteOrder(r.Context(), orderId); err != nil {
 		log.Printf("Error deleting order with id: %v and error: %v", orderId, err)
 		http.Error(w, "Unable to delete order", http.StatusInternalServerError)
 		return
@@ -93,9 +110,27 @@ func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreOrder undoes an order deletion. It is an admin endpoint.
+func (h *OrderHandler) RestoreOrder(w http.ResponseWriter, r *http.Request) {
+	orderId := mux.Vars(r)["id"]
+	order, err := h.orderRepo.RestoreOrder(r.Context(), orderId)
+	if err != nil {
+		if err.Error() == "order not found" {
+			http.Error(w, fmt.Sprintf("Order with id %v not found.", orderId), http.StatusNotFound)
+		} else {
+			log.Printf("Error restoring order with id: %v and error: %v", orderId, err)
+			http.Error(w, "Unable to restore order", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
 func (h *OrderHandler) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
 	orderItemId := mux.Vars(r)["item_id"]
-	if err := h.orderRepo.DeleteOrderItem(orderItemId); err != nil {
+	if err := h.orderRepo.DeleteOrderItem(r.Context(), orderItemId); err != nil {
 		log.Printf("Error deleting order item with id: %v and error: %v", orderItemId, err)
 		http.Error(w, "Unable to delete order item", http.StatusInternalServerError)
 		return
@@ -104,6 +139,8 @@ func (h *OrderHandler) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListAllOrders lists orders a page at a time. With include_deleted=true,
+// an admin-only variant of the route, soft-deleted orders are listed too.
 func (h *OrderHandler) ListAllOrders(w http.ResponseWriter, r *http.Request) {
 
 	// get query params
@@ -125,7 +162,11 @@ func (h *OrderHandler) ListAllOrders(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	orders, err := h.orderRepo.ListAllOrders(limit, offset)
+	ctx := r.Context()
+	if includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted")); includeDeleted {
+		ctx = db.IncludeDeleted(ctx)
+	}
+	orders, err := h.orderRepo.ListAllOrders(ctx, limit, offset)
 	if err != nil {
 		log.Printf("Error listing all orders and error: %v", err)
 		http.Error(w, "Unable to list orders", http.StatusInternalServerError)
@@ -136,9 +177,15 @@ func (h *OrderHandler) ListAllOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(orders)
 }
 
+// ListOrdersByUserId lists a user's orders. Like ListAllOrders it accepts
+// include_deleted=true from admins.
 func (h *OrderHandler) ListOrdersByUserId(w http.ResponseWriter, r *http.Request) {
 	userId := mux.Vars(r)["user_id"]
-	orders, err := h.orderRepo.ListOrdersByUserId(userId)
+	ctx := r.Context()
+	if includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted")); includeDeleted {
+		ctx = db.IncludeDeleted(ctx)
+	}
+	orders, err := h.orderRepo.ListOrdersByUserId(ctx, userId)
 	if err != nil {
 		log.Printf("Error listing orders by user id: %v and error: %v", userId, err)
 		http.Error(w, "Unable to list orders", http.StatusInternalServerError)
@@ -1,10 +1,15 @@
 package models
 
-import "time"
+import (
+	"gocart/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Order struct {
-	OrderID     string      `gorm:"primaryKey;type:uuid" json:"order_id"`
-	UserID      string      `gorm:"not null" json:"user_id"`
+	OrderID         string      `gorm:"primaryKey;type:uuid" json:"order_id"`
+	UserID          string      `gorm:"not null;index" json:"user_id"`
 	Status          string      `gorm:"not null" json:"status"`
 	TotalAmount     float64     `gorm:"not null" json:"total_amount"`
 	FriendlyID      string      `json:"friendly_id"`
@@ -13,17 +18,30 @@ type Order struct {
 	ZipCode         string      `json:"zip_code"`
 	Country         string      `json:"country"`
 	Items           []OrderItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items"` // 1:N relationship, cascade delete
-	CreatedAt   time.Time   `gorm:"not null" json:"created_at"`
-	UpdatedAt   time.Time   `gorm:"not null" json:"updated_at"`
+	CreatedAt       time.Time   `gorm:"not null" json:"created_at"`
+	UpdatedAt       time.Time   `gorm:"not null" json:"updated_at"`
+	// DeletedAt is set when the order is deleted; its items are removed
+	// when it is purged.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 type OrderItem struct {
-	OrderItemID string    `gorm:"primaryKey;type:uuid" json:"order_item_id"`
-	OrderID     string    `gorm:"index" json:"order_id"`
-	ProductID   string    `gorm:"not null" json:"product_id"`
-	Quantity    int       `gorm:"not null" json:"quantity"`
-	Price       float64   `gorm:"not null" json:"price"`
-	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
-	Delete      bool      `json:"delete,omitempty"` // transient: true to remove this item
+	OrderItemID string `gorm:"primaryKey;type:uuid" json:"order_item_id"`
+	OrderID     string `gorm:"index" json:"order_id"`
+	ProductID   string `gorm:"not null;index" json:"product_id"`
+	// VariantID optionally picks one of the product's variants.
+	VariantID *string `gorm:"index" json:"variant_id,omitempty"`
+	Quantity  int     `gorm:"not null" json:"quantity"`
+	Price     float64 `gorm:"not null" json:"price"`
+	// Product details as they were when the item was added, so renaming or
+	// deleting the product doesn't change the order. Set by the repository.
+	ProductName     string `json:"product_name"`
+	ProductCategory string `json:"product_category"`
+	ProductImageURL string `json:"product_image_url"`
+	ProductSKU      string `json:"product_sku"`
+	// ProductOptions are the variant's option values, e.g. {"size": "M"}.
+	ProductOptions db.StringMap `gorm:"type:jsonb;not null;default:'{}'" json:"product_options,omitempty"`
+	CreatedAt      time.Time    `gorm:"not null" json:"created_at"`
+	UpdatedAt      time.Time    `gorm:"not null" json:"updated_at"`
+	Delete         bool         `gorm:"-" json:"delete,omitempty"` // transient: true to remove this item
 }
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"gocart/internal/order-management-service/models"
+	"gocart/pkg/cache"
+	"gocart/pkg/db"
+	"time"
+)
+
+// cachedOrderRepository serves single orders and per-user order lists from
+// a cache. Order item writes only know the item ID, so instead of deleting
+// individual keys every write moves the "orders" namespace to a new
+// generation. The paginated admin listing and reads that include deleted
+// orders are not cached.
+type cachedOrderRepository struct {
+	OrderRepository
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+const orderNamespace = "orders"
+
+// NewCachedOrderRepository wraps repo with read-through caching.
+func NewCachedOrderRepository(repo OrderRepository, c cache.Cache, ttl time.Duration) OrderRepository {
+	return &cachedOrderRepository{OrderRepository: repo, cache: c, ttl: ttl}
+}
+
+func (r *cachedOrderRepository) GetOrderById(ctx context.Context, id string) (models.Order, error) {
+	if db.IncludesDeleted(ctx) {
+		return r.OrderRepository.GetOrderById(ctx, id)
+	}
+	key := "order:" + cache.Generation(ctx, r.cache, orderNamespace) + ":" + id
+	return cache.GetOrLoad(ctx, r.cache, "orders", key, r.ttl, func() (models.Order, error) {
+		return r.OrderRepository.GetOrderById(ctx, id)
+	})
+}
+
+func (r *cachedOrderRepository) ListOrdersByUserId(ctx context.Context, userId string) ([]models.Order, error) {
+	if db.IncludesDeleted(ctx) {
+		return r.OrderRepository.ListOrdersByUserId(ctx, userId)
+	}
+	key := "orders:user:" + cache.Generation(ctx, r.cache, orderNamespace) + ":" + userId
+	return cache.GetOrLoad(ctx, r.cache, "orders", key, r.ttl, func() ([]models.Order, error) {
+		return r.OrderRepository.ListOrdersByUserId(ctx, userId)
+	})
+}
+
+func (r *cachedOrderRepository) CreateOrder(ctx context.Context, order models.Order) (models.Order, error) {
+	created, err := r.OrderRepository.CreateOrder(ctx, order)
+	if err != nil {
+		return created, err
+	}
+	cache.BumpGeneration(ctx, r.cache, orderNamespace)
+	return created, nil
+}
+
+func (r *cachedOrderRepository) UpdateOrder(ctx context.Context, order models.Order) (models.Order, error) {
+	updated, err := r.OrderRepository.UpdateOrder(ctx, order)
+	if err != nil {
+		return updated, err
+	}
+	cache.BumpGeneration(ctx, r.cache, orderNamespace)
+	return updated, nil
+}
+
+func (r *cachedOrderRepository) DeleteOrder(ctx context.Context, id string) error {
+	if err := r.OrderRepository.DeleteOrder(ctx, id); err != nil {
+		return err
+	}
+	cache.BumpGeneration(ctx, r.cache, orderNamespace)
+	return nil
+}
+
+func (r *cachedOrderRepository) DeleteOrderItem(ctx context.Context, orderItemID string) error {
+	if err := r.OrderRepository.DeleteOrderItem(ctx, orderItemID); err != nil {
+		return err
+	}
+	cache.BumpGeneration(ctx, r.cache, orderNamespace)
+	return nil
+}
+
+func (r *cachedOrderRepository) RestoreOrder(ctx context.Context, id string) (models.Order, error) {
+	restored, err := r.OrderRepository.RestoreOrder(ctx, id)
+	if err != nil {
+		return restored, err
+	}
+	cache.BumpGeneration(ctx, r.cache, orderNamespace)
+	return restored, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"gocart/internal/order-management-service/models"
+	"gocart/pkg/cache"
+	"gocart/pkg/db"
+	"testing"
+	"time"
+)
+
+// stubOrderRepository returns a fixed order per user and counts reads.
+// Methods the tests don't use panic through the nil embedded interface.
+type stubOrderRepository struct {
+	OrderRepository
+	status string
+	reads  int
+}
+
+func (r *stubOrderRepository) GetOrderById(ctx context.Context, id string) (models.Order, error) {
+	r.reads++
+	return models.Order{OrderID: id, UserID: "u1", Status: r.status}, nil
+}
+
+func (r *stubOrderRepository) ListOrdersByUserId(ctx context.Context, userId string) ([]models.Order, error) {
+	r.reads++
+	return []models.Order{{OrderID: "o1", UserID: userId, Status: r.status}}, nil
+}
+
+func (r *stubOrderRepository) DeleteOrderItem(ctx context.Context, orderItemID string) error {
+	r.status = "Item removed"
+	return nil
+}
+
+func (r *stubOrderRepository) RestoreOrder(ctx context.Context, id string) (models.Order, error) {
+	r.status = "Restored"
+	return models.Order{OrderID: id, UserID: "u1", Status: r.status}, nil
+}
+
+func TestCachedOrderRepository(t *testing.T) {
+	ctx := context.Background()
+	inner := &stubOrderRepository{status: "Pending"}
+	repo := NewCachedOrderRepository(inner, cache.NewMemory(100), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := repo.GetOrderById(ctx, "o1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.ListOrdersByUserId(ctx, "u1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.reads != 2 {
+		t.Errorf("Expected repeated reads to hit the cache, got %d loads", inner.reads)
+	}
+
+	// Deleting an item only names the item, so every order key must go
+	if err := repo.DeleteOrderItem(ctx, "item-1"); err != nil {
+		t.Fatal(err)
+	}
+	order, _ := repo.GetOrderById(ctx, "o1")
+	orders, _ := repo.ListOrdersByUserId(ctx, "u1")
+	if order.Status != "Item removed" || orders[0].Status != "Item removed" {
+		t.Errorf("Expected write to invalidate cached orders, got %q and %q", order.Status, orders[0].Status)
+	}
+}
+
+func TestCachedOrderRepositoryIncludeDeleted(t *testing.T) {
+	ctx := context.Background()
+	inner := &stubOrderRepository{status: "Pending"}
+	repo := NewCachedOrderRepository(inner, cache.NewMemory(100), time.Minute)
+
+	if _, err := repo.ListOrdersByUserId(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.ListOrdersByUserId(db.IncludeDeleted(ctx), "u1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.reads != 3 {
+		t.Errorf("Expected include-deleted reads to bypass the cache, got %d loads", inner.reads)
+	}
+
+	if _, err := repo.RestoreOrder(ctx, "o1"); err != nil {
+		t.Fatal(err)
+	}
+	if orders, _ := repo.ListOrdersByUserId(ctx, "u1"); orders[0].Status != "Restored" {
+		t.Errorf("Expected restore to invalidate cached orders, got %q", orders[0].Status)
+	}
+}
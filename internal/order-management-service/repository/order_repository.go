@@ -1,24 +1,47 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"gocart/internal/order-management-service/models"
+	"gocart/pkg/db"
+	"gocart/pkg/tracing"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var tracer = tracing.Tracer("gocart/internal/order-management-service/repository")
+
+// ErrInsufficientStock is returned, wrapped with the variant and quantities,
+// when an order asks for more of a variant than is in stock.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrOrderItemNotFound is returned, wrapped with the item, when an update
+// refers to an item that isn't part of the order.
+var ErrOrderItemNotFound = errors.New("order item not found")
+
 type OrderRepository interface {
-	CreateOrder(order models.Order) (models.Order, error)
-	GetOrderById(id string) (models.Order, error)
-	UpdateOrder(order models.Order) (models.Order, error)
-	DeleteOrder(id string) error
-	DeleteOrderItem(orderItemID string) error
-	ListAllOrders(limit, offset int) ([]models.Order, error)
-	ListOrdersByUserId(userId string) ([]models.Order, error)
+	CreateOrder(ctx context.Context, order models.Order) (models.Order, error)
+	GetOrderById(ctx context.Context, id string) (models.Order, error)
+	UpdateOrder(ctx context.Context, order models.Order) (models.Order, error)
+	// DeleteOrder soft-deletes an order; its items are removed when it is
+	// purged.
+	DeleteOrder(ctx context.Context, id string) error
+	// RestoreOrder undoes DeleteOrder.
+	RestoreOrder(ctx context.Context, id string) (models.Order, error)
+	// PurgeDeleted permanently removes orders deleted before the given time,
+	// with their items, and puts the items' variants back into stock.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	DeleteOrderItem(ctx context.Context, orderItemID string) error
+	ListAllOrders(ctx context.Context, limit, offset int) ([]models.Order, error)
+	ListOrdersByUserId(ctx context.Context, userId string) ([]models.Order, error)
 }
 
 type orderRepository struct {
@@ -31,19 +54,16 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 	}
 }
 
-func (r *orderRepository) CreateOrder(order models.Order) (models.Order, error) {
-
-	// validate user exists
-	if err := r.validateUserExists(order.UserID); err != nil {
-		return models.Order{}, fmt.Errorf("user validation failed: %w", err)
-	}
+func (r *orderRepository) CreateOrder(ctx context.Context, order models.Order) (models.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.CreateOrder")
+	defer span.End()
 
 	// Step 1: Basic validation (expand as needed)
 	if len(order.Items) == 0 {
 		return models.Order{}, errors.New("order must have at least one item")
 	}
 
-	for i, item := range order.Items {
+	for _, item := range order.Items {
 		if item.ProductID == "" {
 			return models.Order{}, errors.New("invalid order item: missing product_id")
 		}
@@ -53,12 +73,6 @@ func (r *orderRepository) CreateOrder(order models.Order) (models.Order, error)
 		if item.Price <= 0 {
 			return models.Order{}, errors.New("invalid order item: price must be greater than 0")
 		}
-
-		currentPrice, err := r.validateProductAndFetchPrice(item.ProductID)
-		if err != nil {
-			return models.Order{}, fmt.Errorf("product validation failed for item %d: %w", i+1, err)
-		}
-		order.Items[i].Price = currentPrice
 	}
 
 	// Step 2: Create order and items in a transaction
@@ -66,9 +80,29 @@ func (r *orderRepository) CreateOrder(order models.Order) (models.Order, error)
 	order.FriendlyID = generateFriendlyID()
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = time.Now()
-	order.TotalAmount = calculateTotal(order.Items)
 
-	err := r.db.Transaction(func(tx *gorm.DB) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The user and products stay locked until commit, so they can't be
+		// deleted while the order is being placed
+		if err := validateUserExists(tx, order.UserID); err != nil {
+			return fmt.Errorf("user validation failed: %w", err)
+		}
+		snapshots, err := fetchItemSnapshots(tx, order.Items)
+		if err != nil {
+			return fmt.Errorf("product validation failed: %w", err)
+		}
+		stock := stockChanges{}
+		for i := range order.Items {
+			if err := snapshots.applyTo(&order.Items[i]); err != nil {
+				return fmt.Errorf("product validation failed for item %d: %w", i+1, err)
+			}
+			stock.add(order.Items[i].VariantID, order.Items[i].Quantity)
+		}
+		if err := stock.apply(tx); err != nil {
+			return err
+		}
+		order.TotalAmount = calculateTotal(order.Items)
+
 		// Create order without items first
 		orderWithoutItems := models.Order{
 			OrderID:         order.OrderID,
@@ -106,11 +140,20 @@ func (r *orderRepository) CreateOrder(order models.Order) (models.Order, error)
 	return order, nil
 }
 
-func (r *orderRepository) GetOrderById(id string) (models.Order, error) {
+func (r *orderRepository) GetOrderById(ctx context.Context, id string) (models.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.GetOrderById")
+	defer span.End()
+
+	return r.getOrderById(db.ReadOnly(ctx), id)
+}
+
+// getOrderById loads an order with its items. Write paths call it directly
+// with an unmarked context so they always read from the primary.
+func (r *orderRepository) getOrderById(ctx context.Context, id string) (models.Order, error) {
 	var order models.Order
 
 	//Preload associated items
-	err := r.db.Preload("Items").Where("order_id = ?", id).First(&order).Error
+	err := db.Scoped(ctx, r.db).Preload("Items").Where("order_id = ?", id).First(&order).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return models.Order{}, errors.New("order not found")
@@ -120,14 +163,16 @@ func (r *orderRepository) GetOrderById(id string) (models.Order, error) {
 	return order, nil
 }
 
-func (r *orderRepository) UpdateOrder(order models.Order) (models.Order, error) {
+func (r *orderRepository) UpdateOrder(ctx context.Context, order models.Order) (models.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.UpdateOrder")
+	defer span.End()
 
-	existingOrder, err := r.GetOrderById(order.OrderID)
+	existingOrder, err := r.getOrderById(ctx, order.OrderID)
 	if err != nil {
 		return models.Order{}, fmt.Errorf("failed to get order %s: %w", order.OrderID, err)
 	}
 	// atomic update of order and items
-	err = r.db.Transaction(func(tx *gorm.DB) error {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 
 		// update order-level fields only if provided (partial update)
 		orderUpdates := make(map[string]interface{})
@@ -143,21 +188,59 @@ func (r *orderRepository) UpdateOrder(order models.Order) (models.Order, error)
 			}
 		}
 
+		// validate every product and variant the items switch to or add at once
+		var changed []models.OrderItem
+		for _, item := range order.Items {
+			if !item.Delete && item.ProductID != "" {
+				changed = append(changed, item)
+			}
+		}
+		snapshots, err := fetchItemSnapshots(tx, changed)
+		if err != nil {
+			return fmt.Errorf("product validation failed: %w", err)
+		}
+
+		// the items as they are now, locked so the stock they hold can't
+		// change under us
+		var current []models.OrderItem
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ?", existingOrder.OrderID).
+			Find(&current).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch order items for order %s: %w", existingOrder.OrderID, err)
+		}
+		currentItems := make(map[string]models.OrderItem, len(current))
+		for _, item := range current {
+			currentItems[item.OrderItemID] = item
+		}
+		stock := stockChanges{}
+
 		// process order items: handle deletions, updates and inserts
 		for i := range order.Items {
 
 			order.Items[i].UpdatedAt = time.Now()
 			order.Items[i].OrderID = existingOrder.OrderID
 
+			// items deleted or updated must belong to this order
+			var old models.OrderItem
+			if order.Items[i].OrderItemID != "" {
+				var ok bool
+				if old, ok = currentItems[order.Items[i].OrderItemID]; !ok {
+					return fmt.Errorf("%w: %s is not an item of order %s", ErrOrderItemNotFound, order.Items[i].OrderItemID, existingOrder.OrderID)
+				}
+			}
+
 			// check if item is marked for deletion
 			if order.Items[i].Delete {
 				if order.Items[i].OrderItemID == "" {
 					return fmt.Errorf("invalid order item: missing order_item_id")
 				}
 				// delete item with proper WHERE clause
-				if err := tx.Where("order_item_id = ?", order.Items[i].OrderItemID).Delete(&models.OrderItem{}).Error; err != nil {
-					return fmt.Errorf("failed to delete order item %s: %w", order.Items[i].OrderItemID, err)
+				if err := tx.Where("order_id = ? AND order_item_id = ?", existingOrder.OrderID, old.OrderItemID).Delete(&models.OrderItem{}).Error; err != nil {
+					return fmt.Errorf("failed to delete order item %s: %w", old.OrderItemID, err)
 				}
+				stock.add(old.VariantID, -old.Quantity)
+				delete(currentItems, old.OrderItemID)
 
 				continue // Skip further processing for deleted items
 			}
@@ -165,24 +248,30 @@ func (r *orderRepository) UpdateOrder(order models.Order) (models.Order, error)
 			if order.Items[i].OrderItemID != "" {
 				// update existing item
 				itemUpdates := make(map[string]interface{})
+				variantID, quantity := old.VariantID, old.Quantity
 				if order.Items[i].ProductID != "" {
-					// Validate product exists
-					currentPrice, err := r.validateProductAndFetchPrice(order.Items[i].ProductID)
-					if err != nil {
+					// snapshot the new product in place of the old one
+					if err := snapshots.applyTo(&order.Items[i]); err != nil {
 						return fmt.Errorf("product validation failed for item update: %w", err)
 					}
-					order.Items[i].Price = currentPrice
+					for column, value := range snapshotColumns(order.Items[i]) {
+						itemUpdates[column] = value
+					}
 					itemUpdates["product_id"] = order.Items[i].ProductID
+					variantID = order.Items[i].VariantID
 				}
 				if order.Items[i].Quantity > 0 {
 					itemUpdates["quantity"] = order.Items[i].Quantity
+					quantity = order.Items[i].Quantity
 				}
+				stock.add(old.VariantID, -old.Quantity)
+				stock.add(variantID, quantity)
 				if order.Items[i].Price > 0 {
 					itemUpdates["price"] = order.Items[i].Price
 				}
 				itemUpdates["updated_at"] = time.Now()
 				if len(itemUpdates) > 0 {
-					if err := tx.Model(&models.OrderItem{}).Where("order_item_id = ?", order.Items[i].OrderItemID).Updates(itemUpdates).Error; err != nil {
+					if err := tx.Model(&models.OrderItem{}).Where("order_id = ? AND order_item_id = ?", existingOrder.OrderID, old.OrderItemID).Updates(itemUpdates).Error; err != nil {
 						return fmt.Errorf("failed to update order item %s: %w", order.Items[i].OrderItemID, err)
 					}
 				}
@@ -194,12 +283,11 @@ func (r *orderRepository) UpdateOrder(order models.Order) (models.Order, error)
 				if order.Items[i].Quantity <= 0 {
 					return fmt.Errorf("new item invalid quantity")
 				}
-				// validate product exists, and get current price for new items
-				currentPrice, err := r.validateProductAndFetchPrice(order.Items[i].ProductID)
-				if err != nil {
+				// snapshot the product's current price and details
+				if err := snapshots.applyTo(&order.Items[i]); err != nil {
 					return fmt.Errorf("product validation failed for new item %d: %w", i+1, err)
 				}
-				order.Items[i].Price = currentPrice
+				stock.add(order.Items[i].VariantID, order.Items[i].Quantity)
 
 				// create new item
 				order.Items[i].OrderItemID = uuid.New().String()
@@ -212,6 +300,10 @@ func (r *orderRepository) UpdateOrder(order models.Order) (models.Order, error)
 			}
 		}
 
+		if err := stock.apply(tx); err != nil {
+			return err
+		}
+
 		//recalculate total amount based on all current items
 		var allItems []models.OrderItem
 		if err := tx.Where("order_id = ?", order.OrderID).Find(&allItems).Error; err != nil {
@@ -230,22 +322,39 @@ func (r *orderRepository) UpdateOrder(order models.Order) (models.Order, error)
 	}
 
 	// Return updated order with all items
-	return r.GetOrderById(existingOrder.OrderID)
+	return r.getOrderById(ctx, existingOrder.OrderID)
 }
 
-func (r *orderRepository) DeleteOrderItem(orderItemID string) error {
-	result := r.db.Where("order_item_id = ?", orderItemID).Delete(&models.OrderItem{})
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete order item %s: %w", orderItemID, result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("order item not found")
-	}
-	return nil
+func (r *orderRepository) DeleteOrderItem(ctx context.Context, orderItemID string) error {
+	ctx, span := tracer.Start(ctx, "OrderRepository.DeleteOrderItem")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var item models.OrderItem
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_item_id = ?", orderItemID).
+			First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("order item not found")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete order item %s: %w", orderItemID, err)
+		}
+		if err := tx.Delete(&item).Error; err != nil {
+			return fmt.Errorf("failed to delete order item %s: %w", orderItemID, err)
+		}
+		// The variant's units go back into stock
+		stock := stockChanges{}
+		stock.add(item.VariantID, -item.Quantity)
+		return stock.apply(tx)
+	})
 }
 
-func (r *orderRepository) DeleteOrder(id string) error {
-	result := r.db.Delete(&models.Order{}, "order_id = ?", id)
+func (r *orderRepository) DeleteOrder(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "OrderRepository.DeleteOrder")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Delete(&models.Order{}, "order_id = ?", id)
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete order %s: %w", id, result.Error)
 	}
@@ -255,7 +364,67 @@ func (r *orderRepository) DeleteOrder(id string) error {
 	return nil
 }
 
-func (r *orderRepository) ListAllOrders(limit, offset int) ([]models.Order, error) {
+func (r *orderRepository) RestoreOrder(ctx context.Context, id string) (models.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.RestoreOrder")
+	defer span.End()
+
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.Order{}).
+		Where("order_id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil).Error
+	if err != nil {
+		return models.Order{}, err
+	}
+	return r.getOrderById(ctx, id)
+}
+
+func (r *orderRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.PurgeDeleted")
+	defer span.End()
+
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locked, so an order can't be restored while its stock is released
+		var ids []string
+		err := tx.Unscoped().Model(&models.Order{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("deleted_at < ?", before).
+			Order("order_id").
+			Pluck("order_id", &ids).Error
+		if err != nil {
+			return fmt.Errorf("failed to find deleted orders: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		// Deleted orders hold their stock in case they are restored, until now
+		var items []models.OrderItem
+		if err := tx.Where("order_id IN ?", ids).Find(&items).Error; err != nil {
+			return fmt.Errorf("failed to fetch items of deleted orders: %w", err)
+		}
+		stock := stockChanges{}
+		for _, item := range items {
+			stock.add(item.VariantID, -item.Quantity)
+		}
+		if err := stock.apply(tx); err != nil {
+			return err
+		}
+
+		// Items go with their order through ON DELETE CASCADE
+		result := tx.Unscoped().Where("order_id IN ?", ids).Delete(&models.Order{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (r *orderRepository) ListAllOrders(ctx context.Context, limit, offset int) ([]models.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.ListAllOrders")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
 	var orders []models.Order
 
 	if limit <= 0 {
@@ -270,47 +439,247 @@ func (r *orderRepository) ListAllOrders(limit, offset int) ([]models.Order, erro
 		limit = 100 // maximum page size
 	}
 
-	if err := r.db.Preload("Items").Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
+	if err := db.Scoped(ctx, r.db).Preload("Items").Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
 		return nil, fmt.Errorf("failed to list orders: %w", err)
 	}
 	return orders, nil
 }
 
-func (r *orderRepository) ListOrdersByUserId(userId string) ([]models.Order, error) {
+func (r *orderRepository) ListOrdersByUserId(ctx context.Context, userId string) ([]models.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderRepository.ListOrdersByUserId")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
 	var orders []models.Order
-	if err := r.db.Preload("Items").Where("user_id = ?", userId).Find(&orders).Error; err != nil {
+	if err := db.Scoped(ctx, r.db).Preload("Items").Where("user_id = ?", userId).Find(&orders).Error; err != nil {
 		return nil, fmt.Errorf("failed to list orders by user %s: %w", userId, err)
 	}
 	return orders, nil
 }
 
-func (r *orderRepository) validateUserExists(userId string) error {
-	var count int64
-	err := r.db.Table("users").Where("user_id = ?", userId).Count(&count).Error
+// validateUserExists checks the user can place orders and locks their row
+// against deletion for the rest of tx.
+func validateUserExists(tx *gorm.DB, userId string) error {
+	var user struct {
+		UserID string `gorm:"column:user_id"`
+	}
+	err := tx.Table("users").Clauses(clause.Locking{Strength: "SHARE"}).
+		Select("user_id").
+		Where("user_id = ? AND deleted_at IS NULL", userId).
+		First(&user).Error
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("user %s not found", userId)
+		}
 		return fmt.Errorf("failed to validate user exists: %w", err)
 	}
-	if count == 0 {
-		return fmt.Errorf("user %s not found", userId)
+	return nil
+}
+
+// productSnapshot holds the product columns copied onto an order item.
+type productSnapshot struct {
+	ProductID string  `gorm:"column:product_id"`
+	Price     float64 `gorm:"column:price"`
+	Name      string  `gorm:"column:name"`
+	Category  string  `gorm:"column:category"`
+	ImageURL  string  `gorm:"column:image_url"`
+	SKU       string  `gorm:"column:sku"`
+}
+
+// variantSnapshot holds the variant columns copied onto an order item,
+// which take precedence over the product's.
+type variantSnapshot struct {
+	VariantID string       `gorm:"column:variant_id"`
+	ProductID string       `gorm:"column:product_id"`
+	SKU       string       `gorm:"column:sku"`
+	Price     *float64     `gorm:"column:price"`
+	ImageURL  string       `gorm:"column:image_url"`
+	Options   db.StringMap `gorm:"column:options"`
+}
+
+// itemSnapshots are the products and variants a set of order items refer
+// to, by ID.
+type itemSnapshots struct {
+	products map[string]productSnapshot
+	variants map[string]variantSnapshot
+}
+
+// applyTo sets item's price to the current one and records the product and
+// variant details. It fails if the variant belongs to another product.
+func (s itemSnapshots) applyTo(item *models.OrderItem) error {
+	product := s.products[item.ProductID]
+	item.Price = product.Price
+	item.ProductName = product.Name
+	item.ProductCategory = product.Category
+	item.ProductImageURL = product.ImageURL
+	item.ProductSKU = product.SKU
+	item.ProductOptions = nil
+	if item.VariantID == nil {
+		return nil
+	}
+
+	variant := s.variants[*item.VariantID]
+	if variant.ProductID != item.ProductID {
+		return fmt.Errorf("variant %s is not a variant of product %s", *item.VariantID, item.ProductID)
+	}
+	if variant.Price != nil {
+		item.Price = *variant.Price
 	}
+	if variant.ImageURL != "" {
+		item.ProductImageURL = variant.ImageURL
+	}
+	item.ProductSKU = variant.SKU
+	item.ProductOptions = variant.Options
 	return nil
 }
 
-func (r *orderRepository) validateProductAndFetchPrice(productID string) (float64, error) {
-	var product struct {
-		Price float64 `gorm:"column:price"`
+// snapshotColumns returns the item columns itemSnapshots.applyTo sets.
+func snapshotColumns(item models.OrderItem) map[string]interface{} {
+	return map[string]interface{}{
+		"variant_id":        item.VariantID,
+		"price":             item.Price,
+		"product_name":      item.ProductName,
+		"product_category":  item.ProductCategory,
+		"product_image_url": item.ProductImageURL,
+		"product_sku":       item.ProductSKU,
+		"product_options":   item.ProductOptions,
+	}
+}
+
+// fetchItemSnapshots checks the products and variants items refer to can
+// be ordered and loads their current prices and details, in one query each.
+// Every missing product or variant is named in the error. Like
+// validateUserExists it locks the rows for the rest of tx.
+func fetchItemSnapshots(tx *gorm.DB, items []models.OrderItem) (itemSnapshots, error) {
+	var productIDs, variantIDs []string
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+		if item.VariantID != nil {
+			variantIDs = append(variantIDs, *item.VariantID)
+		}
 	}
-	err := r.db.Table("products").
-		Select("price").
-		Where("product_id = ?", productID).
-		First(&product).Error
+
+	var products []productSnapshot
+	err := lockLive(tx, "SHARE", "products", "product_id", productIDs).
+		Select("product_id", "price", "name", "category", "image_url", "sku").
+		Find(&products).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return 0, fmt.Errorf("product %s not found", productID)
+		return itemSnapshots{}, fmt.Errorf("failed to validate products exist: %w", err)
+	}
+	var variants []variantSnapshot
+	if len(variantIDs) > 0 {
+		// Locked for update, as ordering them takes them out of stock
+		err := lockLive(tx, "UPDATE", "product_variants", "variant_id", variantIDs).
+			Select("variant_id", "product_id", "sku", "price", "image_url", "options").
+			Find(&variants).Error
+		if err != nil {
+			return itemSnapshots{}, fmt.Errorf("failed to validate variants exist: %w", err)
+		}
+	}
+
+	snapshots := itemSnapshots{
+		products: make(map[string]productSnapshot, len(products)),
+		variants: make(map[string]variantSnapshot, len(variants)),
+	}
+	for _, product := range products {
+		snapshots.products[product.ProductID] = product
+	}
+	for _, variant := range variants {
+		snapshots.variants[variant.VariantID] = variant
+	}
+	if err := notFound("product", productIDs, snapshots.products); err != nil {
+		return itemSnapshots{}, err
+	}
+	if err := notFound("variant", variantIDs, snapshots.variants); err != nil {
+		return itemSnapshots{}, err
+	}
+	return snapshots, nil
+}
+
+// stockChanges are how many units of each variant an order takes out of
+// stock, by variant ID; negative changes go back into stock.
+type stockChanges map[string]int
+
+// add records quantity more units of variantID, if the item has a variant.
+func (c stockChanges) add(variantID *string, quantity int) {
+	if variantID != nil {
+		c[*variantID] += quantity
+	}
+}
+
+// apply takes the changes out of stock, failing with ErrInsufficientStock
+// if a variant doesn't have enough left. Variants are locked in a fixed
+// order for the rest of tx. Units go back to variants even once they are
+// deleted.
+func (c stockChanges) apply(tx *gorm.DB) error {
+	var ids []string
+	for id, change := range c {
+		if change != 0 {
+			ids = append(ids, id)
 		}
-		return 0, fmt.Errorf("failed to validate product exists: %w", err)
 	}
-	return product.Price, nil
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	var variants []struct {
+		VariantID string `gorm:"column:variant_id"`
+		Stock     int    `gorm:"column:stock"`
+	}
+	err := tx.Table("product_variants").Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("variant_id", "stock").
+		Where("variant_id IN ?", ids).
+		Order("variant_id").
+		Find(&variants).Error
+	if err != nil {
+		return fmt.Errorf("failed to check stock: %w", err)
+	}
+	inStock := make(map[string]int, len(variants))
+	for _, variant := range variants {
+		inStock[variant.VariantID] = variant.Stock
+	}
+
+	for _, id := range ids {
+		if c[id] > inStock[id] {
+			return fmt.Errorf("%w: variant %s has %d left, %d more requested", ErrInsufficientStock, id, inStock[id], c[id])
+		}
+		err := tx.Table("product_variants").
+			Where("variant_id = ?", id).
+			Update("stock", gorm.Expr("stock - ?", c[id])).Error
+		if err != nil {
+			return fmt.Errorf("failed to update stock of variant %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// lockLive selects the rows of table whose column is one of ids and that
+// aren't deleted, locked with strength for the rest of tx in a fixed order.
+func lockLive(tx *gorm.DB, strength, table, column string, ids []string) *gorm.DB {
+	return tx.Table(table).Clauses(clause.Locking{Strength: strength}).
+		Where(column+" IN ? AND deleted_at IS NULL", ids).
+		Order(column)
+}
+
+// notFound reports the distinct ids missing from found, in order.
+func notFound[T any](kind string, ids []string, found map[string]T) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if _, ok := found[id]; !ok && !seen[id] {
+			seen[id] = true
+			missing = append(missing, id)
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s %s not found", kind, missing[0])
+	default:
+		return fmt.Errorf("%ss not found: %s", kind, strings.Join(missing, ", "))
+	}
 }
 
 func calculateTotal(items []models.OrderItem) float64 {
@@ -1,11 +1,18 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"gocart/internal/order-management-service/models"
 	productModels "gocart/internal/product-service/models"
 	userModels "gocart/internal/user-service/models"
+	"gocart/pkg/db"
+	"gocart/pkg/migrate"
 	"gocart/pkg/testutils"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -18,6 +25,7 @@ func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 			&models.OrderItem{},
 			&userModels.User{},       // Add User model for validation
 			&productModels.Product{}, // Add Product model for validation
+			&productModels.ProductVariant{},
 		},
 	}
 	return testutils.SetupTestDB(t, config)
@@ -91,7 +99,7 @@ func TestCreateOrderIntegration(t *testing.T) {
 		},
 	}
 
-	createdOrder, err := repo.CreateOrder(order)
+	createdOrder, err := repo.CreateOrder(context.Background(), order)
 	if err != nil {
 		t.Fatalf("Failed to create order: %v", err)
 	}
@@ -134,12 +142,12 @@ func TestGetOrderByIdIntegration(t *testing.T) {
 		},
 	}
 
-	createdOrder, err := repo.CreateOrder(order)
+	createdOrder, err := repo.CreateOrder(context.Background(), order)
 	if err != nil {
 		t.Fatalf("Failed to create order: %v", err)
 	}
 
-	retrievedOrder, err := repo.GetOrderById(createdOrder.OrderID)
+	retrievedOrder, err := repo.GetOrderById(context.Background(), createdOrder.OrderID)
 	if err != nil {
 		t.Fatalf("Failed to get order by ID: %v", err)
 	}
@@ -175,7 +183,7 @@ func TestUpdateOrderIntegration(t *testing.T) {
 		},
 	}
 
-	createdOrder, err := repo.CreateOrder(order) // Capture the created order
+	createdOrder, err := repo.CreateOrder(context.Background(), order) // Capture the created order
 	if err != nil {
 		t.Fatalf("Failed to create order: %v", err)
 	}
@@ -194,7 +202,7 @@ func TestUpdateOrderIntegration(t *testing.T) {
 		},
 	}
 
-	result, err := repo.UpdateOrder(updatedOrder)
+	result, err := repo.UpdateOrder(context.Background(), updatedOrder)
 	if err != nil {
 		t.Fatalf("Failed to update order: %v", err)
 	}
@@ -237,17 +245,17 @@ func TestDeleteOrderIntegration(t *testing.T) {
 		},
 	}
 
-	createdOrder, err := repo.CreateOrder(order) // Capture the created order
+	createdOrder, err := repo.CreateOrder(context.Background(), order) // Capture the created order
 	if err != nil {
 		t.Fatalf("Failed to create order: %v", err)
 	}
 
-	err = repo.DeleteOrder(createdOrder.OrderID) // Use the generated ID
+	err = repo.DeleteOrder(context.Background(), createdOrder.OrderID) // Use the generated ID
 	if err != nil {
 		t.Fatalf("Failed to delete order: %v", err)
 	}
 
-	_, err = repo.GetOrderById(createdOrder.OrderID) // Use the generated ID
+	_, err = repo.GetOrderById(context.Background(), createdOrder.OrderID) // Use the generated ID
 	if err == nil {
 		t.Error("Expected error when getting deleted order, but got none")
 	}
@@ -291,13 +299,13 @@ func TestListAllOrdersIntegration(t *testing.T) {
 	}
 
 	for _, order := range orders {
-		_, err := repo.CreateOrder(order)
+		_, err := repo.CreateOrder(context.Background(), order)
 		if err != nil {
 			t.Fatalf("Failed to create order %s: %v", order.OrderID, err)
 		}
 	}
 
-	allOrders, err := repo.ListAllOrders(10, 0)
+	allOrders, err := repo.ListAllOrders(context.Background(), 10, 0)
 	if err != nil {
 		t.Fatalf("Failed to list all orders: %v", err)
 	}
@@ -359,13 +367,13 @@ func TestListOrdersByUserIdIntegration(t *testing.T) {
 	}
 
 	for _, order := range orders {
-		_, err := repo.CreateOrder(order)
+		_, err := repo.CreateOrder(context.Background(), order)
 		if err != nil {
 			t.Fatalf("Failed to create order %s: %v", order.OrderID, err)
 		}
 	}
 
-	userOrders, err := repo.ListOrdersByUserId(userID)
+	userOrders, err := repo.ListOrdersByUserId(context.Background(), userID)
 	if err != nil {
 		t.Fatalf("Failed to list orders by user ID: %v", err)
 	}
@@ -408,7 +416,7 @@ func TestDeleteOrderItemIntegration(t *testing.T) {
 		},
 	}
 
-	createdOrder, err := repo.CreateOrder(order)
+	createdOrder, err := repo.CreateOrder(context.Background(), order)
 	if err != nil {
 		t.Fatalf("Failed to create order: %v", err)
 	}
@@ -419,13 +427,13 @@ func TestDeleteOrderItemIntegration(t *testing.T) {
 
 	// Delete one item
 	itemToDelete := createdOrder.Items[0]
-	err = repo.DeleteOrderItem(itemToDelete.OrderItemID) // Use OrderItemID, not OrderID
+	err = repo.DeleteOrderItem(context.Background(), itemToDelete.OrderItemID) // Use OrderItemID, not OrderID
 	if err != nil {
 		t.Fatalf("Failed to delete order item: %v", err)
 	}
 
 	// Verify item was deleted
-	updatedOrder, err := repo.GetOrderById(createdOrder.OrderID) // Use createdOrder.OrderID
+	updatedOrder, err := repo.GetOrderById(context.Background(), createdOrder.OrderID) // Use createdOrder.OrderID
 	if err != nil {
 		t.Fatalf("Failed to get updated order: %v", err)
 	}
@@ -438,3 +446,470 @@ func TestDeleteOrderItemIntegration(t *testing.T) {
 		t.Error("Item was not properly deleted")
 	}
 }
+
+func TestSoftDeleteOrderIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+
+	repo := NewOrderRepository(gormDB)
+	ctx := context.Background()
+
+	order, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-111",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-006", Quantity: 2, Price: 300.00}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if err := repo.DeleteOrder(ctx, order.OrderID); err != nil {
+		t.Fatalf("Failed to delete order: %v", err)
+	}
+
+	if orders, _ := repo.ListOrdersByUserId(ctx, "user-111"); len(orders) != 0 {
+		t.Errorf("Expected deleted order to be hidden, got %d orders", len(orders))
+	}
+	orders, err := repo.ListOrdersByUserId(db.IncludeDeleted(ctx), "user-111")
+	if err != nil {
+		t.Fatalf("Failed to list orders: %v", err)
+	}
+	if len(orders) != 1 || len(orders[0].Items) != 1 {
+		t.Errorf("Expected the deleted order with its item, got %+v", orders)
+	}
+
+	restored, err := repo.RestoreOrder(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("Failed to restore order: %v", err)
+	}
+	if restored.DeletedAt.Valid || len(restored.Items) != 1 {
+		t.Errorf("Expected restored order with its item, got %+v", restored)
+	}
+	if _, err := repo.RestoreOrder(ctx, "00000000-0000-0000-0000-000000000000"); err == nil || err.Error() != "order not found" {
+		t.Errorf("Expected order not found, got %v", err)
+	}
+
+	if err := repo.DeleteOrder(ctx, order.OrderID); err != nil {
+		t.Fatalf("Failed to delete order: %v", err)
+	}
+	purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to purge orders: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 order purged, got %d", purged)
+	}
+	var items int64
+	gormDB.Model(&models.OrderItem{}).Where("order_id = ?", order.OrderID).Count(&items)
+	if items != 0 {
+		t.Errorf("Expected purged order's items to be removed, got %d", items)
+	}
+}
+
+func TestCreateOrderRejectsDeletedProductIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+	if err := gormDB.Delete(&productModels.Product{}, "product_id = ?", "product-007").Error; err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	repo := NewOrderRepository(gormDB)
+	_, err := repo.CreateOrder(context.Background(), models.Order{
+		UserID: "user-111",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-007", Quantity: 1, Price: 350.00}},
+	})
+	if err == nil {
+		t.Error("Expected ordering a deleted product to fail")
+	}
+}
+
+func TestOrderItemSnapshotIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+	if err := gormDB.Model(&productModels.Product{}).Where("product_id = ?", "product-008").
+		Updates(map[string]interface{}{"sku": "TP-008", "image_url": "/uploads/products/tp-008.png"}).Error; err != nil {
+		t.Fatalf("Failed to set product SKU: %v", err)
+	}
+
+	repo := NewOrderRepository(gormDB)
+	ctx := context.Background()
+
+	order, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-333",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-008", Quantity: 1, Price: 1, ProductName: "Spoofed"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Later product changes must not show up on the order
+	if err := gormDB.Model(&productModels.Product{}).Where("product_id = ?", "product-008").
+		Updates(map[string]interface{}{"name": "Renamed", "price": 1.0}).Error; err != nil {
+		t.Fatalf("Failed to rename product: %v", err)
+	}
+	if err := gormDB.Delete(&productModels.Product{}, "product_id = ?", "product-008").Error; err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	fetched, err := repo.GetOrderById(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	item := fetched.Items[0]
+	if item.ProductName != "Test Product 8" || item.ProductCategory != "Test" || item.ProductSKU != "TP-008" ||
+		item.ProductImageURL != "/uploads/products/tp-008.png" || item.Price != 400.00 {
+		t.Errorf("Expected the item to keep the product as ordered, got %+v", item)
+	}
+
+	updated, err := repo.UpdateOrder(ctx, models.Order{
+		OrderID: order.OrderID,
+		Items:   []models.OrderItem{{OrderItemID: item.OrderItemID, ProductID: "product-009"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update order: %v", err)
+	}
+	if item := updated.Items[0]; item.ProductName != "Test Product 9" || item.ProductSKU != "" || item.Price != 450.00 {
+		t.Errorf("Expected swapping the product to take a new snapshot, got %+v", item)
+	}
+}
+
+// setupMigratedDB returns a database with the production schema, which has
+// constraints AutoMigrate doesn't create.
+func setupMigratedDB(t *testing.T) (*gorm.DB, func()) {
+	gormDB, cleanup := testutils.SetupTestDB(t, testutils.TestDBConfig{ServiceName: "orders_fk"})
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	migrator, err := migrate.New(sqlDB)
+	if err != nil {
+		cleanup()
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		cleanup()
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	return gormDB, cleanup
+}
+
+func TestReferentialIntegrityIntegration(t *testing.T) {
+	gormDB, cleanup := setupMigratedDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+
+	repo := NewOrderRepository(gormDB)
+	ctx := context.Background()
+
+	order, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-444",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-010", Quantity: 1, Price: 500.00}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Rows orders refer to can't be removed, only soft-deleted
+	if err := gormDB.Unscoped().Delete(&productModels.Product{}, "product_id = ?", "product-010").Error; err == nil {
+		t.Error("Expected removing an ordered product to violate its foreign key")
+	}
+	if err := gormDB.Unscoped().Delete(&userModels.User{}, "user_id = ?", "user-444").Error; err == nil {
+		t.Error("Expected removing a user with orders to violate their foreign key")
+	}
+
+	orphan := models.Order{OrderID: "00000000-0000-0000-0000-000000000001", UserID: "missing-user", Status: "pending", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := gormDB.Create(&orphan).Error; err == nil {
+		t.Error("Expected an order for an unknown user to violate its foreign key")
+	}
+	item := models.OrderItem{OrderItemID: "00000000-0000-0000-0000-000000000002", OrderID: order.OrderID, ProductID: "missing-product", Quantity: 1, Price: 1, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := gormDB.Create(&item).Error; err == nil {
+		t.Error("Expected an item for an unknown product to violate its foreign key")
+	}
+}
+
+func TestCreateOrderWaitsForProductLockIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+	repo := NewOrderRepository(gormDB)
+
+	// Hold a soft delete of the product open while the order is placed
+	tx := gormDB.Begin()
+	if err := tx.Delete(&productModels.Product{}, "product_id = ?", "product-011").Error; err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := repo.CreateOrder(context.Background(), models.Order{
+			UserID: "user-444",
+			Status: "pending",
+			Items:  []models.OrderItem{{ProductID: "product-011", Quantity: 1, Price: 550.00}},
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected CreateOrder to wait for the deleting transaction, got %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Fatalf("Failed to commit delete: %v", err)
+	}
+	if err := <-done; err == nil {
+		t.Error("Expected ordering a product deleted concurrently to fail")
+	}
+}
+
+func TestCreateOrderReportsAllMissingProductsIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+	repo := NewOrderRepository(gormDB)
+
+	_, err := repo.CreateOrder(context.Background(), models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items: []models.OrderItem{
+			{ProductID: "product-001", Quantity: 1, Price: 99.99},
+			{ProductID: "missing-b", Quantity: 1, Price: 1},
+			{ProductID: "missing-a", Quantity: 1, Price: 1},
+			{ProductID: "missing-b", Quantity: 2, Price: 1},
+		},
+	})
+	if err == nil || err.Error() != "product validation failed: products not found: missing-b, missing-a" {
+		t.Errorf("Expected both missing products in one error, got %v", err)
+	}
+}
+
+func TestOrderVariantIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+	price := 12.5
+	variants := []productModels.ProductVariant{
+		{VariantID: "variant-red", ProductID: "product-002", SKU: "TP2-RED", Options: db.StringMap{"color": "red"}, Price: &price, ImageURL: "/uploads/products/red.png", Stock: 5},
+		{VariantID: "variant-blue", ProductID: "product-002", SKU: "TP2-BLUE", Options: db.StringMap{"color": "blue"}, Stock: 5},
+		{VariantID: "variant-other", ProductID: "product-003", SKU: "TP3-ONE", Stock: 5},
+	}
+	if err := gormDB.Create(&variants).Error; err != nil {
+		t.Fatalf("Failed to create variants: %v", err)
+	}
+
+	repo := NewOrderRepository(gormDB)
+	ctx := context.Background()
+	red, blue, other := "variant-red", "variant-blue", "variant-other"
+
+	order, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items: []models.OrderItem{
+			{ProductID: "product-002", VariantID: &red, Quantity: 2, Price: 1},
+			{ProductID: "product-002", VariantID: &blue, Quantity: 1, Price: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	fetched, err := repo.GetOrderById(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	items := map[string]models.OrderItem{}
+	for _, item := range fetched.Items {
+		items[*item.VariantID] = item
+	}
+	if item := items[red]; item.Price != 12.5 || item.ProductSKU != "TP2-RED" || item.ProductOptions["color"] != "red" ||
+		item.ProductImageURL != "/uploads/products/red.png" {
+		t.Errorf("Expected the red variant's price, SKU, image and options, got %+v", item)
+	}
+	if item := items[blue]; item.Price != 100.01 || item.ProductSKU != "TP2-BLUE" || item.ProductOptions["color"] != "blue" {
+		t.Errorf("Expected the blue variant at the product's price, got %+v", item)
+	}
+	if math.Abs(fetched.TotalAmount-125.01) > 0.001 {
+		t.Errorf("Expected the total to use variant prices, got %v", fetched.TotalAmount)
+	}
+
+	_, err = repo.CreateOrder(ctx, models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-002", VariantID: &other, Quantity: 1, Price: 1}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "variant variant-other is not a variant of product product-002") {
+		t.Errorf("Expected a variant of another product to be rejected, got %v", err)
+	}
+
+	if err := gormDB.Delete(&productModels.ProductVariant{}, "variant_id = ?", blue).Error; err != nil {
+		t.Fatalf("Failed to delete variant: %v", err)
+	}
+	_, err = repo.CreateOrder(ctx, models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-002", VariantID: &blue, Quantity: 1, Price: 1}},
+	})
+	if err == nil || err.Error() != "product validation failed: variant variant-blue not found" {
+		t.Errorf("Expected a deleted variant to be rejected, got %v", err)
+	}
+}
+
+func TestOrderVariantStockIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createTestData(t, gormDB)
+	variants := []productModels.ProductVariant{
+		{VariantID: "variant-s", ProductID: "product-002", SKU: "TP2-S", Stock: 3},
+		{VariantID: "variant-m", ProductID: "product-002", SKU: "TP2-M", Stock: 1},
+		{VariantID: "variant-none", ProductID: "product-002", SKU: "TP2-NONE"},
+	}
+	if err := gormDB.Create(&variants).Error; err != nil {
+		t.Fatalf("Failed to create variants: %v", err)
+	}
+	stockOf := func(variantID string) int {
+		t.Helper()
+		var variant productModels.ProductVariant
+		if err := gormDB.Unscoped().First(&variant, "variant_id = ?", variantID).Error; err != nil {
+			t.Fatalf("Failed to get variant %s: %v", variantID, err)
+		}
+		return variant.Stock
+	}
+
+	repo := NewOrderRepository(gormDB)
+	ctx := context.Background()
+	small, medium, none := "variant-s", "variant-m", "variant-none"
+
+	// Items for the same variant draw on the same stock
+	_, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items: []models.OrderItem{
+			{ProductID: "product-002", VariantID: &small, Quantity: 2, Price: 1},
+			{ProductID: "product-002", VariantID: &small, Quantity: 2, Price: 1},
+		},
+	})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected more than is in stock to be rejected, got %v", err)
+	}
+	_, err = repo.CreateOrder(ctx, models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-002", VariantID: &none, Quantity: 1, Price: 1}},
+	})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected a variant out of stock to be rejected, got %v", err)
+	}
+	if stockOf(small) != 3 {
+		t.Errorf("Expected a rejected order to leave stock alone, got %d", stockOf(small))
+	}
+
+	order, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-123",
+		Status: "pending",
+		Items: []models.OrderItem{
+			{ProductID: "product-002", VariantID: &small, Quantity: 2, Price: 1},
+			{ProductID: "product-002", VariantID: &medium, Quantity: 1, Price: 1},
+			{ProductID: "product-001", Quantity: 10, Price: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if stockOf(small) != 1 || stockOf(medium) != 0 {
+		t.Errorf("Expected the order to take 2 small and 1 medium, got %d and %d left", stockOf(small), stockOf(medium))
+	}
+	items := map[string]models.OrderItem{}
+	for _, item := range order.Items {
+		if item.VariantID != nil {
+			items[*item.VariantID] = item
+		}
+	}
+
+	// Raising a quantity only needs the difference in stock
+	_, err = repo.UpdateOrder(ctx, models.Order{OrderID: order.OrderID, Items: []models.OrderItem{{OrderItemID: items[small].OrderItemID, Quantity: 4}}})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected raising the quantity past the stock to be rejected, got %v", err)
+	}
+	if _, err := repo.UpdateOrder(ctx, models.Order{OrderID: order.OrderID, Items: []models.OrderItem{{OrderItemID: items[small].OrderItemID, Quantity: 3}}}); err != nil {
+		t.Fatalf("Failed to raise the quantity: %v", err)
+	}
+	if stockOf(small) != 0 {
+		t.Errorf("Expected the last small one to be taken, got %d left", stockOf(small))
+	}
+
+	// Switching variant moves the units from one to the other
+	_, err = repo.UpdateOrder(ctx, models.Order{OrderID: order.OrderID, Items: []models.OrderItem{
+		{OrderItemID: items[medium].OrderItemID, ProductID: "product-002", VariantID: &small},
+	}})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected switching to a variant out of stock to be rejected, got %v", err)
+	}
+
+	// Removed items go back into stock
+	_, err = repo.UpdateOrder(ctx, models.Order{OrderID: order.OrderID, Items: []models.OrderItem{
+		{OrderItemID: items[small].OrderItemID, Delete: true},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to remove item: %v", err)
+	}
+	if err := repo.DeleteOrderItem(ctx, items[medium].OrderItemID); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+	if stockOf(small) != 3 || stockOf(medium) != 1 {
+		t.Errorf("Expected the removed items back in stock, got %d small and %d medium", stockOf(small), stockOf(medium))
+	}
+	if err := repo.DeleteOrderItem(ctx, items[medium].OrderItemID); err == nil || err.Error() != "order item not found" {
+		t.Errorf("Expected order item not found, got %v", err)
+	}
+
+	// Another order's items can't be changed through this one
+	other, err := repo.CreateOrder(ctx, models.Order{
+		UserID: "user-456",
+		Status: "pending",
+		Items:  []models.OrderItem{{ProductID: "product-002", VariantID: &small, Quantity: 1, Price: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	foreign := other.Items[0].OrderItemID
+	for _, item := range []models.OrderItem{{OrderItemID: foreign, Quantity: 3}, {OrderItemID: foreign, Delete: true}} {
+		_, err := repo.UpdateOrder(ctx, models.Order{OrderID: order.OrderID, Items: []models.OrderItem{item}})
+		if !errors.Is(err, ErrOrderItemNotFound) {
+			t.Errorf("Expected another order's item to be rejected, got %v", err)
+		}
+	}
+	if stored, _ := repo.GetOrderById(ctx, other.OrderID); len(stored.Items) != 1 || stored.Items[0].Quantity != 1 {
+		t.Errorf("Expected the other order's item to be unchanged, got %+v", stored.Items)
+	}
+	if stockOf(small) != 2 {
+		t.Errorf("Expected 2 small left, got %d", stockOf(small))
+	}
+
+	// Deleted orders hold their stock until they are purged
+	if err := repo.DeleteOrder(ctx, other.OrderID); err != nil {
+		t.Fatalf("Failed to delete order: %v", err)
+	}
+	if stockOf(small) != 2 {
+		t.Errorf("Expected a deleted order to keep its stock, got %d small left", stockOf(small))
+	}
+	if _, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to purge orders: %v", err)
+	}
+	if stockOf(small) != 3 {
+		t.Errorf("Expected a purged order's units back in stock, got %d small left", stockOf(small))
+	}
+}
@@ -2,20 +2,30 @@ package server
 
 import (
 	"gocart/internal/order-management-service/handler"
+	"gocart/pkg/auth"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	handler *handler.OrderHandler
-	router  *mux.Router
+	handler      *handler.OrderHandler
+	router       *mux.Router
+	requireAdmin func(http.Handler) http.Handler
 }
 
+// NewServer returns a server whose admin endpoints refuse every request.
 func NewServer(handler *handler.OrderHandler) *Server {
+	return NewServerWithAdmin(handler, auth.RequireAdmin(""))
+}
+
+// NewServerWithAdmin returns a server that guards admin endpoints with
+// requireAdmin.
+func NewServerWithAdmin(handler *handler.OrderHandler, requireAdmin func(http.Handler) http.Handler) *Server {
 	s := &Server{
-		handler: handler,
-		router:  mux.NewRouter(),
+		handler:      handler,
+		router:       mux.NewRouter(),
+		requireAdmin: requireAdmin,
 	}
 	s.setupRoutes()
 	return s
@@ -27,8 +37,17 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/orders/{id}", s.handler.UpdateOrder).Methods("PUT")
 	s.router.HandleFunc("/orders/{id}", s.handler.DeleteOrder).Methods("DELETE")
 	s.router.HandleFunc("/orders/{id}/items", s.handler.DeleteOrderItem).Methods("DELETE")
+	// Any include_deleted query takes the admin routes, so only admins see
+	// deleted orders
+	s.router.Handle("/orders", s.requireAdmin(http.HandlerFunc(s.handler.ListAllOrders))).
+		Methods("GET").Queries("include_deleted", "{include_deleted}")
 	s.router.HandleFunc("/orders", s.handler.ListAllOrders).Methods("GET")
+	s.router.Handle("/orders/user/{user_id}", s.requireAdmin(http.HandlerFunc(s.handler.ListOrdersByUserId))).
+		Methods("GET").Queries("include_deleted", "{include_deleted}")
 	s.router.HandleFunc("/orders/user/{user_id}", s.handler.ListOrdersByUserId).Methods("GET")
+
+	// Admin endpoints
+	s.router.Handle("/orders/{id}/restore", s.requireAdmin(http.HandlerFunc(s.handler.RestoreOrder))).Methods("POST")
 }
 
 func (s *Server) GetRouter() *mux.Router {
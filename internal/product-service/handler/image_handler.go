@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	productModels "gocart/internal/product-service/models"
+	"gocart/pkg/imaging"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Product images are stored under productUploadsKey in the blob store,
+// which is mounted at /uploads/, so their URLs start with productUploadsURL.
+const (
+	productUploadsKey = "products/"
+	productUploadsURL = "/uploads/" + productUploadsKey
+)
+
+// imageRenditions are the resized copies made of each uploaded image. Each
+// is saved in the original's format (PNG for GIFs and WebP) and as WebP.
+var imageRenditions = []struct {
+	name          string
+	width, height int
+}{
+	{name: "thumbnail", width: 200, height: 200},
+	{name: "medium", width: 800, height: 800},
+}
+
+// imageErrorStatus maps repository errors to a status code and message.
+func imageErrorStatus(err error, productID, imageID string) (int, string) {
+	switch err.Error() {
+	case "product not found":
+		return http.StatusNotFound, fmt.Sprintf("Product with id %v not found.", productID)
+	case "image not found":
+		return http.StatusNotFound, fmt.Sprintf("Image with id %v not found.", imageID)
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// readImageUpload reads the "image" field of a multipart upload and checks
+// its size, sniffed type and dimensions. On failure it writes the error
+// response and returns false.
+func (h *ProductHandler) readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, imaging.Info, bool) {
+	// Limit upload size, leaving 1MB of headroom for the multipart envelope
+	r.Body = http.MaxBytesReader(w, r.Body, h.uploads.MaxImageBytes+1<<20)
+	if err := r.ParseMultipartForm(h.uploads.MaxImageBytes); err != nil {
+		http.Error(w, "Invalid multipart form data", http.StatusBadRequest)
+		return nil, imaging.Info{}, false
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "Missing image file (field name: image)", http.StatusBadRequest)
+		return nil, imaging.Info{}, false
+	}
+	defer file.Close()
+	if header.Size > h.uploads.MaxImageBytes {
+		http.Error(w, fmt.Sprintf("Image exceeds the %d byte limit", h.uploads.MaxImageBytes), http.StatusRequestEntityTooLarge)
+		return nil, imaging.Info{}, false
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		return nil, imaging.Info{}, false
+	}
+
+	info, err := h.checkImage(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, imaging.Info{}, false
+	}
+	return data, info, true
+}
+
+// checkImage sniffs an image's type and checks its dimensions. The error
+// is meant for the client.
+func (h *ProductHandler) checkImage(data []byte) (imaging.Info, error) {
+	// The type comes from the content; the filename is ignored
+	info, err := imaging.Inspect(data)
+	if err != nil {
+		return imaging.Info{}, errors.New("Unsupported image type. Use jpg, png, webp, or gif.")
+	}
+	if info.Width > h.uploads.MaxImageWidth || info.Height > h.uploads.MaxImageHeight {
+		return imaging.Info{}, fmt.Errorf("Image is %dx%d; the limit is %dx%d pixels", info.Width, info.Height, h.uploads.MaxImageWidth, h.uploads.MaxImageHeight)
+	}
+	return info, nil
+}
+
+// saveImage stores an uploaded image and its renditions under the
+// "products/" prefix of the blob store and returns an unsaved gallery image
+// for them. If anything fails, the blobs already stored are removed.
+func (h *ProductHandler) saveImage(ctx context.Context, productID string, data []byte, info imaging.Info) (productModels.ProductImage, error) {
+	base := fmt.Sprintf("%s-%s", productID, uuid.New().String())
+	var written []string
+	write := func(filename string, data []byte) (string, error) {
+		key := productUploadsKey + filename
+		if err := h.uploads.Store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), http.DetectContentType(data)); err != nil {
+			return "", err
+		}
+		written = append(written, key)
+		return productUploadsURL + filename, nil
+	}
+	fail := func(err error) (productModels.ProductImage, error) {
+		for _, key := range written {
+			if removeErr := h.uploads.Store.Delete(ctx, key); removeErr != nil {
+				log.Printf("Failed to clean up orphaned blob %s: %v", key, removeErr)
+			}
+		}
+		return productModels.ProductImage{}, err
+	}
+
+	image := productModels.ProductImage{
+		ProductID:   productID,
+		ContentType: info.ContentType,
+		Width:       info.Width,
+		Height:      info.Height,
+		Renditions:  map[string]string{},
+	}
+	url, err := write(base+info.Extension(), data)
+	if err != nil {
+		return fail(err)
+	}
+	image.URL = url
+
+	decoded, err := imaging.Decode(data)
+	if err != nil {
+		return fail(err)
+	}
+	for _, rendition := range imageRenditions {
+		resized := imaging.Fit(decoded, rendition.width, rendition.height)
+
+		var encoded bytes.Buffer
+		ext := ".png"
+		if info.ContentType == "image/jpeg" {
+			ext = ".jpg"
+			err = jpeg.Encode(&encoded, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&encoded, resized)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if image.Renditions[rendition.name], err = write(base+"-"+rendition.name+ext, encoded.Bytes()); err != nil {
+			return fail(err)
+		}
+
+		var webp bytes.Buffer
+		if err := imaging.EncodeWebP(&webp, resized); err != nil {
+			return fail(err)
+		}
+		if image.Renditions[rendition.name+"_webp"], err = write(base+"-"+rendition.name+".webp", webp.Bytes()); err != nil {
+			return fail(err)
+		}
+	}
+	return image, nil
+}
+
+// removeImageFiles deletes an image's uploaded files. URLs outside the
+// uploads prefix, such as seeded external images, are left alone.
+func (h *ProductHandler) removeImageFiles(ctx context.Context, image productModels.ProductImage) {
+	urls := []string{image.URL}
+	for _, url := range image.Renditions {
+		urls = append(urls, url)
+	}
+	for _, url := range urls {
+		if !strings.HasPrefix(url, productUploadsURL) {
+			continue
+		}
+		key := productUploadsKey + strings.TrimPrefix(url, productUploadsURL)
+		if err := h.uploads.Store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to remove product image %s: %v", key, err)
+		}
+	}
+}
+
+// uploadImage reads, checks and saves an uploaded image, then adds it to
+// the product's gallery. The image is primary if primary is set or the
+// form's "primary" field is true. On failure it writes the error response
+// and returns false.
+func (h *ProductHandler) uploadImage(w http.ResponseWriter, r *http.Request, productID string, primary bool) (productModels.ProductImage, bool) {
+	data, info, ok := h.readImageUpload(w, r)
+	if !ok {
+		return productModels.ProductImage{}, false
+	}
+	if value := r.FormValue("primary"); value != "" && !primary {
+		var err error
+		if primary, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "primary must be true or false", http.StatusBadRequest)
+			return productModels.ProductImage{}, false
+		}
+	}
+	return h.addImage(w, r, productID, data, info, r.FormValue("alt_text"), primary)
+}
+
+// addImage saves a checked image and its renditions and adds it to the
+// product's gallery. On failure it removes the saved files, writes the
+// error response and returns false.
+func (h *ProductHandler) addImage(w http.ResponseWriter, r *http.Request, productID string, data []byte, info imaging.Info, altText string, primary bool) (productModels.ProductImage, bool) {
+	image, err := h.saveImage(r.Context(), productID, data, info)
+	if err != nil {
+		log.Printf("Error saving image for product with id: %v and error: %v", productID, err)
+		http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		return productModels.ProductImage{}, false
+	}
+	image.AltText = strings.TrimSpace(altText)
+	image.IsPrimary = primary
+
+	added, err := h.repo.AddImage(r.Context(), image)
+	if err != nil {
+		h.removeImageFiles(r.Context(), image)
+		status, message := imageErrorStatus(err, productID, "")
+		if status == http.StatusInternalServerError {
+			log.Printf("Error adding image to product with id: %v and error: %v", productID, err)
+			message = "Failed to add product image"
+		}
+		http.Error(w, message, status)
+		return productModels.ProductImage{}, false
+	}
+	return added, true
+}
+
+// UploadProductImage accepts multipart/form-data with field name "image",
+// adds it to the product's gallery as the primary image and returns the
+// updated product.
+func (h *ProductHandler) UploadProductImage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	// Ensure product exists
+	if _, err := h.repo.GetProductById(r.Context(), id); err != nil {
+		log.Printf("Error fetching product with id: %v and error: %v", id, err)
+		http.Error(w, fmt.Sprintf("Product with id %v not found.", id), http.StatusNotFound)
+		return
+	}
+	if _, ok := h.uploadImage(w, r, id, true); !ok {
+		return
+	}
+
+	// Fetch again for the new image_url
+	product, err := h.repo.GetProductById(r.Context(), id)
+	if err != nil {
+		log.Printf("Error fetching product with id: %v and error: %v", id, err)
+		http.Error(w, fmt.Sprintf("Unable to retrieve product with id: %v.", id), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(product)
+}
+
+func (h *ProductHandler) ListProductImages(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	images, err := h.repo.ListImages(r.Context(), id)
+	if err != nil {
+		status, message := imageErrorStatus(err, id, "")
+		if status == http.StatusInternalServerError {
+			log.Printf("Error listing images of product with id: %v and error: %v", id, err)
+			message = "Unable to retrieve images"
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(images)
+}
+
+// AddProductImage accepts multipart/form-data with the file in "image",
+// and optionally "alt_text" and "primary", and appends it to the product's
+// gallery.
+func (h *ProductHandler) AddProductImage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	// Check the product exists before reading the upload
+	if _, err := h.repo.GetProductById(r.Context(), id); err != nil {
+		log.Printf("Error fetching product with id: %v and error: %v", id, err)
+		http.Error(w, fmt.Sprintf("Product with id %v not found.", id), http.StatusNotFound)
+		return
+	}
+
+	image, ok := h.uploadImage(w, r, id, false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+// UpdateProductImage sets an image's alt_text and sort_order; with
+// is_primary true it also becomes the primary image.
+func (h *ProductHandler) UpdateProductImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, imageID := vars["id"], vars["image_id"]
+
+	var image productModels.ProductImage
+	if err := json.NewDecoder(r.Body).Decode(&image); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if image.SortOrder < 0 {
+		http.Error(w, "sort_order must not be negative", http.StatusBadRequest)
+		return
+	}
+	image.ProductID, image.ImageID = id, imageID
+	image.AltText = strings.TrimSpace(image.AltText)
+
+	updated, err := h.repo.UpdateImage(r.Context(), image)
+	if err != nil {
+		status, message := imageErrorStatus(err, id, imageID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error updating image with id: %v and error: %v", imageID, err)
+			message = fmt.Sprintf("Unable to update image with id: %v.", imageID)
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteProductImage removes an image from the gallery and deletes its
+// files.
+func (h *ProductHandler) DeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, imageID := vars["id"], vars["image_id"]
+
+	deleted, err := h.repo.DeleteImage(r.Context(), id, imageID)
+	if err != nil {
+		status, message := imageErrorStatus(err, id, imageID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error deleting image with id: %v and error: %v", imageID, err)
+			message = fmt.Sprintf("Unable to delete image with id: %v.", imageID)
+		}
+		http.Error(w, message, status)
+		return
+	}
+	h.removeImageFiles(r.Context(), deleted)
+	w.WriteHeader(http.StatusNoContent)
+}
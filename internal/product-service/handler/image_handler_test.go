@@ -0,0 +1,362 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/blobstore"
+	"gocart/pkg/imaging"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// pngImage returns a width x height PNG file.
+func pngImage(width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// imageUploadRequest builds a multipart upload of data as "image", with
+// any other form fields given.
+func imageUploadRequest(t *testing.T, filename string, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("image", filename)
+	part.Write(data)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/products/p1/images", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return mux.SetURLVars(req, map[string]string{"id": "p1"})
+}
+
+func uploadedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, _ := os.ReadDir(filepath.Join(dir, "products"))
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAddProductImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		filename       string
+		data           []byte
+		fields         map[string]string
+		mockError      error
+		expectedStatus int
+		expectedFiles  int
+	}{
+		// The original, then a resized copy and a WebP copy per rendition
+		{name: "PNG", filename: "photo.png", data: pngImage(60, 30), expectedStatus: http.StatusCreated, expectedFiles: 5},
+		{name: "Misleading extension", filename: "photo.gif", data: pngImage(10, 10), expectedStatus: http.StatusCreated, expectedFiles: 5},
+		{name: "Primary with alt text", filename: "photo.png", data: pngImage(10, 10), fields: map[string]string{"primary": "true", "alt_text": " Front "}, expectedStatus: http.StatusCreated, expectedFiles: 5},
+		{name: "Not an image", filename: "shell.png", data: []byte("<?php system($_GET['c']); ?>"), expectedStatus: http.StatusBadRequest},
+		{name: "Too wide", filename: "wide.png", data: pngImage(65, 10), expectedStatus: http.StatusBadRequest},
+		{name: "Invalid primary", filename: "photo.png", data: pngImage(10, 10), fields: map[string]string{"primary": "maybe"}, expectedStatus: http.StatusBadRequest},
+		{name: "Product deleted meanwhile", filename: "photo.png", data: pngImage(10, 10), mockError: errors.New("product not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", filename: "photo.png", data: pngImage(10, 10), mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added models.ProductImage
+			mockRepo := &MockProductRepository{
+				MockGetProductById: func(id string) (models.Product, error) {
+					return models.Product{ProductID: id}, nil
+				},
+				MockAddImage: func(image models.ProductImage) (models.ProductImage, error) {
+					added = image
+					return image, tt.mockError
+				},
+			}
+			dir := t.TempDir()
+			handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Dir: dir, MaxImageBytes: 1 << 20, MaxImageWidth: 64, MaxImageHeight: 64})
+			w := httptest.NewRecorder()
+
+			handler.AddProductImage(w, imageUploadRequest(t, tt.filename, tt.data, tt.fields))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if files := uploadedFiles(t, dir); len(files) != tt.expectedFiles {
+				t.Errorf("Expected %d files, got %v", tt.expectedFiles, files)
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+
+			if added.ContentType != "image/png" || filepath.Ext(added.URL) != ".png" {
+				t.Errorf("Expected a sniffed PNG, got %s at %s", added.ContentType, added.URL)
+			}
+			if tt.fields["primary"] == "true" && (!added.IsPrimary || added.AltText != "Front") {
+				t.Errorf("Expected a primary image with trimmed alt text, got %+v", added)
+			}
+			for _, name := range []string{"thumbnail", "thumbnail_webp", "medium", "medium_webp"} {
+				path := filepath.Join(dir, "products", filepath.Base(added.Renditions[name]))
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("Expected the %s rendition to be written: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAddProductImageRenditionSizes(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		MockGetProductById: func(id string) (models.Product, error) {
+			return models.Product{ProductID: id}, nil
+		},
+		MockAddImage: func(image models.ProductImage) (models.ProductImage, error) {
+			return image, nil
+		},
+	}
+	dir := t.TempDir()
+	handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Dir: dir, MaxImageBytes: 1 << 20})
+	w := httptest.NewRecorder()
+
+	handler.AddProductImage(w, imageUploadRequest(t, "photo.png", pngImage(1000, 400), nil))
+
+	var added models.ProductImage
+	json.NewDecoder(w.Body).Decode(&added)
+	if added.Width != 1000 || added.Height != 400 {
+		t.Errorf("Expected the original to be 1000x400, got %dx%d", added.Width, added.Height)
+	}
+	for name, expected := range map[string]image.Point{"thumbnail": {200, 80}, "medium": {800, 320}} {
+		file, err := os.Open(filepath.Join(dir, "products", filepath.Base(added.Renditions[name])))
+		if err != nil {
+			t.Fatalf("Failed to open the %s rendition: %v", name, err)
+		}
+		config, err := png.DecodeConfig(file)
+		file.Close()
+		if err != nil || config.Width != expected.X || config.Height != expected.Y {
+			t.Errorf("Expected the %s rendition to be %v, got %dx%d (%v)", name, expected, config.Width, config.Height, err)
+		}
+	}
+}
+
+// failingStore is a local blob store whose Put fails after the first
+// succeeding ones.
+type failingStore struct {
+	*blobstore.Local
+	succeeding int
+}
+
+func (s *failingStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if s.succeeding == 0 {
+		return errors.New("bucket unavailable")
+	}
+	s.succeeding--
+	return s.Local.Put(ctx, key, body, size, contentType)
+}
+
+func TestAddProductImageStoreFailure(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		MockGetProductById: func(id string) (models.Product, error) {
+			return models.Product{ProductID: id}, nil
+		},
+		MockAddImage: func(image models.ProductImage) (models.ProductImage, error) {
+			t.Error("Expected no image to be added")
+			return image, nil
+		},
+	}
+	dir := t.TempDir()
+	store := &failingStore{Local: blobstore.NewLocal(dir, "/uploads/", []byte("key")), succeeding: 3}
+	handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Store: store, MaxImageBytes: 1 << 20})
+	w := httptest.NewRecorder()
+
+	handler.AddProductImage(w, imageUploadRequest(t, "photo.png", pngImage(300, 300), nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusInternalServerError, w.Code, w.Body.String())
+	}
+	if files := uploadedFiles(t, dir); len(files) != 0 {
+		t.Errorf("Expected the stored blobs to be removed, got %v", files)
+	}
+}
+
+func TestAddProductImageWebP(t *testing.T) {
+	// WebP uploads get PNG and WebP renditions
+	var webp bytes.Buffer
+	imaging.EncodeWebP(&webp, image.NewNRGBA(image.Rect(0, 0, 16, 16)))
+
+	mockRepo := &MockProductRepository{
+		MockGetProductById: func(id string) (models.Product, error) {
+			return models.Product{ProductID: id}, nil
+		},
+		MockAddImage: func(image models.ProductImage) (models.ProductImage, error) {
+			return image, nil
+		},
+	}
+	dir := t.TempDir()
+	handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Dir: dir, MaxImageBytes: 1 << 20})
+	w := httptest.NewRecorder()
+
+	handler.AddProductImage(w, imageUploadRequest(t, "photo.jpg", webp.Bytes(), nil))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var added models.ProductImage
+	json.NewDecoder(w.Body).Decode(&added)
+	if added.ContentType != "image/webp" || filepath.Ext(added.URL) != ".webp" || added.Width != 16 {
+		t.Errorf("Expected a 16x16 WebP, got %+v", added)
+	}
+	if ext := filepath.Ext(added.Renditions["thumbnail"]); ext != ".png" {
+		t.Errorf("Expected a PNG thumbnail, got %q", added.Renditions["thumbnail"])
+	}
+	if ext := filepath.Ext(added.Renditions["medium_webp"]); ext != ".webp" {
+		t.Errorf("Expected a WebP medium rendition, got %q", added.Renditions["medium_webp"])
+	}
+	if files := uploadedFiles(t, dir); len(files) != 5 {
+		t.Errorf("Expected the original and four renditions, got %v", files)
+	}
+}
+
+func TestUpdateProductImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", body: `{"alt_text":"Side view","sort_order":2,"is_primary":true}`, expectedStatus: http.StatusOK},
+		{name: "Negative sort order", body: `{"sort_order":-1}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "Image Not Found", body: `{}`, mockError: errors.New("image not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", body: `{}`, mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated models.ProductImage
+			mockRepo := &MockProductRepository{
+				MockUpdateImage: func(image models.ProductImage) (models.ProductImage, error) {
+					updated = image
+					return image, tt.mockError
+				},
+			}
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPut, "/products/p1/images/i1", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "p1", "image_id": "i1"})
+			w := httptest.NewRecorder()
+
+			handler.UpdateProductImage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.name == "Success" && (updated.ProductID != "p1" || updated.ImageID != "i1" || !updated.IsPrimary || updated.SortOrder != 2) {
+				t.Errorf("Expected the path IDs and body fields to be passed on, got %+v", updated)
+			}
+		})
+	}
+}
+
+func TestDeleteProductImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusNoContent},
+		{name: "Image Not Found", mockError: errors.New("image not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.MkdirAll(filepath.Join(dir, "products"), 0o755)
+			for _, name := range []string{"p1-a.png", "p1-a-thumbnail.webp", "p1-b.png"} {
+				os.WriteFile(filepath.Join(dir, "products", name), []byte{1}, 0o644)
+			}
+
+			mockRepo := &MockProductRepository{
+				MockDeleteImage: func(productID, imageID string) (models.ProductImage, error) {
+					image := models.ProductImage{
+						ProductID:  productID,
+						ImageID:    imageID,
+						URL:        "/uploads/products/p1-a.png",
+						Renditions: map[string]string{"thumbnail_webp": "/uploads/products/p1-a-thumbnail.webp", "external": "https://picsum.photos/200"},
+					}
+					return image, tt.mockError
+				},
+			}
+			handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Dir: dir, MaxImageBytes: 1 << 20})
+			req := httptest.NewRequest(http.MethodDelete, "/products/p1/images/i1", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "p1", "image_id": "i1"})
+			w := httptest.NewRecorder()
+
+			handler.DeleteProductImage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			expected := []string{"p1-a-thumbnail.webp", "p1-a.png", "p1-b.png"}
+			if tt.mockError == nil {
+				expected = []string{"p1-b.png"}
+			}
+			if files := uploadedFiles(t, dir); len(files) != len(expected) {
+				t.Errorf("Expected files %v to remain, got %v", expected, files)
+			}
+		})
+	}
+}
+
+func TestListProductImages(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusOK},
+		{name: "Product Not Found", mockError: errors.New("product not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				MockListImages: func(productID string) ([]models.ProductImage, error) {
+					return []models.ProductImage{{ImageID: "i1", ProductID: productID, IsPrimary: true}}, tt.mockError
+				},
+			}
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodGet, "/products/p1/images", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "p1"})
+			w := httptest.NewRecorder()
+
+			handler.ListProductImages(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
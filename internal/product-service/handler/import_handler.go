@@ -0,0 +1,456 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	productModels "gocart/internal/product-service/models"
+	productRepository "gocart/internal/product-service/repository"
+	"gocart/pkg/db"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Limits on one import request.
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 10000
+)
+
+// attributeColumnPrefix starts CSV columns holding an attribute, such as
+// attr.brand.
+const attributeColumnPrefix = "attr."
+
+// productColumns are the product fields an import may set, by their JSON
+// and CSV column names, and the order CSV exports list them in.
+var productColumns = []string{"product_id", "sku", "name", "description", "price", "category", "image_url"}
+
+// importRow is a parsed product to import, or the reason it couldn't be
+// parsed.
+type importRow struct {
+	// Row is the line number in a CSV file, or the position in a JSON
+	// array, counting from 1.
+	Row    int
+	Import productRepository.ProductImport
+	Err    error
+}
+
+// importRowResult reports what happened to one row.
+type importRowResult struct {
+	Row       int    `json:"row"`
+	ProductID string `json:"product_id,omitempty"`
+	SKU       string `json:"sku,omitempty"`
+	// Action is created, updated or failed.
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importReport is the response to an import. Committed is false when
+// nothing was saved, because of a dry run or a failed atomic import.
+type importReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Atomic    bool              `json:"atomic"`
+	Committed bool              `json:"committed"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Failed    int               `json:"failed"`
+	Rows      []importRowResult `json:"rows"`
+}
+
+// ImportProducts creates or updates products in bulk from a CSV file
+// (Content-Type text/csv) or a JSON array of products. Rows with a
+// product_id update that product, or create it with that id; rows without
+// one update the product with the same sku, or create a new product. An
+// update only changes the fields given. With mode=atomic (the default)
+// nothing is imported if any row fails; with mode=best_effort the valid
+// rows are. dry_run=true reports what would happen without saving.
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var report importReport
+	var err error
+	if value := query.Get("dry_run"); value != "" {
+		if report.DryRun, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	switch query.Get("mode") {
+	case "", "atomic":
+		report.Atomic = true
+	case "best_effort":
+	default:
+		http.Error(w, "mode must be atomic or best_effort", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var rows []importRow
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		rows, err = parseCSVImport(r.Body)
+	case "application/json", "":
+		rows, err = parseJSONImport(r.Body)
+	default:
+		http.Error(w, "Content-Type must be text/csv or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Import exceeds the %d byte limit", maxImportBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) > maxImportRows {
+		http.Error(w, fmt.Sprintf("Import at most %d products per request", maxImportRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Rows that failed to parse can't be imported, so an atomic import
+	// only checks the others
+	var imports []productRepository.ProductImport
+	for _, row := range rows {
+		if row.Err == nil {
+			imports = append(imports, row.Import)
+		} else {
+			report.Failed++
+		}
+	}
+	options := productRepository.ImportOptions{
+		Atomic: report.Atomic,
+		DryRun: report.DryRun || (report.Atomic && report.Failed > 0),
+	}
+	results, err := h.repo.ImportProducts(r.Context(), imports, options)
+	if err != nil {
+		log.Printf("Error importing products with error: %v", err)
+		http.Error(w, "Unable to import products. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+
+	report.Rows = make([]importRowResult, 0, len(rows))
+	for _, row := range rows {
+		result := importRowResult{Row: row.Row, ProductID: row.Import.Product.ProductID, SKU: row.Import.Product.SKU}
+		if row.Err != nil {
+			result.Action, result.Error = "failed", row.Err.Error()
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+		imported := results[0]
+		results = results[1:]
+		switch {
+		case errors.Is(imported.Err, productRepository.ErrImportFailed):
+			log.Printf("Error importing product at row: %v and error: %v", row.Row, imported.Err)
+			result.Action, result.Error = "failed", "Unable to import product"
+			report.Failed++
+		case imported.Err != nil:
+			result.Action, result.Error = "failed", imported.Err.Error()
+			report.Failed++
+		case imported.Action == productRepository.ImportCreated:
+			report.Created++
+		default:
+			report.Updated++
+		}
+		if imported.Action != "" {
+			result.Action = imported.Action
+		}
+		if imported.ProductID != "" {
+			result.ProductID = imported.ProductID
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	report.Committed = !options.DryRun && !(report.Atomic && report.Failed > 0)
+
+	status := http.StatusOK
+	if report.Atomic && report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// validateImport checks the values given for a product to import.
+func validateImport(imported productRepository.ProductImport) error {
+	for _, field := range imported.Fields {
+		switch field {
+		case "name":
+			if strings.TrimSpace(imported.Product.Name) == "" {
+				return errors.New("name must not be empty")
+			}
+		case "price":
+			if math.IsNaN(imported.Product.Price) || math.IsInf(imported.Product.Price, 0) {
+				return errors.New("price must be a finite number")
+			}
+			if imported.Product.Price < 0 {
+				return errors.New("price must not be negative")
+			}
+		case "attributes":
+			if err := validateAttributes(imported.Product.Attributes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseJSONImport reads a JSON array of products. Elements that aren't
+// valid products become failed rows; a body that isn't an array is an
+// error.
+func parseJSONImport(body io.Reader) ([]importRow, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&elements); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, errors.New("Request body must be a JSON array of products")
+	}
+
+	rows := make([]importRow, 0, len(elements))
+	for i, element := range elements {
+		row := importRow{Row: i + 1}
+		var given map[string]json.RawMessage
+		if err := json.Unmarshal(element, &given); err != nil {
+			row.Err = errors.New("must be a JSON object")
+			rows = append(rows, row)
+			continue
+		}
+		// Exports include deleted_at, which an import can't set; ignore it
+		// so exported products can be imported back
+		delete(given, "deleted_at")
+		for _, field := range slices.Sorted(maps.Keys(given)) {
+			if field != "attributes" && !slices.Contains(productColumns, field) {
+				row.Err = fmt.Errorf("unknown field %s", field)
+				break
+			}
+			// null would otherwise set the price to 0
+			if field == "price" && string(given[field]) == "null" {
+				row.Err = errors.New("price must be a number, got null")
+				break
+			}
+			row.Import.Fields = append(row.Import.Fields, field)
+		}
+		if row.Err == nil {
+			if err := json.Unmarshal(element, &row.Import.Product); err != nil {
+				row.Err = fmt.Errorf("invalid product: %v", err)
+			}
+		}
+		if row.Err == nil {
+			row.Err = validateImport(row.Import)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseCSVImport reads a CSV file whose header names its columns: any of
+// productColumns, and attr.<name> for attributes. Empty attribute cells
+// leave the attribute out. Blank lines are skipped.
+func parseCSVImport(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(bufio.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+	// Spreadsheets often save a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	seen := map[string]bool{}
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		header[i] = column
+		name, isAttribute := strings.CutPrefix(column, attributeColumnPrefix)
+		if !slices.Contains(productColumns, column) && (!isAttribute || strings.TrimSpace(name) == "") {
+			return nil, fmt.Errorf("Unknown CSV column %q; use %s or %s<name> for attributes", column, strings.Join(productColumns, ", "), attributeColumnPrefix)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("Duplicate CSV column %q", column)
+		}
+		seen[column] = true
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+		line, _ := reader.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		row := importRow{Row: line}
+		if len(record) != len(header) {
+			row.Err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+			rows = append(rows, row)
+			continue
+		}
+		row.Import, row.Err = csvProduct(header, record)
+		if row.Err == nil {
+			row.Err = validateImport(row.Import)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvProduct builds the product to import from one CSV record.
+func csvProduct(header, record []string) (productRepository.ProductImport, error) {
+	var imported productRepository.ProductImport
+	product := &imported.Product
+	for i, column := range header {
+		value := strings.TrimSpace(record[i])
+		if name, ok := strings.CutPrefix(column, attributeColumnPrefix); ok {
+			if product.Attributes == nil {
+				product.Attributes = db.StringMap{}
+				imported.Fields = append(imported.Fields, "attributes")
+			}
+			if value != "" {
+				product.Attributes[name] = value
+			}
+			continue
+		}
+
+		imported.Fields = append(imported.Fields, column)
+		switch column {
+		case "product_id":
+			product.ProductID = value
+		case "sku":
+			product.SKU = value
+		case "name":
+			product.Name = value
+		case "description":
+			product.Description = value
+		case "price":
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return imported, fmt.Errorf("price must be a number, got %q", value)
+			}
+			product.Price = price
+		case "category":
+			product.Category = value
+		case "image_url":
+			product.ImageURL = value
+		}
+	}
+	return imported, nil
+}
+
+// csvError describes a CSV syntax error for the client. The rest of the
+// file can't be read reliably after one, so it fails the whole import.
+func csvError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("Invalid CSV on line %d: %v", parseErr.Line, parseErr.Err)
+	}
+	return fmt.Errorf("Invalid CSV: %v", err)
+}
+
+// ExportProducts streams every product that isn't deleted, as CSV with
+// format=csv (the default) or as a JSON array with format=json. The CSV has
+// a column for each attribute in use, and can be edited and imported back.
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "csv":
+		h.exportCSV(w, r)
+	case "json":
+		h.exportJSON(w, r)
+	default:
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+	}
+}
+
+func (h *ProductHandler) exportCSV(w http.ResponseWriter, r *http.Request) {
+	attributes, err := h.repo.AttributeNames(r.Context())
+	if err != nil {
+		log.Printf("Error listing product attributes with error: %v", err)
+		http.Error(w, "Unable to export products. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	header := append([]string{}, productColumns...)
+	for _, name := range attributes {
+		header = append(header, attributeColumnPrefix+name)
+	}
+	writer.Write(header)
+
+	record := make([]string, len(header))
+	err = h.repo.ExportProducts(r.Context(), func(product productModels.Product) error {
+		record = append(record[:0],
+			product.ProductID,
+			product.SKU,
+			product.Name,
+			product.Description,
+			strconv.FormatFloat(product.Price, 'f', -1, 64),
+			product.Category,
+			product.ImageURL,
+		)
+		for _, name := range attributes {
+			record = append(record, product.Attributes[name])
+		}
+		return writer.Write(record)
+	})
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		// The status is already sent, so the client sees a truncated file
+		log.Printf("Error exporting products with error: %v", err)
+	}
+}
+
+func (h *ProductHandler) exportJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="products.json"`)
+	w.WriteHeader(http.StatusOK)
+
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	separator := "[\n"
+	err := h.repo.ExportProducts(r.Context(), func(product productModels.Product) error {
+		buffered.WriteString(separator)
+		separator = ","
+		return encoder.Encode(product)
+	})
+	if separator == "[\n" {
+		buffered.WriteString(separator)
+	}
+	buffered.WriteString("]\n")
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		// The status is already sent, so the client sees a truncated array
+		log.Printf("Error exporting products with error: %v", err)
+	}
+}
@@ -0,0 +1,414 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocart/internal/product-service/models"
+	"gocart/internal/product-service/repository"
+	"gocart/pkg/db"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// importRepository returns a mock repository that imports products by
+// SKU into the existing map, failing any product without a SKU, and
+// records what it was asked to do.
+func importRepository(existing map[string]bool, got *[]repository.ProductImport, gotOptions *repository.ImportOptions) *MockProductRepository {
+	return &MockProductRepository{
+		MockImportProducts: func(imports []repository.ProductImport, options repository.ImportOptions) ([]repository.ImportResult, error) {
+			*got, *gotOptions = imports, options
+			results := make([]repository.ImportResult, len(imports))
+			for i, imported := range imports {
+				switch sku := imported.Product.SKU; {
+				case sku == "":
+					results[i] = repository.ImportResult{Err: errors.New("sku is required")}
+				case existing[sku]:
+					results[i] = repository.ImportResult{ProductID: "id-" + sku, Action: repository.ImportUpdated}
+				default:
+					results[i] = repository.ImportResult{ProductID: "id-" + sku, Action: repository.ImportCreated}
+				}
+			}
+			return results, nil
+		},
+	}
+}
+
+// importProducts posts body to handler's import endpoint.
+func importProducts(handler *ProductHandler, query, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/products/import"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	handler.ImportProducts(w, req)
+	return w
+}
+
+func TestImportProductsCSV(t *testing.T) {
+	var got []repository.ProductImport
+	var options repository.ImportOptions
+	handler := NewProductHandler(importRepository(map[string]bool{"A1": true}, &got, &options))
+
+	body := "\ufeffsku,name,price,attr.brand,attr.color\n" +
+		"A1,Anvil,12.50,Acme,\n" +
+		"\n" +
+		"B2, Bucket ,3,,Red\n"
+	w := importProducts(handler, "", "text/csv; charset=utf-8", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expected := []repository.ProductImport{
+		{
+			Product: models.Product{SKU: "A1", Name: "Anvil", Price: 12.5, Attributes: db.StringMap{"brand": "Acme"}},
+			Fields:  []string{"sku", "name", "price", "attributes"},
+		},
+		{
+			Product: models.Product{SKU: "B2", Name: "Bucket", Price: 3, Attributes: db.StringMap{"color": "Red"}},
+			Fields:  []string{"sku", "name", "price", "attributes"},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected imports %+v, got %+v", expected, got)
+	}
+	if !options.Atomic || options.DryRun {
+		t.Errorf("Expected an atomic import, got %+v", options)
+	}
+
+	var report importReport
+	json.NewDecoder(w.Body).Decode(&report)
+	expectedRows := []importRowResult{
+		{Row: 2, ProductID: "id-A1", SKU: "A1", Action: "updated"},
+		{Row: 4, ProductID: "id-B2", SKU: "B2", Action: "created"},
+	}
+	if !report.Committed || report.Created != 1 || report.Updated != 1 || report.Failed != 0 || !reflect.DeepEqual(report.Rows, expectedRows) {
+		t.Errorf("Expected rows %+v committed, got %+v", expectedRows, report)
+	}
+}
+
+func TestImportProductsJSON(t *testing.T) {
+	var got []repository.ProductImport
+	var options repository.ImportOptions
+	handler := NewProductHandler(importRepository(nil, &got, &options))
+
+	body := `[
+		{"product_id": "p1", "sku": "A1", "price": 2, "deleted_at": null},
+		{"sku": "B2", "attributes": {"brand": "Acme"}}
+	]`
+	w := importProducts(handler, "?mode=best_effort", "application/json", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expected := []repository.ProductImport{
+		{Product: models.Product{ProductID: "p1", SKU: "A1", Price: 2}, Fields: []string{"price", "product_id", "sku"}},
+		{Product: models.Product{SKU: "B2", Attributes: db.StringMap{"brand": "Acme"}}, Fields: []string{"attributes", "sku"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected imports %+v, got %+v", expected, got)
+	}
+	if options.Atomic {
+		t.Errorf("Expected a best effort import, got %+v", options)
+	}
+}
+
+func TestImportProductsRowErrors(t *testing.T) {
+	body := "sku,name,price\n" +
+		"A1,Anvil,-1\n" +
+		"B2,Bucket,abc\n" +
+		"C3,,4\n" +
+		"D4,Drill\n" +
+		",Nameless,5\n" +
+		"E5,Easel,6\n" +
+		"F6,File,NaN\n" +
+		"G7,Gauge,-Inf\n"
+	expectedErrors := map[int]string{
+		2: "price must not be negative",
+		3: `price must be a number, got "abc"`,
+		4: "name must not be empty",
+		5: "expected 3 fields, got 2",
+		6: "sku is required",
+		8: "price must be a finite number",
+		9: "price must be a finite number",
+	}
+
+	tests := []struct {
+		name              string
+		query             string
+		expectedStatus    int
+		expectedDryRun    bool
+		expectedCommitted bool
+	}{
+		{name: "Atomic", query: "", expectedStatus: http.StatusUnprocessableEntity, expectedDryRun: true},
+		{name: "Atomic dry run", query: "?dry_run=true", expectedStatus: http.StatusUnprocessableEntity, expectedDryRun: true},
+		{name: "Best effort", query: "?mode=best_effort", expectedStatus: http.StatusOK, expectedCommitted: true},
+		{name: "Best effort dry run", query: "?mode=best_effort&dry_run=true", expectedStatus: http.StatusOK, expectedDryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []repository.ProductImport
+			var options repository.ImportOptions
+			handler := NewProductHandler(importRepository(nil, &got, &options))
+
+			w := importProducts(handler, tt.query, "text/csv", body)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			// Only rows that parsed reach the repository
+			if len(got) != 2 || got[0].Product.Name != "Nameless" || got[1].Product.SKU != "E5" {
+				t.Errorf("Expected the two valid rows to be imported, got %+v", got)
+			}
+			if options.DryRun != tt.expectedDryRun {
+				t.Errorf("Expected dry run %v, got %v", tt.expectedDryRun, options.DryRun)
+			}
+
+			var report importReport
+			json.NewDecoder(w.Body).Decode(&report)
+			if report.Committed != tt.expectedCommitted || report.Failed != 7 || report.Created != 1 || len(report.Rows) != 8 {
+				t.Errorf("Expected 7 failed rows and 1 created, got %+v", report)
+			}
+			for _, row := range report.Rows {
+				if expected, failed := expectedErrors[row.Row]; failed != (row.Action == "failed") || row.Error != expected {
+					t.Errorf("Expected row %d to fail with %q, got %+v", row.Row, expected, row)
+				}
+			}
+		})
+	}
+}
+
+func TestImportProductsRejected(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Unsupported type", contentType: "application/xml", body: "<products/>", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Invalid mode", query: "?mode=sometimes", contentType: "text/csv", body: "sku\nA1\n", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid dry run", query: "?dry_run=maybe", contentType: "text/csv", body: "sku\nA1\n", expectedStatus: http.StatusBadRequest},
+		{name: "Empty CSV", contentType: "text/csv", body: "", expectedStatus: http.StatusBadRequest},
+		{name: "Unknown column", contentType: "text/csv", body: "sku,colour\nA1,Red\n", expectedStatus: http.StatusBadRequest},
+		{name: "Empty attribute column", contentType: "text/csv", body: "sku,attr.\nA1,Red\n", expectedStatus: http.StatusBadRequest},
+		{name: "Duplicate column", contentType: "text/csv", body: "sku,name,sku\nA1,Anvil,A1\n", expectedStatus: http.StatusBadRequest},
+		{name: "Malformed CSV", contentType: "text/csv", body: "sku,name\nA1,\"Anvil\n", expectedStatus: http.StatusBadRequest},
+		{name: "JSON object", contentType: "application/json", body: `{"sku": "A1"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Too large", contentType: "text/csv", body: "sku\n" + strings.Repeat("A1\n", maxImportBytes/3+1), expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewProductHandler(&MockProductRepository{
+				MockImportProducts: func(imports []repository.ProductImport, options repository.ImportOptions) ([]repository.ImportResult, error) {
+					t.Error("Expected nothing to be imported")
+					return nil, nil
+				},
+			})
+
+			w := importProducts(handler, tt.query, tt.contentType, tt.body)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestImportProductsJSONRowErrors(t *testing.T) {
+	var got []repository.ProductImport
+	var options repository.ImportOptions
+	handler := NewProductHandler(importRepository(nil, &got, &options))
+
+	body := `["A1", {"sku": "B2", "colour": "Red"}, {"sku": "C3", "price": "free"}, {"sku": "D4", "attributes": {"brand": " "}}, {"sku": "E5", "price": null}]`
+	w := importProducts(handler, "?mode=best_effort", "application/json", body)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var report importReport
+	json.NewDecoder(w.Body).Decode(&report)
+	if report.Failed != 5 || len(got) != 0 {
+		t.Fatalf("Expected every row to fail, got %+v", report)
+	}
+	if report.Rows[1].Error != "unknown field colour" || report.Rows[3].Error != "attribute names and values must not be empty" ||
+		report.Rows[4].Error != "price must be a number, got null" {
+		t.Errorf("Expected the row errors to be reported, got %+v", report.Rows)
+	}
+}
+
+func TestImportProductsRepositoryError(t *testing.T) {
+	handler := NewProductHandler(&MockProductRepository{
+		MockImportProducts: func(imports []repository.ProductImport, options repository.ImportOptions) ([]repository.ImportResult, error) {
+			return nil, errors.New("database error")
+		},
+	})
+
+	w := importProducts(handler, "", "text/csv", "sku,name\nA1,Anvil\n")
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestImportProductsRowFailures(t *testing.T) {
+	handler := NewProductHandler(&MockProductRepository{
+		MockImportProducts: func(imports []repository.ProductImport, options repository.ImportOptions) ([]repository.ImportResult, error) {
+			return []repository.ImportResult{
+				{Err: errors.New("sku A1 already belongs to another product")},
+				{Err: fmt.Errorf("%w: %w", repository.ErrImportFailed, errors.New(`pq: relation "products" does not exist`))},
+			}, nil
+		},
+	})
+
+	w := importProducts(handler, "?mode=best_effort", "text/csv", "sku,name,price\nA1,Anvil,1\nB2,Bucket,2\n")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var report importReport
+	json.NewDecoder(w.Body).Decode(&report)
+	if report.Failed != 2 || len(report.Rows) != 2 {
+		t.Fatalf("Expected both rows to fail, got %+v", report)
+	}
+	// Conflicts are reported as they are, but database errors aren't
+	if report.Rows[0].Error != "sku A1 already belongs to another product" || report.Rows[1].Error != "Unable to import product" {
+		t.Errorf("Expected the row errors to be reported, got %+v", report.Rows)
+	}
+}
+
+// exportRepository returns a mock repository exporting products.
+func exportRepository(products []models.Product, attributes []string) *MockProductRepository {
+	return &MockProductRepository{
+		MockExportProducts: func(fn func(models.Product) error) error {
+			for _, product := range products {
+				if err := fn(product); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		MockAttributeNames: func() ([]string, error) {
+			return attributes, nil
+		},
+	}
+}
+
+func TestExportProducts(t *testing.T) {
+	products := []models.Product{
+		{ProductID: "p1", SKU: "A1", Name: "Anvil, heavy", Price: 12.5, Category: "Tools", Attributes: db.StringMap{"brand": "Acme"}},
+		{ProductID: "p2", Name: "Bucket", Price: 3, Attributes: db.StringMap{"color": "Red"}},
+	}
+
+	tests := []struct {
+		name                string
+		query               string
+		products            []models.Product
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "CSV",
+			products:            products,
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody: "product_id,sku,name,description,price,category,image_url,attr.brand,attr.color\n" +
+				"p1,A1,\"Anvil, heavy\",,12.5,Tools,,Acme,\n" +
+				"p2,,Bucket,,3,,,,Red\n",
+		},
+		{
+			name:                "JSON",
+			query:               "?format=json",
+			products:            products,
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+		},
+		{
+			name:                "Empty JSON",
+			query:               "?format=json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        "[\n]\n",
+		},
+		{
+			name:           "Invalid format",
+			query:          "?format=xml",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewProductHandler(exportRepository(tt.products, []string{"brand", "color"}))
+			req := httptest.NewRequest(http.MethodGet, "/products/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.ExportProducts(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectedContentType, contentType)
+			}
+			if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+				t.Errorf("Expected an attachment, got %q", w.Header().Get("Content-Disposition"))
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if tt.name == "JSON" {
+				var exported []models.Product
+				if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+					t.Fatalf("Expected a JSON array, got %q: %v", w.Body.String(), err)
+				}
+				if !reflect.DeepEqual(exported, tt.products) {
+					t.Errorf("Expected %+v, got %+v", tt.products, exported)
+				}
+			}
+		})
+	}
+}
+
+// TestExportedCSVImports checks that an export can be edited and imported
+// back unchanged.
+func TestExportedCSVImports(t *testing.T) {
+	products := []models.Product{
+		{ProductID: "p1", SKU: "A1", Name: "Anvil", Description: "Heavy\nand \"solid\"", Price: 12.5, Attributes: db.StringMap{"brand": "Acme"}},
+	}
+	handler := NewProductHandler(exportRepository(products, []string{"brand"}))
+	w := httptest.NewRecorder()
+	handler.ExportProducts(w, httptest.NewRequest(http.MethodGet, "/products/export", nil))
+
+	var got []repository.ProductImport
+	var options repository.ImportOptions
+	handler = NewProductHandler(importRepository(nil, &got, &options))
+	if w := importProducts(handler, "", "text/csv", w.Body.String()); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Product, products[0]) {
+		t.Errorf("Expected %+v to be imported, got %+v", products, got)
+	}
+}
+
+func TestExportProductsError(t *testing.T) {
+	handler := NewProductHandler(&MockProductRepository{
+		MockAttributeNames: func() ([]string, error) {
+			return nil, errors.New("database error")
+		},
+	})
+	w := httptest.NewRecorder()
+
+	handler.ExportProducts(w, httptest.NewRequest(http.MethodGet, "/products/export", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
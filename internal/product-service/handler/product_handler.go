@@ -1,33 +1,120 @@
 package handler
 
 import (
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	productModels "gocart/internal/product-service/models"
 	productRepository "gocart/internal/product-service/repository"
+	"gocart/pkg/blobstore"
+	"gocart/pkg/db"
+	"gocart/pkg/patch"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type ProductHandler struct {
-	repo productRepository.ProductRepository
+	repo    productRepository.ProductRepository
+	uploads UploadConfig
+}
+
+// UploadConfig controls where product images are stored and how large they may be.
+type UploadConfig struct {
+	// Store holds the images. When nil, they are kept as files in Dir.
+	Store         blobstore.BlobStore
+	Dir           string
+	MaxImageBytes int64
+	// MaxImageWidth and MaxImageHeight limit an image's pixel dimensions;
+	// zero means the default of 4096.
+	MaxImageWidth  int
+	MaxImageHeight int
+	// MaxDirectUploadBytes limits images uploaded straight to the store
+	// with a signed URL, and DirectUploadTTL is how long such an upload may
+	// take before it is confirmed; zero means the defaults of 25MB and 15m.
+	MaxDirectUploadBytes int64
+	DirectUploadTTL      time.Duration
+}
+
+func DefaultUploadConfig() UploadConfig {
+	return UploadConfig{
+		Dir:                  "uploads",
+		MaxImageBytes:        5 << 20,
+		MaxImageWidth:        4096,
+		MaxImageHeight:       4096,
+		MaxDirectUploadBytes: 25 << 20,
+		DirectUploadTTL:      15 * time.Minute,
+	}
 }
 
 func NewProductHandler(repo productRepository.ProductRepository) *ProductHandler {
+	return NewProductHandlerWithUploads(repo, DefaultUploadConfig())
+}
+
+func NewProductHandlerWithUploads(repo productRepository.ProductRepository, uploads UploadConfig) *ProductHandler {
+	defaults := DefaultUploadConfig()
+	if uploads.MaxImageWidth == 0 {
+		uploads.MaxImageWidth = defaults.MaxImageWidth
+	}
+	if uploads.MaxImageHeight == 0 {
+		uploads.MaxImageHeight = defaults.MaxImageHeight
+	}
+	if uploads.MaxDirectUploadBytes == 0 {
+		uploads.MaxDirectUploadBytes = defaults.MaxDirectUploadBytes
+	}
+	if uploads.DirectUploadTTL == 0 {
+		uploads.DirectUploadTTL = defaults.DirectUploadTTL
+	}
+	if uploads.Store == nil {
+		signingKey := make([]byte, 32)
+		rand.Read(signingKey)
+		uploads.Store = blobstore.NewLocal(uploads.Dir, "/uploads/", signingKey)
+	}
 	return &ProductHandler{
-		repo: repo,
+		repo:    repo,
+		uploads: uploads,
 	}
 }
 
+// maxProductIDs caps how many products one ids= lookup may ask for.
+const maxProductIDs = 100
+
+// ListProducts lists products, or with ids=a,b,c only those products, in
+// that order. Otherwise category= and attr.<name>= filter the list; see
+// productFilter. With include_deleted=true, an admin-only variant of the
+// route, soft-deleted products are listed too.
 func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.repo.ListAllProducts()
+	ctx := r.Context()
+	if includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted")); includeDeleted {
+		ctx = db.IncludeDeleted(ctx)
+	}
+
+	var products []productModels.Product
+	var err error
+	if r.URL.Query().Has("ids") {
+		var ids []string
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > maxProductIDs {
+			http.Error(w, fmt.Sprintf("At most %d product ids can be requested at once", maxProductIDs), http.StatusBadRequest)
+			return
+		}
+		products, err = h.repo.GetProductsByIds(ctx, ids)
+	} else if filter := productFilter(r); !filter.IsEmpty() {
+		products, err = h.repo.FilterProducts(ctx, filter)
+	} else {
+		products, err = h.repo.ListAllProducts(ctx)
+	}
 	if err != nil {
 		log.Printf("Error fetching products with error: %v", err)
 		http.Error(w, "Unable to retrieve products. Please try again later.", http.StatusInternalServerError)
@@ -38,18 +125,87 @@ func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(products)
 }
 
+// attributeParamPrefix starts the query parameters that filter products by
+// attribute, e.g. attr.brand=Acme.
+const attributeParamPrefix = "attr."
+
+// productFilter reads a product filter from the query string. category and
+// each attr.<name> may be repeated to match any of several values, e.g.
+// ?category=Laptops&attr.brand=Dell&attr.brand=HP.
+func productFilter(r *http.Request) productRepository.ProductFilter {
+	var filter productRepository.ProductFilter
+	for param, values := range r.URL.Query() {
+		values = nonEmpty(values)
+		if len(values) == 0 {
+			continue
+		}
+		if param == "category" {
+			filter.Categories = values
+		} else if name, ok := strings.CutPrefix(param, attributeParamPrefix); ok && name != "" {
+			if filter.Attributes == nil {
+				filter.Attributes = make(map[string][]string)
+			}
+			filter.Attributes[name] = values
+		}
+	}
+	return filter
+}
+
+// nonEmpty returns the values that aren't blank.
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// ProductFacets counts the products matching the same filters as
+// ListProducts by category and attribute value, for filter sidebars.
+func (h *ProductHandler) ProductFacets(w http.ResponseWriter, r *http.Request) {
+	facets, err := h.repo.ProductFacets(r.Context(), productFilter(r))
+	if err != nil {
+		log.Printf("Error counting product facets with error: %v", err)
+		http.Error(w, "Unable to retrieve product facets. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(facets)
+}
+
+// validateAttributes checks attribute names and values aren't blank.
+func validateAttributes(attributes map[string]string) error {
+	for name, value := range attributes {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			return errors.New("attribute names and values must not be empty")
+		}
+	}
+	return nil
+}
+
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var product productModels.Product
 	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := validateAttributes(product.Attributes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	product.ProductID = uuid.New().String()
 
-	newProduct, err := h.repo.CreateProduct(product)
+	newProduct, err := h.repo.CreateProduct(r.Context(), product)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err.Error() == "product with this SKU already exists" {
+			http.Error(w, "A product with this SKU already exists", http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -63,7 +219,7 @@ func (h *ProductHandler) GetProductById(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	product, err := h.repo.GetProductById(id)
+	product, err := h.repo.GetProductById(r.Context(), id)
 	if err != nil {
 		log.Printf("Error fetching product with id: %v and error: %v", id, err)
 		if err.Error() == "product not found" {
@@ -87,8 +243,12 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := validateAttributes(updatedProduct.Attributes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	existingProduct, err := h.repo.GetProductById(id)
+	existingProduct, err := h.repo.GetProductById(r.Context(), id)
 	if err != nil {
 		log.Printf("Error fetching product with id: %v and error: %v", id, err)
 		http.Error(w, "Product not found", http.StatusNotFound)
@@ -97,10 +257,14 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
 	updatedProduct.ProductID = existingProduct.ProductID
 
-	result, err := h.repo.UpdateProduct(updatedProduct)
+	result, err := h.repo.UpdateProduct(r.Context(), updatedProduct)
 	if err != nil {
-		log.Printf("Error updating product with id: %v and error: %v", id, err)
-		http.Error(w, "Unable to update product", http.StatusInternalServerError)
+		if err.Error() == "product with this SKU already exists" {
+			http.Error(w, "A product with this SKU already exists", http.StatusConflict)
+		} else {
+			log.Printf("Error updating product with id: %v and error: %v", id, err)
+			http.Error(w, "Unable to update product", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -109,116 +273,157 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
-func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+// Members a product PATCH may set, named like their columns. Optional text
+// fields are cleared with null; name and price are required. attributes is
+// merged member by member: null removes an attribute, and null for the
+// whole object removes them all.
+var (
+	requiredProductFields = []string{"name", "price"}
+	optionalProductFields = []string{"description", "category", "image_url", "sku"}
+)
+
+// PatchProduct applies a JSON merge patch to a product. Only the fields
+// present are validated and written.
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	err := h.repo.DeleteProduct(id)
+	doc, err := patch.Decode(r)
 	if err != nil {
-		log.Printf("Error deleting product with id: %v and error: %v", id, err)
-		http.Error(w, "Unable to delete product", http.StatusInternalServerError)
+		if errors.Is(err, patch.ErrUnsupportedMediaType) {
+			w.Header().Set("Accept-Patch", patch.ContentType)
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// UploadProductImage accepts multipart/form-data with field name "image".
-// It stores the file under ./uploads/products and updates product.image_url to /uploads/products/<filename>.
-func (h *ProductHandler) UploadProductImage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
 
-	// Ensure product exists
-	product, err := h.repo.GetProductById(id)
+	changes, err := productChanges(doc)
 	if err != nil {
-		log.Printf("Error fetching product with id: %v and error: %v", id, err)
-		http.Error(w, fmt.Sprintf("Product with id %v not found.", id), http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	oldImageURL := product.ImageURL
 
-	// Limit upload size (5MB)
-	r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
-	if err := r.ParseMultipartForm(6 << 20); err != nil {
-		http.Error(w, "Invalid multipart form data", http.StatusBadRequest)
+	product, err := h.repo.PatchProduct(r.Context(), id, changes)
+	if err != nil {
+		if err.Error() == "product not found" {
+			http.Error(w, fmt.Sprintf("Product with id %v not found.", id), http.StatusNotFound)
+		} else if err.Error() == "product with this SKU already exists" {
+			http.Error(w, "A product with this SKU already exists", http.StatusConflict)
+		} else {
+			log.Printf("Error patching product with id: %v and error: %v", id, err)
+			http.Error(w, "Unable to update product", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	file, header, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "Missing image file (field name: image)", http.StatusBadRequest)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(product)
+}
+
+// productChanges validates the members of a product patch and returns the
+// columns to write.
+func productChanges(doc patch.Document) (map[string]interface{}, error) {
+	if unknown := doc.Unknown(append(append(requiredProductFields, optionalProductFields...), "attributes")...); len(unknown) > 0 {
+		return nil, fmt.Errorf("Unknown or read-only fields: %s", strings.Join(unknown, ", "))
 	}
-	defer file.Close()
 
-	// Infer extension (fallback to original filename ext)
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext == "" {
-		ext = ".jpg"
+	changes := make(map[string]interface{}, len(doc))
+	for _, name := range requiredProductFields {
+		if doc.IsNull(name) {
+			return nil, fmt.Errorf("%s is required and can't be cleared", name)
+		}
 	}
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".webp", ".gif":
-	default:
-		http.Error(w, "Unsupported image type. Use jpg, png, webp, or gif.", http.StatusBadRequest)
-		return
+	if doc.Has("name") {
+		var name string
+		if err := doc.Value("name", &name); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(name) == "" {
+			return nil, errors.New("name must not be empty")
+		}
+		changes["name"] = name
 	}
-
-	dir := filepath.Join("uploads", "products")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
-		return
+	if doc.Has("price") {
+		var price float64
+		if err := doc.Value("price", &price); err != nil {
+			return nil, err
+		}
+		if price < 0 {
+			return nil, errors.New("price must not be negative")
+		}
+		changes["price"] = price
 	}
-
-	filename := fmt.Sprintf("%s-%s%s", id, uuid.New().String(), ext)
-	dstPath := filepath.Join(dir, filename)
-
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		http.Error(w, "Failed to save image", http.StatusInternalServerError)
-		return
+	for _, name := range optionalProductFields {
+		if !doc.Has(name) {
+			continue
+		}
+		var value string
+		if !doc.IsNull(name) {
+			if err := doc.Value(name, &value); err != nil {
+				return nil, err
+			}
+		}
+		changes[name] = value
 	}
-
-	// Track whether upload completed successfully to clean up orphaned files
-	uploadSuccess := false
-	defer func() {
-		// Close the file first (important for Windows)
-		dst.Close()
-		if !uploadSuccess {
-			// Remove the file if any operation after creation failed
-			if removeErr := os.Remove(dstPath); removeErr != nil {
-				log.Printf("Failed to clean up orphaned file %s: %v", dstPath, removeErr)
+	if doc.IsNull("attributes") {
+		changes["attributes"] = db.StringMap{}
+	} else if doc.Has("attributes") {
+		var patch map[string]*string
+		if err := doc.Value("attributes", &patch); err != nil {
+			return nil, err
+		}
+		attributes := productRepository.AttributeChanges{Set: db.StringMap{}}
+		for name, value := range patch {
+			if value == nil {
+				attributes.Remove = append(attributes.Remove, name)
+			} else {
+				attributes.Set[name] = *value
 			}
 		}
-	}()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, "Failed to write image", http.StatusInternalServerError)
-		return
+		if err := validateAttributes(attributes.Set); err != nil {
+			return nil, err
+		}
+		sort.Strings(attributes.Remove)
+		changes["attributes"] = attributes
 	}
+	return changes, nil
+}
+
+func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
 
-	newImageURL := "/uploads/products/" + filename
-	product.ImageURL = newImageURL
-	updated, err := h.repo.UpdateProduct(product)
+	err := h.repo.DeleteProduct(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Failed to update product image", http.StatusInternalServerError)
+		log.Printf("Error deleting product with id: %v and error: %v", id, err)
+		http.Error(w, "Unable to delete product", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// Mark upload as successful so defer doesn't remove the file
-	uploadSuccess = true
+// RestoreProduct undoes a product deletion. It is an admin endpoint.
+func (h *ProductHandler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
 
-	// Best-effort cleanup: delete the previous uploaded image (only if it was a local upload).
-	// Don't delete external seed URLs (picsum) or non-local paths.
-	if oldImageURL != "" && oldImageURL != newImageURL && strings.HasPrefix(oldImageURL, "/uploads/products/") {
-		oldFilename := filepath.Base(oldImageURL)
-		oldPath := filepath.Join("uploads", "products", oldFilename)
-		if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
-			log.Printf("Failed to remove old product image %s: %v", oldPath, err)
+	product, err := h.repo.RestoreProduct(r.Context(), id)
+	if err != nil {
+		if err.Error() == "product not found" {
+			http.Error(w, fmt.Sprintf("Product with id %v not found.", id), http.StatusNotFound)
+		} else if err.Error() == "product with this SKU already exists" {
+			http.Error(w, "Another product now has this product's SKU", http.StatusConflict)
+		} else {
+			log.Printf("Error restoring product with id: %v and error: %v", id, err)
+			http.Error(w, "Unable to restore product", http.StatusInternalServerError)
 		}
+		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(updated)
+	json.NewEncoder(w).Encode(product)
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"gocart/internal/product-service/models"
 	"gocart/internal/product-service/repository"
@@ -122,9 +123,9 @@ func TestListProductsIntegration(t *testing.T) {
 		Category:    "Category 3",
 	}
 
-	productRepo.CreateProduct(product1)
-	productRepo.CreateProduct(product2)
-	productRepo.CreateProduct(product3)
+	productRepo.CreateProduct(context.Background(), product1)
+	productRepo.CreateProduct(context.Background(), product2)
+	productRepo.CreateProduct(context.Background(), product3)
 
 	req := httptest.NewRequest(http.MethodGet, "/products", nil)
 	w := httptest.NewRecorder()
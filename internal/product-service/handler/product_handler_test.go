@@ -2,45 +2,170 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"gocart/internal/product-service/models"
+	"gocart/internal/product-service/repository"
+	"gocart/pkg/db"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type MockProductRepository struct {
-	MockListAllProducts func() ([]models.Product, error)
-	MockCreateProduct   func(product models.Product) (models.Product, error)
-	MockGetProductById  func(id string) (models.Product, error)
-	MockUpdateProduct   func(product models.Product) (models.Product, error)
-	MockDeleteProduct   func(id string) error
+	MockListAllProducts  func() ([]models.Product, error)
+	MockCreateProduct    func(product models.Product) (models.Product, error)
+	MockGetProductById   func(id string) (models.Product, error)
+	MockUpdateProduct    func(product models.Product) (models.Product, error)
+	MockDeleteProduct    func(id string) error
+	MockPatchProduct     func(id string, changes map[string]interface{}) (models.Product, error)
+	MockRestoreProduct   func(id string) (models.Product, error)
+	MockGetProductsByIds func(ids []string) ([]models.Product, error)
+	MockFilterProducts   func(filter repository.ProductFilter) ([]models.Product, error)
+	MockProductFacets    func(filter repository.ProductFilter) (models.ProductFacets, error)
+	MockPurgeDeleted     func(before time.Time) (int64, error)
+
+	MockListVariants         func(productID string) ([]models.ProductVariant, error)
+	MockGetVariant           func(productID, variantID string) (models.ProductVariant, error)
+	MockCreateVariant        func(variant models.ProductVariant) (models.ProductVariant, error)
+	MockUpdateVariant        func(variant models.ProductVariant) (models.ProductVariant, error)
+	MockDeleteVariant        func(productID, variantID string) error
+	MockPurgeDeletedVariants func(before time.Time) (int64, error)
+
+	MockListImages  func(productID string) ([]models.ProductImage, error)
+	MockAddImage    func(image models.ProductImage) (models.ProductImage, error)
+	MockUpdateImage func(image models.ProductImage) (models.ProductImage, error)
+	MockDeleteImage func(productID, imageID string) (models.ProductImage, error)
+
+	MockCreateUpload       func(upload models.ProductUpload) (models.ProductUpload, error)
+	MockGetUpload          func(productID, uploadID string) (models.ProductUpload, error)
+	MockDeleteUpload       func(uploadID string) error
+	MockListExpiredUploads func(before time.Time, limit int) ([]models.ProductUpload, error)
+
+	MockImportProducts func(imports []repository.ProductImport, options repository.ImportOptions) ([]repository.ImportResult, error)
+	MockExportProducts func(fn func(models.Product) error) error
+	MockAttributeNames func() ([]string, error)
 }
 
-func (m *MockProductRepository) ListAllProducts() ([]models.Product, error) {
+func (m *MockProductRepository) ListAllProducts(ctx context.Context) ([]models.Product, error) {
 	return m.MockListAllProducts()
 }
 
-func (m *MockProductRepository) CreateProduct(product models.Product) (models.Product, error) {
+func (m *MockProductRepository) CreateProduct(ctx context.Context, product models.Product) (models.Product, error) {
 	return m.MockCreateProduct(product)
 }
 
-func (m *MockProductRepository) GetProductById(id string) (models.Product, error) {
+func (m *MockProductRepository) GetProductById(ctx context.Context, id string) (models.Product, error) {
 	return m.MockGetProductById(id)
 }
 
-func (m *MockProductRepository) UpdateProduct(product models.Product) (models.Product, error) {
+func (m *MockProductRepository) UpdateProduct(ctx context.Context, product models.Product) (models.Product, error) {
 	return m.MockUpdateProduct(product)
 }
 
-func (m *MockProductRepository) DeleteProduct(id string) error {
+func (m *MockProductRepository) DeleteProduct(ctx context.Context, id string) error {
 	return m.MockDeleteProduct(id)
 }
 
+func (m *MockProductRepository) PatchProduct(ctx context.Context, id string, changes map[string]interface{}) (models.Product, error) {
+	return m.MockPatchProduct(id, changes)
+}
+
+func (m *MockProductRepository) GetProductsByIds(ctx context.Context, ids []string) ([]models.Product, error) {
+	return m.MockGetProductsByIds(ids)
+}
+
+func (m *MockProductRepository) FilterProducts(ctx context.Context, filter repository.ProductFilter) ([]models.Product, error) {
+	return m.MockFilterProducts(filter)
+}
+
+func (m *MockProductRepository) ProductFacets(ctx context.Context, filter repository.ProductFilter) (models.ProductFacets, error) {
+	return m.MockProductFacets(filter)
+}
+
+func (m *MockProductRepository) RestoreProduct(ctx context.Context, id string) (models.Product, error) {
+	return m.MockRestoreProduct(id)
+}
+
+func (m *MockProductRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return m.MockPurgeDeleted(before)
+}
+
+func (m *MockProductRepository) ListVariants(ctx context.Context, productID string) ([]models.ProductVariant, error) {
+	return m.MockListVariants(productID)
+}
+
+func (m *MockProductRepository) GetVariant(ctx context.Context, productID, variantID string) (models.ProductVariant, error) {
+	return m.MockGetVariant(productID, variantID)
+}
+
+func (m *MockProductRepository) CreateVariant(ctx context.Context, variant models.ProductVariant) (models.ProductVariant, error) {
+	return m.MockCreateVariant(variant)
+}
+
+func (m *MockProductRepository) UpdateVariant(ctx context.Context, variant models.ProductVariant) (models.ProductVariant, error) {
+	return m.MockUpdateVariant(variant)
+}
+
+func (m *MockProductRepository) DeleteVariant(ctx context.Context, productID, variantID string) error {
+	return m.MockDeleteVariant(productID, variantID)
+}
+
+func (m *MockProductRepository) PurgeDeletedVariants(ctx context.Context, before time.Time) (int64, error) {
+	return m.MockPurgeDeletedVariants(before)
+}
+
+func (m *MockProductRepository) ListImages(ctx context.Context, productID string) ([]models.ProductImage, error) {
+	return m.MockListImages(productID)
+}
+
+func (m *MockProductRepository) AddImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	return m.MockAddImage(image)
+}
+
+func (m *MockProductRepository) UpdateImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	return m.MockUpdateImage(image)
+}
+
+func (m *MockProductRepository) DeleteImage(ctx context.Context, productID, imageID string) (models.ProductImage, error) {
+	return m.MockDeleteImage(productID, imageID)
+}
+
+func (m *MockProductRepository) CreateUpload(ctx context.Context, upload models.ProductUpload) (models.ProductUpload, error) {
+	return m.MockCreateUpload(upload)
+}
+
+func (m *MockProductRepository) GetUpload(ctx context.Context, productID, uploadID string) (models.ProductUpload, error) {
+	return m.MockGetUpload(productID, uploadID)
+}
+
+func (m *MockProductRepository) DeleteUpload(ctx context.Context, uploadID string) error {
+	return m.MockDeleteUpload(uploadID)
+}
+
+func (m *MockProductRepository) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]models.ProductUpload, error) {
+	return m.MockListExpiredUploads(before, limit)
+}
+
+func (m *MockProductRepository) ImportProducts(ctx context.Context, imports []repository.ProductImport, options repository.ImportOptions) ([]repository.ImportResult, error) {
+	return m.MockImportProducts(imports, options)
+}
+
+func (m *MockProductRepository) ExportProducts(ctx context.Context, fn func(models.Product) error) error {
+	return m.MockExportProducts(fn)
+}
+
+func (m *MockProductRepository) AttributeNames(ctx context.Context) ([]string, error) {
+	return m.MockAttributeNames()
+}
+
 func TestListProducts(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -113,6 +238,13 @@ func TestCreateProduct(t *testing.T) {
 			mockError:      nil,
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:           "Duplicate SKU",
+			input:          models.Product{Name: "New Product", Price: 99.99, SKU: "A1"},
+			mockProduct:    models.Product{},
+			mockError:      errors.New("product with this SKU already exists"),
+			expectedStatus: http.StatusConflict,
+		},
 		{
 			name:           "Database Error",
 			input:          models.Product{Name: "New Product", Price: 99.99},
@@ -282,6 +414,110 @@ func TestUpdateProduct(t *testing.T) {
 	}
 }
 
+func TestPatchProduct(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              string
+		contentType     string
+		body            string
+		mockError       error
+		expectedStatus  int
+		expectedChanges map[string]interface{}
+	}{
+		{
+			name:            "Set and clear fields",
+			id:              "1",
+			contentType:     "application/merge-patch+json",
+			body:            `{"price": 12.5, "description": null, "category": "Kitchen"}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{"price": 12.5, "description": "", "category": "Kitchen"},
+		},
+		{
+			name:            "Set SKU",
+			id:              "1",
+			contentType:     "application/merge-patch+json",
+			body:            `{"sku": "MUG-001"}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{"sku": "MUG-001"},
+		},
+		{
+			name:            "Zero price is written",
+			id:              "1",
+			contentType:     "application/json",
+			body:            `{"price": 0}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{"price": 0.0},
+		},
+		{
+			name:            "Empty patch",
+			id:              "1",
+			contentType:     "application/merge-patch+json",
+			body:            `{}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{},
+		},
+		{
+			name:           "Merge attributes",
+			id:             "1",
+			contentType:    "application/merge-patch+json",
+			body:           `{"attributes": {"brand": "Acme", "weight": null, "color": null}}`,
+			expectedStatus: http.StatusOK,
+			expectedChanges: map[string]interface{}{"attributes": repository.AttributeChanges{
+				Set:    db.StringMap{"brand": "Acme"},
+				Remove: []string{"color", "weight"},
+			}},
+		},
+		{
+			name:            "Clear attributes",
+			id:              "1",
+			contentType:     "application/merge-patch+json",
+			body:            `{"attributes": null}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{"attributes": db.StringMap{}},
+		},
+		{name: "Empty attribute value", id: "1", contentType: "application/merge-patch+json", body: `{"attributes": {"brand": ""}}`, expectedStatus: http.StatusBadRequest},
+		{name: "Attributes not an object", id: "1", contentType: "application/merge-patch+json", body: `{"attributes": "Acme"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Clear required field", id: "1", contentType: "application/merge-patch+json", body: `{"name": null}`, expectedStatus: http.StatusBadRequest},
+		{name: "Empty name", id: "1", contentType: "application/merge-patch+json", body: `{"name": " "}`, expectedStatus: http.StatusBadRequest},
+		{name: "Negative price", id: "1", contentType: "application/merge-patch+json", body: `{"price": -1}`, expectedStatus: http.StatusBadRequest},
+		{name: "Wrong type", id: "1", contentType: "application/merge-patch+json", body: `{"price": "free"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Read-only field", id: "1", contentType: "application/merge-patch+json", body: `{"product_id": "2"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Unsupported media type", id: "1", contentType: "text/plain", body: `{"name": "Mug"}`, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Not found", id: "999", contentType: "application/merge-patch+json", body: `{"name": "Mug"}`, mockError: errors.New("product not found"), expectedStatus: http.StatusNotFound},
+		{name: "Duplicate SKU", id: "1", contentType: "application/merge-patch+json", body: `{"sku": "A1"}`, mockError: errors.New("product with this SKU already exists"), expectedStatus: http.StatusConflict},
+		{name: "Database error", id: "1", contentType: "application/merge-patch+json", body: `{"name": "Mug"}`, mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotChanges map[string]interface{}
+			mockRepo := &MockProductRepository{
+				MockPatchProduct: func(id string, changes map[string]interface{}) (models.Product, error) {
+					gotChanges = changes
+					return models.Product{ProductID: id, Name: "Mug"}, tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPatch, "/products/"+tt.id, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+			handler.PatchProduct(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Patch") != "application/merge-patch+json" {
+				t.Error("Expected Accept-Patch header on 415")
+			}
+			if tt.expectedChanges != nil && !reflect.DeepEqual(gotChanges, tt.expectedChanges) {
+				t.Errorf("Expected changes %v, got %v", tt.expectedChanges, gotChanges)
+			}
+		})
+	}
+}
+
 func TestDeleteProduct(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -343,3 +579,212 @@ func TestDeleteProduct(t *testing.T) {
 		})
 	}
 }
+
+func TestUploadProductImageSizeLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		imageSize      int
+		expectedStatus int
+	}{
+		{name: "Within limit", imageSize: 512, expectedStatus: http.StatusOK},
+		{name: "Exceeds limit", imageSize: 2048, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				MockGetProductById: func(id string) (models.Product, error) {
+					return models.Product{ProductID: id}, nil
+				},
+				MockAddImage: func(image models.ProductImage) (models.ProductImage, error) {
+					return image, nil
+				},
+			}
+			uploads := UploadConfig{Dir: t.TempDir(), MaxImageBytes: 1024}
+			handler := NewProductHandlerWithUploads(mockRepo, uploads)
+
+			// Pad a real PNG to the size under test
+			data := pngImage(8, 8)
+			data = append(data, make([]byte, tt.imageSize-len(data))...)
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, _ := form.CreateFormFile("image", "photo.png")
+			part.Write(data)
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/products/1/image", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+
+			handler.UploadProductImage(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRestoreProduct(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusOK},
+		{name: "Not Found", mockError: errors.New("product not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				MockRestoreProduct: func(id string) (models.Product, error) {
+					return models.Product{ProductID: id, Name: "Mug"}, tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPost, "/products/p1/restore", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "p1"})
+			w := httptest.NewRecorder()
+
+			handler.RestoreProduct(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var product models.Product
+				if err := json.NewDecoder(w.Body).Decode(&product); err != nil {
+					t.Fatal(err)
+				}
+				if product.ProductID != "p1" {
+					t.Errorf("Expected restored product p1, got %q", product.ProductID)
+				}
+			}
+		})
+	}
+}
+
+func TestListProductsByIds(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedIDs    []string
+		expectedStatus int
+	}{
+		{name: "Requested IDs", query: "?ids=p2,%20p1,,", expectedIDs: []string{"p2", "p1"}, expectedStatus: http.StatusOK},
+		{name: "Empty list", query: "?ids=", expectedIDs: nil, expectedStatus: http.StatusOK},
+		{name: "Too many IDs", query: "?ids=" + strings.Repeat("p,", maxProductIDs+1), expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIDs []string
+			mockRepo := &MockProductRepository{
+				MockGetProductsByIds: func(ids []string) ([]models.Product, error) {
+					gotIDs = ids
+					return []models.Product{}, nil
+				},
+				MockListAllProducts: func() ([]models.Product, error) {
+					t.Error("Expected an ids lookup not to list every product")
+					return nil, nil
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodGet, "/products"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.ListProducts(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if !reflect.DeepEqual(gotIDs, tt.expectedIDs) {
+				t.Errorf("Expected lookup of %v, got %v", tt.expectedIDs, gotIDs)
+			}
+		})
+	}
+}
+
+func TestListProductsFiltered(t *testing.T) {
+	var got repository.ProductFilter
+	mockRepo := &MockProductRepository{
+		MockFilterProducts: func(filter repository.ProductFilter) ([]models.Product, error) {
+			got = filter
+			return []models.Product{{ProductID: "1", Name: "XPS 15"}}, nil
+		},
+		MockListAllProducts: func() ([]models.Product, error) {
+			t.Error("Expected a filtered list not to list all products")
+			return nil, nil
+		},
+	}
+
+	handler := NewProductHandler(mockRepo)
+	req := httptest.NewRequest(http.MethodGet, "/products?category=Laptops&attr.brand=Dell&attr.brand=HP&attr.color=&sort=name", nil)
+	w := httptest.NewRecorder()
+	handler.ListProducts(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	expected := repository.ProductFilter{
+		Categories: []string{"Laptops"},
+		Attributes: map[string][]string{"brand": {"Dell", "HP"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected filter %+v, got %+v", expected, got)
+	}
+}
+
+func TestProductFacets(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusOK},
+		{name: "Database Error", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got repository.ProductFilter
+			mockRepo := &MockProductRepository{
+				MockProductFacets: func(filter repository.ProductFilter) (models.ProductFacets, error) {
+					got = filter
+					return models.ProductFacets{
+						Categories: []models.FacetValue{{Value: "Laptops", Count: 2}},
+						Attributes: map[string][]models.FacetValue{"brand": {{Value: "Dell", Count: 1}, {Value: "HP", Count: 1}}},
+					}, tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodGet, "/products/facets?attr.brand=Dell", nil)
+			w := httptest.NewRecorder()
+			handler.ProductFacets(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(got.Attributes, map[string][]string{"brand": {"Dell"}}) {
+				t.Errorf("Expected the brand filter to be passed on, got %+v", got)
+			}
+			var facets models.ProductFacets
+			if err := json.NewDecoder(w.Body).Decode(&facets); err != nil {
+				t.Fatal(err)
+			}
+			if len(facets.Attributes["brand"]) != 2 || facets.Categories[0].Count != 2 {
+				t.Errorf("Expected the facet counts, got %+v", facets)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	productModels "gocart/internal/product-service/models"
+	"gocart/pkg/blobstore"
+	"gocart/pkg/imaging"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// pendingUploadsKey is where direct uploads wait in the blob store until
+// they are confirmed. The store never serves them.
+const pendingUploadsKey = blobstore.PrivatePrefix
+
+// expiredUploadsBatch is how many expired uploads are removed per query.
+const expiredUploadsBatch = 100
+
+// uploadErrorStatus maps repository errors to a status code and message.
+func uploadErrorStatus(err error, productID, uploadID string) (int, string) {
+	if err.Error() == "upload not found" {
+		return http.StatusNotFound, fmt.Sprintf("Upload with id %v not found.", uploadID)
+	}
+	return imageErrorStatus(err, productID, "")
+}
+
+// directUploadRequest announces an image the client is about to upload.
+type directUploadRequest struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// directUploadSlot tells the client where and how to upload an image, and
+// which images will be accepted when the upload is confirmed.
+type directUploadSlot struct {
+	UploadID     string            `json:"upload_id"`
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+	MaxBytes     int64             `json:"max_bytes"`
+	MaxWidth     int               `json:"max_width"`
+	MaxHeight    int               `json:"max_height"`
+	ContentTypes []string          `json:"content_types"`
+}
+
+// CreateImageUpload reserves a slot for an image the client uploads
+// straight to the blob store, and returns a signed URL to PUT it to. The
+// URL only accepts the announced content type and size. Once uploaded, the
+// image is added to the gallery by ConfirmImageUpload.
+func (h *ProductHandler) CreateImageUpload(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req directUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(imaging.ContentTypes, req.ContentType) {
+		http.Error(w, fmt.Sprintf("content_type must be one of %s", strings.Join(imaging.ContentTypes, ", ")), http.StatusBadRequest)
+		return
+	}
+	if req.Size <= 0 {
+		http.Error(w, "size must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.Size > h.uploads.MaxDirectUploadBytes {
+		http.Error(w, fmt.Sprintf("Image exceeds the %d byte limit", h.uploads.MaxDirectUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload := productModels.ProductUpload{
+		UploadID:    uuid.New().String(),
+		ProductID:   id,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		ExpiresAt:   time.Now().Add(h.uploads.DirectUploadTTL),
+	}
+	upload.Key = pendingUploadsKey + upload.UploadID
+	url, err := h.uploads.Store.SignedUploadURL(r.Context(), upload.Key, upload.ContentType, upload.Size, h.uploads.DirectUploadTTL)
+	if err != nil {
+		log.Printf("Error signing upload for product with id: %v and error: %v", id, err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	upload, err = h.repo.CreateUpload(r.Context(), upload)
+	if err != nil {
+		status, message := uploadErrorStatus(err, id, "")
+		if status == http.StatusInternalServerError {
+			log.Printf("Error creating upload for product with id: %v and error: %v", id, err)
+			message = "Failed to create upload"
+		}
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(directUploadSlot{
+		UploadID:     upload.UploadID,
+		Method:       http.MethodPut,
+		URL:          url,
+		Headers:      map[string]string{"Content-Type": upload.ContentType},
+		ExpiresAt:    upload.ExpiresAt,
+		MaxBytes:     h.uploads.MaxDirectUploadBytes,
+		MaxWidth:     h.uploads.MaxImageWidth,
+		MaxHeight:    h.uploads.MaxImageHeight,
+		ContentTypes: imaging.ContentTypes,
+	})
+}
+
+// confirmUploadRequest sets the new gallery image's fields.
+type confirmUploadRequest struct {
+	AltText string `json:"alt_text"`
+	Primary bool   `json:"primary"`
+}
+
+// ConfirmImageUpload checks an image uploaded with CreateImageUpload the
+// same way as a multipart upload and adds it to the product's gallery. The
+// body, with alt_text and primary, is optional. Whatever the outcome, the
+// uploaded file is then removed and the slot can't be confirmed again.
+func (h *ProductHandler) ConfirmImageUpload(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, uploadID := vars["id"], vars["upload_id"]
+
+	var req confirmUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.repo.GetUpload(r.Context(), id, uploadID)
+	if err != nil {
+		status, message := uploadErrorStatus(err, id, uploadID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error fetching upload with id: %v and error: %v", uploadID, err)
+			message = fmt.Sprintf("Unable to retrieve upload with id: %v.", uploadID)
+		}
+		http.Error(w, message, status)
+		return
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		http.Error(w, fmt.Sprintf("Upload with id %v has expired.", uploadID), http.StatusGone)
+		return
+	}
+	object, err := h.uploads.Store.Stat(r.Context(), upload.Key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Nothing has been uploaded for upload with id %v yet.", uploadID), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking upload with id: %v and error: %v", uploadID, err)
+		http.Error(w, fmt.Sprintf("Unable to retrieve upload with id: %v.", uploadID), http.StatusInternalServerError)
+		return
+	}
+
+	// Claim the slot, so concurrent confirmations add the image once
+	if err := h.repo.DeleteUpload(r.Context(), uploadID); err != nil {
+		status, message := uploadErrorStatus(err, id, uploadID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error claiming upload with id: %v and error: %v", uploadID, err)
+			message = fmt.Sprintf("Unable to confirm upload with id: %v.", uploadID)
+		}
+		http.Error(w, message, status)
+		return
+	}
+	defer h.removePendingUpload(r.Context(), upload)
+
+	// The signed URL fixes the size, but check what actually arrived
+	if object.Size > h.uploads.MaxDirectUploadBytes {
+		http.Error(w, fmt.Sprintf("Image exceeds the %d byte limit", h.uploads.MaxDirectUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	body, _, err := h.uploads.Store.Get(r.Context(), upload.Key)
+	if err != nil {
+		log.Printf("Error reading upload with id: %v and error: %v", uploadID, err)
+		http.Error(w, "Failed to read image", http.StatusInternalServerError)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(body, h.uploads.MaxDirectUploadBytes+1))
+	body.Close()
+	if err != nil {
+		log.Printf("Error reading upload with id: %v and error: %v", uploadID, err)
+		http.Error(w, "Failed to read image", http.StatusInternalServerError)
+		return
+	}
+	if int64(len(data)) > h.uploads.MaxDirectUploadBytes {
+		http.Error(w, fmt.Sprintf("Image exceeds the %d byte limit", h.uploads.MaxDirectUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	info, err := h.checkImage(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	image, ok := h.addImage(w, r, id, data, info, req.AltText, req.Primary)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(image)
+}
+
+// removePendingUpload deletes a direct upload's file.
+func (h *ProductHandler) removePendingUpload(ctx context.Context, upload productModels.ProductUpload) {
+	if err := h.uploads.Store.Delete(ctx, upload.Key); err != nil {
+		log.Printf("Failed to remove pending upload %s: %v", upload.Key, err)
+	}
+}
+
+// PurgeExpiredUploads removes upload slots that expired before the given
+// time, with any file uploaded to them, and returns how many it removed.
+func (h *ProductHandler) PurgeExpiredUploads(ctx context.Context, before time.Time) (int64, error) {
+	var removed int64
+	for {
+		uploads, err := h.repo.ListExpiredUploads(ctx, before, expiredUploadsBatch)
+		if err != nil {
+			return removed, err
+		}
+		for _, upload := range uploads {
+			// Remove the file first, so it isn't left behind without a slot
+			// pointing at it when removing it fails
+			if err := h.uploads.Store.Delete(ctx, upload.Key); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+				return removed, fmt.Errorf("failed to remove %s: %w", upload.Key, err)
+			}
+			if err := h.repo.DeleteUpload(ctx, upload.UploadID); err != nil {
+				if err.Error() == "upload not found" {
+					continue
+				}
+				return removed, err
+			}
+			removed++
+		}
+		if len(uploads) < expiredUploadsBatch {
+			return removed, nil
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/blobstore"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// uploadsRepository returns a mock repository keeping upload slots in
+// memory, and the added gallery images in *added.
+func uploadsRepository(added *[]models.ProductImage) (*MockProductRepository, map[string]models.ProductUpload) {
+	uploads := map[string]models.ProductUpload{}
+	return &MockProductRepository{
+		MockCreateUpload: func(upload models.ProductUpload) (models.ProductUpload, error) {
+			if upload.ProductID != "p1" {
+				return models.ProductUpload{}, errors.New("product not found")
+			}
+			uploads[upload.UploadID] = upload
+			return upload, nil
+		},
+		MockGetUpload: func(productID, uploadID string) (models.ProductUpload, error) {
+			upload, ok := uploads[uploadID]
+			if !ok || upload.ProductID != productID {
+				return models.ProductUpload{}, errors.New("upload not found")
+			}
+			return upload, nil
+		},
+		MockDeleteUpload: func(uploadID string) error {
+			if _, ok := uploads[uploadID]; !ok {
+				return errors.New("upload not found")
+			}
+			delete(uploads, uploadID)
+			return nil
+		},
+		MockAddImage: func(image models.ProductImage) (models.ProductImage, error) {
+			image.ImageID = "i1"
+			*added = append(*added, image)
+			return image, nil
+		},
+	}, uploads
+}
+
+// requestUpload asks handler for an upload slot for a product.
+func requestUpload(handler *ProductHandler, productID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/products/"+productID+"/images/uploads", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"id": productID})
+	w := httptest.NewRecorder()
+	handler.CreateImageUpload(w, req)
+	return w
+}
+
+// confirmUpload asks handler to confirm an upload to product p1.
+func confirmUpload(handler *ProductHandler, uploadID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/products/p1/images/uploads/"+uploadID, strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"id": "p1", "upload_id": uploadID})
+	w := httptest.NewRecorder()
+	handler.ConfirmImageUpload(w, req)
+	return w
+}
+
+// putUpload uploads data to a slot's signed URL on the local store, the
+// way a client would.
+func putUpload(t *testing.T, store *blobstore.Local, slot directUploadSlot, data []byte) {
+	t.Helper()
+	signed, err := url.Parse(slot.URL)
+	if err != nil {
+		t.Fatalf("Invalid upload URL %q: %v", slot.URL, err)
+	}
+	req := httptest.NewRequest(slot.Method, strings.TrimPrefix(signed.RequestURI(), "/uploads"), bytes.NewReader(data))
+	for name, value := range slot.Headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	store.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the upload to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateImageUpload(t *testing.T) {
+	tests := []struct {
+		name           string
+		productID      string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Success", productID: "p1", body: `{"content_type": "image/png", "size": 1000}`, expectedStatus: http.StatusCreated},
+		{name: "Invalid body", productID: "p1", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "Unsupported type", productID: "p1", body: `{"content_type": "image/svg+xml", "size": 1000}`, expectedStatus: http.StatusBadRequest},
+		{name: "Missing size", productID: "p1", body: `{"content_type": "image/png"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Too large", productID: "p1", body: `{"content_type": "image/png", "size": 2000}`, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Product not found", productID: "p2", body: `{"content_type": "image/png", "size": 1000}`, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added []models.ProductImage
+			mockRepo, uploads := uploadsRepository(&added)
+			handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Dir: t.TempDir(), MaxDirectUploadBytes: 1500, DirectUploadTTL: time.Minute})
+
+			w := requestUpload(handler, tt.productID, tt.body)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+			var slot directUploadSlot
+			json.NewDecoder(w.Body).Decode(&slot)
+			upload := uploads[slot.UploadID]
+			if upload.Key != "pending/"+slot.UploadID || upload.Size != 1000 || upload.ContentType != "image/png" {
+				t.Errorf("Expected the upload slot to be recorded, got %+v", upload)
+			}
+			if slot.Method != http.MethodPut || !strings.HasPrefix(slot.URL, "/uploads/pending/"+slot.UploadID+"?") {
+				t.Errorf("Expected a signed PUT to the pending upload, got %s %s", slot.Method, slot.URL)
+			}
+			if signed, _ := url.Parse(slot.URL); signed.Query().Get("content_type") != "image/png" || signed.Query().Get("size") != "1000" {
+				t.Errorf("Expected the URL to be signed for the announced type and size, got %s", slot.URL)
+			}
+			if slot.Headers["Content-Type"] != "image/png" || slot.MaxBytes != 1500 || slot.MaxWidth != 4096 || len(slot.ContentTypes) != 4 {
+				t.Errorf("Expected the upload constraints, got %+v", slot)
+			}
+			if until := time.Until(slot.ExpiresAt); until <= 0 || until > time.Minute {
+				t.Errorf("Expected the slot to expire within a minute, got %s", slot.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestConfirmImageUpload(t *testing.T) {
+	var added []models.ProductImage
+	mockRepo, uploads := uploadsRepository(&added)
+	dir := t.TempDir()
+	store := blobstore.NewLocal(dir, "/uploads/", []byte("key"))
+	handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Store: store, MaxDirectUploadBytes: 1 << 20})
+
+	data := pngImage(300, 150)
+	w := requestUpload(handler, "p1", fmt.Sprintf(`{"content_type": "image/png", "size": %d}`, len(data)))
+	var slot directUploadSlot
+	json.NewDecoder(w.Body).Decode(&slot)
+
+	// Confirming before anything arrived leaves the slot open
+	if w := confirmUpload(handler, slot.UploadID, ""); w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+
+	putUpload(t, store, slot, data)
+	w = confirmUpload(handler, slot.UploadID, `{"alt_text": " Front ", "primary": true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var image models.ProductImage
+	json.NewDecoder(w.Body).Decode(&image)
+	if image.Width != 300 || image.Height != 150 || image.AltText != "Front" || !image.IsPrimary || len(image.Renditions) != 4 {
+		t.Errorf("Expected the uploaded image with renditions, got %+v", image)
+	}
+	if !strings.HasPrefix(image.URL, productUploadsURL+"p1-") {
+		t.Errorf("Expected the image to be stored with the product images, got %s", image.URL)
+	}
+	if _, err := store.Stat(context.Background(), "pending/"+slot.UploadID); !errors.Is(err, blobstore.ErrNotFound) {
+		t.Errorf("Expected the pending upload to be removed, got %v", err)
+	}
+	if len(uploads) != 0 {
+		t.Errorf("Expected the slot to be used up, got %v", uploads)
+	}
+
+	// A slot can only be confirmed once
+	if w := confirmUpload(handler, slot.UploadID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if len(added) != 1 {
+		t.Errorf("Expected one image to be added, got %d", len(added))
+	}
+}
+
+func TestConfirmImageUploadRejected(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           []byte
+		expired        bool
+		bypass         bool // written to the store without the signed URL's limits
+		expectedStatus int
+	}{
+		{name: "Not an image", data: []byte("<svg></svg>"), expectedStatus: http.StatusBadRequest},
+		{name: "Too many pixels", data: pngImage(100, 1), expectedStatus: http.StatusBadRequest},
+		{name: "Larger than allowed", data: bytes.Repeat([]byte{0}, 3000), bypass: true, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Expired", data: pngImage(10, 10), expired: true, expectedStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added []models.ProductImage
+			mockRepo, uploads := uploadsRepository(&added)
+			store := blobstore.NewLocal(t.TempDir(), "/uploads/", []byte("key"))
+			handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Store: store, MaxImageWidth: 64, MaxImageHeight: 64, MaxDirectUploadBytes: 2000})
+
+			size := len(tt.data)
+			if tt.bypass {
+				size = 100
+			}
+			w := requestUpload(handler, "p1", fmt.Sprintf(`{"content_type": "image/png", "size": %d}`, size))
+			var slot directUploadSlot
+			json.NewDecoder(w.Body).Decode(&slot)
+			if tt.bypass {
+				if err := store.Put(context.Background(), "pending/"+slot.UploadID, bytes.NewReader(tt.data), int64(len(tt.data)), "image/png"); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				putUpload(t, store, slot, tt.data)
+			}
+			if tt.expired {
+				upload := uploads[slot.UploadID]
+				upload.ExpiresAt = time.Now().Add(-time.Second)
+				uploads[slot.UploadID] = upload
+			}
+
+			w = confirmUpload(handler, slot.UploadID, "")
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if len(added) != 0 {
+				t.Errorf("Expected no image to be added, got %+v", added)
+			}
+			// Expired uploads are left for the cleanup
+			_, err := store.Stat(context.Background(), "pending/"+slot.UploadID)
+			if removed := errors.Is(err, blobstore.ErrNotFound); removed == tt.expired {
+				t.Errorf("Expected the pending upload to be removed: %v, got %v", !tt.expired, err)
+			}
+		})
+	}
+}
+
+// failingDeleteStore is a blob store whose deletes fail.
+type failingDeleteStore struct {
+	blobstore.BlobStore
+}
+
+func (failingDeleteStore) Delete(ctx context.Context, key string) error {
+	return errors.New("storage unavailable")
+}
+
+func TestPurgeExpiredUploads(t *testing.T) {
+	ctx := context.Background()
+	store := blobstore.NewLocal(t.TempDir(), "/uploads/", []byte("key"))
+	for _, key := range []string{"pending/u1", "pending/u2"} {
+		store.Put(ctx, key, strings.NewReader("data"), 4, "")
+	}
+
+	cutoff := time.Now()
+	var deleted []string
+	mockRepo := &MockProductRepository{
+		MockListExpiredUploads: func(before time.Time, limit int) ([]models.ProductUpload, error) {
+			if !before.Equal(cutoff) {
+				t.Errorf("Expected uploads expired before %s, got %s", cutoff, before)
+			}
+			return []models.ProductUpload{
+				{UploadID: "u1", Key: "pending/u1"},
+				{UploadID: "u2", Key: "pending/u2"},
+				{UploadID: "u3", Key: "pending/u3"},
+			}, nil
+		},
+		MockDeleteUpload: func(uploadID string) error {
+			deleted = append(deleted, uploadID)
+			// u2 was removed meanwhile, by a confirmation or another purge
+			if uploadID == "u2" {
+				return errors.New("upload not found")
+			}
+			return nil
+		},
+	}
+	handler := NewProductHandlerWithUploads(mockRepo, UploadConfig{Store: store})
+
+	// u3 has no file, which doesn't stop its slot being removed
+	removed, err := handler.PurgeExpiredUploads(ctx, cutoff)
+	if err != nil || removed != 2 {
+		t.Fatalf("Expected 2 uploads removed, got %d (%v)", removed, err)
+	}
+	for _, key := range []string{"pending/u1", "pending/u2"} {
+		if _, err := store.Stat(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+			t.Errorf("Expected %s to be removed, got %v", key, err)
+		}
+	}
+
+	// A file that can't be removed keeps its slot, so the next purge
+	// retries it
+	deleted = nil
+	handler = NewProductHandlerWithUploads(mockRepo, UploadConfig{Store: failingDeleteStore{store}})
+	if removed, err := handler.PurgeExpiredUploads(ctx, cutoff); err == nil || removed != 0 {
+		t.Errorf("Expected the purge to fail without removing anything, got %d (%v)", removed, err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected no slot to be removed, got %v", deleted)
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	productModels "gocart/internal/product-service/models"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// validateVariant checks the fields a variant is created or replaced with.
+func validateVariant(variant productModels.ProductVariant) error {
+	if strings.TrimSpace(variant.SKU) == "" {
+		return errors.New("sku is required")
+	}
+	for name, value := range variant.Options {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			return errors.New("option names and values must not be empty")
+		}
+	}
+	if variant.Price != nil && *variant.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	if variant.Stock < 0 {
+		return errors.New("stock must not be negative")
+	}
+	return nil
+}
+
+// variantErrorStatus maps repository errors to a status code and message.
+func variantErrorStatus(err error, productID, variantID string) (int, string) {
+	switch err.Error() {
+	case "product not found":
+		return http.StatusNotFound, fmt.Sprintf("Product with id %v not found.", productID)
+	case "variant not found":
+		return http.StatusNotFound, fmt.Sprintf("Variant with id %v not found.", variantID)
+	case "variant with this SKU already exists":
+		return http.StatusConflict, "A variant with this SKU already exists"
+	}
+	return http.StatusInternalServerError, ""
+}
+
+func (h *ProductHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	variants, err := h.repo.ListVariants(r.Context(), id)
+	if err != nil {
+		status, message := variantErrorStatus(err, id, "")
+		if status == http.StatusInternalServerError {
+			log.Printf("Error listing variants of product with id: %v and error: %v", id, err)
+			message = "Unable to retrieve variants"
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(variants)
+}
+
+func (h *ProductHandler) GetVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, variantID := vars["id"], vars["variant_id"]
+
+	variant, err := h.repo.GetVariant(r.Context(), id, variantID)
+	if err != nil {
+		status, message := variantErrorStatus(err, id, variantID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error fetching variant with id: %v and error: %v", variantID, err)
+			message = fmt.Sprintf("Unable to retrieve variant with id: %v.", variantID)
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(variant)
+}
+
+func (h *ProductHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var variant productModels.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateVariant(variant); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	variant.ProductID = id
+
+	created, err := h.repo.CreateVariant(r.Context(), variant)
+	if err != nil {
+		status, message := variantErrorStatus(err, id, "")
+		if status == http.StatusInternalServerError {
+			log.Printf("Error creating variant of product with id: %v and error: %v", id, err)
+			message = "Unable to create variant"
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/products/"+id+"/variants/"+created.VariantID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateVariant replaces a variant's SKU, options, price, stock and image.
+func (h *ProductHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, variantID := vars["id"], vars["variant_id"]
+
+	var variant productModels.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateVariant(variant); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	variant.ProductID = id
+	variant.VariantID = variantID
+
+	updated, err := h.repo.UpdateVariant(r.Context(), variant)
+	if err != nil {
+		status, message := variantErrorStatus(err, id, variantID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error updating variant with id: %v and error: %v", variantID, err)
+			message = "Unable to update variant"
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (h *ProductHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, variantID := vars["id"], vars["variant_id"]
+
+	if err := h.repo.DeleteVariant(r.Context(), id, variantID); err != nil {
+		status, message := variantErrorStatus(err, id, variantID)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error deleting variant with id: %v and error: %v", variantID, err)
+			message = "Unable to delete variant"
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
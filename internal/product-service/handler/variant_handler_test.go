@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"gocart/internal/product-service/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestListVariants(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusOK},
+		{name: "Product Not Found", mockError: errors.New("product not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				MockListVariants: func(productID string) ([]models.ProductVariant, error) {
+					return []models.ProductVariant{{VariantID: "v1", ProductID: productID, SKU: "TEE-M"}}, tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodGet, "/products/p1/variants", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "p1"})
+			w := httptest.NewRecorder()
+
+			handler.ListVariants(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateVariant(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		mockError      error
+		expectedStatus int
+	}{
+		{
+			name:           "Success",
+			body:           `{"sku": "TEE-M-RED", "options": {"size": "M", "color": "red"}, "price": 21.5, "stock": 4}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{name: "Missing SKU", body: `{"options": {"size": "M"}}`, expectedStatus: http.StatusBadRequest},
+		{name: "Empty Option Value", body: `{"sku": "TEE-M", "options": {"size": ""}}`, expectedStatus: http.StatusBadRequest},
+		{name: "Negative Price", body: `{"sku": "TEE-M", "price": -1}`, expectedStatus: http.StatusBadRequest},
+		{name: "Negative Stock", body: `{"sku": "TEE-M", "stock": -1}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", body: `{`, expectedStatus: http.StatusBadRequest},
+		{
+			name:           "Product Not Found",
+			body:           `{"sku": "TEE-M"}`,
+			mockError:      errors.New("product not found"),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Duplicate SKU",
+			body:           `{"sku": "TEE-M"}`,
+			mockError:      errors.New("variant with this SKU already exists"),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received models.ProductVariant
+			mockRepo := &MockProductRepository{
+				MockCreateVariant: func(variant models.ProductVariant) (models.ProductVariant, error) {
+					received = variant
+					variant.VariantID = "v1"
+					return variant, tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPost, "/products/p1/variants", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "p1"})
+			w := httptest.NewRecorder()
+
+			handler.CreateVariant(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+			if received.ProductID != "p1" || received.Options["color"] != "red" || received.Price == nil || *received.Price != 21.5 {
+				t.Errorf("Expected the variant to be created for p1 with its options and price, got %+v", received)
+			}
+			if location := w.Header().Get("Location"); location != "/products/p1/variants/v1" {
+				t.Errorf("Expected Location /products/p1/variants/v1, got %q", location)
+			}
+		})
+	}
+}
+
+func TestUpdateVariant(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", body: `{"sku": "TEE-L", "stock": 2}`, expectedStatus: http.StatusOK},
+		{name: "Missing SKU", body: `{"stock": 2}`, expectedStatus: http.StatusBadRequest},
+		{
+			name:           "Not Found",
+			body:           `{"sku": "TEE-L"}`,
+			mockError:      errors.New("variant not found"),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Duplicate SKU",
+			body:           `{"sku": "TEE-L"}`,
+			mockError:      errors.New("variant with this SKU already exists"),
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				MockUpdateVariant: func(variant models.ProductVariant) (models.ProductVariant, error) {
+					return variant, tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPut, "/products/p1/variants/v1", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "p1", "variant_id": "v1"})
+			w := httptest.NewRecorder()
+
+			handler.UpdateVariant(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var variant models.ProductVariant
+				if err := json.NewDecoder(w.Body).Decode(&variant); err != nil {
+					t.Fatal(err)
+				}
+				if variant.VariantID != "v1" || variant.ProductID != "p1" || variant.SKU != "TEE-L" {
+					t.Errorf("Expected variant v1 of p1 to be updated, got %+v", variant)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteVariant(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusNoContent},
+		{name: "Not Found", mockError: errors.New("variant not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				MockDeleteVariant: func(productID, variantID string) error {
+					return tt.mockError
+				},
+			}
+
+			handler := NewProductHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodDelete, "/products/p1/variants/v1", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "p1", "variant_id": "v1"})
+			w := httptest.NewRecorder()
+
+			handler.DeleteVariant(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"gocart/pkg/db"
+	"time"
+)
+
+// ProductImage is one image in a product's gallery. The primary image is
+// also the product's ImageURL.
+type ProductImage struct {
+	ImageID   string `gorm:"primaryKey" json:"image_id"`
+	ProductID string `gorm:"not null;index" json:"product_id"`
+	URL       string `gorm:"not null" json:"url"`
+	AltText   string `gorm:"not null;default:''" json:"alt_text"`
+	// SortOrder orders the gallery, lowest first.
+	SortOrder int  `gorm:"not null;default:0" json:"sort_order"`
+	IsPrimary bool `gorm:"not null;default:false" json:"is_primary"`
+	// ContentType, Width and Height are sniffed from the uploaded file; they
+	// are empty for images added before uploads were checked.
+	ContentType string `gorm:"not null;default:''" json:"content_type"`
+	Width       int    `gorm:"not null;default:0" json:"width"`
+	Height      int    `gorm:"not null;default:0" json:"height"`
+	// Renditions maps resized copies, such as "thumbnail" and
+	// "thumbnail_webp", to their URLs.
+	Renditions db.StringMap `gorm:"type:jsonb;not null;default:'{}'" json:"renditions"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
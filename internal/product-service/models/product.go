@@ -1,5 +1,11 @@
 package models
 
+import (
+	"gocart/pkg/db"
+
+	"gorm.io/gorm"
+)
+
 type Product struct {
 	ProductID   string  `gorm:"primaryKey" json:"product_id"`
 	Name        string  `gorm:"not null"   json:"name"`
@@ -7,4 +13,27 @@ type Product struct {
 	Price       float64 `gorm:"not null"   json:"price"`
 	Category    string  `json:"category"`
 	ImageURL    string  `json:"image_url"`
+	// SKU, when set, is unique among products that aren't deleted.
+	SKU string `gorm:"uniqueIndex:idx_products_sku,where:deleted_at IS NULL AND sku <> ''" json:"sku"`
+	// Attributes describe the product beyond its category, e.g.
+	// {"brand": "Acme", "material": "Steel", "weight": "1.2 kg"}. Products
+	// can be filtered and faceted by them.
+	Attributes db.StringMap `gorm:"type:jsonb;not null;default:'{}'" json:"attributes"`
+	// DeletedAt is set when the product is deleted. Deleted products are
+	// kept for order history until purged.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// FacetValue is a value of a category or attribute and how many products
+// have it.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// ProductFacets counts products by category and by attribute value, most
+// common first.
+type ProductFacets struct {
+	Categories []FacetValue            `json:"categories"`
+	Attributes map[string][]FacetValue `json:"attributes"`
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ProductUpload is a slot for an image the client uploads straight to the
+// blob store with a signed URL. Confirming the upload turns it into a
+// gallery image; slots that aren't confirmed before ExpiresAt are removed
+// along with whatever was uploaded.
+type ProductUpload struct {
+	UploadID  string `gorm:"primaryKey" json:"upload_id"`
+	ProductID string `gorm:"not null;index" json:"product_id"`
+	// Key is where the client uploads the file in the blob store.
+	Key string `gorm:"not null" json:"-"`
+	// ContentType and Size are what the client said it would upload. The
+	// file itself is checked when the upload is confirmed.
+	ContentType string    `gorm:"not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"gocart/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductVariant is a purchasable version of a product, such as a shirt in
+// one size and color. It has its own SKU, stock and image, and may override
+// the product's price.
+type ProductVariant struct {
+	VariantID string `gorm:"primaryKey" json:"variant_id"`
+	ProductID string `gorm:"not null;index" json:"product_id"`
+	// SKU is unique among variants that aren't deleted.
+	SKU string `gorm:"not null;uniqueIndex:idx_product_variants_sku,where:deleted_at IS NULL" json:"sku"`
+	// Options name the variant's option values, e.g. {"size": "M"}.
+	Options db.StringMap `gorm:"type:jsonb;not null;default:'{}'" json:"options"`
+	// Price overrides the product's price when set.
+	Price     *float64  `json:"price,omitempty"`
+	Stock     int       `gorm:"not null;default:0" json:"stock"`
+	ImageURL  string    `json:"image_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set when the variant is deleted. Like products, deleted
+	// variants are kept for order history until purged.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
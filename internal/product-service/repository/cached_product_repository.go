@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/cache"
+	"gocart/pkg/db"
+	"time"
+)
+
+// cachedProductRepository serves product reads from a cache, loading misses
+// from the wrapped repository and invalidating affected keys after writes.
+// Batch lookups, filtered lists, facets and reads that include deleted
+// products bypass the cache.
+type cachedProductRepository struct {
+	ProductRepository
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+const productListKey = "products:all"
+
+// NewCachedProductRepository wraps repo with read-through caching.
+func NewCachedProductRepository(repo ProductRepository, c cache.Cache, ttl time.Duration) ProductRepository {
+	return &cachedProductRepository{ProductRepository: repo, cache: c, ttl: ttl}
+}
+
+func productKey(id string) string {
+	return "product:" + id
+}
+
+func (r *cachedProductRepository) ListAllProducts(ctx context.Context) ([]models.Product, error) {
+	if db.IncludesDeleted(ctx) {
+		return r.ProductRepository.ListAllProducts(ctx)
+	}
+	return cache.GetOrLoad(ctx, r.cache, "products", productListKey, r.ttl, func() ([]models.Product, error) {
+		return r.ProductRepository.ListAllProducts(ctx)
+	})
+}
+
+func (r *cachedProductRepository) GetProductById(ctx context.Context, id string) (models.Product, error) {
+	if db.IncludesDeleted(ctx) {
+		return r.ProductRepository.GetProductById(ctx, id)
+	}
+	return cache.GetOrLoad(ctx, r.cache, "products", productKey(id), r.ttl, func() (models.Product, error) {
+		return r.ProductRepository.GetProductById(ctx, id)
+	})
+}
+
+func (r *cachedProductRepository) CreateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	created, err := r.ProductRepository.CreateProduct(ctx, product)
+	if err != nil {
+		return created, err
+	}
+	cache.Invalidate(ctx, r.cache, productListKey)
+	return created, nil
+}
+
+func (r *cachedProductRepository) UpdateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	updated, err := r.ProductRepository.UpdateProduct(ctx, product)
+	if err != nil {
+		return updated, err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(product.ProductID), productListKey)
+	return updated, nil
+}
+
+func (r *cachedProductRepository) PatchProduct(ctx context.Context, id string, changes map[string]interface{}) (models.Product, error) {
+	patched, err := r.ProductRepository.PatchProduct(ctx, id, changes)
+	if err != nil {
+		return patched, err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(id), productListKey)
+	return patched, nil
+}
+
+func (r *cachedProductRepository) DeleteProduct(ctx context.Context, id string) error {
+	if err := r.ProductRepository.DeleteProduct(ctx, id); err != nil {
+		return err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(id), productListKey)
+	return nil
+}
+
+func (r *cachedProductRepository) RestoreProduct(ctx context.Context, id string) (models.Product, error) {
+	restored, err := r.ProductRepository.RestoreProduct(ctx, id)
+	if err != nil {
+		return restored, err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(id), productListKey)
+	return restored, nil
+}
+
+func (r *cachedProductRepository) AddImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	added, err := r.ProductRepository.AddImage(ctx, image)
+	if err != nil {
+		return added, err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(image.ProductID), productListKey)
+	return added, nil
+}
+
+func (r *cachedProductRepository) UpdateImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	updated, err := r.ProductRepository.UpdateImage(ctx, image)
+	if err != nil {
+		return updated, err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(image.ProductID), productListKey)
+	return updated, nil
+}
+
+func (r *cachedProductRepository) DeleteImage(ctx context.Context, productID, imageID string) (models.ProductImage, error) {
+	deleted, err := r.ProductRepository.DeleteImage(ctx, productID, imageID)
+	if err != nil {
+		return deleted, err
+	}
+	cache.Invalidate(ctx, r.cache, productKey(productID), productListKey)
+	return deleted, nil
+}
+
+func (r *cachedProductRepository) ImportProducts(ctx context.Context, imports []ProductImport, options ImportOptions) ([]ImportResult, error) {
+	results, err := r.ProductRepository.ImportProducts(ctx, imports, options)
+	if err != nil || options.DryRun {
+		return results, err
+	}
+	keys := []string{productListKey}
+	for _, result := range results {
+		if result.Err == nil {
+			keys = append(keys, productKey(result.ProductID))
+		}
+	}
+	cache.Invalidate(ctx, r.cache, keys...)
+	return results, nil
+}
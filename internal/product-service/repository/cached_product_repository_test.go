@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/cache"
+	"gocart/pkg/db"
+	"testing"
+	"time"
+)
+
+// countingProductRepository is an in-memory ProductRepository that counts
+// reads, so tests can tell cache hits from loads. Variants aren't cached,
+// so their methods, and the image methods other than AddImage, are left to
+// the nil embedded interface. ImportProducts only renames products by id.
+type countingProductRepository struct {
+	ProductRepository
+	products map[string]models.Product
+	deleted  map[string]models.Product
+	reads    int
+}
+
+func (r *countingProductRepository) ListAllProducts(ctx context.Context) ([]models.Product, error) {
+	r.reads++
+	products := []models.Product{}
+	for _, product := range r.products {
+		products = append(products, product)
+	}
+	if db.IncludesDeleted(ctx) {
+		for _, product := range r.deleted {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+func (r *countingProductRepository) CreateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	r.products[product.ProductID] = product
+	return product, nil
+}
+
+func (r *countingProductRepository) GetProductById(ctx context.Context, id string) (models.Product, error) {
+	r.reads++
+	product, ok := r.products[id]
+	if !ok {
+		return models.Product{}, errors.New("record not found")
+	}
+	return product, nil
+}
+
+func (r *countingProductRepository) GetProductsByIds(ctx context.Context, ids []string) ([]models.Product, error) {
+	r.reads++
+	products := []models.Product{}
+	for _, id := range ids {
+		if product, ok := r.products[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+func (r *countingProductRepository) UpdateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	r.products[product.ProductID] = product
+	return product, nil
+}
+
+func (r *countingProductRepository) PatchProduct(ctx context.Context, id string, changes map[string]interface{}) (models.Product, error) {
+	product := r.products[id]
+	if name, ok := changes["name"].(string); ok {
+		product.Name = name
+	}
+	r.products[id] = product
+	return product, nil
+}
+
+func (r *countingProductRepository) DeleteProduct(ctx context.Context, id string) error {
+	if r.deleted == nil {
+		r.deleted = map[string]models.Product{}
+	}
+	r.deleted[id] = r.products[id]
+	delete(r.products, id)
+	return nil
+}
+
+func (r *countingProductRepository) RestoreProduct(ctx context.Context, id string) (models.Product, error) {
+	product, ok := r.deleted[id]
+	if !ok {
+		return models.Product{}, errors.New("product not found")
+	}
+	r.products[id] = product
+	delete(r.deleted, id)
+	return product, nil
+}
+
+func (r *countingProductRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	count := int64(len(r.deleted))
+	r.deleted = nil
+	return count, nil
+}
+
+func (r *countingProductRepository) AddImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	if image.IsPrimary {
+		product := r.products[image.ProductID]
+		product.ImageURL = image.URL
+		r.products[image.ProductID] = product
+	}
+	return image, nil
+}
+
+func (r *countingProductRepository) ImportProducts(ctx context.Context, imports []ProductImport, options ImportOptions) ([]ImportResult, error) {
+	results := make([]ImportResult, len(imports))
+	for i, imported := range imports {
+		results[i] = ImportResult{ProductID: imported.Product.ProductID, Action: ImportUpdated}
+		if !options.DryRun {
+			product := r.products[imported.Product.ProductID]
+			product.Name = imported.Product.Name
+			r.products[product.ProductID] = product
+		}
+	}
+	return results, nil
+}
+
+func TestCachedProductRepository(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingProductRepository{products: map[string]models.Product{
+		"p1": {ProductID: "p1", Name: "Keyboard", Price: 50},
+	}}
+	repo := NewCachedProductRepository(inner, cache.NewMemory(100), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if product, err := repo.GetProductById(ctx, "p1"); err != nil || product.Name != "Keyboard" {
+			t.Fatalf("Expected Keyboard, got %+v (%v)", product, err)
+		}
+		if products, err := repo.ListAllProducts(ctx); err != nil || len(products) != 1 {
+			t.Fatalf("Expected 1 product, got %v (%v)", products, err)
+		}
+	}
+	if inner.reads != 2 {
+		t.Errorf("Expected repeated reads to hit the cache, got %d loads", inner.reads)
+	}
+
+	if _, err := repo.UpdateProduct(ctx, models.Product{ProductID: "p1", Name: "Mechanical keyboard", Price: 80}); err != nil {
+		t.Fatal(err)
+	}
+	if product, _ := repo.GetProductById(ctx, "p1"); product.Name != "Mechanical keyboard" {
+		t.Errorf("Expected update to invalidate the product, got %q", product.Name)
+	}
+
+	if _, err := repo.PatchProduct(ctx, "p1", map[string]interface{}{"name": "Wireless keyboard"}); err != nil {
+		t.Fatal(err)
+	}
+	if products, _ := repo.ListAllProducts(ctx); products[0].Name != "Wireless keyboard" {
+		t.Errorf("Expected patch to invalidate the list, got %q", products[0].Name)
+	}
+
+	if _, err := repo.CreateProduct(ctx, models.Product{ProductID: "p2", Name: "Mouse"}); err != nil {
+		t.Fatal(err)
+	}
+	if products, _ := repo.ListAllProducts(ctx); len(products) != 2 {
+		t.Errorf("Expected create to invalidate the list, got %d products", len(products))
+	}
+
+	if err := repo.DeleteProduct(ctx, "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetProductById(ctx, "p1"); err == nil {
+		t.Error("Expected deleted product not to be served from the cache")
+	}
+	if products, _ := repo.ListAllProducts(ctx); len(products) != 1 {
+		t.Errorf("Expected delete to invalidate the list, got %d products", len(products))
+	}
+}
+
+func TestCachedProductRepositoryImages(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingProductRepository{products: map[string]models.Product{
+		"p1": {ProductID: "p1", Name: "Lamp"},
+	}}
+	repo := NewCachedProductRepository(inner, cache.NewMemory(100), time.Minute)
+
+	repo.GetProductById(ctx, "p1")
+	repo.ListAllProducts(ctx)
+	if _, err := repo.AddImage(ctx, models.ProductImage{ProductID: "p1", URL: "/uploads/products/lamp.png", IsPrimary: true}); err != nil {
+		t.Fatal(err)
+	}
+	if product, _ := repo.GetProductById(ctx, "p1"); product.ImageURL != "/uploads/products/lamp.png" {
+		t.Errorf("Expected a new primary image to invalidate the product, got %q", product.ImageURL)
+	}
+	if products, _ := repo.ListAllProducts(ctx); products[0].ImageURL != "/uploads/products/lamp.png" {
+		t.Errorf("Expected a new primary image to invalidate the list, got %q", products[0].ImageURL)
+	}
+}
+
+func TestCachedProductRepositoryImport(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingProductRepository{products: map[string]models.Product{
+		"p1": {ProductID: "p1", Name: "Lamp"},
+	}}
+	repo := NewCachedProductRepository(inner, cache.NewMemory(100), time.Minute)
+	imports := []ProductImport{{Product: models.Product{ProductID: "p1", Name: "Desk lamp"}, Fields: []string{"product_id", "name"}}}
+
+	repo.GetProductById(ctx, "p1")
+	repo.ListAllProducts(ctx)
+	if _, err := repo.ImportProducts(ctx, imports, ImportOptions{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	repo.GetProductById(ctx, "p1")
+	if inner.reads != 2 {
+		t.Errorf("Expected a dry run to keep the cache, got %d loads", inner.reads)
+	}
+
+	if _, err := repo.ImportProducts(ctx, imports, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if product, _ := repo.GetProductById(ctx, "p1"); product.Name != "Desk lamp" {
+		t.Errorf("Expected an import to invalidate the product, got %q", product.Name)
+	}
+	if products, _ := repo.ListAllProducts(ctx); products[0].Name != "Desk lamp" {
+		t.Errorf("Expected an import to invalidate the list, got %q", products[0].Name)
+	}
+}
+
+func TestCachedProductRepositoryIncludeDeleted(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingProductRepository{products: map[string]models.Product{
+		"p1": {ProductID: "p1", Name: "Keyboard", Price: 50},
+		"p2": {ProductID: "p2", Name: "Mouse", Price: 20},
+	}}
+	repo := NewCachedProductRepository(inner, cache.NewMemory(100), time.Minute)
+
+	if err := repo.DeleteProduct(ctx, "p2"); err != nil {
+		t.Fatal(err)
+	}
+	if products, _ := repo.ListAllProducts(ctx); len(products) != 1 {
+		t.Fatalf("Expected 1 live product, got %d", len(products))
+	}
+
+	// The admin view must not be served from, or written to, the cache
+	if products, _ := repo.ListAllProducts(db.IncludeDeleted(ctx)); len(products) != 2 {
+		t.Errorf("Expected include-deleted list to show 2 products, got %d", len(products))
+	}
+	if products, _ := repo.ListAllProducts(ctx); len(products) != 1 {
+		t.Errorf("Expected the cached list to still hide the deleted product, got %d", len(products))
+	}
+
+	if _, err := repo.RestoreProduct(ctx, "p2"); err != nil {
+		t.Fatal(err)
+	}
+	if products, _ := repo.ListAllProducts(ctx); len(products) != 2 {
+		t.Errorf("Expected restore to invalidate the list, got %d products", len(products))
+	}
+}
+
+func TestCachedProductRepositoryDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingProductRepository{products: map[string]models.Product{}}
+	repo := NewCachedProductRepository(inner, cache.NewMemory(100), time.Minute)
+
+	repo.GetProductById(ctx, "missing")
+	inner.products["missing"] = models.Product{ProductID: "missing", Name: "Created later"}
+
+	if product, err := repo.GetProductById(ctx, "missing"); err != nil || product.Name != "Created later" {
+		t.Errorf("Expected not-found result not to be cached, got %+v (%v)", product, err)
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// ProductFilter selects products by category and attribute values. A
+// product matches when its category is one of Categories, if any are
+// given, and each attribute named in Attributes has one of the values
+// listed for it.
+type ProductFilter struct {
+	Categories []string
+	Attributes map[string][]string
+}
+
+// IsEmpty reports whether the filter matches every product.
+func (f ProductFilter) IsEmpty() bool {
+	return len(f.Categories) == 0 && len(f.Attributes) == 0
+}
+
+// attributeNames returns the filtered attributes in a fixed order.
+func (f ProductFilter) attributeNames() []string {
+	names := make([]string, 0, len(f.Attributes))
+	for name := range f.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// where adds the filter's attribute conditions to tx, and its category
+// condition unless withoutCategory is set.
+func (f ProductFilter) where(tx *gorm.DB, withoutCategory bool) *gorm.DB {
+	if len(f.Categories) > 0 && !withoutCategory {
+		tx = tx.Where("products.category IN ?", f.Categories)
+	}
+	for _, name := range f.attributeNames() {
+		tx = tx.Where("products.attributes ->> ? IN ?", name, f.Attributes[name])
+	}
+	return tx
+}
+
+func (r *productRepository) FilterProducts(ctx context.Context, filter ProductFilter) ([]models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.FilterProducts")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	var products []models.Product
+	if err := filter.where(db.Scoped(ctx, r.db), false).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *productRepository) ProductFacets(ctx context.Context, filter ProductFilter) (models.ProductFacets, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ProductFacets")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	facets := models.ProductFacets{
+		Categories: []models.FacetValue{},
+		Attributes: map[string][]models.FacetValue{},
+	}
+
+	// Each field is counted under every condition except its own, so the
+	// other values of a field already filtered on can still be offered
+	err := filter.where(db.Scoped(ctx, r.db).Model(&models.Product{}), true).
+		Select("products.category AS value, COUNT(*) AS count").
+		Where("products.category <> ''").
+		Group("products.category").
+		Order("COUNT(*) DESC, products.category").
+		Scan(&facets.Categories).Error
+	if err != nil {
+		return models.ProductFacets{}, err
+	}
+
+	query := db.Scoped(ctx, r.db).Model(&models.Product{}).
+		Joins("CROSS JOIN LATERAL jsonb_each_text(products.attributes) AS attribute").
+		Select("attribute.key AS name, attribute.value AS value, COUNT(*) AS count")
+	if len(filter.Categories) > 0 {
+		query = query.Where("products.category IN ?", filter.Categories)
+	}
+	for _, name := range filter.attributeNames() {
+		query = query.Where("(attribute.key = ? OR products.attributes ->> ? IN ?)", name, name, filter.Attributes[name])
+	}
+	var counts []struct {
+		Name  string
+		Value string
+		Count int64
+	}
+	err = query.Group("attribute.key, attribute.value").
+		Order("attribute.key, COUNT(*) DESC, attribute.value").
+		Scan(&counts).Error
+	if err != nil {
+		return models.ProductFacets{}, err
+	}
+	for _, count := range counts {
+		facets.Attributes[count.Name] = append(facets.Attributes[count.Name], models.FacetValue{Value: count.Value, Count: count.Count})
+	}
+	return facets, nil
+}
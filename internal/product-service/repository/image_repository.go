@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *productRepository) ListImages(ctx context.Context, productID string) ([]models.ProductImage, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ListImages")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	var count int64
+	if err := db.Scoped(ctx, r.db).Model(&models.Product{}).Where("product_id = ?", productID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, errors.New("product not found")
+	}
+
+	images := []models.ProductImage{}
+	if err := db.Scoped(ctx, r.db).Where("product_id = ?", productID).Order("sort_order, created_at").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *productRepository) AddImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.AddImage")
+	defer span.End()
+
+	image.ImageID = uuid.New().String()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, image.ProductID); err != nil {
+			return err
+		}
+
+		var last struct {
+			Count     int64
+			SortOrder int
+		}
+		err := tx.Model(&models.ProductImage{}).
+			Select("COUNT(*) AS count, COALESCE(MAX(sort_order), -1) AS sort_order").
+			Where("product_id = ?", image.ProductID).
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		image.SortOrder = last.SortOrder + 1
+		image.IsPrimary = image.IsPrimary || last.Count == 0
+
+		if image.IsPrimary {
+			if err := clearPrimaryImage(tx, image.ProductID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&image).Error; err != nil {
+			return err
+		}
+		if image.IsPrimary {
+			return setProductImageURL(tx, image.ProductID, image.URL)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	return image, nil
+}
+
+func (r *productRepository) UpdateImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.UpdateImage")
+	defer span.End()
+
+	var updated models.ProductImage
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, image.ProductID); err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ? AND image_id = ?", image.ProductID, image.ImageID).First(&updated).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("image not found")
+			}
+			return err
+		}
+
+		changes := map[string]interface{}{
+			"alt_text":   image.AltText,
+			"sort_order": image.SortOrder,
+			"updated_at": time.Now(),
+		}
+		if image.IsPrimary && !updated.IsPrimary {
+			if err := clearPrimaryImage(tx, image.ProductID); err != nil {
+				return err
+			}
+			if err := setProductImageURL(tx, image.ProductID, updated.URL); err != nil {
+				return err
+			}
+			changes["is_primary"] = true
+		}
+		if err := tx.Model(&updated).UpdateColumns(changes).Error; err != nil {
+			return err
+		}
+		return tx.Where("image_id = ?", image.ImageID).First(&updated).Error
+	})
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	return updated, nil
+}
+
+func (r *productRepository) DeleteImage(ctx context.Context, productID, imageID string) (models.ProductImage, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.DeleteImage")
+	defer span.End()
+
+	var deleted models.ProductImage
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ? AND image_id = ?", productID, imageID).First(&deleted).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("image not found")
+			}
+			return err
+		}
+		if err := tx.Delete(&deleted).Error; err != nil {
+			return err
+		}
+		if !deleted.IsPrimary {
+			return nil
+		}
+
+		// The first remaining image takes over as primary
+		var next models.ProductImage
+		err := tx.Where("product_id = ?", productID).Order("sort_order, created_at").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return setProductImageURL(tx, productID, "")
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&next).UpdateColumn("is_primary", true).Error; err != nil {
+			return err
+		}
+		return setProductImageURL(tx, productID, next.URL)
+	})
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+	return deleted, nil
+}
+
+// lockProduct locks a product that isn't deleted against concurrent
+// gallery changes for the rest of tx.
+func lockProduct(tx *gorm.DB, productID string) error {
+	var product models.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("product_id").
+		Where("product_id = ?", productID).
+		First(&product).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("product not found")
+	}
+	return err
+}
+
+func clearPrimaryImage(tx *gorm.DB, productID string) error {
+	return tx.Model(&models.ProductImage{}).
+		Where("product_id = ? AND is_primary", productID).
+		UpdateColumn("is_primary", false).Error
+}
+
+// setProductImageURL keeps the product's image_url in step with its
+// primary image.
+func setProductImageURL(tx *gorm.DB, productID, url string) error {
+	return tx.Model(&models.Product{}).Where("product_id = ?", productID).UpdateColumn("image_url", url).Error
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProductImport is one product for ImportProducts to create or update.
+// A product with a ProductID is updated, or created with that id if there
+// is none. Otherwise the product with the same SKU is updated, or a new
+// product created.
+type ProductImport struct {
+	Product models.Product
+	// Fields are the columns given for the product, such as "name" or
+	// "attributes". An update only changes these.
+	Fields []string
+}
+
+// What ImportProducts did with a product.
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+)
+
+// ImportResult is the outcome of one ProductImport. Err is set, with a
+// message meant for the client, when the product couldn't be imported,
+// unless it wraps ErrImportFailed.
+type ImportResult struct {
+	ProductID string
+	Action    string
+	Err       error
+}
+
+// ImportOptions control how ImportProducts treats failures.
+type ImportOptions struct {
+	// Atomic imports nothing unless every product can be imported.
+	// Otherwise the products that can be imported are.
+	Atomic bool
+	// DryRun works out every result and then rolls the import back.
+	DryRun bool
+}
+
+// exportBatchSize is how many products ExportProducts reads per query.
+const exportBatchSize = 500
+
+// ErrImportFailed wraps errors, such as database errors, whose message
+// isn't meant for the client.
+var ErrImportFailed = errors.New("unable to import product")
+
+// errImportRolledBack rolls back an import's transaction.
+var errImportRolledBack = errors.New("import rolled back")
+
+func (r *productRepository) ImportProducts(ctx context.Context, imports []ProductImport, options ImportOptions) ([]ImportResult, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ImportProducts")
+	defer span.End()
+
+	results := make([]ImportResult, len(imports))
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		failed := false
+		for i, imported := range imports {
+			// A savepoint per product stops a failing statement from
+			// aborting the rest of the transaction
+			if err := tx.SavePoint("import_product").Error; err != nil {
+				return err
+			}
+			results[i] = importProduct(tx, imported)
+			if results[i].Err != nil {
+				failed = true
+				if err := tx.RollbackTo("import_product").Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec("RELEASE SAVEPOINT import_product").Error; err != nil {
+				return err
+			}
+		}
+		if options.DryRun || (options.Atomic && failed) {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportRolledBack) {
+		return nil, err
+	}
+	return results, nil
+}
+
+// importProduct creates or updates one product within tx.
+func importProduct(tx *gorm.DB, imported ProductImport) ImportResult {
+	product := imported.Product
+	// Imports never delete products
+	product.DeletedAt = gorm.DeletedAt{}
+	if product.Attributes == nil {
+		product.Attributes = db.StringMap{}
+	}
+
+	var existing models.Product
+	var err error
+	switch {
+	case product.ProductID != "":
+		err = tx.Unscoped().Where("product_id = ?", product.ProductID).First(&existing).Error
+		if err == nil && existing.DeletedAt.Valid {
+			return ImportResult{ProductID: product.ProductID, Err: errors.New("product is deleted; restore it before importing it")}
+		}
+	case product.SKU != "":
+		err = tx.Where("sku = ?", product.SKU).First(&existing).Error
+	default:
+		err = gorm.ErrRecordNotFound
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if product.Name == "" {
+			return ImportResult{ProductID: product.ProductID, Err: errors.New("name is required for new products")}
+		}
+		if !slices.Contains(imported.Fields, "price") {
+			return ImportResult{ProductID: product.ProductID, Err: errors.New("price is required for new products")}
+		}
+		if product.ProductID == "" {
+			product.ProductID = uuid.New().String()
+		}
+		if err := tx.Create(&product).Error; err != nil {
+			return ImportResult{ProductID: product.ProductID, Err: importError(err, product)}
+		}
+		return ImportResult{ProductID: product.ProductID, Action: ImportCreated}
+	}
+	if err != nil {
+		return ImportResult{ProductID: product.ProductID, Err: fmt.Errorf("%w: %w", ErrImportFailed, err)}
+	}
+
+	fields := slices.DeleteFunc(slices.Clone(imported.Fields), func(field string) bool {
+		return field == "product_id"
+	})
+	if len(fields) > 0 {
+		err := tx.Model(&models.Product{}).
+			Where("product_id = ?", existing.ProductID).
+			Select(fields).
+			Updates(&product).Error
+		if err != nil {
+			return ImportResult{ProductID: existing.ProductID, Err: importError(err, product)}
+		}
+	}
+	return ImportResult{ProductID: existing.ProductID, Action: ImportUpdated}
+}
+
+// importError reports a SKU another product already has as a conflict in
+// the product's result, and wraps any other error in ErrImportFailed.
+func importError(err error, product models.Product) error {
+	if isDuplicateKey(err) {
+		return fmt.Errorf("sku %s already belongs to another product", product.SKU)
+	}
+	return fmt.Errorf("%w: %w", ErrImportFailed, err)
+}
+
+func (r *productRepository) ExportProducts(ctx context.Context, fn func(models.Product) error) error {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ExportProducts")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	// Page by id rather than offset, so each batch is an index range scan
+	after := ""
+	for {
+		var batch []models.Product
+		err := db.Scoped(ctx, r.db).
+			Where("product_id > ?", after).
+			Order("product_id").
+			Limit(exportBatchSize).
+			Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		for _, product := range batch {
+			if err := fn(product); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].ProductID
+	}
+}
+
+func (r *productRepository) AttributeNames(ctx context.Context) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.AttributeNames")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	names := []string{}
+	err := db.Scoped(ctx, r.db).
+		Raw("SELECT DISTINCT jsonb_object_keys(attributes) AS name FROM products WHERE deleted_at IS NULL ORDER BY name").
+		Scan(&names).Error
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
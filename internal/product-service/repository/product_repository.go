@@ -1,25 +1,105 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
+	"gocart/pkg/tracing"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var tracer = tracing.Tracer("gocart/internal/product-service/repository")
+
 type ProductRepository interface {
-	ListAllProducts() ([]models.Product, error)
-	CreateProduct(product models.Product) (models.Product, error)
-	GetProductById(id string) (models.Product, error)
-	UpdateProduct(product models.Product) (models.Product, error)
-	DeleteProduct(id string) error
+	ListAllProducts(ctx context.Context) ([]models.Product, error)
+	CreateProduct(ctx context.Context, product models.Product) (models.Product, error)
+	GetProductById(ctx context.Context, id string) (models.Product, error)
+	// GetProductsByIds returns the products with the given IDs in one query,
+	// in the order requested. IDs that aren't found are left out.
+	GetProductsByIds(ctx context.Context, ids []string) ([]models.Product, error)
+	UpdateProduct(ctx context.Context, product models.Product) (models.Product, error)
+	// FilterProducts returns the products that match filter.
+	FilterProducts(ctx context.Context, filter ProductFilter) ([]models.Product, error)
+	// ProductFacets counts the products matching filter by category and
+	// attribute value. The counts for a field ignore the filter's own
+	// condition on that field.
+	ProductFacets(ctx context.Context, filter ProductFilter) (models.ProductFacets, error)
+	// PatchProduct sets the given columns, including zero values, and
+	// returns the updated product. An AttributeChanges value for
+	// "attributes" is merged into the product's attributes.
+	PatchProduct(ctx context.Context, id string, changes map[string]interface{}) (models.Product, error)
+	// DeleteProduct soft-deletes a product; it stays available to order
+	// history until purged.
+	DeleteProduct(ctx context.Context, id string) error
+	// RestoreProduct undoes DeleteProduct.
+	RestoreProduct(ctx context.Context, id string) (models.Product, error)
+	// PurgeDeleted permanently removes products deleted before the given
+	// time that no order item refers to.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+
+	// ListVariants returns a product's variants, or "product not found".
+	ListVariants(ctx context.Context, productID string) ([]models.ProductVariant, error)
+	GetVariant(ctx context.Context, productID, variantID string) (models.ProductVariant, error)
+	// CreateVariant adds a variant to a product that isn't deleted.
+	CreateVariant(ctx context.Context, variant models.ProductVariant) (models.ProductVariant, error)
+	// UpdateVariant replaces a variant's SKU, options, price, stock and
+	// image.
+	UpdateVariant(ctx context.Context, variant models.ProductVariant) (models.ProductVariant, error)
+	// DeleteVariant soft-deletes a variant.
+	DeleteVariant(ctx context.Context, productID, variantID string) error
+	// PurgeDeletedVariants permanently removes variants deleted before the
+	// given time that no order item refers to.
+	PurgeDeletedVariants(ctx context.Context, before time.Time) (int64, error)
+
+	// ListImages returns a product's gallery in sort order, or "product
+	// not found".
+	ListImages(ctx context.Context, productID string) ([]models.ProductImage, error)
+	// AddImage appends an image to a product's gallery. The first image,
+	// or one marked primary, becomes the primary image and the product's
+	// ImageURL.
+	AddImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error)
+	// UpdateImage sets an image's alt text and sort order, and makes it
+	// the primary image if it's marked primary.
+	UpdateImage(ctx context.Context, image models.ProductImage) (models.ProductImage, error)
+	// DeleteImage removes an image and returns it. Deleting the primary
+	// image promotes the next one in sort order.
+	DeleteImage(ctx context.Context, productID, imageID string) (models.ProductImage, error)
+
+	// CreateUpload records a slot for a direct upload, or returns "product
+	// not found".
+	CreateUpload(ctx context.Context, upload models.ProductUpload) (models.ProductUpload, error)
+	// GetUpload returns a product's upload slot, or "upload not found".
+	GetUpload(ctx context.Context, productID, uploadID string) (models.ProductUpload, error)
+	// DeleteUpload removes an upload slot, or returns "upload not found" if
+	// it is already gone, so only one caller can claim a slot.
+	DeleteUpload(ctx context.Context, uploadID string) error
+	// ListExpiredUploads returns up to limit slots that expired before the
+	// given time, oldest first.
+	ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]models.ProductUpload, error)
+
+	// ImportProducts creates or updates products in order and reports the
+	// outcome of each. It only returns an error if the import as a whole
+	// failed.
+	ImportProducts(ctx context.Context, imports []ProductImport, options ImportOptions) ([]ImportResult, error)
+	// ExportProducts calls fn for each product that isn't deleted, in id
+	// order, reading them in batches. It stops at the first error fn
+	// returns.
+	ExportProducts(ctx context.Context, fn func(models.Product) error) error
+	// AttributeNames returns the names of the attributes products have, in
+	// alphabetical order.
+	AttributeNames(ctx context.Context) ([]string, error)
 }
 
 /**
 Error Handling:
 	-GORM methods return a *gorm.DB object, which includes an Error field.
 	- This field will be populated with any error that occurs during the execution of the database operation.
-	- By checking err := db.DB.Method().Error, you can determine if the operation was successful or if an error occurred.
+	- By checking err := r.db.Method().Error, you can determine if the operation was successful or if an error occurred.
 Chaining:
 	- GORM allows method chaining, meaning you can call multiple methods in a single line.
 	- The .Error field provides a way to check for errors after executing a chain of methods.
@@ -36,37 +116,179 @@ func NewProductRepository(db *gorm.DB) ProductRepository {
 	}
 }
 
-func (r *productRepository) ListAllProducts() ([]models.Product, error) {
+func (r *productRepository) ListAllProducts(ctx context.Context) ([]models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ListAllProducts")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
 	var products []models.Product
-	if err := r.db.Find(&products).Error; err != nil {
+	if err := db.Scoped(ctx, r.db).Find(&products).Error; err != nil {
 		return nil, err
 	}
 	return products, nil
 }
 
-func (r *productRepository) CreateProduct(product models.Product) (models.Product, error) {
+func (r *productRepository) CreateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.CreateProduct")
+	defer span.End()
+
 	product.ProductID = uuid.New().String()
-	if err := r.db.Create(&product).Error; err != nil {
+	if err := r.db.WithContext(ctx).Create(&product).Error; err != nil {
+		return models.Product{}, productError(err)
+	}
+	return product, nil
+}
+
+func (r *productRepository) GetProductById(ctx context.Context, productId string) (models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.GetProductById")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	var product models.Product
+	if err := db.Scoped(ctx, r.db).Where("product_id = ?", productId).First(&product).Error; err != nil {
 		return models.Product{}, err
 	}
 	return product, nil
 }
 
-func (r *productRepository) GetProductById(productId string) (models.Product, error) {
+func (r *productRepository) GetProductsByIds(ctx context.Context, ids []string) ([]models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.GetProductsByIds")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	if len(ids) == 0 {
+		return []models.Product{}, nil
+	}
+	var found []models.Product
+	if err := db.Scoped(ctx, r.db).Where("product_id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.Product, len(found))
+	for _, product := range found {
+		byID[product.ProductID] = product
+	}
+	products := make([]models.Product, 0, len(found))
+	for _, id := range ids {
+		if product, ok := byID[id]; ok {
+			products = append(products, product)
+			delete(byID, id)
+		}
+	}
+	return products, nil
+}
+
+func (r *productRepository) UpdateProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.UpdateProduct")
+	defer span.End()
+
+	if err := r.db.WithContext(ctx).Model(&models.Product{}).Where("product_id = ?", product.ProductID).Updates(&product).Error; err != nil {
+		return models.Product{}, productError(err)
+	}
+	return product, nil
+}
+
+// AttributeChanges patches a product's attributes: Set adds or replaces
+// attributes and Remove deletes them.
+type AttributeChanges struct {
+	Set    db.StringMap
+	Remove []string
+}
+
+// expr returns the SQL that applies the changes to the attributes column.
+func (c AttributeChanges) expr() clause.Expr {
+	sql := "attributes || ?::jsonb"
+	args := []interface{}{c.Set}
+	for _, name := range c.Remove {
+		sql += " - ?::text"
+		args = append(args, name)
+	}
+	return gorm.Expr(sql, args...)
+}
+
+func (r *productRepository) PatchProduct(ctx context.Context, id string, changes map[string]interface{}) (models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.PatchProduct")
+	defer span.End()
+
+	if attributes, ok := changes["attributes"].(AttributeChanges); ok {
+		merged := make(map[string]interface{}, len(changes))
+		for column, value := range changes {
+			merged[column] = value
+		}
+		merged["attributes"] = attributes.expr()
+		changes = merged
+	}
+
 	var product models.Product
-	if err := r.db.Where("product_id = ?", productId).First(&product).Error; err != nil {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(changes) > 0 {
+			result := tx.Model(&models.Product{}).Where("product_id = ?", id).UpdateColumns(changes)
+			if result.Error != nil {
+				return productError(result.Error)
+			}
+		}
+		if err := tx.Where("product_id = ?", id).First(&product).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
 		return models.Product{}, err
 	}
 	return product, nil
 }
 
-func (r *productRepository) UpdateProduct(product models.Product) (models.Product, error) {
-	if err := r.db.Model(&models.Product{}).Where("product_id = ?", product.ProductID).Updates(&product).Error; err != nil {
+func (r *productRepository) DeleteProduct(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "ProductRepository.DeleteProduct")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Delete(&models.Product{}, "product_id = ?", id).Error
+}
+
+func (r *productRepository) RestoreProduct(ctx context.Context, id string) (models.Product, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.RestoreProduct")
+	defer span.End()
+
+	var product models.Product
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Product{}).
+			Where("product_id = ? AND deleted_at IS NOT NULL", id).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return productError(err)
+		}
+		if err := tx.Where("product_id = ?", id).First(&product).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
 		return models.Product{}, err
 	}
 	return product, nil
 }
 
-func (r *productRepository) DeleteProduct(id string) error {
-	return r.db.Delete(&models.Product{}, "product_id = ?", id).Error
+// productError turns a duplicate SKU error into one handlers can report.
+func productError(err error) error {
+	if isDuplicateKey(err) {
+		return errors.New("product with this SKU already exists")
+	}
+	return err
+}
+
+func (r *productRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.PurgeDeleted")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.product_id = products.product_id)").
+		Delete(&models.Product{})
+	return result.RowsAffected, result.Error
 }
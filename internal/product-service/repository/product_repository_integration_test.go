@@ -1,12 +1,18 @@
 package repository
 
 import (
+	"context"
 	"fmt"
+	orderModels "gocart/internal/order-management-service/models"
 	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
 	"gocart/pkg/testutils"
 	"log"
 	"os"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -15,7 +21,8 @@ import (
 func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 	config := testutils.TestDBConfig{
 		ServiceName: "products_repo",
-		Models:      []interface{}{&models.Product{}},
+		// Orders are migrated so purge can check which products they hold
+		Models: []interface{}{&models.Product{}, &models.ProductVariant{}, &models.ProductImage{}, &models.ProductUpload{}, &orderModels.Order{}, &orderModels.OrderItem{}},
 	}
 	return testutils.SetupTestDB(t, config)
 }
@@ -38,14 +45,14 @@ func TestListAllProducts(t *testing.T) {
 			Price:       float64(i) * 29.99,
 		}
 		logger.Printf("Creating test product: %s", product.Name)
-		_, err := repo.CreateProduct(product)
+		_, err := repo.CreateProduct(context.Background(), product)
 		if err != nil {
 			t.Fatalf("Failed to create product %s: %v", product.Name, err)
 		}
 	}
 
 	logger.Printf("Listing all products currently in db")
-	products, err := repo.ListAllProducts()
+	products, err := repo.ListAllProducts(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to list all products: %v", err)
 	}
@@ -74,7 +81,7 @@ func TestUpdateProductIntegration(t *testing.T) {
 	}
 
 	logger.Printf("Creating test product with ID: %s", testProduct.ProductID)
-	createdProduct, err := repo.CreateProduct(testProduct)
+	createdProduct, err := repo.CreateProduct(context.Background(), testProduct)
 	if err != nil {
 		t.Fatalf("Failed to create test product: %v", err)
 	}
@@ -88,7 +95,7 @@ func TestUpdateProductIntegration(t *testing.T) {
 	}
 
 	logger.Printf("Updating test product with ID: %s", updatedProduct.ProductID)
-	updated, err := repo.UpdateProduct(updatedProduct)
+	updated, err := repo.UpdateProduct(context.Background(), updatedProduct)
 	if err != nil {
 		t.Fatalf("Failed to update test product: %v", err)
 	}
@@ -114,14 +121,14 @@ func TestCreateAndDeleteProductIntegration(t *testing.T) {
 	}
 
 	logger.Printf("Creating test product with ID: %s", testProduct.ProductID)
-	createdProduct, err := repo.CreateProduct(testProduct)
+	createdProduct, err := repo.CreateProduct(context.Background(), testProduct)
 	if err != nil {
 		t.Fatalf("Failed to create test product: %v", err)
 	}
 	logger.Printf("Successfully created test product: %+v", createdProduct)
 
 	logger.Printf("Verifying product creation...")
-	fetchedProduct, err := repo.GetProductById(createdProduct.ProductID)
+	fetchedProduct, err := repo.GetProductById(context.Background(), createdProduct.ProductID)
 	if err != nil {
 		t.Fatalf("Failed to fetch created product: %v", err)
 	}
@@ -131,14 +138,14 @@ func TestCreateAndDeleteProductIntegration(t *testing.T) {
 	logger.Printf("Successfully fetched product: %+v", fetchedProduct)
 
 	logger.Printf("Attempting to delete product with ID: %s", createdProduct.ProductID)
-	err = repo.DeleteProduct(createdProduct.ProductID)
+	err = repo.DeleteProduct(context.Background(), createdProduct.ProductID)
 	if err != nil {
 		t.Errorf("Failed to delete product: %v", err)
 	}
 	logger.Println("Successfully deleted product")
 
 	logger.Printf("Verifying product deletion...")
-	_, err = repo.GetProductById(createdProduct.ProductID)
+	_, err = repo.GetProductById(context.Background(), createdProduct.ProductID)
 	if err == nil {
 		t.Error("Expected error when fetching deleted product, got nil")
 	} else {
@@ -147,3 +154,526 @@ func TestCreateAndDeleteProductIntegration(t *testing.T) {
 
 	logger.Println("Create and delete a product test completed successfully")
 }
+
+func TestPatchProductIntegration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(db)
+	ctx := context.Background()
+
+	created, err := repo.CreateProduct(ctx, models.Product{
+		Name:        "Mug",
+		Description: "Holds coffee",
+		Price:       12.5,
+		Category:    "Kitchen",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	patched, err := repo.PatchProduct(ctx, created.ProductID, map[string]interface{}{"description": "", "price": 0.0})
+	if err != nil {
+		t.Fatalf("Failed to patch product: %v", err)
+	}
+	if patched.Description != "" || patched.Price != 0 || patched.Name != "Mug" || patched.Category != "Kitchen" {
+		t.Errorf("Expected description and price cleared and other fields kept, got %+v", patched)
+	}
+
+	if _, err := repo.PatchProduct(ctx, "missing-product", map[string]interface{}{"name": "Cup"}); err == nil || err.Error() != "product not found" {
+		t.Errorf("Expected product not found, got %v", err)
+	}
+}
+
+func TestSoftDeleteProductIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	kept, err := repo.CreateProduct(ctx, models.Product{ProductID: uuid.New().String(), Name: "Kept", Price: 10})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	ordered, err := repo.CreateProduct(ctx, models.Product{ProductID: uuid.New().String(), Name: "Ordered", Price: 20})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	unordered, err := repo.CreateProduct(ctx, models.Product{ProductID: uuid.New().String(), Name: "Unordered", Price: 30})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	order := orderModels.Order{
+		OrderID: uuid.New().String(), UserID: "user-1", Status: "Pending", TotalAmount: 20,
+		CreatedAt: time.Now(), UpdatedAt: time.Now(),
+		Items: []orderModels.OrderItem{{
+			OrderItemID: uuid.New().String(), ProductID: ordered.ProductID, Quantity: 1, Price: 20,
+			CreatedAt: time.Now(), UpdatedAt: time.Now(),
+		}},
+	}
+	if err := gormDB.Create(&order).Error; err != nil {
+		t.Fatalf("Failed to create test order: %v", err)
+	}
+
+	for _, id := range []string{ordered.ProductID, unordered.ProductID} {
+		if err := repo.DeleteProduct(ctx, id); err != nil {
+			t.Fatalf("Failed to delete product: %v", err)
+		}
+	}
+
+	products, err := repo.ListAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 1 || products[0].ProductID != kept.ProductID {
+		t.Errorf("Expected only the kept product, got %+v", products)
+	}
+	products, err = repo.ListAllProducts(db.IncludeDeleted(ctx))
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 3 {
+		t.Errorf("Expected 3 products including deleted ones, got %d", len(products))
+	}
+
+	restored, err := repo.RestoreProduct(ctx, unordered.ProductID)
+	if err != nil {
+		t.Fatalf("Failed to restore product: %v", err)
+	}
+	if restored.DeletedAt.Valid {
+		t.Errorf("Expected restored product to have no deleted_at, got %v", restored.DeletedAt)
+	}
+	if _, err := repo.RestoreProduct(ctx, "missing-product"); err == nil || err.Error() != "product not found" {
+		t.Errorf("Expected product not found, got %v", err)
+	}
+
+	// The ordered product is past retention but still referenced
+	if err := repo.DeleteProduct(ctx, unordered.ProductID); err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+	purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to purge products: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 product purged, got %d", purged)
+	}
+	if _, err := repo.GetProductById(db.IncludeDeleted(ctx), ordered.ProductID); err != nil {
+		t.Errorf("Expected the ordered product to survive the purge, got %v", err)
+	}
+	if _, err := repo.GetProductById(db.IncludeDeleted(ctx), unordered.ProductID); err == nil {
+		t.Error("Expected the unordered product to be purged")
+	}
+}
+
+func TestGetProductsByIdsIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	var ids []string
+	for _, name := range []string{"Pen", "Pencil", "Eraser"} {
+		product, err := repo.CreateProduct(ctx, models.Product{Name: name, Price: 1})
+		if err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+		ids = append(ids, product.ProductID)
+	}
+	if err := repo.DeleteProduct(ctx, ids[2]); err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	products, err := repo.GetProductsByIds(ctx, []string{ids[1], "missing-product", ids[0], ids[2], ids[1]})
+	if err != nil {
+		t.Fatalf("Failed to get products: %v", err)
+	}
+	if len(products) != 2 || products[0].ProductID != ids[1] || products[1].ProductID != ids[0] {
+		t.Errorf("Expected Pencil then Pen, got %+v", products)
+	}
+
+	if products, _ := repo.GetProductsByIds(db.IncludeDeleted(ctx), []string{ids[2]}); len(products) != 1 {
+		t.Errorf("Expected the deleted product when including deleted ones, got %+v", products)
+	}
+	if products, err := repo.GetProductsByIds(ctx, nil); err != nil || len(products) != 0 {
+		t.Errorf("Expected no products for no IDs, got %+v (%v)", products, err)
+	}
+}
+
+func TestProductVariantsIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	product, err := repo.CreateProduct(ctx, models.Product{Name: "T-Shirt", Price: 20})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	price := 22.5
+	large, err := repo.CreateVariant(ctx, models.ProductVariant{
+		ProductID: product.ProductID, SKU: "TEE-L", Options: db.StringMap{"size": "L"}, Price: &price, Stock: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+	medium, err := repo.CreateVariant(ctx, models.ProductVariant{ProductID: product.ProductID, SKU: "TEE-M", Options: db.StringMap{"size": "M"}})
+	if err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+
+	if _, err := repo.CreateVariant(ctx, models.ProductVariant{ProductID: product.ProductID, SKU: "TEE-L"}); err == nil || err.Error() != "variant with this SKU already exists" {
+		t.Errorf("Expected a duplicate SKU error, got %v", err)
+	}
+	if _, err := repo.CreateVariant(ctx, models.ProductVariant{ProductID: "missing-product", SKU: "TEE-S"}); err == nil || err.Error() != "product not found" {
+		t.Errorf("Expected product not found, got %v", err)
+	}
+
+	fetched, err := repo.GetVariant(ctx, product.ProductID, large.VariantID)
+	if err != nil {
+		t.Fatalf("Failed to get variant: %v", err)
+	}
+	if fetched.Options["size"] != "L" || fetched.Price == nil || *fetched.Price != 22.5 || fetched.Stock != 3 {
+		t.Errorf("Expected the variant as created, got %+v", fetched)
+	}
+	if _, err := repo.GetVariant(ctx, "other-product", large.VariantID); err == nil || err.Error() != "variant not found" {
+		t.Errorf("Expected variants to be looked up under their product, got %v", err)
+	}
+
+	medium.Options = db.StringMap{"size": "M", "fit": "slim"}
+	medium.Stock = 7
+	updated, err := repo.UpdateVariant(ctx, medium)
+	if err != nil {
+		t.Fatalf("Failed to update variant: %v", err)
+	}
+	if updated.Options["fit"] != "slim" || updated.Stock != 7 || updated.Price != nil {
+		t.Errorf("Expected the variant to be replaced, got %+v", updated)
+	}
+
+	if err := repo.DeleteVariant(ctx, product.ProductID, large.VariantID); err != nil {
+		t.Fatalf("Failed to delete variant: %v", err)
+	}
+	variants, err := repo.ListVariants(ctx, product.ProductID)
+	if err != nil {
+		t.Fatalf("Failed to list variants: %v", err)
+	}
+	if len(variants) != 1 || variants[0].VariantID != medium.VariantID {
+		t.Errorf("Expected only the medium variant, got %+v", variants)
+	}
+	if _, err := repo.ListVariants(ctx, "missing-product"); err == nil || err.Error() != "product not found" {
+		t.Errorf("Expected product not found, got %v", err)
+	}
+
+	// A deleted variant's SKU can be reused
+	if _, err := repo.CreateVariant(ctx, models.ProductVariant{ProductID: product.ProductID, SKU: "TEE-L"}); err != nil {
+		t.Errorf("Expected the deleted variant's SKU to be free, got %v", err)
+	}
+	purged, err := repo.PurgeDeletedVariants(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to purge variants: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 variant purged, got %d", purged)
+	}
+}
+
+func TestProductFacetsIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	products := []models.Product{
+		{Name: "XPS 15", Price: 1500, Category: "Laptops", Attributes: db.StringMap{"brand": "Dell", "material": "Aluminum"}},
+		{Name: "XPS 13", Price: 1100, Category: "Laptops", Attributes: db.StringMap{"brand": "Dell", "material": "Carbon fiber"}},
+		{Name: "Spectre", Price: 1400, Category: "Laptops", Attributes: db.StringMap{"brand": "HP", "material": "Aluminum"}},
+		{Name: "Pixel", Price: 900, Category: "Smartphones", Attributes: db.StringMap{"brand": "Google", "material": "Aluminum"}},
+		{Name: "Deleted", Price: 1, Category: "Laptops", Attributes: db.StringMap{"brand": "Dell"}},
+	}
+	for i := range products {
+		created, err := repo.CreateProduct(ctx, products[i])
+		if err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+		products[i] = created
+	}
+	if err := repo.DeleteProduct(ctx, products[4].ProductID); err != nil {
+		t.Fatalf("Failed to delete product: %v", err)
+	}
+
+	filter := ProductFilter{Categories: []string{"Laptops"}, Attributes: map[string][]string{"brand": {"Dell"}}}
+	filtered, err := repo.FilterProducts(ctx, filter)
+	if err != nil {
+		t.Fatalf("Failed to filter products: %v", err)
+	}
+	if len(filtered) != 2 {
+		t.Errorf("Expected the 2 Dell laptops, got %+v", filtered)
+	}
+
+	facets, err := repo.ProductFacets(ctx, filter)
+	if err != nil {
+		t.Fatalf("Failed to count facets: %v", err)
+	}
+	// Categories are counted among Dell products, brands among laptops and
+	// materials among Dell laptops
+	expected := models.ProductFacets{
+		Categories: []models.FacetValue{{Value: "Laptops", Count: 2}},
+		Attributes: map[string][]models.FacetValue{
+			"brand":    {{Value: "Dell", Count: 2}, {Value: "HP", Count: 1}},
+			"material": {{Value: "Aluminum", Count: 1}, {Value: "Carbon fiber", Count: 1}},
+		},
+	}
+	if !reflect.DeepEqual(facets, expected) {
+		t.Errorf("Expected facets %+v, got %+v", expected, facets)
+	}
+
+	patched, err := repo.PatchProduct(ctx, products[0].ProductID, map[string]interface{}{
+		"attributes": AttributeChanges{Set: db.StringMap{"weight": "1.9 kg"}, Remove: []string{"material"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to patch attributes: %v", err)
+	}
+	if !reflect.DeepEqual(patched.Attributes, db.StringMap{"brand": "Dell", "weight": "1.9 kg"}) {
+		t.Errorf("Expected the attributes to be merged, got %v", patched.Attributes)
+	}
+}
+
+func TestProductImagesIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	product, err := repo.CreateProduct(ctx, models.Product{Name: "Lamp", Price: 40})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	// The first image becomes primary even when not asked to
+	front, err := repo.AddImage(ctx, models.ProductImage{ProductID: product.ProductID, URL: "/uploads/products/front.png"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	side, err := repo.AddImage(ctx, models.ProductImage{ProductID: product.ProductID, URL: "/uploads/products/side.png", AltText: "Side"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	if !front.IsPrimary || side.IsPrimary || front.SortOrder != 0 || side.SortOrder != 1 {
+		t.Errorf("Expected the first image to be primary and images appended in order, got %+v and %+v", front, side)
+	}
+	if _, err := repo.AddImage(ctx, models.ProductImage{ProductID: "missing-product", URL: "/x.png"}); err == nil || err.Error() != "product not found" {
+		t.Errorf("Expected product not found, got %v", err)
+	}
+
+	back, err := repo.AddImage(ctx, models.ProductImage{ProductID: product.ProductID, URL: "/uploads/products/back.png", IsPrimary: true})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	fetched, _ := repo.GetProductById(ctx, product.ProductID)
+	if fetched.ImageURL != back.URL {
+		t.Errorf("Expected a new primary image to become the product image, got %q", fetched.ImageURL)
+	}
+
+	side.IsPrimary = true
+	side.SortOrder = -1
+	if _, err := repo.UpdateImage(ctx, side); err != nil {
+		t.Fatalf("Failed to update image: %v", err)
+	}
+	images, err := repo.ListImages(ctx, product.ProductID)
+	if err != nil {
+		t.Fatalf("Failed to list images: %v", err)
+	}
+	primaries := 0
+	for _, image := range images {
+		if image.IsPrimary {
+			primaries++
+		}
+	}
+	if len(images) != 3 || images[0].ImageID != side.ImageID || !images[0].IsPrimary || primaries != 1 {
+		t.Errorf("Expected the side image first and the only primary, got %+v", images)
+	}
+	if _, err := repo.UpdateImage(ctx, models.ProductImage{ProductID: product.ProductID, ImageID: "missing-image"}); err == nil || err.Error() != "image not found" {
+		t.Errorf("Expected image not found, got %v", err)
+	}
+
+	// Deleting the primary image promotes the next one in sort order
+	if _, err := repo.DeleteImage(ctx, product.ProductID, side.ImageID); err != nil {
+		t.Fatalf("Failed to delete image: %v", err)
+	}
+	images, _ = repo.ListImages(ctx, product.ProductID)
+	fetched, _ = repo.GetProductById(ctx, product.ProductID)
+	if len(images) != 2 || images[0].ImageID != front.ImageID || !images[0].IsPrimary || fetched.ImageURL != front.URL {
+		t.Errorf("Expected the front image to be promoted, got %+v and image_url %q", images, fetched.ImageURL)
+	}
+
+	for _, image := range images {
+		if _, err := repo.DeleteImage(ctx, product.ProductID, image.ImageID); err != nil {
+			t.Fatalf("Failed to delete image: %v", err)
+		}
+	}
+	fetched, _ = repo.GetProductById(ctx, product.ProductID)
+	if fetched.ImageURL != "" {
+		t.Errorf("Expected the product image to be cleared with the last image, got %q", fetched.ImageURL)
+	}
+}
+
+func TestProductUploadsIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	product, err := repo.CreateProduct(ctx, models.Product{Name: "Rug", Price: 120})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	now := time.Now()
+	expired, err := repo.CreateUpload(ctx, models.ProductUpload{
+		UploadID: "u1", ProductID: product.ProductID, Key: "pending/u1", ContentType: "image/png", Size: 10, ExpiresAt: now.Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create upload: %v", err)
+	}
+	if _, err := repo.CreateUpload(ctx, models.ProductUpload{
+		UploadID: "u2", ProductID: product.ProductID, Key: "pending/u2", ContentType: "image/png", Size: 10, ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("Failed to create upload: %v", err)
+	}
+	if _, err := repo.CreateUpload(ctx, models.ProductUpload{UploadID: "u3", ProductID: "missing-product", ExpiresAt: now}); err == nil || err.Error() != "product not found" {
+		t.Errorf("Expected product not found, got %v", err)
+	}
+
+	fetched, err := repo.GetUpload(ctx, product.ProductID, "u1")
+	if err != nil || fetched.Key != expired.Key {
+		t.Errorf("Expected to fetch the upload, got %+v (%v)", fetched, err)
+	}
+	if _, err := repo.GetUpload(ctx, "other-product", "u1"); err == nil || err.Error() != "upload not found" {
+		t.Errorf("Expected upload not found for another product, got %v", err)
+	}
+
+	uploads, err := repo.ListExpiredUploads(ctx, now, 10)
+	if err != nil || len(uploads) != 1 || uploads[0].UploadID != "u1" {
+		t.Errorf("Expected only the expired upload, got %+v (%v)", uploads, err)
+	}
+
+	// Only the first delete claims the upload
+	if err := repo.DeleteUpload(ctx, "u1"); err != nil {
+		t.Fatalf("Failed to delete upload: %v", err)
+	}
+	if err := repo.DeleteUpload(ctx, "u1"); err == nil || err.Error() != "upload not found" {
+		t.Errorf("Expected upload not found, got %v", err)
+	}
+}
+
+func TestProductImportIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewProductRepository(gormDB)
+	ctx := context.Background()
+
+	anvil, err := repo.CreateProduct(ctx, models.Product{Name: "Anvil", Price: 50, SKU: "A1", Category: "Tools"})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	bucket, err := repo.CreateProduct(ctx, models.Product{Name: "Bucket", Price: 5})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	deleted, err := repo.CreateProduct(ctx, models.Product{Name: "Crate", Price: 9})
+	if err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	if err := repo.DeleteProduct(ctx, deleted.ProductID); err != nil {
+		t.Fatalf("Failed to delete test product: %v", err)
+	}
+
+	imports := []ProductImport{
+		// By SKU, changing only the price
+		{Product: models.Product{SKU: "A1", Price: 45}, Fields: []string{"sku", "price"}},
+		// By id
+		{Product: models.Product{ProductID: bucket.ProductID, Name: "Pail", Attributes: db.StringMap{"color": "Red"}}, Fields: []string{"product_id", "name", "attributes"}},
+		// New, with and without an id
+		{Product: models.Product{ProductID: "imported-drill", Name: "Drill", Price: 80}, Fields: []string{"product_id", "name", "price"}},
+		{Product: models.Product{SKU: "E5", Name: "Easel", Price: 30}, Fields: []string{"sku", "name", "price"}},
+		// Failures
+		{Product: models.Product{SKU: "F6", Price: 1}, Fields: []string{"sku", "price"}},
+		{Product: models.Product{ProductID: deleted.ProductID, Price: 1}, Fields: []string{"product_id", "price"}},
+		{Product: models.Product{ProductID: "imported-saw", SKU: "A1", Name: "Saw", Price: 20}, Fields: []string{"product_id", "sku", "name", "price"}},
+		{Product: models.Product{SKU: "G7", Name: "Gauge"}, Fields: []string{"sku", "name"}},
+	}
+	expectedActions := []string{ImportUpdated, ImportUpdated, ImportCreated, ImportCreated, "", "", "", ""}
+	checkResults := func(results []ImportResult) {
+		t.Helper()
+		for i, result := range results {
+			if result.Action != expectedActions[i] || (result.Err != nil) != (expectedActions[i] == "") {
+				t.Errorf("Expected product %d to be %q, got %+v", i, expectedActions[i], result)
+			}
+		}
+	}
+
+	// Neither a dry run nor a failed atomic import changes anything
+	for _, options := range []ImportOptions{{DryRun: true}, {Atomic: true}} {
+		results, err := repo.ImportProducts(ctx, imports, options)
+		if err != nil || len(results) != len(imports) {
+			t.Fatalf("Failed to import products with %+v: %v", options, err)
+		}
+		checkResults(results)
+		products, err := repo.ListAllProducts(ctx)
+		if err != nil || len(products) != 2 {
+			t.Errorf("Expected the import with %+v to be rolled back, got %+v (%v)", options, products, err)
+		}
+	}
+
+	results, err := repo.ImportProducts(ctx, imports, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to import products: %v", err)
+	}
+	checkResults(results)
+
+	updated, _ := repo.GetProductById(ctx, anvil.ProductID)
+	if updated.Price != 45 || updated.Name != "Anvil" || updated.Category != "Tools" {
+		t.Errorf("Expected only the price to change, got %+v", updated)
+	}
+	renamed, _ := repo.GetProductById(ctx, bucket.ProductID)
+	if renamed.Name != "Pail" || renamed.Price != 5 || renamed.Attributes["color"] != "Red" {
+		t.Errorf("Expected the name and attributes to change, got %+v", renamed)
+	}
+	if drill, err := repo.GetProductById(ctx, "imported-drill"); err != nil || drill.Price != 80 {
+		t.Errorf("Expected the drill to be created with its id, got %+v (%v)", drill, err)
+	}
+	if results[3].ProductID == "" {
+		t.Errorf("Expected the easel to get an id, got %+v", results[3])
+	}
+	if err := results[6].Err; err == nil || err.Error() != "sku A1 already belongs to another product" {
+		t.Errorf("Expected the saw's SKU to conflict, got %v", err)
+	}
+	if err := results[7].Err; err == nil || err.Error() != "price is required for new products" {
+		t.Errorf("Expected the gauge to need a price, got %v", err)
+	}
+	if _, err := repo.CreateProduct(ctx, models.Product{Name: "Easel", Price: 30, SKU: "E5"}); err == nil || err.Error() != "product with this SKU already exists" {
+		t.Errorf("Expected a duplicate SKU error, got %v", err)
+	}
+
+	// Exports come in id order, without the deleted product
+	var exported []string
+	err = repo.ExportProducts(ctx, func(product models.Product) error {
+		exported = append(exported, product.ProductID)
+		return nil
+	})
+	if err != nil || len(exported) != 4 || !slices.IsSorted(exported) || slices.Contains(exported, deleted.ProductID) {
+		t.Errorf("Expected the four products in id order, got %v (%v)", exported, err)
+	}
+
+	names, err := repo.AttributeNames(ctx)
+	if err != nil || !reflect.DeepEqual(names, []string{"color"}) {
+		t.Errorf("Expected the attributes in use, got %v (%v)", names, err)
+	}
+}
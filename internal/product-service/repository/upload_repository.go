@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r *productRepository) CreateUpload(ctx context.Context, upload models.ProductUpload) (models.ProductUpload, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.CreateUpload")
+	defer span.End()
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, upload.ProductID); err != nil {
+			return err
+		}
+		return tx.Create(&upload).Error
+	})
+	if err != nil {
+		return models.ProductUpload{}, err
+	}
+	return upload, nil
+}
+
+func (r *productRepository) GetUpload(ctx context.Context, productID, uploadID string) (models.ProductUpload, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.GetUpload")
+	defer span.End()
+
+	// Read from the primary: the slot was usually created moments ago
+	var upload models.ProductUpload
+	err := r.db.WithContext(ctx).Where("product_id = ? AND upload_id = ?", productID, uploadID).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.ProductUpload{}, errors.New("upload not found")
+	}
+	if err != nil {
+		return models.ProductUpload{}, err
+	}
+	return upload, nil
+}
+
+func (r *productRepository) DeleteUpload(ctx context.Context, uploadID string) error {
+	ctx, span := tracer.Start(ctx, "ProductRepository.DeleteUpload")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Where("upload_id = ?", uploadID).Delete(&models.ProductUpload{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("upload not found")
+	}
+	return nil
+}
+
+func (r *productRepository) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]models.ProductUpload, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ListExpiredUploads")
+	defer span.End()
+
+	uploads := []models.ProductUpload{}
+	err := db.Scoped(ctx, r.db).Where("expires_at < ?", before).Order("expires_at").Limit(limit).Find(&uploads).Error
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
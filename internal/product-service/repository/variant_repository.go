@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gocart/internal/product-service/models"
+	"gocart/pkg/db"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *productRepository) ListVariants(ctx context.Context, productID string) ([]models.ProductVariant, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.ListVariants")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	var count int64
+	if err := db.Scoped(ctx, r.db).Model(&models.Product{}).Where("product_id = ?", productID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, errors.New("product not found")
+	}
+
+	variants := []models.ProductVariant{}
+	if err := db.Scoped(ctx, r.db).Where("product_id = ?", productID).Order("created_at, sku").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+func (r *productRepository) GetVariant(ctx context.Context, productID, variantID string) (models.ProductVariant, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.GetVariant")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
+	var variant models.ProductVariant
+	if err := db.Scoped(ctx, r.db).Where("product_id = ? AND variant_id = ?", productID, variantID).First(&variant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.ProductVariant{}, errors.New("variant not found")
+		}
+		return models.ProductVariant{}, err
+	}
+	return variant, nil
+}
+
+func (r *productRepository) CreateVariant(ctx context.Context, variant models.ProductVariant) (models.ProductVariant, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.CreateVariant")
+	defer span.End()
+
+	variant.VariantID = uuid.New().String()
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the product so it can't be deleted before the variant exists
+		var product models.Product
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+			Select("product_id").
+			Where("product_id = ?", variant.ProductID).
+			First(&product).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return err
+		}
+		return tx.Create(&variant).Error
+	})
+	if err != nil {
+		return models.ProductVariant{}, variantError(err)
+	}
+	return variant, nil
+}
+
+func (r *productRepository) UpdateVariant(ctx context.Context, variant models.ProductVariant) (models.ProductVariant, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.UpdateVariant")
+	defer span.End()
+
+	var updated models.ProductVariant
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ProductVariant{}).
+			Where("product_id = ? AND variant_id = ?", variant.ProductID, variant.VariantID).
+			UpdateColumns(map[string]interface{}{
+				"sku":        variant.SKU,
+				"options":    variant.Options,
+				"price":      variant.Price,
+				"stock":      variant.Stock,
+				"image_url":  variant.ImageURL,
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("variant not found")
+		}
+		return tx.Where("variant_id = ?", variant.VariantID).First(&updated).Error
+	})
+	if err != nil {
+		return models.ProductVariant{}, variantError(err)
+	}
+	return updated, nil
+}
+
+func (r *productRepository) DeleteVariant(ctx context.Context, productID, variantID string) error {
+	ctx, span := tracer.Start(ctx, "ProductRepository.DeleteVariant")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Where("product_id = ? AND variant_id = ?", productID, variantID).Delete(&models.ProductVariant{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("variant not found")
+	}
+	return nil
+}
+
+func (r *productRepository) PurgeDeletedVariants(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "ProductRepository.PurgeDeletedVariants")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.variant_id = product_variants.variant_id)").
+		Delete(&models.ProductVariant{})
+	return result.RowsAffected, result.Error
+}
+
+// variantError turns a duplicate SKU error into one handlers can report.
+func variantError(err error) error {
+	if isDuplicateKey(err) {
+		return errors.New("variant with this SKU already exists")
+	}
+	return err
+}
+
+// isDuplicateKey reports whether err is a unique constraint violation.
+func isDuplicateKey(err error) bool {
+	return strings.Contains(err.Error(), "duplicate key") ||
+		strings.Contains(err.Error(), "UNIQUE constraint failed") ||
+		strings.Contains(err.Error(), "duplicate entry")
+}
@@ -3,20 +3,30 @@ package server
 
 import (
 	"gocart/internal/product-service/handler"
+	"gocart/pkg/auth"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	handler *handler.ProductHandler
-	router  *mux.Router
+	handler      *handler.ProductHandler
+	router       *mux.Router
+	requireAdmin func(http.Handler) http.Handler
 }
 
+// NewServer returns a server whose admin endpoints refuse every request.
 func NewServer(handler *handler.ProductHandler) *Server {
+	return NewServerWithAdmin(handler, auth.RequireAdmin(""))
+}
+
+// NewServerWithAdmin returns a server that guards admin endpoints with
+// requireAdmin.
+func NewServerWithAdmin(handler *handler.ProductHandler, requireAdmin func(http.Handler) http.Handler) *Server {
 	s := &Server{
-		handler: handler,
-		router:  mux.NewRouter(),
+		handler:      handler,
+		router:       mux.NewRouter(),
+		requireAdmin: requireAdmin,
 	}
 	s.setupRoutes()
 	return s
@@ -27,12 +37,34 @@ func (s *Server) GetRouter() *mux.Router {
 }
 
 func (s *Server) setupRoutes() {
+	// Any include_deleted query takes the admin route, so only admins see
+	// deleted products
+	s.router.Handle("/products", s.requireAdmin(http.HandlerFunc(s.handler.ListProducts))).
+		Methods("GET").Queries("include_deleted", "{include_deleted}")
 	s.router.HandleFunc("/products", s.handler.ListProducts).Methods("GET")
 	s.router.HandleFunc("/products", s.handler.CreateProduct).Methods("POST")
+	s.router.HandleFunc("/products/facets", s.handler.ProductFacets).Methods("GET")
+	s.router.Handle("/products/import", s.requireAdmin(http.HandlerFunc(s.handler.ImportProducts))).Methods("POST")
+	s.router.HandleFunc("/products/export", s.handler.ExportProducts).Methods("GET")
 	s.router.HandleFunc("/products/{id}", s.handler.GetProductById).Methods("GET")
 	s.router.HandleFunc("/products/{id}", s.handler.UpdateProduct).Methods("PUT")
+	s.router.HandleFunc("/products/{id}", s.handler.PatchProduct).Methods("PATCH")
 	s.router.HandleFunc("/products/{id}", s.handler.DeleteProduct).Methods("DELETE")
 	s.router.HandleFunc("/products/{id}/image", s.handler.UploadProductImage).Methods("POST")
+	s.router.HandleFunc("/products/{id}/images", s.handler.ListProductImages).Methods("GET")
+	s.router.HandleFunc("/products/{id}/images", s.handler.AddProductImage).Methods("POST")
+	s.router.HandleFunc("/products/{id}/images/uploads", s.handler.CreateImageUpload).Methods("POST")
+	s.router.HandleFunc("/products/{id}/images/uploads/{upload_id}", s.handler.ConfirmImageUpload).Methods("POST")
+	s.router.HandleFunc("/products/{id}/images/{image_id}", s.handler.UpdateProductImage).Methods("PUT")
+	s.router.HandleFunc("/products/{id}/images/{image_id}", s.handler.DeleteProductImage).Methods("DELETE")
+	s.router.HandleFunc("/products/{id}/variants", s.handler.ListVariants).Methods("GET")
+	s.router.HandleFunc("/products/{id}/variants", s.handler.CreateVariant).Methods("POST")
+	s.router.HandleFunc("/products/{id}/variants/{variant_id}", s.handler.GetVariant).Methods("GET")
+	s.router.HandleFunc("/products/{id}/variants/{variant_id}", s.handler.UpdateVariant).Methods("PUT")
+	s.router.HandleFunc("/products/{id}/variants/{variant_id}", s.handler.DeleteVariant).Methods("DELETE")
+
+	// Admin endpoints
+	s.router.Handle("/products/{id}/restore", s.requireAdmin(http.HandlerFunc(s.handler.RestoreProduct))).Methods("POST")
 }
 
 // Implement the generated interface methods
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocart/internal/user-service/models"
+	"gocart/internal/user-service/repository"
+	"gocart/pkg/mailer"
+	"gocart/pkg/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// backgroundMailTimeout bounds mail sent after the response.
+const backgroundMailTimeout = 30 * time.Second
+
+// maxBackgroundMail is how many emails may be sent after responding at
+// once; further requests answer 503 until one is done.
+const maxBackgroundMail = 16
+
+// ForgotPassword mails a password reset link. It answers 202 whether or not
+// the email belongs to an account so it can't be used to discover users;
+// the account is looked up and mailed after responding, so the response
+// time doesn't tell either.
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(request.Email) == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.mailSlots <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many password reset requests, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), backgroundMailTimeout)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		defer func() { <-h.mailSlots }()
+		defer cancel()
+		h.mailPasswordReset(ctx, request.Email)
+	}()
+
+	writeMessage(w, http.StatusAccepted, "If an account exists for this email, a password reset link has been sent")
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword.
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.passwords.validate(request.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := h.hashPassword(request.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.repo.ResetPassword(r.Context(), models.HashToken(request.Token), hashedPassword, h.now())
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		} else {
+			log.Printf("Error resetting password: %v", err)
+			http.Error(w, "Unable to reset password", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("Password reset for user %s", user.UserID)
+	writeMessage(w, http.StatusOK, "Password has been reset")
+}
+
+// VerifyEmail marks a user's email as verified. The token comes from the
+// token query parameter, so the mailed link works when opened directly, or
+// from a JSON body.
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost {
+		var request struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token = request.Token
+	}
+	if token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.repo.VerifyEmail(r.Context(), models.HashToken(token), h.now())
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		} else {
+			log.Printf("Error verifying email: %v", err)
+			http.Error(w, "Unable to verify email", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+// ChangePassword sets a new password for a user who knows the current one.
+// A wrong current password counts towards the per-IP login throttle but
+// not the account lockout, since the route isn't authenticated and anyone
+// could otherwise lock the user out. Changing the password revokes the
+// user's outstanding reset and verification tokens.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["user_id"]
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.CurrentPassword == "" {
+		http.Error(w, "Current password is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.passwords.validate(request.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == request.CurrentPassword {
+		http.Error(w, "New password must differ from the current password", http.StatusBadRequest)
+		return
+	}
+
+	now := h.now()
+	event := models.LoginEvent{
+		UserID:    userID,
+		IP:        ratelimit.ClientIP(r, h.lockout.TrustProxy),
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLength),
+		CreatedAt: now,
+	}
+	if h.ipThrottled(w, r, event) {
+		return
+	}
+
+	user, err := h.repo.GetUserById(r.Context(), userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "no rows") {
+			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
+		} else {
+			log.Printf("Error fetching user with id %v: %v", userID, err)
+			http.Error(w, fmt.Sprintf("Unable to retrieve user with id %v", userID), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	event.Email = user.Email
+	if user.IsLocked(now) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(user.LockedUntil.Sub(now).Seconds()))))
+		http.Error(w, "Account is temporarily locked after too many failed login attempts", http.StatusLocked)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.CurrentPassword)); err != nil {
+		h.loginFailed(r, event, models.LoginReasonPasswordChange)
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	hashedPassword, err := h.hashPassword(request.NewPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.repo.ChangePassword(r.Context(), userID, hashedPassword, now); err != nil {
+		log.Printf("Error changing password for user %s: %v", userID, err)
+		http.Error(w, "Unable to change password", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Password changed for user %s", userID)
+	writeMessage(w, http.StatusOK, "Password has been changed")
+}
+
+// mailPasswordReset sends a reset link to the account with email, if
+// there is one.
+func (h *UserHandler) mailPasswordReset(ctx context.Context, email string) {
+	user, err := h.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+		return
+	}
+	if err := h.sendPasswordResetEmail(ctx, user); err != nil {
+		log.Printf("Error sending password reset email to user %s: %v", user.UserID, err)
+	}
+}
+
+func (h *UserHandler) sendPasswordResetEmail(ctx context.Context, user models.User) error {
+	link, err := h.issueToken(ctx, user, models.TokenPurposePasswordReset, h.tokens.PasswordResetURL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your GoCart password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your GoCart account. "+
+			"To choose a new password, open this link within %s:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email; your password won't change.\n",
+			user.FirstName, h.tokens.PasswordResetTTL, link),
+	})
+}
+
+func (h *UserHandler) sendVerificationEmail(ctx context.Context, user models.User) error {
+	link, err := h.issueToken(ctx, user, models.TokenPurposeEmailVerification, h.tokens.EmailVerificationURL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your GoCart email address",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to GoCart! Please confirm your email address by opening this link within %s:\n\n%s\n",
+			user.FirstName, h.tokens.VerificationTTL, link),
+	})
+}
+
+// issueToken stores a new token for user and returns baseURL with the token
+// added as a query parameter.
+func (h *UserHandler) issueToken(ctx context.Context, user models.User, purpose, baseURL string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	ttl := h.tokens.VerificationTTL
+	if purpose == models.TokenPurposePasswordReset {
+		ttl = h.tokens.PasswordResetTTL
+	}
+	now := h.now()
+	err := h.repo.CreateUserToken(ctx, models.UserToken{
+		TokenHash: models.HashToken(token),
+		UserID:    user.UserID,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store %s token: %w", purpose, err)
+	}
+
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s URL %q: %w", purpose, baseURL, err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
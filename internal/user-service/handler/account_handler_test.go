@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"gocart/internal/user-service/models"
+	"gocart/internal/user-service/repository"
+	"gocart/pkg/mailer"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recordingMailer keeps sent messages in memory.
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// mailedToken extracts the token from the link in a sent message.
+func mailedToken(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	if err != nil || link.Query().Get("token") == "" {
+		t.Fatalf("Expected a link with a token in:\n%s", msg.Body)
+	}
+	return link.Query().Get("token")
+}
+
+func TestForgotPassword(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectMail     bool
+	}{
+		{name: "Known email", body: `{"email":"john@example.com"}`, expectedStatus: http.StatusAccepted, expectMail: true},
+		{name: "Unknown email looks the same", body: `{"email":"nobody@example.com"}`, expectedStatus: http.StatusAccepted},
+		{name: "Missing email", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", body: `{`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored []models.UserToken
+			mockRepo := &MockUserRepository{
+				MockGetUserByEmail: func(email string) (models.User, error) {
+					if email != "john@example.com" {
+						return models.User{}, errors.New("user not found")
+					}
+					return models.User{UserID: "1", FirstName: "John", Email: email}, nil
+				},
+				MockCreateUserToken: func(token models.UserToken) error {
+					stored = append(stored, token)
+					return nil
+				},
+			}
+			sent := &recordingMailer{}
+			opts := DefaultOptions()
+			opts.Mailer = sent
+			handler := NewUserHandlerWithOptions(mockRepo, opts)
+			handler.now = func() time.Time { return now }
+
+			w := httptest.NewRecorder()
+			handler.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/users/password/forgot", strings.NewReader(tt.body)))
+			handler.Close()
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if !tt.expectMail {
+				if len(sent.sent) != 0 || len(stored) != 0 {
+					t.Errorf("Expected no token or mail, got %d tokens and %d mails", len(stored), len(sent.sent))
+				}
+				return
+			}
+
+			if len(sent.sent) != 1 || sent.sent[0].To != "john@example.com" {
+				t.Fatalf("Expected one mail to john@example.com, got %+v", sent.sent)
+			}
+			token := mailedToken(t, sent.sent[0])
+			if len(stored) != 1 {
+				t.Fatalf("Expected one stored token, got %d", len(stored))
+			}
+			if stored[0].TokenHash != models.HashToken(token) || stored[0].TokenHash == token {
+				t.Error("Expected only the hash of the mailed token to be stored")
+			}
+			if stored[0].Purpose != models.TokenPurposePasswordReset || !stored[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("Expected a reset token expiring in an hour, got %+v", stored[0])
+			}
+		})
+	}
+}
+
+func TestForgotPasswordBusy(t *testing.T) {
+	handler := NewUserHandler(&MockUserRepository{})
+	for i := 0; i < maxBackgroundMail; i++ {
+		handler.mailSlots <- struct{}{}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/users/password/forgot", strings.NewReader(`{"email":"john@example.com"}`)))
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After while every mail slot is taken, got %d", w.Code)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", body: `{"token":"abc","password":"new-password"}`, expectedStatus: http.StatusOK},
+		{name: "Invalid token", body: `{"token":"abc","password":"new-password"}`, mockError: repository.ErrInvalidToken, expectedStatus: http.StatusBadRequest},
+		{name: "Database error", body: `{"token":"abc","password":"new-password"}`, mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+		{name: "Missing token", body: `{"password":"new-password"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Short password", body: `{"token":"abc","password":"123"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotHash, gotPassword string
+			mockRepo := &MockUserRepository{
+				MockResetPassword: func(tokenHash, passwordHash string, now time.Time) (models.User, error) {
+					gotHash, gotPassword = tokenHash, passwordHash
+					return models.User{UserID: "1"}, tt.mockError
+				},
+			}
+
+			handler := NewUserHandler(mockRepo)
+			w := httptest.NewRecorder()
+			handler.ResetPassword(w, httptest.NewRequest(http.MethodPost, "/users/password/reset", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if gotHash != models.HashToken("abc") {
+					t.Errorf("Expected the token hash to be redeemed, got %q", gotHash)
+				}
+				if bcrypt.CompareHashAndPassword([]byte(gotPassword), []byte("new-password")) != nil {
+					t.Error("Expected the new password to be stored hashed")
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Link from email", method: http.MethodGet, target: "/users/verify?token=abc", expectedStatus: http.StatusOK},
+		{name: "JSON body", method: http.MethodPost, target: "/users/verify", body: `{"token":"abc"}`, expectedStatus: http.StatusOK},
+		{name: "Invalid token", method: http.MethodGet, target: "/users/verify?token=abc", mockError: repository.ErrInvalidToken, expectedStatus: http.StatusBadRequest},
+		{name: "Missing token", method: http.MethodGet, target: "/users/verify", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			mockRepo := &MockUserRepository{
+				MockVerifyEmail: func(tokenHash string, now time.Time) (models.User, error) {
+					if tokenHash != models.HashToken("abc") {
+						t.Errorf("Expected hash of abc, got %q", tokenHash)
+					}
+					return models.User{UserID: "1", EmailVerifiedAt: &verified}, tt.mockError
+				},
+			}
+
+			handler := NewUserHandler(mockRepo)
+			w := httptest.NewRecorder()
+			handler.VerifyEmail(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateUserSendsVerificationEmail(t *testing.T) {
+	var stored models.UserToken
+	mockRepo := &MockUserRepository{
+		MockCreateUser: func(user models.User) (models.User, error) {
+			return user, nil
+		},
+		MockCreateUserToken: func(token models.UserToken) error {
+			stored = token
+			return nil
+		},
+	}
+	sent := &recordingMailer{}
+	opts := DefaultOptions()
+	opts.Mailer = sent
+	opts.Tokens.EmailVerificationURL = "https://shop.example.com/verify?source=email"
+	handler := NewUserHandlerWithOptions(mockRepo, opts)
+
+	body, _ := json.Marshal(models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Phone: "555-0100", Password: "correct-horse-42"})
+	w := httptest.NewRecorder()
+	handler.CreateUser(w, httptest.NewRequest(http.MethodPost, "/users/register", bytes.NewReader(body)))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+	if len(sent.sent) != 1 || sent.sent[0].To != "jane@example.com" {
+		t.Fatalf("Expected a verification email to jane@example.com, got %+v", sent.sent)
+	}
+	link, _ := url.Parse(linkPattern.FindString(sent.sent[0].Body))
+	if link.Host != "shop.example.com" || link.Query().Get("source") != "email" {
+		t.Errorf("Expected the configured verification URL to be kept, got %s", link)
+	}
+	if stored.Purpose != models.TokenPurposeEmailVerification || stored.TokenHash != models.HashToken(mailedToken(t, sent.sent[0])) {
+		t.Errorf("Expected the mailed verification token to be stored, got %+v", stored)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("old-password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	lockedUntil := now.Add(time.Minute)
+
+	tests := []struct {
+		name           string
+		userID         string
+		body           string
+		lockedUntil    *time.Time
+		ipFailures     int64
+		expectedStatus int
+		expectChanged  bool
+		expectFailure  bool
+	}{
+		{name: "Success", userID: "1", body: `{"current_password":"old-password-1","new_password":"new-password-2"}`, expectedStatus: http.StatusOK, expectChanged: true},
+		{name: "Wrong current password", userID: "1", body: `{"current_password":"guess","new_password":"new-password-2"}`, expectedStatus: http.StatusUnauthorized, expectFailure: true},
+		{name: "Throttled address", userID: "1", body: `{"current_password":"old-password-1","new_password":"new-password-2"}`, ipFailures: 20, expectedStatus: http.StatusTooManyRequests},
+		{name: "Locked account", userID: "1", body: `{"current_password":"old-password-1","new_password":"new-password-2"}`, lockedUntil: &lockedUntil, expectedStatus: http.StatusLocked},
+		{name: "Weak new password", userID: "1", body: `{"current_password":"old-password-1","new_password":"password1"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Unchanged password", userID: "1", body: `{"current_password":"old-password-1","new_password":"old-password-1"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Missing current password", userID: "1", body: `{"new_password":"new-password-2"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Unknown user", userID: "2", body: `{"current_password":"old-password-1","new_password":"new-password-2"}`, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &loginRepo{user: models.User{UserID: "1", Email: "john@example.com", PasswordHash: string(hash), LockedUntil: tt.lockedUntil}, ipFailures: tt.ipFailures}
+			handler := NewUserHandler(repo.mock())
+			handler.now = func() time.Time { return now }
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+tt.userID+"/password", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"user_id": tt.userID})
+			w := httptest.NewRecorder()
+			handler.ChangePassword(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			changed := repo.user.PasswordChangedAt != nil
+			if changed != tt.expectChanged {
+				t.Errorf("Expected password changed %v, got %v", tt.expectChanged, changed)
+			}
+			if changed && bcrypt.CompareHashAndPassword([]byte(repo.user.PasswordHash), []byte("new-password-2")) != nil {
+				t.Error("Expected the new password to be stored")
+			}
+			// Wrong guesses feed the IP throttle, but can't lock the
+			// user out of logging in
+			failed := len(repo.events) == 1 && repo.events[0].Reason == models.LoginReasonPasswordChange
+			if failed != tt.expectFailure {
+				t.Errorf("Expected failed attempt recorded %v, got %+v", tt.expectFailure, repo.events)
+			}
+			if repo.user.FailedLoginAttempts != 0 || repo.user.LockedUntil != tt.lockedUntil {
+				t.Errorf("Expected the login lockout to be untouched, got %+v", repo.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the longest password bcrypt hashes without truncating.
+const maxPasswordBytes = 72
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy describes which new passwords are accepted.
+type PasswordPolicy struct {
+	MinLength int
+	// MinCharacterClasses is how many of lowercase letters, uppercase
+	// letters, digits and other characters a password must mix.
+	MinCharacterClasses int
+	// DenyList holds passwords that are refused whatever their strength,
+	// compared case-insensitively.
+	DenyList []string
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:           8,
+		MinCharacterClasses: 2,
+		DenyList:            CommonPasswords(),
+	}
+}
+
+// CommonPasswords returns the built-in list of frequently used passwords.
+func CommonPasswords() []string {
+	passwords, _ := readDenyList(strings.NewReader(commonPasswords))
+	return passwords
+}
+
+// LoadDenyList reads a deny-list file with one password per line. Blank
+// lines and lines starting with # are ignored.
+func LoadDenyList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readDenyList(f)
+}
+
+func readDenyList(r io.Reader) ([]string, error) {
+	var passwords []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords = append(passwords, line)
+	}
+	return passwords, scanner.Err()
+}
+
+// passwordChecker applies a PasswordPolicy with the deny-list indexed.
+type passwordChecker struct {
+	policy PasswordPolicy
+	denied map[string]struct{}
+}
+
+func newPasswordChecker(policy PasswordPolicy) passwordChecker {
+	denied := make(map[string]struct{}, len(policy.DenyList))
+	for _, password := range policy.DenyList {
+		denied[strings.ToLower(password)] = struct{}{}
+	}
+	return passwordChecker{policy: policy, denied: denied}
+}
+
+// validate returns an error describing why password is not acceptable, or
+// nil. The messages are meant for the user.
+func (c passwordChecker) validate(password string) error {
+	if strings.TrimSpace(password) == "" {
+		return errors.New("Password is required")
+	}
+	if length := utf8.RuneCountInString(password); length < c.policy.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", c.policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("Password must be at most %d bytes", maxPasswordBytes)
+	}
+	if classes := characterClasses(password); classes < c.policy.MinCharacterClasses {
+		return fmt.Errorf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols",
+			c.policy.MinCharacterClasses)
+	}
+	if _, ok := c.denied[strings.ToLower(password)]; ok {
+		return errors.New("Password is too common")
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	checker := newPasswordChecker(DefaultPasswordPolicy())
+
+	tests := []struct {
+		password string
+		problem  string
+	}{
+		{password: "correct-horse-42"},
+		{password: "Tr0ub4dor"},
+		{password: "ünïcödé-9"},
+		{password: "", problem: "required"},
+		{password: "a1-b2", problem: "at least 8 characters"},
+		{password: "alllowercase", problem: "mix at least 2"},
+		{password: "Password123", problem: "too common"},
+		{password: "QWERTY123", problem: "too common"},
+		{password: strings.Repeat("a1", 40), problem: "at most 72 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := checker.validate(tt.password)
+			if tt.problem == "" {
+				if err != nil {
+					t.Errorf("Expected %q to be accepted, got %v", tt.password, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("Expected error containing %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestReadDenyList(t *testing.T) {
+	passwords, err := readDenyList(strings.NewReader("# comment\n\n  hunter2  \nletmein\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(passwords, ",") != "hunter2,letmein" {
+		t.Errorf("Expected comments and blank lines to be skipped, got %q", passwords)
+	}
+
+	checker := newPasswordChecker(PasswordPolicy{DenyList: passwords})
+	if err := checker.validate("HUNTER2"); err == nil {
+		t.Error("Expected deny-list matches to ignore case")
+	}
+}
@@ -0,0 +1,63 @@
+package handler_test
+
+import (
+	"gocart/internal/user-service/handler"
+	"gocart/internal/user-service/models"
+	"gocart/internal/user-service/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestUserRoutes sends requests through the service's router, so the
+// path variables it sets are the ones the handlers read.
+func TestUserRoutes(t *testing.T) {
+	var gotID string
+	user := func(id string) (models.User, error) {
+		gotID = id
+		return models.User{UserID: id, FirstName: "John", LastName: "Doe", Email: "john@example.com", Phone: "1234567890"}, nil
+	}
+	repo := &handler.MockUserRepository{
+		MockGetUserById: user,
+		MockDeleteUser:  user,
+		MockUpdateUser: func(updated models.User) (models.User, error) {
+			return updated, nil
+		},
+		MockPatchUser: func(id string, changes map[string]interface{}) (models.User, error) {
+			return user(id)
+		},
+	}
+	router := server.NewServer(handler.NewUserHandler(repo)).GetRouter()
+
+	tests := []struct {
+		method         string
+		body           string
+		contentType    string
+		expectedStatus int
+	}{
+		{method: http.MethodGet, expectedStatus: http.StatusOK},
+		{method: http.MethodPut, body: `{"first_name":"Jane","last_name":"Doe","email":"jane@example.com","phone":"1234567890"}`, contentType: "application/json", expectedStatus: http.StatusOK},
+		{method: http.MethodPatch, body: `{"first_name":"Jane"}`, contentType: "application/merge-patch+json", expectedStatus: http.StatusOK},
+		{method: http.MethodDelete, expectedStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			gotID = ""
+			req := httptest.NewRequest(tt.method, "/users/42", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if gotID != "42" {
+				t.Errorf("Expected the handler to look up user 42, got %q", gotID)
+			}
+		})
+	}
+}
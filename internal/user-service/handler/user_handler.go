@@ -2,12 +2,21 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gocart/internal/user-service/models"
 	"gocart/internal/user-service/repository"
+	"gocart/pkg/db"
+	"gocart/pkg/mailer"
+	"gocart/pkg/metrics"
+	"gocart/pkg/patch"
+	"gocart/pkg/ratelimit"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,11 +25,126 @@ import (
 )
 
 type UserHandler struct {
-	repo repository.UserRepository
+	repo       repository.UserRepository
+	lockout    LockoutConfig
+	tokens     TokenConfig
+	mailer     mailer.Mailer
+	passwords  passwordChecker
+	bcryptCost int
+	now        func() time.Time
+	// background tracks work finished after the response, such as
+	// password reset mail; mailSlots bounds how much of it runs at once.
+	background sync.WaitGroup
+	mailSlots  chan struct{}
+}
+
+// Options configures the optional behaviour of a UserHandler.
+type Options struct {
+	Lockout   LockoutConfig
+	Tokens    TokenConfig
+	Passwords PasswordPolicy
+	// BcryptCost is the cost new password hashes are created with; zero
+	// means bcrypt.DefaultCost. Hashes of another cost are replaced at the
+	// next successful login.
+	BcryptCost int
+	// Mailer delivers password reset and verification emails; nil logs
+	// them instead.
+	Mailer mailer.Mailer
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Lockout:    DefaultLockoutConfig(),
+		Tokens:     DefaultTokenConfig(),
+		Passwords:  DefaultPasswordPolicy(),
+		BcryptCost: bcrypt.DefaultCost,
+	}
+}
+
+// TokenConfig controls the password reset and email verification tokens
+// mailed to users. The token is appended to the URLs as the token query
+// parameter.
+type TokenConfig struct {
+	PasswordResetTTL     time.Duration
+	VerificationTTL      time.Duration
+	PasswordResetURL     string
+	EmailVerificationURL string
+}
+
+func DefaultTokenConfig() TokenConfig {
+	return TokenConfig{
+		PasswordResetTTL:     time.Hour,
+		VerificationTTL:      48 * time.Hour,
+		PasswordResetURL:     "http://localhost:3000/reset-password",
+		EmailVerificationURL: "http://localhost:8080/users/verify",
+	}
+}
+
+// LockoutConfig controls brute-force protection on Login.
+type LockoutConfig struct {
+	// MaxFailedAttempts wrong passwords in a row lock an account for
+	// Duration, doubling with each further lockout up to MaxDuration.
+	MaxFailedAttempts int
+	Duration          time.Duration
+	MaxDuration       time.Duration
+	// IPMaxFailures failed logins from one address within IPWindow make
+	// further attempts from it fail with 429 until older failures age out.
+	IPMaxFailures int
+	IPWindow      time.Duration
+	// TrustProxy takes the client address from X-Forwarded-For.
+	TrustProxy bool
+}
+
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		MaxFailedAttempts: 5,
+		Duration:          time.Minute,
+		MaxDuration:       time.Hour,
+		IPMaxFailures:     20,
+		IPWindow:          15 * time.Minute,
+	}
+}
+
+// lockoutDuration returns how long to lock an account that has already
+// been locked previous times since its last successful login.
+func (c LockoutConfig) lockoutDuration(previous int) time.Duration {
+	duration := c.Duration
+	for i := 0; i < previous && duration < c.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > c.MaxDuration {
+		duration = c.MaxDuration
+	}
+	return duration
 }
 
 func NewUserHandler(repo repository.UserRepository) *UserHandler {
-	return &UserHandler{repo: repo}
+	return NewUserHandlerWithOptions(repo, DefaultOptions())
+}
+
+func NewUserHandlerWithOptions(repo repository.UserRepository, opts Options) *UserHandler {
+	if opts.Mailer == nil {
+		opts.Mailer = mailer.LogMailer{}
+	}
+	if opts.BcryptCost == 0 {
+		opts.BcryptCost = bcrypt.DefaultCost
+	}
+	return &UserHandler{
+		repo:       repo,
+		lockout:    opts.Lockout,
+		tokens:     opts.Tokens,
+		mailer:     opts.Mailer,
+		passwords:  newPasswordChecker(opts.Passwords),
+		bcryptCost: opts.BcryptCost,
+		now:        time.Now,
+		mailSlots:  make(chan struct{}, maxBackgroundMail),
+	}
+}
+
+// Close waits for mail still being sent after responding. Call it once the
+// server has stopped taking requests and before the database is closed.
+func (h *UserHandler) Close() {
+	h.background.Wait()
 }
 
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -47,23 +171,19 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Phone is required", http.StatusBadRequest)
 		return
 	}
-	if strings.TrimSpace(user.Password) == "" {
-		http.Error(w, "Password is required", http.StatusBadRequest)
-		return
-	}
-	if len(strings.TrimSpace(user.Password)) < 6 {
-		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+	if err := h.passwords.validate(user.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.hashPassword(user.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 	user.Password = "" // Don't save plain text password
 
 	// Generate a new UUID for the user
@@ -72,7 +192,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	user.UpdatedAt = time.Now()
 
 	// Save to database
-	createdUser, err := h.repo.CreateUser(user)
+	createdUser, err := h.repo.CreateUser(r.Context(), user)
 	if err != nil {
 		// Check for specific error types
 		lower := strings.ToLower(err.Error())
@@ -85,6 +205,11 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Registration succeeds even if the verification email can't be sent
+	if err := h.sendVerificationEmail(r.Context(), createdUser); err != nil {
+		log.Printf("Error sending verification email to user %s: %v", createdUser.UserID, err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(createdUser)
@@ -101,23 +226,207 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.repo.GetUserByEmail(credentials.Email)
+	now := h.now()
+	event := models.LoginEvent{
+		Email:     credentials.Email,
+		IP:        ratelimit.ClientIP(r, h.lockout.TrustProxy),
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLength),
+		CreatedAt: now,
+	}
+
+	if h.ipThrottled(w, r, event) {
+		return
+	}
+
+	user, err := h.repo.GetUserByEmail(r.Context(), credentials.Email)
 	if err != nil {
+		h.loginFailed(r, event, models.LoginReasonUnknownUser)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	event.UserID = user.UserID
+
+	// Refuse locked accounts without checking the password, so a lockout
+	// can't be used to keep guessing
+	if user.IsLocked(now) {
+		h.loginFailed(r, event, models.LoginReasonLocked)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(user.LockedUntil.Sub(now).Seconds()))))
+		http.Error(w, "Account is temporarily locked after too many failed login attempts", http.StatusLocked)
+		return
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(credentials.Password)); err != nil {
+		h.loginFailed(r, event, models.LoginReasonInvalidPassword)
+		h.recordFailedPassword(r, user, now)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
+	if user.FailedLoginAttempts > 0 || user.LockoutCount > 0 {
+		if err := h.repo.ResetFailedLogins(r.Context(), user.UserID); err != nil {
+			log.Printf("Error resetting failed logins for user %s: %v", user.UserID, err)
+		}
+		user.FailedLoginAttempts, user.LockoutCount = 0, 0
+	}
+	h.rehashPassword(r, user, credentials.Password)
+	event.Success = true
+	h.recordLoginEvent(r, event)
+
 	// In a real app, we would generate a JWT token here
 	// For now, we'll just return the user object (excluding password hash)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
+// maxUserAgentLength bounds the user agent stored with login events.
+const maxUserAgentLength = 512
+
+// ipThrottled refuses the request with 429 when the event's address has
+// failed too many password checks recently, whichever accounts it tried.
+func (h *UserHandler) ipThrottled(w http.ResponseWriter, r *http.Request, event models.LoginEvent) bool {
+	if h.lockout.IPMaxFailures <= 0 {
+		return false
+	}
+	failures, err := h.repo.CountFailedLoginsByIP(r.Context(), event.IP, event.CreatedAt.Add(-h.lockout.IPWindow))
+	if err != nil {
+		log.Printf("Error counting failed logins for %s: %v", event.IP, err)
+		return false
+	}
+	if failures < int64(h.lockout.IPMaxFailures) {
+		return false
+	}
+	h.loginFailed(r, event, models.LoginReasonIPThrottled)
+	w.Header().Set("Retry-After", strconv.Itoa(int(h.lockout.IPWindow.Seconds())))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+func (h *UserHandler) loginFailed(r *http.Request, event models.LoginEvent, reason string) {
+	metrics.LoginFailed(reason)
+	event.Reason = reason
+	h.recordLoginEvent(r, event)
+}
+
+// recordLoginEvent writes the audit record. A failing audit write is logged
+// rather than failing the login.
+func (h *UserHandler) recordLoginEvent(r *http.Request, event models.LoginEvent) {
+	if err := h.repo.RecordLoginEvent(r.Context(), event); err != nil {
+		log.Printf("Error recording login event for %s: %v", event.Email, err)
+	}
+}
+
+// recordFailedPassword counts a wrong password and locks the account once
+// it reaches the configured number of attempts.
+func (h *UserHandler) recordFailedPassword(r *http.Request, user models.User, now time.Time) {
+	if h.lockout.MaxFailedAttempts <= 0 {
+		return
+	}
+	attempts, err := h.repo.RecordFailedLogin(r.Context(), user.UserID)
+	if err != nil {
+		log.Printf("Error recording failed login for user %s: %v", user.UserID, err)
+		return
+	}
+	if attempts < h.lockout.MaxFailedAttempts {
+		return
+	}
+
+	duration := h.lockout.lockoutDuration(user.LockoutCount)
+	if err := h.repo.LockUser(r.Context(), user.UserID, now.Add(duration)); err != nil {
+		log.Printf("Error locking user %s: %v", user.UserID, err)
+		return
+	}
+	metrics.AccountLocked()
+	log.Printf("Locked user %s for %s after %d failed login attempts", user.UserID, duration, attempts)
+}
+
+// rehashPassword replaces the user's password hash after a successful login
+// when it was created with a different bcrypt cost than configured, so
+// changing the cost applies to existing users as they log in.
+func (h *UserHandler) rehashPassword(r *http.Request, user models.User, password string) {
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err != nil || cost == h.bcryptCost {
+		return
+	}
+	hash, err := h.hashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %s: %v", user.UserID, err)
+		return
+	}
+	if err := h.repo.RehashPassword(r.Context(), user.UserID, user.PasswordHash, hash); err != nil {
+		log.Printf("Error storing rehashed password for user %s: %v", user.UserID, err)
+		return
+	}
+	log.Printf("Rehashed password for user %s from bcrypt cost %d to %d", user.UserID, cost, h.bcryptCost)
+}
+
+func (h *UserHandler) hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+	return string(hash), err
+}
+
+// UnlockUser lifts a login lockout. It is an admin endpoint.
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.repo.UnlockUser(r.Context(), userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "no rows") {
+			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
+		} else {
+			log.Printf("Error unlocking user with id %v: %v", userID, err)
+			http.Error(w, "Unable to unlock user", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("Unlocked user %s", userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+// RestoreUser undoes a user deletion. It is an admin endpoint, and fails
+// with 409 if another account has taken the email since or the user has
+// been anonymized.
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.repo.RestoreUser(r.Context(), userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "no rows") {
+			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "already exists") || errors.Is(err, repository.ErrUserAnonymized) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			log.Printf("Error restoring user with id %v: %v", userID, err)
+			http.Error(w, "Unable to restore user", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("Restored user %s", userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
 func (h *UserHandler) GetUserById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
@@ -127,7 +436,7 @@ func (h *UserHandler) GetUserById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.repo.GetUserById(userID)
+	user, err := h.repo.GetUserById(r.Context(), userID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "no rows") {
 			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
@@ -156,6 +465,10 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if updatedUser.Password != "" {
+		http.Error(w, "Passwords can't be updated here, use POST /users/{id}/password", http.StatusBadRequest)
+		return
+	}
 
 	// Validate required fields
 	if strings.TrimSpace(updatedUser.FirstName) == "" {
@@ -176,7 +489,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get existing user
-	existingUser, err := h.repo.GetUserById(userID)
+	existingUser, err := h.repo.GetUserById(r.Context(), userID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "no rows") {
 			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
@@ -192,7 +505,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	updatedUser.CreatedAt = existingUser.CreatedAt
 	updatedUser.UpdatedAt = time.Now()
 
-	result, err := h.repo.UpdateUser(updatedUser)
+	result, err := h.repo.UpdateUser(r.Context(), updatedUser)
 	if err != nil {
 		lower := strings.ToLower(err.Error())
 		if strings.Contains(lower, "duplicate") || strings.Contains(lower, "unique") || strings.Contains(lower, "already exists") {
@@ -208,6 +521,87 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
+// patchableUserFields are the members a PATCH may set, named like their
+// columns. Every one is required, so none of them can be cleared with null.
+var patchableUserFields = []string{"first_name", "last_name", "email", "phone"}
+
+// PatchUser applies a JSON merge patch to a user. Only the fields present
+// are validated and written.
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user_id"]
+
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := patch.Decode(r)
+	if err != nil {
+		if errors.Is(err, patch.ErrUnsupportedMediaType) {
+			w.Header().Set("Accept-Patch", patch.ContentType)
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	if doc.Has("password") {
+		http.Error(w, "Passwords can't be updated here, use POST /users/{id}/password", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := userChanges(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.repo.PatchUser(r.Context(), userID, changes)
+	if err != nil {
+		lower := strings.ToLower(err.Error())
+		if strings.Contains(lower, "not found") || strings.Contains(lower, "no rows") {
+			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
+		} else if strings.Contains(lower, "duplicate") || strings.Contains(lower, "unique") || strings.Contains(lower, "already exists") {
+			http.Error(w, "User with this email already exists", http.StatusConflict)
+		} else {
+			log.Printf("Error patching user with id %v: %v", userID, err)
+			http.Error(w, "Unable to update user", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
+
+// userChanges validates the members of a user patch and returns the columns
+// to write.
+func userChanges(doc patch.Document) (map[string]interface{}, error) {
+	if unknown := doc.Unknown(patchableUserFields...); len(unknown) > 0 {
+		return nil, fmt.Errorf("Unknown or read-only fields: %s", strings.Join(unknown, ", "))
+	}
+
+	changes := make(map[string]interface{}, len(doc))
+	for _, name := range patchableUserFields {
+		if !doc.Has(name) {
+			continue
+		}
+		if doc.IsNull(name) {
+			return nil, fmt.Errorf("%s is required and can't be cleared", name)
+		}
+		var value string
+		if err := doc.Value(name, &value); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("%s must not be empty", name)
+		}
+		changes[name] = value
+	}
+	return changes, nil
+}
+
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
@@ -217,7 +611,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := h.repo.DeleteUser(userID)
+	_, err := h.repo.DeleteUser(r.Context(), userID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "no rows") {
 			http.Error(w, fmt.Sprintf("User with id %v not found", userID), http.StatusNotFound)
@@ -231,8 +625,14 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListAllUsers lists users. With include_deleted=true, an admin-only variant
+// of the route, soft-deleted users are listed too.
 func (h *UserHandler) ListAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.repo.ListAllUsers()
+	ctx := r.Context()
+	if includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted")); includeDeleted {
+		ctx = db.IncludeDeleted(ctx)
+	}
+	users, err := h.repo.ListAllUsers(ctx)
 	if err != nil {
 		log.Printf("Error fetching users: %v", err)
 		http.Error(w, "Unable to retrieve users", http.StatusInternalServerError)
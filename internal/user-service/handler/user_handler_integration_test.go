@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"gocart/internal/user-service/models"
 	"gocart/internal/user-service/repository"
@@ -39,7 +40,7 @@ func TestCreateAndGetUserIntegration(t *testing.T) {
 		LastName:  "Doe",
 		Email:     "john.doe@example.com",
 		Phone:     "123-456-7890",
-		Password:  "password123",
+		Password:  "correct-horse-42",
 	}
 	body, err := json.Marshal(testUser)
 	if err != nil {
@@ -120,9 +121,9 @@ func TestListUsersIntegration(t *testing.T) {
 		Phone:     "123-456-7890",
 	}
 
-	userRepo.CreateUser(user1)
-	userRepo.CreateUser(user2)
-	userRepo.CreateUser(user3)
+	userRepo.CreateUser(context.Background(), user1)
+	userRepo.CreateUser(context.Background(), user2)
+	userRepo.CreateUser(context.Background(), user3)
 
 	req := httptest.NewRequest(http.MethodGet, "/users", nil)
 	w := httptest.NewRecorder()
@@ -177,7 +178,7 @@ func TestCreateUserValidationErrors(t *testing.T) {
 				LastName: "Doe",
 				Email:    "john.doe@example.com",
 				Phone:    "123-456-7890",
-				Password: "password123",
+				Password: "correct-horse-42",
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "First name is required",
@@ -188,7 +189,7 @@ func TestCreateUserValidationErrors(t *testing.T) {
 				FirstName: "John",
 				Email:     "john.doe@example.com",
 				Phone:     "123-456-7890",
-				Password:  "password123",
+				Password:  "correct-horse-42",
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Last name is required",
@@ -199,7 +200,7 @@ func TestCreateUserValidationErrors(t *testing.T) {
 				FirstName: "John",
 				LastName:  "Doe",
 				Phone:     "123-456-7890",
-				Password:  "password123",
+				Password:  "correct-horse-42",
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Email is required",
@@ -210,7 +211,7 @@ func TestCreateUserValidationErrors(t *testing.T) {
 				FirstName: "John",
 				LastName:  "Doe",
 				Email:     "john.doe@example.com",
-				Password:  "password123",
+				Password:  "correct-horse-42",
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Phone is required",
@@ -283,7 +284,7 @@ func TestCreateUserDuplicateEmail(t *testing.T) {
 		LastName:  "Doe",
 		Email:     "john.doe@example.com",
 		Phone:     "123-456-7890",
-		Password:  "password123",
+		Password:  "correct-horse-42",
 	}
 	body1, _ := json.Marshal(user1)
 	req1 := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body1))
@@ -301,7 +302,7 @@ func TestCreateUserDuplicateEmail(t *testing.T) {
 		LastName:  "Doe",
 		Email:     "john.doe@example.com", // Same email
 		Phone:     "123-456-7890",
-		Password:  "password123",
+		Password:  "correct-horse-42",
 	}
 	body2, _ := json.Marshal(user2)
 	req2 := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(body2))
@@ -2,14 +2,20 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"gocart/internal/user-service/models"
+	"gocart/internal/user-service/repository"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type MockUserRepository struct {
@@ -19,32 +25,103 @@ type MockUserRepository struct {
 	MockGetUserByEmail func(email string) (models.User, error)
 	MockUpdateUser     func(user models.User) (models.User, error)
 	MockDeleteUser     func(id string) (models.User, error)
+
+	MockRecordFailedLogin     func(id string) (int, error)
+	MockLockUser              func(id string, until time.Time) error
+	MockResetFailedLogins     func(id string) error
+	MockUnlockUser            func(id string) (models.User, error)
+	MockRecordLoginEvent      func(event models.LoginEvent) error
+	MockCountFailedLoginsByIP func(ip string, since time.Time) (int64, error)
+	MockCreateUserToken       func(token models.UserToken) error
+	MockResetPassword         func(tokenHash, passwordHash string, now time.Time) (models.User, error)
+	MockVerifyEmail           func(tokenHash string, now time.Time) (models.User, error)
+	MockChangePassword        func(userID, passwordHash string, now time.Time) (models.User, error)
+	MockRehashPassword        func(userID, oldHash, newHash string) error
+	MockPatchUser             func(id string, changes map[string]interface{}) (models.User, error)
+	MockRestoreUser           func(id string) (models.User, error)
+	MockPurgeDeleted          func(before time.Time) (int64, error)
 }
 
-func (m *MockUserRepository) ListAllUsers() ([]models.User, error) {
+func (m *MockUserRepository) ListAllUsers(ctx context.Context) ([]models.User, error) {
 	return m.MockListAllUsers()
 }
 
-func (m *MockUserRepository) CreateUser(user models.User) (models.User, error) {
+func (m *MockUserRepository) CreateUser(ctx context.Context, user models.User) (models.User, error) {
 	return m.MockCreateUser(user)
 }
 
-func (m *MockUserRepository) GetUserById(id string) (models.User, error) {
+func (m *MockUserRepository) GetUserById(ctx context.Context, id string) (models.User, error) {
 	return m.MockGetUserById(id)
 }
 
-func (m *MockUserRepository) GetUserByEmail(email string) (models.User, error) {
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	return m.MockGetUserByEmail(email)
 }
 
-func (m *MockUserRepository) UpdateUser(user models.User) (models.User, error) {
+func (m *MockUserRepository) UpdateUser(ctx context.Context, user models.User) (models.User, error) {
 	return m.MockUpdateUser(user)
 }
 
-func (m *MockUserRepository) DeleteUser(id string) (models.User, error) {
+func (m *MockUserRepository) DeleteUser(ctx context.Context, id string) (models.User, error) {
 	return m.MockDeleteUser(id)
 }
 
+func (m *MockUserRepository) RecordFailedLogin(ctx context.Context, id string) (int, error) {
+	return m.MockRecordFailedLogin(id)
+}
+
+func (m *MockUserRepository) LockUser(ctx context.Context, id string, until time.Time) error {
+	return m.MockLockUser(id, until)
+}
+
+func (m *MockUserRepository) ResetFailedLogins(ctx context.Context, id string) error {
+	return m.MockResetFailedLogins(id)
+}
+
+func (m *MockUserRepository) UnlockUser(ctx context.Context, id string) (models.User, error) {
+	return m.MockUnlockUser(id)
+}
+
+func (m *MockUserRepository) RecordLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	return m.MockRecordLoginEvent(event)
+}
+
+func (m *MockUserRepository) CountFailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int64, error) {
+	return m.MockCountFailedLoginsByIP(ip, since)
+}
+
+func (m *MockUserRepository) CreateUserToken(ctx context.Context, token models.UserToken) error {
+	return m.MockCreateUserToken(token)
+}
+
+func (m *MockUserRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (models.User, error) {
+	return m.MockResetPassword(tokenHash, passwordHash, now)
+}
+
+func (m *MockUserRepository) VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (models.User, error) {
+	return m.MockVerifyEmail(tokenHash, now)
+}
+
+func (m *MockUserRepository) ChangePassword(ctx context.Context, userID, passwordHash string, now time.Time) (models.User, error) {
+	return m.MockChangePassword(userID, passwordHash, now)
+}
+
+func (m *MockUserRepository) RehashPassword(ctx context.Context, userID, oldHash, newHash string) error {
+	return m.MockRehashPassword(userID, oldHash, newHash)
+}
+
+func (m *MockUserRepository) PatchUser(ctx context.Context, id string, changes map[string]interface{}) (models.User, error) {
+	return m.MockPatchUser(id, changes)
+}
+
+func (m *MockUserRepository) RestoreUser(ctx context.Context, id string) (models.User, error) {
+	return m.MockRestoreUser(id)
+}
+
+func (m *MockUserRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return m.MockPurgeDeleted(before)
+}
+
 func TestListUsers(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -140,7 +217,7 @@ func TestCreateUser(t *testing.T) {
 	}{
 		{
 			name:           "Success",
-			input:          models.User{FirstName: "John", LastName: "Doe", Email: "john.doe@example.com", Phone: "123-456-7890", Password: "password123"},
+			input:          models.User{FirstName: "John", LastName: "Doe", Email: "john.doe@example.com", Phone: "123-456-7890", Password: "correct-horse-42"},
 			mockUser:       models.User{UserID: "1", FirstName: "John", LastName: "Doe", Email: "john.doe@example.com", Phone: "123-456-7890"},
 			mockError:      nil,
 			expectedStatus: http.StatusCreated,
@@ -148,7 +225,7 @@ func TestCreateUser(t *testing.T) {
 		},
 		{
 			name:           "Missing FirstName",
-			input:          models.User{LastName: "Doe", Email: "john@example.com", Phone: "123-456-7890", Password: "password123"},
+			input:          models.User{LastName: "Doe", Email: "john@example.com", Phone: "123-456-7890", Password: "correct-horse-42"},
 			mockUser:       models.User{},
 			mockError:      errors.New("first name is required"),
 			expectedStatus: http.StatusBadRequest,
@@ -156,7 +233,7 @@ func TestCreateUser(t *testing.T) {
 		},
 		{
 			name:           "Missing LastName",
-			input:          models.User{FirstName: "John", Email: "john@example.com", Phone: "123-456-7890", Password: "password123"},
+			input:          models.User{FirstName: "John", Email: "john@example.com", Phone: "123-456-7890", Password: "correct-horse-42"},
 			mockUser:       models.User{},
 			mockError:      errors.New("last name is required"),
 			expectedStatus: http.StatusBadRequest,
@@ -164,7 +241,7 @@ func TestCreateUser(t *testing.T) {
 		},
 		{
 			name:           "Missing Email",
-			input:          models.User{FirstName: "John", LastName: "Doe", Phone: "123-456-7890", Password: "password123"},
+			input:          models.User{FirstName: "John", LastName: "Doe", Phone: "123-456-7890", Password: "correct-horse-42"},
 			mockUser:       models.User{},
 			mockError:      errors.New("email is required"),
 			expectedStatus: http.StatusBadRequest,
@@ -172,7 +249,7 @@ func TestCreateUser(t *testing.T) {
 		},
 		{
 			name:           "Missing Phone",
-			input:          models.User{FirstName: "John", LastName: "Doe", Email: "john@example.com", Password: "password123"},
+			input:          models.User{FirstName: "John", LastName: "Doe", Email: "john@example.com", Password: "correct-horse-42"},
 			mockUser:       models.User{},
 			mockError:      errors.New("phone is required"),
 			expectedStatus: http.StatusBadRequest,
@@ -205,7 +282,7 @@ func TestCreateUser(t *testing.T) {
 		},
 		{
 			name:           "Duplicate Email",
-			input:          models.User{FirstName: "John", LastName: "Doe", Email: "existing@example.com", Phone: "123-456-7890", Password: "password123"},
+			input:          models.User{FirstName: "John", LastName: "Doe", Email: "existing@example.com", Phone: "123-456-7890", Password: "correct-horse-42"},
 			mockUser:       models.User{},
 			mockError:      errors.New("duplicate email address"),
 			expectedStatus: http.StatusConflict,
@@ -213,7 +290,7 @@ func TestCreateUser(t *testing.T) {
 		},
 		{
 			name:           "Database Error",
-			input:          models.User{FirstName: "Jane", LastName: "Hunter", Email: "jane.hunter@example.com", Phone: "123-456-7890", Password: "password123"},
+			input:          models.User{FirstName: "Jane", LastName: "Hunter", Email: "jane.hunter@example.com", Phone: "123-456-7890", Password: "correct-horse-42"},
 			mockUser:       models.User{},
 			mockError:      errors.New("database connection failed"),
 			expectedStatus: http.StatusInternalServerError,
@@ -227,6 +304,9 @@ func TestCreateUser(t *testing.T) {
 				MockCreateUser: func(user models.User) (models.User, error) {
 					return tt.mockUser, tt.mockError
 				},
+				MockCreateUserToken: func(token models.UserToken) error {
+					return nil
+				},
 			}
 
 			handler := NewUserHandler(mockRepo)
@@ -397,6 +477,14 @@ func TestUpdateUser(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			setContentType: true,
 		},
+		{
+			name:           "Password Change Not Allowed",
+			userID:         "1",
+			input:          models.User{FirstName: "Updated", LastName: "User", Email: "updated@example.com", Phone: "123-456-7890", Password: "correct-horse-42"},
+			mockUser:       models.User{},
+			expectedStatus: http.StatusBadRequest,
+			setContentType: true,
+		},
 		{
 			name:           "Not Found",
 			userID:         "999",
@@ -501,6 +589,67 @@ func TestUpdateUser(t *testing.T) {
 	}
 }
 
+func TestPatchUser(t *testing.T) {
+	tests := []struct {
+		name            string
+		userID          string
+		body            string
+		mockError       error
+		expectedStatus  int
+		expectedChanges map[string]interface{}
+	}{
+		{
+			name:            "Only provided fields",
+			userID:          "1",
+			body:            `{"phone": "555-0199"}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{"phone": "555-0199"},
+		},
+		{
+			name:            "Several fields",
+			userID:          "1",
+			body:            `{"first_name": "Jane", "email": "jane@example.com"}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanges: map[string]interface{}{"first_name": "Jane", "email": "jane@example.com"},
+		},
+		{name: "Clear required field", userID: "1", body: `{"last_name": null}`, expectedStatus: http.StatusBadRequest},
+		{name: "Empty field", userID: "1", body: `{"email": ""}`, expectedStatus: http.StatusBadRequest},
+		{name: "Password", userID: "1", body: `{"password": "correct-horse-42"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Read-only field", userID: "1", body: `{"user_id": "2"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Not an object", userID: "1", body: `"Jane"`, expectedStatus: http.StatusBadRequest},
+		{name: "Empty User ID", userID: "", body: `{"phone": "555-0199"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Not Found", userID: "999", body: `{"phone": "555-0199"}`, mockError: errors.New("user not found"), expectedStatus: http.StatusNotFound},
+		{name: "Duplicate Email", userID: "1", body: `{"email": "taken@example.com"}`, mockError: errors.New("user with this email already exists"), expectedStatus: http.StatusConflict},
+		{name: "Database Error", userID: "1", body: `{"phone": "555-0199"}`, mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotChanges map[string]interface{}
+			mockRepo := &MockUserRepository{
+				MockPatchUser: func(id string, changes map[string]interface{}) (models.User, error) {
+					gotChanges = changes
+					return models.User{UserID: id}, tt.mockError
+				},
+			}
+
+			handler := NewUserHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPatch, "/users/"+tt.userID, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			req = mux.SetURLVars(req, map[string]string{"user_id": tt.userID})
+			w := httptest.NewRecorder()
+			handler.PatchUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedChanges != nil && !reflect.DeepEqual(gotChanges, tt.expectedChanges) {
+				t.Errorf("Expected changes %v, got %v", tt.expectedChanges, gotChanges)
+			}
+		})
+	}
+}
+
 func TestDeleteUser(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -574,3 +723,291 @@ func TestDeleteUser(t *testing.T) {
 		})
 	}
 }
+
+// loginRepo is an in-memory user store for Login tests that applies the
+// lockout repository methods to a single user.
+type loginRepo struct {
+	user       models.User
+	ipFailures int64
+	events     []models.LoginEvent
+}
+
+func (l *loginRepo) mock() *MockUserRepository {
+	return &MockUserRepository{
+		MockGetUserByEmail: func(email string) (models.User, error) {
+			if email != l.user.Email {
+				return models.User{}, errors.New("user not found")
+			}
+			return l.user, nil
+		},
+		MockRecordFailedLogin: func(id string) (int, error) {
+			l.user.FailedLoginAttempts++
+			return l.user.FailedLoginAttempts, nil
+		},
+		MockLockUser: func(id string, until time.Time) error {
+			l.user.LockedUntil = &until
+			l.user.LockoutCount++
+			l.user.FailedLoginAttempts = 0
+			return nil
+		},
+		MockResetFailedLogins: func(id string) error {
+			l.user.FailedLoginAttempts, l.user.LockoutCount = 0, 0
+			return nil
+		},
+		MockRecordLoginEvent: func(event models.LoginEvent) error {
+			l.events = append(l.events, event)
+			return nil
+		},
+		MockCountFailedLoginsByIP: func(ip string, since time.Time) (int64, error) {
+			return l.ipFailures, nil
+		},
+		MockGetUserById: func(id string) (models.User, error) {
+			if id != l.user.UserID {
+				return models.User{}, errors.New("user not found")
+			}
+			return l.user, nil
+		},
+		MockChangePassword: func(id, passwordHash string, now time.Time) (models.User, error) {
+			l.user.PasswordHash = passwordHash
+			l.user.PasswordChangedAt = &now
+			return l.user, nil
+		},
+		MockRehashPassword: func(id, oldHash, newHash string) error {
+			if l.user.PasswordHash == oldHash {
+				l.user.PasswordHash = newHash
+			}
+			return nil
+		},
+	}
+}
+
+func TestLogin(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	lockedUntil := now.Add(30 * time.Second)
+	expiredLock := now.Add(-time.Second)
+
+	tests := []struct {
+		name           string
+		user           models.User
+		ipFailures     int64
+		email          string
+		password       string
+		expectedStatus int
+		expectedReason string
+		retryAfter     string
+	}{
+		{name: "Success", password: "correct-password", expectedStatus: http.StatusOK},
+		{name: "Unknown user", email: "nobody@example.com", password: "correct-password", expectedStatus: http.StatusUnauthorized, expectedReason: models.LoginReasonUnknownUser},
+		{name: "Wrong password", password: "wrong", expectedStatus: http.StatusUnauthorized, expectedReason: models.LoginReasonInvalidPassword},
+		{
+			name:           "Locked account refuses correct password",
+			user:           models.User{LockedUntil: &lockedUntil},
+			password:       "correct-password",
+			expectedStatus: http.StatusLocked,
+			expectedReason: models.LoginReasonLocked,
+			retryAfter:     "30",
+		},
+		{name: "Expired lock allows login", user: models.User{LockedUntil: &expiredLock}, password: "correct-password", expectedStatus: http.StatusOK},
+		{
+			name:           "Throttled address",
+			ipFailures:     20,
+			password:       "correct-password",
+			expectedStatus: http.StatusTooManyRequests,
+			expectedReason: models.LoginReasonIPThrottled,
+			retryAfter:     "900",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.UserID, user.Email, user.PasswordHash = "1", "john@example.com", string(hash)
+			repo := &loginRepo{user: user, ipFailures: tt.ipFailures}
+			handler := NewUserHandler(repo.mock())
+			handler.now = func() time.Time { return now }
+
+			email := tt.email
+			if email == "" {
+				email = user.Email
+			}
+			body, _ := json.Marshal(map[string]string{"email": email, "password": tt.password})
+			req := httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(body))
+			req.RemoteAddr = "203.0.113.7:4321"
+			req.Header.Set("User-Agent", "test-agent")
+			w := httptest.NewRecorder()
+
+			handler.Login(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Expected Retry-After %q, got %q", tt.retryAfter, got)
+			}
+			if len(repo.events) != 1 {
+				t.Fatalf("Expected one login event, got %d", len(repo.events))
+			}
+			event := repo.events[0]
+			if event.Success != (tt.expectedStatus == http.StatusOK) || event.Reason != tt.expectedReason {
+				t.Errorf("Expected event success=%v reason=%q, got %+v", tt.expectedStatus == http.StatusOK, tt.expectedReason, event)
+			}
+			if event.IP != "203.0.113.7" || event.UserAgent != "test-agent" || event.Email != email {
+				t.Errorf("Expected event to record address, user agent and email, got %+v", event)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := &loginRepo{user: models.User{UserID: "1", Email: "john@example.com", PasswordHash: string(hash)}}
+	handler := NewUserHandlerWithOptions(repo.mock(), Options{Lockout: LockoutConfig{
+		MaxFailedAttempts: 3,
+		Duration:          time.Minute,
+		MaxDuration:       3 * time.Minute,
+	}})
+	handler.now = func() time.Time { return now }
+
+	login := func(password string) int {
+		body, _ := json.Marshal(map[string]string{"email": "john@example.com", "password": password})
+		w := httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(body)))
+		return w.Code
+	}
+
+	// Each lockout doubles the previous one, up to the maximum
+	for i, expected := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		for attempt := 0; attempt < 3; attempt++ {
+			if code := login("wrong"); code != http.StatusUnauthorized {
+				t.Fatalf("Lockout %d attempt %d: expected 401, got %d", i+1, attempt+1, code)
+			}
+		}
+		if repo.user.LockedUntil == nil || !repo.user.LockedUntil.Equal(now.Add(expected)) {
+			t.Fatalf("Lockout %d: expected lock until %s, got %v", i+1, now.Add(expected), repo.user.LockedUntil)
+		}
+		if code := login("correct-password"); code != http.StatusLocked {
+			t.Fatalf("Lockout %d: expected 423 while locked, got %d", i+1, code)
+		}
+		now = *repo.user.LockedUntil
+	}
+
+	if code := login("correct-password"); code != http.StatusOK {
+		t.Fatalf("Expected login after lock expired, got %d", code)
+	}
+	if repo.user.LockoutCount != 0 || repo.user.FailedLoginAttempts != 0 {
+		t.Errorf("Expected successful login to reset counters, got %+v", repo.user)
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &loginRepo{user: models.User{UserID: "1", Email: "john@example.com", PasswordHash: string(hash)}}
+	handler := NewUserHandlerWithOptions(repo.mock(), Options{BcryptCost: bcrypt.MinCost + 1})
+
+	login := func(password string) int {
+		body, _ := json.Marshal(map[string]string{"email": "john@example.com", "password": password})
+		w := httptest.NewRecorder()
+		handler.Login(w, httptest.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(body)))
+		return w.Code
+	}
+
+	if code := login("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for a wrong password, got %d", code)
+	}
+	if repo.user.PasswordHash != string(hash) {
+		t.Fatal("Expected a failed login to keep the hash")
+	}
+
+	if code := login("correct-password"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if cost, _ := bcrypt.Cost([]byte(repo.user.PasswordHash)); cost != bcrypt.MinCost+1 {
+		t.Errorf("Expected the hash to be upgraded to cost %d, got %d", bcrypt.MinCost+1, cost)
+	}
+	if code := login("correct-password"); code != http.StatusOK {
+		t.Errorf("Expected the rehashed password to keep working, got %d", code)
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", userID: "1", expectedStatus: http.StatusOK},
+		{name: "Empty User ID", userID: "", expectedStatus: http.StatusBadRequest},
+		{name: "Not Found", userID: "999", mockError: errors.New("user not found"), expectedStatus: http.StatusNotFound},
+		{name: "Database Error", userID: "1", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockUserRepository{
+				MockUnlockUser: func(id string) (models.User, error) {
+					return models.User{UserID: id}, tt.mockError
+				},
+			}
+
+			handler := NewUserHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPost, "/users/"+tt.userID+"/unlock", nil)
+			req = mux.SetURLVars(req, map[string]string{"user_id": tt.userID})
+			w := httptest.NewRecorder()
+
+			handler.UnlockUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		mockError      error
+		expectedStatus int
+	}{
+		{name: "Success", userID: "1", expectedStatus: http.StatusOK},
+		{name: "Empty User ID", userID: "", expectedStatus: http.StatusBadRequest},
+		{name: "Not Found", userID: "999", mockError: errors.New("user not found"), expectedStatus: http.StatusNotFound},
+		{name: "Email Taken", userID: "1", mockError: errors.New("user with this email already exists"), expectedStatus: http.StatusConflict},
+		{name: "Anonymized", userID: "1", mockError: repository.ErrUserAnonymized, expectedStatus: http.StatusConflict},
+		{name: "Database Error", userID: "1", mockError: errors.New("database connection failed"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockUserRepository{
+				MockRestoreUser: func(id string) (models.User, error) {
+					return models.User{UserID: id}, tt.mockError
+				},
+			}
+
+			handler := NewUserHandler(mockRepo)
+			req := httptest.NewRequest(http.MethodPost, "/users/"+tt.userID+"/restore", nil)
+			req = mux.SetURLVars(req, map[string]string{"user_id": tt.userID})
+			w := httptest.NewRecorder()
+
+			handler.RestoreUser(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Reasons recorded for failed logins.
+const (
+	LoginReasonUnknownUser     = "unknown_user"
+	LoginReasonInvalidPassword = "invalid_password"
+	LoginReasonLocked          = "locked"
+	LoginReasonIPThrottled     = "ip_throttled"
+	// A wrong current password when changing the password. It counts
+	// towards the IP throttle but not the account lockout.
+	LoginReasonPasswordChange = "password_change"
+)
+
+// LoginEvent is an audit record of one login attempt. UserID is empty when
+// the email didn't match an account.
+type LoginEvent struct {
+	LoginEventID int64     `gorm:"primaryKey" json:"login_event_id"`
+	UserID       string    `gorm:"not null;default:'';index:idx_login_events_user_id,priority:1" json:"user_id,omitempty"`
+	Email        string    `gorm:"not null" json:"email"`
+	IP           string    `gorm:"not null;index:idx_login_events_ip,priority:1" json:"ip"`
+	UserAgent    string    `gorm:"not null;default:''" json:"user_agent"`
+	Success      bool      `gorm:"not null" json:"success"`
+	Reason       string    `gorm:"not null;default:''" json:"reason,omitempty"`
+	CreatedAt    time.Time `gorm:"not null;index:idx_login_events_user_id,priority:2;index:idx_login_events_ip,priority:2" json:"created_at"`
+}
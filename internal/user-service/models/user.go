@@ -1,15 +1,42 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	UserID       string    `gorm:"primaryKey" json:"user_id"`
 	FirstName    string    `json:"first_name"`
 	LastName     string    `json:"last_name"`
-	Email        string    `gorm:"uniqueIndex" json:"email"`
+	Email        string    `gorm:"uniqueIndex:idx_users_email,where:deleted_at IS NULL" json:"email"`
 	Phone        string    `json:"phone"`
 	PasswordHash string    `json:"-"`
 	Password     string    `gorm:"-" json:"password,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// EmailVerifiedAt is set once the user follows the verification link.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// PasswordChangedAt is set when the password is changed or reset. Login
+	// issues no sessions or tokens yet, so nothing is revoked by it; any
+	// added later should be rejected when issued before it.
+	PasswordChangedAt *time.Time `json:"-"`
+	// DeletedAt is set when the user is deleted; the email can then be
+	// registered again.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// AnonymizedAt is set when a deleted user who placed orders is purged:
+	// their personal details are erased but the row stays for the orders.
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+
+	// Login lockout state. LockoutCount counts lockouts since the last
+	// successful login and doubles each new lockout's duration.
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockoutCount        int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+}
+
+// IsLocked reports whether the account is locked at now.
+func (u User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
 }
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Purposes a UserToken can be issued for.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use token mailed to a user. Only the hash of the
+// token is stored, so a database leak doesn't expose usable tokens.
+type UserToken struct {
+	TokenHash string    `gorm:"primaryKey"`
+	UserID    string    `gorm:"not null;index:idx_user_tokens_user_id,priority:1"`
+	Purpose   string    `gorm:"not null;index:idx_user_tokens_user_id,priority:2"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// HashToken returns the value stored in TokenHash for token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
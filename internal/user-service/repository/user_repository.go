@@ -1,8 +1,11 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"gocart/internal/user-service/models"
+	"gocart/pkg/db"
+	"gocart/pkg/tracing"
 	"strings"
 	"time"
 
@@ -10,13 +13,67 @@ import (
 	"gorm.io/gorm"
 )
 
+var tracer = tracing.Tracer("gocart/internal/user-service/repository")
+
+// ErrInvalidToken is returned when a user token is unknown, expired, already
+// used or issued for another purpose.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ErrUserAnonymized is returned when restoring a deleted user whose personal
+// details have already been erased.
+var ErrUserAnonymized = errors.New("user has been anonymized and can't be restored")
+
 type UserRepository interface {
-	CreateUser(user models.User) (models.User, error)
-	GetUserById(userID string) (models.User, error)
-	GetUserByEmail(email string) (models.User, error)
-	UpdateUser(user models.User) (models.User, error)
-	DeleteUser(userID string) (models.User, error)
-	ListAllUsers() ([]models.User, error)
+	CreateUser(ctx context.Context, user models.User) (models.User, error)
+	GetUserById(ctx context.Context, userID string) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	UpdateUser(ctx context.Context, user models.User) (models.User, error)
+	// PatchUser sets the given columns, including zero values, and returns
+	// the updated user.
+	PatchUser(ctx context.Context, userID string, changes map[string]interface{}) (models.User, error)
+	// DeleteUser soft-deletes a user and returns it.
+	DeleteUser(ctx context.Context, userID string) (models.User, error)
+	// RestoreUser undoes DeleteUser. It fails if the email has since been
+	// taken by another user, or with ErrUserAnonymized once the user has
+	// been purged.
+	RestoreUser(ctx context.Context, userID string) (models.User, error)
+	// PurgeDeleted permanently removes users deleted before the given time.
+	// Users who placed orders are anonymized instead, since the orders must
+	// keep pointing at them.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	ListAllUsers(ctx context.Context) ([]models.User, error)
+
+	// RecordFailedLogin increments the user's failed login counter and
+	// returns its new value.
+	RecordFailedLogin(ctx context.Context, userID string) (int, error)
+	// LockUser locks the account until the given time and starts a new
+	// failure count.
+	LockUser(ctx context.Context, userID string, until time.Time) error
+	// ResetFailedLogins clears failure and lockout counters after a
+	// successful login.
+	ResetFailedLogins(ctx context.Context, userID string) error
+	// UnlockUser lifts a lockout and clears its counters.
+	UnlockUser(ctx context.Context, userID string) (models.User, error)
+	RecordLoginEvent(ctx context.Context, event models.LoginEvent) error
+	// CountFailedLoginsByIP counts failed logins from ip since the given
+	// time, excluding attempts that were already throttled.
+	CountFailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int64, error)
+
+	// CreateUserToken stores token and revokes the user's earlier unused
+	// tokens for the same purpose.
+	CreateUserToken(ctx context.Context, token models.UserToken) error
+	// ResetPassword consumes a password reset token, sets the new password
+	// hash, lifts any login lockout and revokes the user's other tokens.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (models.User, error)
+	// ChangePassword sets a new password hash and revokes the user's unused
+	// tokens.
+	ChangePassword(ctx context.Context, userID, passwordHash string, now time.Time) (models.User, error)
+	// RehashPassword replaces the password hash with one of a different
+	// bcrypt cost, unless the password changed since oldHash was read.
+	RehashPassword(ctx context.Context, userID, oldHash, newHash string) error
+	// VerifyEmail consumes an email verification token and marks the user's
+	// email as verified.
+	VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (models.User, error)
 }
 
 type userRepository struct {
@@ -29,10 +86,13 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	}
 }
 
-func (r *userRepository) CreateUser(user models.User) (models.User, error) {
+func (r *userRepository) CreateUser(ctx context.Context, user models.User) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.CreateUser")
+	defer span.End()
+
 	user.CreatedAt = time.Now()
 	user.UserID = uuid.New().String()
-	if err := r.db.Create(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Create(&user).Error; err != nil {
 		// Check for duplicate email error
 		if strings.Contains(err.Error(), "duplicate key") ||
 			strings.Contains(err.Error(), "UNIQUE constraint failed") ||
@@ -44,9 +104,13 @@ func (r *userRepository) CreateUser(user models.User) (models.User, error) {
 	return user, nil
 }
 
-func (r *userRepository) GetUserById(userID string) (models.User, error) {
+func (r *userRepository) GetUserById(ctx context.Context, userID string) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.GetUserById")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
 	var user models.User
-	if err := r.db.Where("user_id = ?", userID).First(&user).Error; err != nil {
+	if err := db.Scoped(ctx, r.db).Where("user_id = ?", userID).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return models.User{}, errors.New("user not found")
 		}
@@ -55,9 +119,12 @@ func (r *userRepository) GetUserById(userID string) (models.User, error) {
 	return user, nil
 }
 
-func (r *userRepository) GetUserByEmail(email string) (models.User, error) {
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.GetUserByEmail")
+	defer span.End()
+
 	var user models.User
-	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return models.User{}, errors.New("user not found")
 		}
@@ -66,25 +133,116 @@ func (r *userRepository) GetUserByEmail(email string) (models.User, error) {
 	return user, nil
 }
 
-func (r *userRepository) DeleteUser(userID string) (models.User, error) {
+func (r *userRepository) DeleteUser(ctx context.Context, userID string) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.DeleteUser")
+	defer span.End()
+
 	var user models.User
 	// First get the user to return it
-	if err := r.db.Where("user_id = ?", userID).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return models.User{}, errors.New("user not found")
 		}
 		return models.User{}, err
 	}
 	// Then delete it
-	if err := r.db.Where("user_id = ?", userID).Delete(&models.User{}).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.User{}).Error; err != nil {
 		return models.User{}, err
 	}
 	return user, nil
 }
 
-func (r *userRepository) UpdateUser(user models.User) (models.User, error) {
+func (r *userRepository) RestoreUser(ctx context.Context, userID string) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.RestoreUser")
+	defer span.End()
+
+	var user models.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+		if user.AnonymizedAt != nil {
+			return ErrUserAnonymized
+		}
+		err := tx.Unscoped().Model(&models.User{}).
+			Where("user_id = ?", userID).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		user.DeletedAt = gorm.DeletedAt{}
+		return nil
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") ||
+			strings.Contains(err.Error(), "UNIQUE constraint failed") ||
+			strings.Contains(err.Error(), "duplicate entry") {
+			return models.User{}, errors.New("user with this email already exists")
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.PurgeDeleted")
+	defer span.End()
+
+	const hasOrders = "EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id)"
+	// Truncated to what Postgres stores, so the rows can be found by it
+	now := time.Now().Truncate(time.Microsecond)
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Where("deleted_at < ?", before).
+			Where("NOT " + hasOrders).
+			Delete(&models.User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+
+		// Clearing the email is safe: it is only unique among live users
+		result = tx.Unscoped().Model(&models.User{}).
+			Where("deleted_at < ? AND anonymized_at IS NULL", before).
+			Where(hasOrders).
+			UpdateColumns(map[string]interface{}{
+				"first_name":        "",
+				"last_name":         "",
+				"email":             "",
+				"phone":             "",
+				"password_hash":     "",
+				"email_verified_at": nil,
+				"locked_until":      nil,
+				"anonymized_at":     now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged += result.RowsAffected
+
+		// Tokens and login history would tie the rows back to a person.
+		// Tokens of removed users went with them through the foreign key.
+		anonymized := tx.Unscoped().Model(&models.User{}).Select("user_id").Where("anonymized_at = ?", now)
+		if err := tx.Where("user_id IN (?)", anonymized).Delete(&models.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id IN (?)", anonymized).
+			Or("user_id <> '' AND NOT EXISTS (SELECT 1 FROM users WHERE users.user_id = login_events.user_id)").
+			Delete(&models.LoginEvent{}).Error
+	})
+	return purged, err
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, user models.User) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.UpdateUser")
+	defer span.End()
+
 	user.UpdatedAt = time.Now()
-	if err := r.db.Model(&models.User{}).Where("user_id = ?", user.UserID).Updates(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&models.User{}).Where("user_id = ?", user.UserID).Updates(&user).Error; err != nil {
 		// Check for duplicate email error
 		if strings.Contains(err.Error(), "duplicate key") ||
 			strings.Contains(err.Error(), "UNIQUE constraint failed") ||
@@ -96,10 +254,245 @@ func (r *userRepository) UpdateUser(user models.User) (models.User, error) {
 	return user, nil
 }
 
-func (r *userRepository) ListAllUsers() ([]models.User, error) {
+func (r *userRepository) PatchUser(ctx context.Context, userID string, changes map[string]interface{}) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.PatchUser")
+	defer span.End()
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	for column, value := range changes {
+		updates[column] = value
+	}
+
+	var user models.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("user_id = ?", userID).UpdateColumns(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("user not found")
+		}
+		return tx.Where("user_id = ?", userID).First(&user).Error
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") ||
+			strings.Contains(err.Error(), "UNIQUE constraint failed") ||
+			strings.Contains(err.Error(), "duplicate entry") {
+			return models.User{}, errors.New("user with this email already exists")
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) ListAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.ListAllUsers")
+	defer span.End()
+	ctx = db.ReadOnly(ctx)
+
 	var users []models.User
-	if err := r.db.Find(&users).Error; err != nil {
+	if err := db.Scoped(ctx, r.db).Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
 }
+
+func (r *userRepository) RecordFailedLogin(ctx context.Context, userID string) (int, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.RecordFailedLogin")
+	defer span.End()
+
+	// Increment in the database so concurrent failures all count
+	var attempts []int
+	err := r.db.WithContext(ctx).
+		Raw("UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE user_id = ? RETURNING failed_login_attempts", userID).
+		Scan(&attempts).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(attempts) == 0 {
+		return 0, errors.New("user not found")
+	}
+	return attempts[0], nil
+}
+
+func (r *userRepository) LockUser(ctx context.Context, userID string, until time.Time) error {
+	ctx, span := tracer.Start(ctx, "UserRepository.LockUser")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+		"locked_until":          until,
+		"lockout_count":         gorm.Expr("lockout_count + 1"),
+		"failed_login_attempts": 0,
+	}).Error
+}
+
+func (r *userRepository) ResetFailedLogins(ctx context.Context, userID string) error {
+	ctx, span := tracer.Start(ctx, "UserRepository.ResetFailedLogins")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"lockout_count":         0,
+	}).Error
+}
+
+func (r *userRepository) UnlockUser(ctx context.Context, userID string) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.UnlockUser")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+		"locked_until":          nil,
+		"failed_login_attempts": 0,
+		"lockout_count":         0,
+	})
+	if result.Error != nil {
+		return models.User{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.User{}, errors.New("user not found")
+	}
+
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) RecordLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	ctx, span := tracer.Start(ctx, "UserRepository.RecordLoginEvent")
+	defer span.End()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return r.db.WithContext(ctx).Create(&event).Error
+}
+
+func (r *userRepository) CountFailedLoginsByIP(ctx context.Context, ip string, since time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.CountFailedLoginsByIP")
+	defer span.End()
+
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.LoginEvent{}).
+		Where("ip = ? AND created_at >= ? AND NOT success AND reason <> ?", ip, since, models.LoginReasonIPThrottled).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *userRepository) CreateUserToken(ctx context.Context, token models.UserToken) error {
+	ctx, span := tracer.Start(ctx, "UserRepository.CreateUserToken")
+	defer span.End()
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Update("used_at", token.CreatedAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&token).Error
+	})
+}
+
+func (r *userRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.ResetPassword")
+	defer span.End()
+
+	return r.redeemToken(ctx, tokenHash, models.TokenPurposePasswordReset, now, map[string]interface{}{
+		"password_hash":         passwordHash,
+		"password_changed_at":   now,
+		"updated_at":            now,
+		"failed_login_attempts": 0,
+		"lockout_count":         0,
+		"locked_until":          nil,
+	})
+}
+
+func (r *userRepository) ChangePassword(ctx context.Context, userID, passwordHash string, now time.Time) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.ChangePassword")
+	defer span.End()
+
+	var user models.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+			"password_hash":       passwordHash,
+			"password_changed_at": now,
+			"updated_at":          now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("user not found")
+		}
+		if err := revokeUserTokens(tx, userID, now); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).First(&user).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) RehashPassword(ctx context.Context, userID, oldHash, newHash string) error {
+	ctx, span := tracer.Start(ctx, "UserRepository.RehashPassword")
+	defer span.End()
+
+	return r.db.WithContext(ctx).Model(&models.User{}).
+		Where("user_id = ? AND password_hash = ?", userID, oldHash).
+		UpdateColumn("password_hash", newHash).Error
+}
+
+// revokeUserTokens marks every unused token of the user as used.
+func revokeUserTokens(tx *gorm.DB, userID string, now time.Time) error {
+	return tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error
+}
+
+func (r *userRepository) VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.VerifyEmail")
+	defer span.End()
+
+	return r.redeemToken(ctx, tokenHash, models.TokenPurposeEmailVerification, now, map[string]interface{}{
+		"email_verified_at": now,
+	})
+}
+
+// redeemToken marks a valid token as used and applies updates to its user in
+// one transaction, so a token can't be redeemed twice concurrently.
+func (r *userRepository) redeemToken(ctx context.Context, tokenHash, purpose string, now time.Time, updates map[string]interface{}) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var userIDs []string
+		err := tx.Raw("UPDATE user_tokens SET used_at = ? WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ? RETURNING user_id",
+			now, tokenHash, purpose, now).Scan(&userIDs).Error
+		if err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return ErrInvalidToken
+		}
+
+		if err := tx.Model(&models.User{}).Where("user_id = ?", userIDs[0]).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		// A new password also invalidates any other outstanding tokens
+		if _, ok := updates["password_hash"]; ok {
+			if err := revokeUserTokens(tx, userIDs[0], now); err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ?", userIDs[0]).First(&user).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
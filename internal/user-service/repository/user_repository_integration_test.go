@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	orderModels "gocart/internal/order-management-service/models"
 	"gocart/internal/user-service/models"
+	"gocart/pkg/db"
 	"gocart/pkg/testutils"
 	"log"
 	"os"
@@ -15,7 +19,8 @@ import (
 func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 	config := testutils.TestDBConfig{
 		ServiceName: "users_repo",
-		Models:      []interface{}{&models.User{}},
+		// Orders are migrated so purge can check which users placed them
+		Models: []interface{}{&models.User{}, &models.LoginEvent{}, &models.UserToken{}, &orderModels.Order{}},
 	}
 	return testutils.SetupTestDB(t, config)
 }
@@ -40,14 +45,14 @@ func TestCreateAndGetUserIntegration(t *testing.T) {
 	}
 
 	logger.Printf("Creating test user with ID: %s", testUser.UserID)
-	createdUser, err := repo.CreateUser(testUser)
+	createdUser, err := repo.CreateUser(context.Background(), testUser)
 	if err != nil {
 		t.Fatalf("Failed to create test user: %v", err)
 	}
 	logger.Printf("Successfully created test user: %+v", createdUser)
 
 	logger.Printf("Fetching user by ID: %s", createdUser.UserID)
-	fetchedUser, err := repo.GetUserById(createdUser.UserID)
+	fetchedUser, err := repo.GetUserById(context.Background(), createdUser.UserID)
 	if err != nil {
 		t.Fatalf("Failed to fetch user: %v", err)
 	}
@@ -94,14 +99,14 @@ func TestListAllUsersIntegration(t *testing.T) {
 	}
 
 	for _, user := range users {
-		_, err := repo.CreateUser(user)
+		_, err := repo.CreateUser(context.Background(), user)
 		if err != nil {
 			t.Fatalf("Failed to create user %s: %v", user.Email, err)
 		}
 		logger.Printf("Created user: %s", user.Email)
 	}
 
-	allUsers, err := repo.ListAllUsers()
+	allUsers, err := repo.ListAllUsers(context.Background())
 	if err != nil {
 		t.Fatalf("Failed to list all users: %v", err)
 	}
@@ -112,3 +117,315 @@ func TestListAllUsersIntegration(t *testing.T) {
 
 	logger.Printf("List all users test completed successfully with %d users", len(allUsers))
 }
+
+func TestLoginLockoutIntegration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	user, err := repo.CreateUser(ctx, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane.lockout@example.com", Phone: "555-0100"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	for expected := 1; expected <= 3; expected++ {
+		attempts, err := repo.RecordFailedLogin(ctx, user.UserID)
+		if err != nil || attempts != expected {
+			t.Fatalf("Expected %d failed attempts, got %d (%v)", expected, attempts, err)
+		}
+	}
+	if _, err := repo.RecordFailedLogin(ctx, "missing-user"); err == nil {
+		t.Error("Expected error recording a failed login for a missing user")
+	}
+
+	until := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	if err := repo.LockUser(ctx, user.UserID, until); err != nil {
+		t.Fatalf("Failed to lock user: %v", err)
+	}
+	locked, _ := repo.GetUserByEmail(ctx, user.Email)
+	if !locked.IsLocked(time.Now()) || locked.LockoutCount != 1 || locked.FailedLoginAttempts != 0 {
+		t.Errorf("Expected locked user with one lockout and reset attempts, got %+v", locked)
+	}
+
+	unlocked, err := repo.UnlockUser(ctx, user.UserID)
+	if err != nil {
+		t.Fatalf("Failed to unlock user: %v", err)
+	}
+	if unlocked.LockedUntil != nil || unlocked.LockoutCount != 0 {
+		t.Errorf("Expected unlocked user with cleared counters, got %+v", unlocked)
+	}
+	if _, err := repo.UnlockUser(ctx, "missing-user"); err == nil {
+		t.Error("Expected error unlocking a missing user")
+	}
+}
+
+func TestCountFailedLoginsByIPIntegration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	events := []models.LoginEvent{
+		{Email: "a@example.com", IP: "203.0.113.7", Reason: models.LoginReasonInvalidPassword, CreatedAt: now.Add(-time.Minute)},
+		{Email: "b@example.com", IP: "203.0.113.7", Reason: models.LoginReasonUnknownUser, CreatedAt: now.Add(-2 * time.Minute)},
+		{Email: "a@example.com", IP: "203.0.113.7", Reason: models.LoginReasonIPThrottled, CreatedAt: now.Add(-time.Minute)},
+		{Email: "a@example.com", IP: "203.0.113.7", Success: true, CreatedAt: now.Add(-time.Minute)},
+		{Email: "a@example.com", IP: "203.0.113.7", Reason: models.LoginReasonInvalidPassword, CreatedAt: now.Add(-time.Hour)},
+		{Email: "a@example.com", IP: "198.51.100.1", Reason: models.LoginReasonInvalidPassword, CreatedAt: now.Add(-time.Minute)},
+	}
+	for _, event := range events {
+		if err := repo.RecordLoginEvent(ctx, event); err != nil {
+			t.Fatalf("Failed to record login event: %v", err)
+		}
+	}
+
+	count, err := repo.CountFailedLoginsByIP(ctx, "203.0.113.7", now.Add(-15*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to count failed logins: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 recent unthrottled failures, got %d", count)
+	}
+}
+
+func TestUserTokensIntegration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	user, err := repo.CreateUser(ctx, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane.tokens@example.com", Phone: "555-0100", PasswordHash: "old"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if _, err := repo.RecordFailedLogin(ctx, user.UserID); err != nil {
+		t.Fatalf("Failed to record failed login: %v", err)
+	}
+
+	issue := func(token, purpose string, expiresAt time.Time) {
+		t.Helper()
+		err := repo.CreateUserToken(ctx, models.UserToken{
+			TokenHash: models.HashToken(token),
+			UserID:    user.UserID,
+			Purpose:   purpose,
+			ExpiresAt: expiresAt,
+			CreatedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+	}
+
+	// A newer reset token revokes the older one
+	issue("first", models.TokenPurposePasswordReset, now.Add(time.Hour))
+	issue("second", models.TokenPurposePasswordReset, now.Add(time.Hour))
+	if _, err := repo.ResetPassword(ctx, models.HashToken("first"), "new", now); err != ErrInvalidToken {
+		t.Errorf("Expected superseded token to be invalid, got %v", err)
+	}
+
+	reset, err := repo.ResetPassword(ctx, models.HashToken("second"), "new", now)
+	if err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+	if reset.PasswordHash != "new" || reset.FailedLoginAttempts != 0 {
+		t.Errorf("Expected new password and cleared failed logins, got %+v", reset)
+	}
+	if _, err := repo.ResetPassword(ctx, models.HashToken("second"), "again", now); err != ErrInvalidToken {
+		t.Errorf("Expected used token to be invalid, got %v", err)
+	}
+
+	// Tokens only work for their own purpose and before they expire
+	issue("verify", models.TokenPurposeEmailVerification, now.Add(time.Hour))
+	if _, err := repo.ResetPassword(ctx, models.HashToken("verify"), "new", now); err != ErrInvalidToken {
+		t.Errorf("Expected verification token to be rejected for a reset, got %v", err)
+	}
+	if _, err := repo.VerifyEmail(ctx, models.HashToken("verify"), now.Add(2*time.Hour)); err != ErrInvalidToken {
+		t.Errorf("Expected expired token to be invalid, got %v", err)
+	}
+	verified, err := repo.VerifyEmail(ctx, models.HashToken("verify"), now)
+	if err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	if verified.EmailVerifiedAt == nil {
+		t.Error("Expected email_verified_at to be set")
+	}
+}
+
+func TestChangePasswordIntegration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	user, err := repo.CreateUser(ctx, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane.password@example.com", Phone: "555-0100", PasswordHash: "old"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	err = repo.CreateUserToken(ctx, models.UserToken{
+		TokenHash: models.HashToken("reset"),
+		UserID:    user.UserID,
+		Purpose:   models.TokenPurposePasswordReset,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	changed, err := repo.ChangePassword(ctx, user.UserID, "new", now)
+	if err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+	if changed.PasswordHash != "new" || changed.PasswordChangedAt == nil {
+		t.Errorf("Expected new hash and change time, got %+v", changed)
+	}
+	if _, err := repo.ResetPassword(ctx, models.HashToken("reset"), "other", now); err != ErrInvalidToken {
+		t.Errorf("Expected outstanding reset token to be revoked, got %v", err)
+	}
+	if _, err := repo.ChangePassword(ctx, "missing-user", "new", now); err == nil {
+		t.Error("Expected error changing the password of a missing user")
+	}
+
+	// A rehash only applies while the hash is still the one that was read
+	if err := repo.RehashPassword(ctx, user.UserID, "old", "stale"); err != nil {
+		t.Fatalf("Failed to rehash: %v", err)
+	}
+	if err := repo.RehashPassword(ctx, user.UserID, "new", "rehashed"); err != nil {
+		t.Fatalf("Failed to rehash: %v", err)
+	}
+	stored, _ := repo.GetUserById(ctx, user.UserID)
+	if stored.PasswordHash != "rehashed" {
+		t.Errorf("Expected only the current hash to be replaced, got %q", stored.PasswordHash)
+	}
+}
+
+func TestPatchUserIntegration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	user, err := repo.CreateUser(ctx, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane.patch@example.com", Phone: "555-0100"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	if _, err := repo.CreateUser(ctx, models.User{FirstName: "John", LastName: "Doe", Email: "john.patch@example.com", Phone: "555-0101"}); err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	patched, err := repo.PatchUser(ctx, user.UserID, map[string]interface{}{"phone": "555-0199"})
+	if err != nil {
+		t.Fatalf("Failed to patch user: %v", err)
+	}
+	if patched.Phone != "555-0199" || patched.FirstName != "Jane" || patched.Email != user.Email {
+		t.Errorf("Expected only the phone to change, got %+v", patched)
+	}
+
+	if _, err := repo.PatchUser(ctx, user.UserID, map[string]interface{}{"email": "john.patch@example.com"}); err == nil || err.Error() != "user with this email already exists" {
+		t.Errorf("Expected duplicate email error, got %v", err)
+	}
+	if _, err := repo.PatchUser(ctx, "missing-user", map[string]interface{}{"phone": "555-0199"}); err == nil || err.Error() != "user not found" {
+		t.Errorf("Expected user not found, got %v", err)
+	}
+}
+
+func TestSoftDeleteUserIntegration(t *testing.T) {
+	gormDB, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(gormDB)
+	ctx := context.Background()
+
+	shopper, err := repo.CreateUser(ctx, models.User{FirstName: "Sam", LastName: "Shopper", Email: "sam.deleted@example.com", Phone: "555-0110"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	browser, err := repo.CreateUser(ctx, models.User{FirstName: "Bo", LastName: "Browser", Email: "bo.deleted@example.com", Phone: "555-0111"})
+	if err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	order := orderModels.Order{OrderID: uuid.New().String(), UserID: shopper.UserID, Status: "Pending", TotalAmount: 10, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := gormDB.Create(&order).Error; err != nil {
+		t.Fatalf("Failed to create test order: %v", err)
+	}
+
+	for _, id := range []string{shopper.UserID, browser.UserID} {
+		if _, err := repo.DeleteUser(ctx, id); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+	}
+	if _, err := repo.GetUserByEmail(ctx, browser.Email); err == nil {
+		t.Error("Expected deleted user not to be found by email")
+	}
+	if users, _ := repo.ListAllUsers(ctx); len(users) != 0 {
+		t.Errorf("Expected deleted users to be hidden, got %d", len(users))
+	}
+	if users, _ := repo.ListAllUsers(db.IncludeDeleted(ctx)); len(users) != 2 {
+		t.Errorf("Expected 2 users including deleted ones, got %d", len(users))
+	}
+
+	// A deleted user's email is free again, which blocks restoring them
+	if _, err := repo.CreateUser(ctx, models.User{FirstName: "Bo", LastName: "Again", Email: browser.Email, Phone: "555-0112"}); err != nil {
+		t.Fatalf("Expected a deleted user's email to be reusable, got %v", err)
+	}
+	if _, err := repo.RestoreUser(ctx, browser.UserID); err == nil || err.Error() != "user with this email already exists" {
+		t.Errorf("Expected duplicate email error, got %v", err)
+	}
+	restored, err := repo.RestoreUser(ctx, shopper.UserID)
+	if err != nil {
+		t.Fatalf("Failed to restore user: %v", err)
+	}
+	if restored.Email != shopper.Email || restored.DeletedAt.Valid {
+		t.Errorf("Expected restored user, got %+v", restored)
+	}
+	if _, err := repo.RestoreUser(ctx, "missing-user"); err == nil || err.Error() != "user not found" {
+		t.Errorf("Expected user not found, got %v", err)
+	}
+
+	// The browser is removed; the shopper placed an order, so they stay
+	// but lose their personal details
+	if _, err := repo.DeleteUser(ctx, shopper.UserID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if err := repo.RecordLoginEvent(ctx, models.LoginEvent{UserID: shopper.UserID, Email: shopper.Email, IP: "10.0.0.1", Success: true}); err != nil {
+		t.Fatalf("Failed to record login event: %v", err)
+	}
+	purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to purge users: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("Expected 2 users purged, got %d", purged)
+	}
+	if _, err := repo.GetUserById(db.IncludeDeleted(ctx), browser.UserID); err == nil {
+		t.Error("Expected the user without orders to be removed")
+	}
+	anonymized, err := repo.GetUserById(db.IncludeDeleted(ctx), shopper.UserID)
+	if err != nil {
+		t.Fatalf("Expected the user with orders to survive the purge, got %v", err)
+	}
+	if anonymized.AnonymizedAt == nil || anonymized.Email != "" || anonymized.FirstName != "" || anonymized.PasswordHash != "" {
+		t.Errorf("Expected the user with orders to be anonymized, got %+v", anonymized)
+	}
+	var events int64
+	gormDB.Model(&models.LoginEvent{}).Where("user_id = ?", shopper.UserID).Count(&events)
+	if events != 0 {
+		t.Errorf("Expected the anonymized user's login events to be removed, got %d", events)
+	}
+	if _, err := repo.RestoreUser(ctx, shopper.UserID); !errors.Is(err, ErrUserAnonymized) {
+		t.Errorf("Expected ErrUserAnonymized, got %v", err)
+	}
+
+	// Anonymized users aren't counted again
+	if purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Minute)); err != nil || purged != 0 {
+		t.Errorf("Expected a second purge to do nothing, got %d (%v)", purged, err)
+	}
+}
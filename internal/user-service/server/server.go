@@ -2,32 +2,57 @@ package server
 
 import (
 	"gocart/internal/user-service/handler"
+	"gocart/pkg/auth"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	handler *handler.UserHandler
-	router  *mux.Router
+	handler      *handler.UserHandler
+	router       *mux.Router
+	requireAdmin func(http.Handler) http.Handler
 }
 
+// NewServer returns a server whose admin endpoints refuse every request.
 func NewServer(handler *handler.UserHandler) *Server {
+	return NewServerWithAdmin(handler, auth.RequireAdmin(""))
+}
+
+// NewServerWithAdmin returns a server that guards admin endpoints with
+// requireAdmin.
+func NewServerWithAdmin(handler *handler.UserHandler, requireAdmin func(http.Handler) http.Handler) *Server {
 	s := &Server{
-		handler: handler,
-		router:  mux.NewRouter(),
+		handler:      handler,
+		router:       mux.NewRouter(),
+		requireAdmin: requireAdmin,
 	}
 	s.setupRoutes()
 	return s
 }
 
 func (s *Server) setupRoutes() {
+	// Any include_deleted query takes the admin route, so only admins see
+	// deleted users
+	s.router.Handle("/users", s.requireAdmin(http.HandlerFunc(s.handler.ListAllUsers))).
+		Methods("GET").Queries("include_deleted", "{include_deleted}")
 	s.router.HandleFunc("/users", s.handler.ListAllUsers).Methods("GET")
 	s.router.HandleFunc("/users/register", s.handler.CreateUser).Methods("POST")
 	s.router.HandleFunc("/users/login", s.handler.Login).Methods("POST")
-	s.router.HandleFunc("/users/{id}", s.handler.GetUserById).Methods("GET")
-	s.router.HandleFunc("/users/{id}", s.handler.UpdateUser).Methods("PUT")
-	s.router.HandleFunc("/users/{id}", s.handler.DeleteUser).Methods("DELETE")
+	// Registered before /users/{user_id} so "verify" isn't taken for an ID
+	s.router.HandleFunc("/users/verify", s.handler.VerifyEmail).Methods("GET", "POST")
+	s.router.HandleFunc("/users/password/forgot", s.handler.ForgotPassword).Methods("POST")
+	s.router.HandleFunc("/users/password/reset", s.handler.ResetPassword).Methods("POST")
+	s.router.HandleFunc("/users/{user_id}", s.handler.GetUserById).Methods("GET")
+	s.router.HandleFunc("/users/{user_id}", s.handler.UpdateUser).Methods("PUT")
+	s.router.HandleFunc("/users/{user_id}", s.handler.PatchUser).Methods("PATCH")
+	s.router.HandleFunc("/users/{user_id}", s.handler.DeleteUser).Methods("DELETE")
+	// Self-service; the current password authorizes the change
+	s.router.HandleFunc("/users/{user_id}/password", s.handler.ChangePassword).Methods("POST")
+
+	// Admin endpoints
+	s.router.Handle("/users/{user_id}/unlock", s.requireAdmin(http.HandlerFunc(s.handler.UnlockUser))).Methods("POST")
+	s.router.Handle("/users/{user_id}/restore", s.requireAdmin(http.HandlerFunc(s.handler.RestoreUser))).Methods("POST")
 }
 
 func (s *Server) GetRouter() *mux.Router {
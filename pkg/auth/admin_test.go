@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name           string
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "Valid token", token: "s3cret", authorization: "Bearer s3cret", expectedStatus: http.StatusOK},
+		{name: "Scheme is case-insensitive", token: "s3cret", authorization: "bearer s3cret", expectedStatus: http.StatusOK},
+		{name: "Wrong token", token: "s3cret", authorization: "Bearer guess", expectedStatus: http.StatusUnauthorized},
+		{name: "Missing header", token: "s3cret", expectedStatus: http.StatusUnauthorized},
+		{name: "Other scheme", token: "s3cret", authorization: "Basic s3cret", expectedStatus: http.StatusUnauthorized},
+		{name: "Disabled without token", token: "", authorization: "Bearer ", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/42/unlock", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			RequireAdmin(tt.token)(ok).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
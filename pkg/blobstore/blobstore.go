@@ -0,0 +1,233 @@
+// Package blobstore stores uploaded files on the local filesystem or in an
+// S3-compatible object store, so every replica of the service sees the same
+// files.
+package blobstore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no blob is stored at a key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that aren't clean relative paths.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Object describes a stored blob.
+type Object struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// BlobStore stores blobs under slash-separated keys such as
+// "products/p1-<uuid>.png". It is also an http.Handler serving GET and HEAD
+// requests for keys at paths relative to where it is mounted.
+type BlobStore interface {
+	// Put stores size bytes read from body at key, replacing any blob
+	// already there.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the blob at key, or returns ErrNotFound. The caller closes
+	// the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Stat returns the blob's metadata, or ErrNotFound.
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete removes the blob at key. Deleting a missing blob is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// List calls fn for each blob whose key starts with prefix, stopping at
+	// the first error fn returns.
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+	// SignedURL returns a URL that allows a GET of key without other
+	// credentials until ttl has passed.
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// SignedUploadURL returns a URL that allows a PUT of exactly size bytes
+	// of contentType to key until ttl has passed. The request must send
+	// that Content-Type and Content-Length.
+	SignedUploadURL(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, error)
+	// Ping checks the store can be reached.
+	Ping(ctx context.Context) error
+	http.Handler
+}
+
+// Supported values for Config.Backend.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// PrivatePrefix holds blobs the handlers never serve, such as direct
+// uploads that haven't been checked yet.
+const PrivatePrefix = "pending/"
+
+// servedContentTypes are the types blobs are served as, by extension.
+// Anything else is served as a download, so a stored file can't be
+// rendered as a page on the API's origin.
+var servedContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// maxSignedURLTTL is the longest validity S3 accepts for a presigned URL.
+const maxSignedURLTTL = 7 * 24 * time.Hour
+
+type Config struct {
+	Backend string `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND"` // local or s3
+	// SignedURLTTL is how long signed URLs stay valid, including the ones
+	// S3 files are served through.
+	SignedURLTTL time.Duration `yaml:"signed_url_ttl" toml:"signed_url_ttl" env:"STORAGE_SIGNED_URL_TTL"`
+	// SigningKey signs the local backend's URLs. When empty a random key is
+	// used, so URLs don't survive a restart.
+	SigningKey string `yaml:"signing_key" toml:"signing_key" env:"STORAGE_SIGNING_KEY" secret:"true"`
+
+	// S3Endpoint is the object store's base URL, e.g.
+	// https://s3.eu-west-1.amazonaws.com or http://localhost:9000 for MinIO.
+	S3Endpoint        string `yaml:"s3_endpoint" toml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region          string `yaml:"s3_region" toml:"s3_region" env:"S3_REGION"`
+	S3Bucket          string `yaml:"s3_bucket" toml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKeyID     string `yaml:"s3_access_key_id" toml:"s3_access_key_id" env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `yaml:"s3_secret_access_key" toml:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+	// S3PathStyle addresses the bucket in the path rather than the host
+	// name, as MinIO and most other stand-ins expect.
+	S3PathStyle bool `yaml:"s3_path_style" toml:"s3_path_style" env:"S3_PATH_STYLE"`
+	// S3PublicURL, when set, is a public bucket or CDN base URL that blobs
+	// are served from without signing.
+	S3PublicURL string `yaml:"s3_public_url" toml:"s3_public_url" env:"S3_PUBLIC_URL"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend:      BackendLocal,
+		SignedURLTTL: 15 * time.Minute,
+		S3Region:     "us-east-1",
+	}
+}
+
+// Validate reports settings New would reject.
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Backend {
+	case BackendLocal, BackendS3:
+	default:
+		errs = append(errs, fmt.Errorf("backend must be one of local or s3, got %q", c.Backend))
+	}
+	if c.SignedURLTTL <= 0 || c.SignedURLTTL > maxSignedURLTTL {
+		errs = append(errs, fmt.Errorf("signed_url_ttl must be positive and at most 168h, got %s", c.SignedURLTTL))
+	}
+	if c.Backend == BackendS3 {
+		if u, err := url.Parse(c.S3Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("s3_endpoint must be an http or https URL, got %q", c.S3Endpoint))
+		}
+		if c.S3Region == "" || c.S3Bucket == "" {
+			errs = append(errs, errors.New("s3_region and s3_bucket are required for the s3 backend"))
+		}
+		if c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" {
+			errs = append(errs, errors.New("s3_access_key_id and s3_secret_access_key are required for the s3 backend"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New returns the store selected by config.Backend. The local backend keeps
+// files in dir and is served at baseURL, the path the store is mounted at.
+func New(config Config, dir, baseURL string) (BlobStore, error) {
+	switch config.Backend {
+	case BackendLocal:
+		key := []byte(config.SigningKey)
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			rand.Read(key)
+		}
+		return NewLocal(dir, baseURL, key), nil
+	case BackendS3:
+		return NewS3(config)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+}
+
+// CheckKey returns ErrInvalidKey unless key is a clean relative path: no
+// leading slash, empty, "." or ".." segments, or backslashes.
+func CheckKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// servable reports whether the handlers may serve key: not under
+// PrivatePrefix, and not a dotfile such as a partial upload.
+func servable(key string) bool {
+	if strings.HasPrefix(key, PrivatePrefix) {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// servedContentType returns the Content-Type key is served with.
+func servedContentType(key string) string {
+	if contentType, ok := servedContentTypes[strings.ToLower(path.Ext(key))]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// Copy copies every blob under prefix from src to dst and returns how many
+// were copied. Blobs dst already holds with the same size are skipped, so
+// an interrupted copy can be resumed. With remove, each blob is deleted
+// from src once it is in dst.
+func Copy(ctx context.Context, src, dst BlobStore, prefix string, remove bool, progress func(Object, bool)) (int, error) {
+	copied := 0
+	err := src.List(ctx, prefix, func(object Object) error {
+		existing, err := dst.Stat(ctx, object.Key)
+		skip := err == nil && existing.Size == object.Size
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("stat %s: %w", object.Key, err)
+		}
+		if !skip {
+			body, info, err := src.Get(ctx, object.Key)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", object.Key, err)
+			}
+			err = dst.Put(ctx, object.Key, body, info.Size, info.ContentType)
+			body.Close()
+			if err != nil {
+				return fmt.Errorf("write %s: %w", object.Key, err)
+			}
+			copied++
+		}
+		if progress != nil {
+			progress(object, skip)
+		}
+		if remove {
+			if err := src.Delete(ctx, object.Key); err != nil {
+				return fmt.Errorf("delete %s: %w", object.Key, err)
+			}
+		}
+		return nil
+	})
+	return copied, err
+}
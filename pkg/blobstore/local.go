@@ -0,0 +1,306 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local stores blobs as files under a directory. It only suits a single
+// replica, or replicas sharing a network filesystem.
+//
+// Files are served to anyone, as the upload directory always was. Signed
+// URLs point back at the store's own handler, which accepts PUT requests
+// only with a valid signature.
+type Local struct {
+	dir        string
+	baseURL    string
+	signingKey []byte
+	now        func() time.Time
+}
+
+// NewLocal returns a store keeping files in dir, served at baseURL (such as
+// "/uploads/"). URLs are signed with signingKey.
+func NewLocal(dir, baseURL string, signingKey []byte) *Local {
+	return &Local{
+		dir:        dir,
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/",
+		signingKey: signingKey,
+		now:        time.Now,
+	}
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	dst := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place, so readers never
+	// see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if size >= 0 {
+		body = io.LimitReader(body, size+1)
+	}
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		if err == nil {
+			err = ErrNotFound
+		}
+		return nil, Object{}, err
+	}
+	return file, localObject(key, info), nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Object, error) {
+	if err := CheckKey(key); err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(l.path(key))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	return localObject(key, info), nil
+}
+
+// localObject describes a file. The content type isn't stored, so it's
+// guessed from the extension.
+func localObject(key string, info fs.FileInfo) Object {
+	return Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: info.ModTime(),
+	}
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List skips dotfiles, such as partial uploads and readiness probes.
+func (l *Local) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	err := filepath.WalkDir(l.dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && p != l.dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(localObject(key, info))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// SignedURL returns the blob's URL. Reads need no signature, so it is
+// only signed to match SignedUploadURL.
+func (l *Local) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return l.signedURL(http.MethodGet, key, ttl, url.Values{})
+}
+
+func (l *Local) SignedUploadURL(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, error) {
+	return l.signedURL(http.MethodPut, key, ttl, url.Values{
+		"content_type": {contentType},
+		"size":         {strconv.FormatInt(size, 10)},
+	})
+}
+
+func (l *Local) signedURL(method, key string, ttl time.Duration, query url.Values) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	query.Set("expires", strconv.FormatInt(l.now().Add(ttl).Unix(), 10))
+	query.Set("signature", l.signature(method, key, query))
+	return l.baseURL + escapePath(key) + "?" + query.Encode(), nil
+}
+
+// signature signs method on key with the expiry, content type and size in
+// query.
+func (l *Local) signature(method, key string, query url.Values) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, key, query.Get("expires"), query.Get("content_type"), query.Get("size"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify reports whether r carries an unexpired signature for method on
+// key.
+func (l *Local) verify(r *http.Request, method, key string) bool {
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || l.now().Unix() > expires {
+		return false
+	}
+	expected := l.signature(method, key, query)
+	return hmac.Equal([]byte(expected), []byte(query.Get("signature")))
+}
+
+// Ping checks a file can be created in the directory.
+func (l *Local) Ping(ctx context.Context) error {
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(l.dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// ServeHTTP serves files to GET and HEAD requests, and stores the body of
+// PUT requests made with a URL from SignedUploadURL, provided they send the
+// signed Content-Type and size. Files are served with a Content-Type picked
+// from their extension, never sniffed, and private ones not at all.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if CheckKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !servable(key) {
+			http.NotFound(w, r)
+			return
+		}
+		body, object, err := l.Get(r.Context(), key)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				http.Error(w, "Failed to read file", http.StatusInternalServerError)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", servedContentType(key))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, path.Base(key), object.LastModified, body.(io.ReadSeeker))
+	case http.MethodPut:
+		if !l.verify(r, http.MethodPut, key) {
+			http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+			return
+		}
+		query := r.URL.Query()
+		if contentType := query.Get("content_type"); r.Header.Get("Content-Type") != contentType {
+			http.Error(w, fmt.Sprintf("Content-Type must be %s", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.ContentLength < 0 {
+			http.Error(w, "Content-Length is required", http.StatusLengthRequired)
+			return
+		}
+		size, _ := strconv.ParseInt(query.Get("size"), 10, 64)
+		if r.ContentLength > size {
+			http.Error(w, fmt.Sprintf("File exceeds the %d byte limit", size), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if r.ContentLength != size {
+			http.Error(w, fmt.Sprintf("Content-Length must be %d", size), http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, size)
+		if err := l.Put(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+			http.Error(w, "Failed to store file", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// escapePath escapes each segment of a slash-separated key for use in a
+// URL path.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gocart/pkg/metrics"
+)
+
+// ErrMiss is returned by Get when the key is not cached.
+var ErrMiss = errors.New("cache miss")
+
+// Cache is a byte-oriented key/value store with expiry.
+type Cache interface {
+	// Get returns the value stored at key or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value at key for ttl; a zero ttl never expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Supported values for Config.Backend.
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+type Config struct {
+	Backend string        `yaml:"backend" toml:"backend" env:"CACHE_BACKEND"` // none, memory or redis
+	TTL     time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+	// KeyPrefix namespaces keys so several environments can share a server.
+	KeyPrefix string `yaml:"key_prefix" toml:"key_prefix" env:"CACHE_KEY_PREFIX"`
+
+	// MaxEntries bounds the memory backend; least recently used entries are
+	// evicted first.
+	MaxEntries int `yaml:"max_entries" toml:"max_entries" env:"CACHE_MAX_ENTRIES"`
+
+	RedisAddr     string `yaml:"redis_addr" toml:"redis_addr" env:"REDIS_ADDR"`
+	RedisPassword string `yaml:"redis_password" toml:"redis_password" env:"REDIS_PASSWORD" secret:"true"`
+	RedisDB       int    `yaml:"redis_db" toml:"redis_db" env:"REDIS_DB"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend:    BackendNone,
+		TTL:        5 * time.Minute,
+		KeyPrefix:  "gocart:",
+		MaxEntries: 10000,
+		RedisAddr:  "localhost:6379",
+	}
+}
+
+// Validate reports settings New would reject.
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Backend {
+	case BackendNone, BackendMemory, BackendRedis:
+	default:
+		errs = append(errs, fmt.Errorf("backend must be one of none, memory or redis, got %q", c.Backend))
+	}
+	if c.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("ttl must be positive, got %s", c.TTL))
+	}
+	if c.Backend == BackendMemory && c.MaxEntries < 1 {
+		errs = append(errs, fmt.Errorf("max_entries must be at least 1, got %d", c.MaxEntries))
+	}
+	if c.Backend == BackendRedis && c.RedisAddr == "" {
+		errs = append(errs, errors.New("redis_addr is required for the redis backend"))
+	}
+	return errors.Join(errs...)
+}
+
+// New returns the cache selected by config.Backend, or nil for "none".
+func New(config Config) (Cache, error) {
+	switch config.Backend {
+	case BackendNone, "":
+		return nil, nil
+	case BackendMemory:
+		return NewMemory(config.MaxEntries), nil
+	case BackendRedis:
+		return NewRedis(config), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", config.Backend)
+	}
+}
+
+// GetOrLoad returns the JSON-encoded value cached at key, or calls load and
+// caches its result for ttl. Cache failures are logged and treated as misses
+// so an unavailable cache only costs latency; load errors are returned
+// as-is and never cached. Lookups are counted under name in the metrics.
+func GetOrLoad[T any](ctx context.Context, c Cache, name, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	data, err := c.Get(ctx, key)
+	switch {
+	case err == nil:
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			metrics.CacheLookup(name, "hit")
+			return value, nil
+		}
+		log.Printf("⚠️  Warning: Discarding undecodable cache entry %s: %v", key, err)
+		metrics.CacheLookup(name, "error")
+	case errors.Is(err, ErrMiss):
+		metrics.CacheLookup(name, "miss")
+	default:
+		log.Printf("⚠️  Warning: Cache lookup for %s failed: %v", key, err)
+		metrics.CacheLookup(name, "error")
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	if data, err := json.Marshal(value); err == nil {
+		if err := c.Set(ctx, key, data, ttl); err != nil {
+			log.Printf("⚠️  Warning: Failed to cache %s: %v", key, err)
+		}
+	}
+	return value, nil
+}
+
+// Invalidate deletes keys, logging instead of failing so a cache outage
+// doesn't fail writes that already succeeded.
+func Invalidate(ctx context.Context, c Cache, keys ...string) {
+	if err := c.Delete(ctx, keys...); err != nil {
+		log.Printf("⚠️  Warning: Failed to invalidate cache keys %v: %v", keys, err)
+	}
+}
+
+// Generation returns the current generation token of a key namespace.
+// Embedding it in keys lets BumpGeneration invalidate every key of the
+// namespace at once, for data whose affected keys can't be listed on write.
+// Tokens are unique rather than counters, so a generation key that was
+// evicted can never bring back entries from an older generation.
+func Generation(ctx context.Context, c Cache, namespace string) string {
+	key := namespace + ":generation"
+	data, err := c.Get(ctx, key)
+	if err == nil {
+		return string(data)
+	}
+	generation := newGeneration()
+	if errors.Is(err, ErrMiss) {
+		if err := c.Set(ctx, key, []byte(generation), 0); err != nil {
+			log.Printf("⚠️  Warning: Failed to store cache generation %s: %v", key, err)
+		}
+	}
+	return generation
+}
+
+// BumpGeneration invalidates every key built with the namespace's current
+// generation.
+func BumpGeneration(ctx context.Context, c Cache, namespace string) {
+	if err := c.Set(ctx, namespace+":generation", []byte(newGeneration()), 0); err != nil {
+		log.Printf("⚠️  Warning: Failed to invalidate cache namespace %s: %v", namespace, err)
+	}
+}
+
+func newGeneration() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
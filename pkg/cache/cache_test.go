@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// backends returns every Cache implementation, the Redis one backed by an
+// embedded fake server.
+func backends(t *testing.T) map[string]Cache {
+	t.Helper()
+	server := miniredis.RunT(t)
+	config := DefaultConfig()
+	config.RedisAddr = server.Addr()
+	redisCache := NewRedis(config)
+	t.Cleanup(func() { redisCache.Close() })
+
+	return map[string]Cache{
+		"memory": NewMemory(100),
+		"redis":  redisCache,
+	}
+}
+
+func TestCacheContract(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrMiss) {
+				t.Errorf("Expected ErrMiss for missing key, got %v", err)
+			}
+
+			if err := c.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			value, err := c.Get(ctx, "key")
+			if err != nil || string(value) != "value" {
+				t.Errorf("Expected value, got %q (%v)", value, err)
+			}
+
+			if err := c.Delete(ctx, "key", "missing"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, err := c.Get(ctx, "key"); !errors.Is(err, ErrMiss) {
+				t.Errorf("Expected ErrMiss after delete, got %v", err)
+			}
+
+			if err := c.Ping(ctx); err != nil {
+				t.Errorf("Ping failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedisKeyPrefix(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := DefaultConfig()
+	config.RedisAddr = server.Addr()
+	c := NewRedis(config)
+	defer c.Close()
+
+	c.Set(context.Background(), "product:1", []byte("{}"), time.Minute)
+	if !server.Exists("gocart:product:1") {
+		t.Errorf("Expected key to be stored with prefix, got keys %v", server.Keys())
+	}
+}
+
+func TestMemoryExpiryAndEviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(2)
+
+	c.Set(ctx, "expired", []byte("x"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err := c.Get(ctx, "expired"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected expired entry to miss, got %v", err)
+	}
+
+	c.Set(ctx, "a", []byte("a"), 0)
+	c.Set(ctx, "b", []byte("b"), 0)
+	c.Get(ctx, "a") // a is now more recently used than b
+	c.Set(ctx, "c", []byte("c"), 0)
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Expected least recently used entry to be evicted, got %v", err)
+	}
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Errorf("Expected recently used entry to survive, got %v", err)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			loads := 0
+			load := func() ([]string, error) {
+				loads++
+				return []string{"a", "b"}, nil
+			}
+
+			for i := 0; i < 2; i++ {
+				value, err := GetOrLoad(ctx, c, "test", "list", time.Minute, load)
+				if err != nil || len(value) != 2 {
+					t.Fatalf("Expected loaded value, got %v (%v)", value, err)
+				}
+			}
+			if loads != 1 {
+				t.Errorf("Expected second call to hit the cache, loaded %d times", loads)
+			}
+
+			failing := func() (int, error) {
+				loads++
+				return 0, errors.New("db down")
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := GetOrLoad(ctx, c, "test", "failing", time.Minute, failing); err == nil {
+					t.Error("Expected load error, got nil")
+				}
+			}
+			if loads != 3 {
+				t.Errorf("Expected load errors not to be cached, loaded %d times", loads)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadFailsOpen(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := DefaultConfig()
+	config.RedisAddr = server.Addr()
+	c := NewRedis(config)
+	defer c.Close()
+	server.Close()
+
+	value, err := GetOrLoad(context.Background(), c, "test", "key", time.Minute, func() (string, error) {
+		return "from db", nil
+	})
+	if err != nil || value != "from db" {
+		t.Errorf("Expected unavailable cache to fall through to load, got %q (%v)", value, err)
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			first := Generation(ctx, c, "orders")
+			if again := Generation(ctx, c, "orders"); again != first {
+				t.Errorf("Expected stable generation, got %s then %s", first, again)
+			}
+
+			BumpGeneration(ctx, c, "orders")
+			bumped := Generation(ctx, c, "orders")
+			if bumped == first {
+				t.Errorf("Expected new generation after bump, still %s", bumped)
+			}
+
+			c.Delete(ctx, "orders:generation")
+			if evicted := Generation(ctx, c, "orders"); evicted == first || evicted == bumped {
+				t.Errorf("Expected a fresh generation after eviction, got %s", evicted)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected default config to be valid, got %v", err)
+	}
+
+	config.Backend = "memcached"
+	config.TTL = 0
+	if err := config.Validate(); err == nil {
+		t.Error("Expected error for unknown backend and zero ttl, got nil")
+	}
+}
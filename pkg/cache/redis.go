@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis stores entries on a server speaking the Redis protocol (Redis,
+// Valkey, KeyDB, ...), so every instance of the service shares one cache.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis returns a cache backed by the server at config.RedisAddr. The
+// connection is made lazily; use Ping to check the server is reachable.
+func NewRedis(config Config) *Redis {
+	return &Redis{client: NewRedisClient(config), prefix: config.KeyPrefix}
+}
+
+// NewRedisClient returns a client for the server in config, for other
+// subsystems that share it with the cache.
+func NewRedisClient(config Config) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddr,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = r.prefix + key
+	}
+	return r.client.Del(ctx, prefixed...).Err()
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
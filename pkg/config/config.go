@@ -0,0 +1,528 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocart/pkg/auth"
+	"gocart/pkg/blobstore"
+	"gocart/pkg/cache"
+	"gocart/pkg/db"
+	"gocart/pkg/mailer"
+	"gocart/pkg/purge"
+	"gocart/pkg/ratelimit"
+	"gocart/pkg/secrets"
+	"gocart/pkg/tracing"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete application configuration. Subsystems own their
+// settings structs; this package only aggregates and loads them.
+//
+// Every leaf field is addressable three ways: by its dotted key in a config
+// file (e.g. database.max_open_conns), by the environment variable in its env
+// tag, and by a flag named after the dotted key (-database.max_open_conns).
+// Fields tagged secret:"true" are redacted when the config is printed.
+type Config struct {
+	Server     ServerConfig     `yaml:"server" toml:"server"`
+	Database   db.Config        `yaml:"database" toml:"database"`
+	Tracing    tracing.Config   `yaml:"tracing" toml:"tracing"`
+	Uploads    UploadsConfig    `yaml:"uploads" toml:"uploads"`
+	Storage    blobstore.Config `yaml:"storage" toml:"storage"`
+	CORS       CORSConfig       `yaml:"cors" toml:"cors"`
+	Migrations MigrationsConfig `yaml:"migrations" toml:"migrations"`
+	Secrets    SecretsConfig    `yaml:"secrets" toml:"secrets"`
+	Cache      cache.Config     `yaml:"cache" toml:"cache"`
+	RateLimit  ratelimit.Config `yaml:"rate_limit" toml:"rate_limit"`
+	Auth       auth.Config      `yaml:"auth" toml:"auth"`
+	Login      LoginConfig      `yaml:"login" toml:"login"`
+	Accounts   AccountsConfig   `yaml:"accounts" toml:"accounts"`
+	Passwords  PasswordsConfig  `yaml:"passwords" toml:"passwords"`
+	Mail       mailer.Config    `yaml:"mail" toml:"mail"`
+	Purge      purge.Config     `yaml:"purge" toml:"purge"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port" toml:"port" env:"PORT"`
+	// ShutdownDrainDelay keeps serving after SIGTERM so load balancers notice
+	// the failing readiness probe before listeners close.
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+}
+
+type UploadsConfig struct {
+	// Dir holds uploaded files when storage.backend is local.
+	Dir           string `yaml:"dir" toml:"dir" env:"UPLOADS_DIR"`
+	MaxImageBytes int64  `yaml:"max_image_bytes" toml:"max_image_bytes" env:"UPLOADS_MAX_IMAGE_BYTES"`
+	// MaxImageWidth and MaxImageHeight limit the pixel dimensions of
+	// uploaded images.
+	MaxImageWidth  int `yaml:"max_image_width" toml:"max_image_width" env:"UPLOADS_MAX_IMAGE_WIDTH"`
+	MaxImageHeight int `yaml:"max_image_height" toml:"max_image_height" env:"UPLOADS_MAX_IMAGE_HEIGHT"`
+	// MaxDirectUploadBytes limits images uploaded straight to storage with
+	// a signed URL, which must be confirmed within DirectUploadTTL.
+	MaxDirectUploadBytes int64         `yaml:"max_direct_upload_bytes" toml:"max_direct_upload_bytes" env:"UPLOADS_MAX_DIRECT_UPLOAD_BYTES"`
+	DirectUploadTTL      time.Duration `yaml:"direct_upload_ttl" toml:"direct_upload_ttl" env:"UPLOADS_DIRECT_UPLOAD_TTL"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+type MigrationsConfig struct {
+	OnStart      bool `yaml:"on_start" toml:"on_start" env:"MIGRATE_ON_START"`
+	AllowPending bool `yaml:"allow_pending" toml:"allow_pending" env:"ALLOW_PENDING_MIGRATIONS"`
+}
+
+// LoginConfig configures brute-force protection on login: accounts lock
+// after MaxFailedAttempts wrong passwords in a row, for LockoutDuration
+// doubling with each further lockout up to MaxLockoutDuration, and
+// addresses with IPMaxFailures failures within IPWindow are throttled.
+type LoginConfig struct {
+	MaxFailedAttempts  int           `yaml:"max_failed_attempts" toml:"max_failed_attempts" env:"LOGIN_MAX_FAILED_ATTEMPTS"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration" toml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION"`
+	MaxLockoutDuration time.Duration `yaml:"max_lockout_duration" toml:"max_lockout_duration" env:"LOGIN_MAX_LOCKOUT_DURATION"`
+	IPMaxFailures      int           `yaml:"ip_max_failures" toml:"ip_max_failures" env:"LOGIN_IP_MAX_FAILURES"`
+	IPWindow           time.Duration `yaml:"ip_window" toml:"ip_window" env:"LOGIN_IP_WINDOW"`
+}
+
+// AccountsConfig configures password reset and email verification. The
+// URLs are the pages linked from the emails; the token is added to them as
+// the token query parameter.
+type AccountsConfig struct {
+	PasswordResetTTL     time.Duration `yaml:"password_reset_ttl" toml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+	VerificationTTL      time.Duration `yaml:"verification_ttl" toml:"verification_ttl" env:"EMAIL_VERIFICATION_TTL"`
+	PasswordResetURL     string        `yaml:"password_reset_url" toml:"password_reset_url" env:"PASSWORD_RESET_URL"`
+	EmailVerificationURL string        `yaml:"email_verification_url" toml:"email_verification_url" env:"EMAIL_VERIFICATION_URL"`
+}
+
+// PasswordsConfig sets the policy for new passwords and how they are
+// hashed. Passwords are refused if they appear in the built-in list of common
+// passwords (unless DenyCommon is off) or in DenyListFile, a file with one
+// password per line.
+type PasswordsConfig struct {
+	MinLength           int    `yaml:"min_length" toml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MinCharacterClasses int    `yaml:"min_character_classes" toml:"min_character_classes" env:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	DenyCommon          bool   `yaml:"deny_common" toml:"deny_common" env:"PASSWORD_DENY_COMMON"`
+	DenyListFile        string `yaml:"deny_list_file" toml:"deny_list_file" env:"PASSWORD_DENY_LIST_FILE"`
+	// BcryptCost applies to new hashes; existing ones are rehashed at the
+	// user's next login.
+	BcryptCost int `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST"`
+}
+
+// SecretsConfig configures how secret-tagged values are resolved. A secret
+// value may be a literal or a reference such as file:///run/secrets/db_password,
+// local://db_password (looked up in LocalFile) or
+// gcp-sm://projects/<project>/secrets/<name>.
+type SecretsConfig struct {
+	LocalFile string `yaml:"local_file" toml:"local_file" env:"SECRETS_LOCAL_FILE"`
+	// RefreshInterval controls how often references are re-read to pick up
+	// rotated credentials; 0 disables reloading.
+	RefreshInterval time.Duration `yaml:"refresh_interval" toml:"refresh_interval" env:"SECRETS_REFRESH_INTERVAL"`
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() Config {
+	return Config{
+		Server:   ServerConfig{Port: "8080"},
+		Database: db.DefaultConfig(),
+		Tracing:  tracing.DefaultConfig(),
+		Uploads: UploadsConfig{
+			Dir:                  "uploads",
+			MaxImageBytes:        5 << 20,
+			MaxImageWidth:        4096,
+			MaxImageHeight:       4096,
+			MaxDirectUploadBytes: 25 << 20,
+			DirectUploadTTL:      15 * time.Minute,
+		},
+		Storage: blobstore.DefaultConfig(),
+		CORS:    CORSConfig{AllowedOrigins: []string{"*"}},
+		Secrets: SecretsConfig{
+			LocalFile:       ".secrets.yaml",
+			RefreshInterval: 5 * time.Minute,
+		},
+		Cache:     cache.DefaultConfig(),
+		RateLimit: ratelimit.DefaultConfig(),
+		Login: LoginConfig{
+			MaxFailedAttempts:  5,
+			LockoutDuration:    time.Minute,
+			MaxLockoutDuration: time.Hour,
+			IPMaxFailures:      20,
+			IPWindow:           15 * time.Minute,
+		},
+		Accounts: AccountsConfig{
+			PasswordResetTTL:     time.Hour,
+			VerificationTTL:      48 * time.Hour,
+			PasswordResetURL:     "http://localhost:3000/reset-password",
+			EmailVerificationURL: "http://localhost:8080/users/verify",
+		},
+		Passwords: PasswordsConfig{
+			MinLength:           8,
+			MinCharacterClasses: 2,
+			DenyCommon:          true,
+			BcryptCost:          bcrypt.DefaultCost,
+		},
+		Mail:  mailer.DefaultConfig(),
+		Purge: purge.DefaultConfig(),
+	}
+}
+
+// Validate checks every section and reports all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be a number between 1 and 65535, got %q", c.Server.Port))
+	}
+	if c.Server.ShutdownDrainDelay < 0 {
+		errs = append(errs, fmt.Errorf("server.shutdown_drain_delay must not be negative, got %s", c.Server.ShutdownDrainDelay))
+	}
+	if err := c.Database.Validate(); err != nil {
+		errs = append(errs, prefixErrors("database", err))
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs = append(errs, prefixErrors("tracing", err))
+	}
+	if c.Uploads.Dir == "" {
+		errs = append(errs, errors.New("uploads.dir is required"))
+	}
+	if c.Uploads.MaxImageBytes < 1 {
+		errs = append(errs, fmt.Errorf("uploads.max_image_bytes must be positive, got %d", c.Uploads.MaxImageBytes))
+	}
+	if c.Uploads.MaxImageWidth < 1 || c.Uploads.MaxImageHeight < 1 {
+		errs = append(errs, fmt.Errorf("uploads.max_image_width and max_image_height must be positive, got %dx%d", c.Uploads.MaxImageWidth, c.Uploads.MaxImageHeight))
+	}
+	if c.Uploads.MaxDirectUploadBytes < 1 {
+		errs = append(errs, fmt.Errorf("uploads.max_direct_upload_bytes must be positive, got %d", c.Uploads.MaxDirectUploadBytes))
+	}
+	if c.Uploads.DirectUploadTTL <= 0 || c.Uploads.DirectUploadTTL > 7*24*time.Hour {
+		errs = append(errs, fmt.Errorf("uploads.direct_upload_ttl must be positive and at most 168h, got %s", c.Uploads.DirectUploadTTL))
+	}
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allowed_origins must list at least one origin"))
+	}
+	if c.Secrets.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("secrets.refresh_interval must not be negative, got %s", c.Secrets.RefreshInterval))
+	}
+	if c.Login.MaxFailedAttempts < 0 || c.Login.IPMaxFailures < 0 {
+		errs = append(errs, errors.New("login.max_failed_attempts and login.ip_max_failures must not be negative"))
+	}
+	if c.Login.MaxFailedAttempts > 0 && (c.Login.LockoutDuration <= 0 || c.Login.MaxLockoutDuration < c.Login.LockoutDuration) {
+		errs = append(errs, fmt.Errorf("login.lockout_duration must be positive and at most login.max_lockout_duration, got %s and %s",
+			c.Login.LockoutDuration, c.Login.MaxLockoutDuration))
+	}
+	if c.Login.IPMaxFailures > 0 && c.Login.IPWindow <= 0 {
+		errs = append(errs, fmt.Errorf("login.ip_window must be positive, got %s", c.Login.IPWindow))
+	}
+	if c.Accounts.PasswordResetTTL <= 0 || c.Accounts.VerificationTTL <= 0 {
+		errs = append(errs, fmt.Errorf("accounts.password_reset_ttl and accounts.verification_ttl must be positive, got %s and %s",
+			c.Accounts.PasswordResetTTL, c.Accounts.VerificationTTL))
+	}
+	for _, link := range [][2]string{
+		{"password_reset_url", c.Accounts.PasswordResetURL},
+		{"email_verification_url", c.Accounts.EmailVerificationURL},
+	} {
+		if u, err := url.Parse(link[1]); err != nil || !u.IsAbs() {
+			errs = append(errs, fmt.Errorf("accounts.%s must be an absolute URL, got %q", link[0], link[1]))
+		}
+	}
+	if c.Passwords.MinLength < 1 || c.Passwords.MinLength > 72 {
+		errs = append(errs, fmt.Errorf("passwords.min_length must be between 1 and 72, got %d", c.Passwords.MinLength))
+	}
+	if c.Passwords.MinCharacterClasses < 0 || c.Passwords.MinCharacterClasses > 4 {
+		errs = append(errs, fmt.Errorf("passwords.min_character_classes must be between 0 and 4, got %d", c.Passwords.MinCharacterClasses))
+	}
+	if c.Passwords.BcryptCost < bcrypt.MinCost || c.Passwords.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("passwords.bcrypt_cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Passwords.BcryptCost))
+	}
+	if err := c.Storage.Validate(); err != nil {
+		errs = append(errs, prefixErrors("storage", err))
+	}
+	if err := c.Mail.Validate(); err != nil {
+		errs = append(errs, prefixErrors("mail", err))
+	}
+	if err := c.Cache.Validate(); err != nil {
+		errs = append(errs, prefixErrors("cache", err))
+	}
+	if err := c.RateLimit.Validate(); err != nil {
+		errs = append(errs, prefixErrors("rate_limit", err))
+	}
+	if err := c.Purge.Validate(); err != nil {
+		errs = append(errs, prefixErrors("purge", err))
+	}
+	return errors.Join(errs...)
+}
+
+// prefixErrors qualifies the field names in a subsystem's validation errors
+// with its section key.
+func prefixErrors(section string, err error) error {
+	var errs []error
+	for _, line := range strings.Split(err.Error(), "\n") {
+		errs = append(errs, fmt.Errorf("%s.%s", section, line))
+	}
+	return errors.Join(errs...)
+}
+
+// String renders the effective configuration as key = value lines
+// with secrets redacted, suitable for logging at startup.
+func (c Config) String() string {
+	var b strings.Builder
+	walk(reflect.ValueOf(&c).Elem(), "", func(f field) {
+		value := formatValue(f.value)
+		if f.secret && value != "" {
+			value = "[redacted]"
+		}
+		env := ""
+		if f.env != "" {
+			env = "  (" + f.env + ")"
+		}
+		fmt.Fprintf(&b, "  %s = %s%s\n", f.key, value, env)
+	})
+	return b.String()
+}
+
+// SecretResolver returns a resolver with the file://, local:// and gcp-sm://
+// providers registered.
+func (c Config) SecretResolver() *secrets.Resolver {
+	resolver := secrets.NewResolver()
+	resolver.Register("local", secrets.LocalProvider{Path: c.Secrets.LocalFile})
+	resolver.Register("gcp-sm", &secrets.GCPProvider{})
+	return resolver
+}
+
+// ResolveSecrets replaces every secret-tagged value that is a provider
+// reference with the secret it points at. It returns a handle per secret
+// field, keyed by its dotted key, for callers that need to pick up rotated
+// values later (see secrets.Watch).
+func (c *Config) ResolveSecrets(ctx context.Context, resolver *secrets.Resolver) (map[string]*secrets.Secret, error) {
+	resolved := make(map[string]*secrets.Secret)
+	var errs []error
+	walk(reflect.ValueOf(c).Elem(), "", func(f field) {
+		if !f.secret || f.value.Kind() != reflect.String {
+			return
+		}
+		secret, err := resolver.Secret(ctx, f.value.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+			return
+		}
+		f.value.SetString(secret.Value())
+		resolved[f.key] = secret
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// Loader builds a Config from defaults, an optional config file, the
+// environment and command-line flags, in increasing order of precedence.
+type Loader struct {
+	file      *string
+	overrides map[string]string
+	order     []string
+}
+
+// NewLoader registers -config and one flag per configuration key on fs. Call
+// Load after fs has been parsed.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{overrides: make(map[string]string)}
+	l.file = fs.String("config", "", "path to a YAML or TOML config file (env CONFIG_FILE)")
+
+	defaults := Default()
+	walk(reflect.ValueOf(&defaults).Elem(), "", func(f field) {
+		key := f.key
+		usage := "override " + key
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		fs.Func(key, usage, func(value string) error {
+			if _, seen := l.overrides[key]; !seen {
+				l.order = append(l.order, key)
+			}
+			l.overrides[key] = value
+			return nil
+		})
+	})
+	return l
+}
+
+// Load assembles and validates the configuration.
+func (l *Loader) Load() (Config, error) {
+	cfg := Default()
+
+	path := *l.file
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(&cfg).Elem(), "", func(f field) {
+		if f.env == "" {
+			return
+		}
+		if raw, ok := os.LookupEnv(f.env); ok && raw != "" {
+			if err := setValue(f.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	})
+	fields := make(map[string]reflect.Value)
+	walk(reflect.ValueOf(&cfg).Elem(), "", func(f field) { fields[f.key] = f.value })
+	for _, key := range l.order {
+		if err := setValue(fields[key], l.overrides[key]); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// Load parses args with a fresh flag set and loads the configuration. It is
+// the entry point for commands that take no flags of their own.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return loader.Load()
+}
+
+// loadFile decodes a YAML or TOML file over cfg. Unknown keys are rejected so
+// typos don't silently fall back to defaults.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("failed to parse %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	return nil
+}
+
+type field struct {
+	key    string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// walk calls fn for every leaf field of the struct v, depth first in
+// declaration order, with its dotted key built from the yaml tags.
+func walk(v reflect.Value, prefix string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+			walk(v.Field(i), key, fn)
+			continue
+		}
+		fn(field{key: key, env: sf.Tag.Get("env"), secret: sf.Tag.Get("secret") == "true", value: v.Field(i)})
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into the field v. Lists are comma separated.
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Port != "8080" || cfg.Database.MaxOpenConns != 100 || cfg.Uploads.MaxImageBytes != 5<<20 {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "gocart.yaml", `
+server:
+  port: "9000"
+  shutdown_drain_delay: 5s
+database:
+  host: db.internal
+  max_open_conns: 20
+cors:
+  allowed_origins: [https://shop.example.com]
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_HOST", "db.from-env")
+	t.Setenv("DB_MAX_IDLE_CONNS", "4")
+
+	cfg, err := Load([]string{"-database.host", "db.from-flag"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Server.Port != "9000" {
+		t.Errorf("Expected port from file, got %s", cfg.Server.Port)
+	}
+	if cfg.Server.ShutdownDrainDelay != 5*time.Second {
+		t.Errorf("Expected drain delay from file, got %s", cfg.Server.ShutdownDrainDelay)
+	}
+	if cfg.Database.Host != "db.from-flag" {
+		t.Errorf("Expected flag to override env and file, got %s", cfg.Database.Host)
+	}
+	if cfg.Database.MaxIdleConns != 4 || cfg.Database.MaxOpenConns != 20 {
+		t.Errorf("Expected pool sizes 4/20, got %d/%d", cfg.Database.MaxIdleConns, cfg.Database.MaxOpenConns)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://shop.example.com" {
+		t.Errorf("Unexpected CORS origins: %v", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "gocart.toml", `
+[database]
+conn_max_lifetime = "30m"
+
+[migrations]
+on_start = true
+`)
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Database.ConnMaxLifetime != 30*time.Minute || !cfg.Migrations.OnStart {
+		t.Errorf("Unexpected config from TOML: %+v", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		args    []string
+		env     map[string]string
+		message string
+	}{
+		{name: "Unknown file key", file: "server:\n  prot: \"9000\"\n", message: "prot"},
+		{name: "Malformed env value", env: map[string]string{"DB_MAX_OPEN_CONNS": "lots"}, message: "DB_MAX_OPEN_CONNS"},
+		{name: "Invalid port", args: []string{"-server.port", "http"}, message: "server.port"},
+		{name: "Idle above open", args: []string{"-database.max_open_conns", "5", "-database.max_idle_conns", "10"}, message: "database.max_idle_conns"},
+		{name: "Unknown exporter", env: map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, message: "tracing.exporter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "gocart.yaml", tt.file)}, args...)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load(args)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected error mentioning %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestStringRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+
+	out := cfg.String()
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("Expected password to be redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "database.password = [redacted]") || !strings.Contains(out, "database.conn_max_lifetime = 1h0m0s") {
+		t.Errorf("Unexpected config output:\n%s", out)
+	}
+}
+
+func TestNewLoaderRegistersFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	NewLoader(fs)
+	for _, name := range []string{"config", "server.port", "database.password", "uploads.max_image_bytes", "migrations.allow_pending"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("Expected flag -%s to be registered", name)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "db_password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_PASSWORD", "file://"+passwordFile)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	resolved, err := cfg.ResolveSecrets(context.Background(), cfg.SecretResolver())
+	if err != nil {
+		t.Fatalf("ResolveSecrets failed: %v", err)
+	}
+	if cfg.Database.Password != "from-file" {
+		t.Errorf("Expected password from file, got %q", cfg.Database.Password)
+	}
+	if secret := resolved["database.password"]; secret == nil || secret.Value() != "from-file" {
+		t.Errorf("Expected a handle for database.password, got %v", resolved)
+	}
+
+	t.Setenv("DB_PASSWORD", "local://db_password")
+	cfg, _ = Load([]string{"-secrets.local_file", filepath.Join(dir, "missing.yaml")})
+	if _, err := cfg.ResolveSecrets(context.Background(), cfg.SecretResolver()); err == nil || !strings.Contains(err.Error(), "database.password") {
+		t.Errorf("Expected resolution error naming database.password, got %v", err)
+	}
+}
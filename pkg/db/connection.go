@@ -1,123 +1,140 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"strconv"
 	"time"
 
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
-var DB *gorm.DB
-
 type Config struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port     string `yaml:"port" toml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	DBName   string `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"ssl_mode" toml:"ssl_mode" env:"DB_SSL_MODE"`
+
+	// Connection pool settings
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+
+	// PasswordFunc, if set, is called for every new connection instead of
+	// using Password, so rotated credentials apply without a restart.
+	PasswordFunc func() string `yaml:"-" toml:"-"`
+
+	// Read replicas as host or host:port (defaulting to Port). They share the
+	// primary's credentials, database name and pool settings.
+	Replicas             []string      `yaml:"replicas" toml:"replicas" env:"DB_REPLICAS"`
+	ReplicaMaxLag        time.Duration `yaml:"replica_max_lag" toml:"replica_max_lag" env:"DB_REPLICA_MAX_LAG"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" toml:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL"`
+	// StickyWindow is how long a client keeps reading from the primary after
+	// it wrote, so it sees its own changes despite replication lag.
+	StickyWindow time.Duration `yaml:"sticky_window" toml:"sticky_window" env:"DB_STICKY_WINDOW"`
 }
 
+// DefaultConfig returns settings for the local docker-compose database.
 func DefaultConfig() Config {
 	return Config{
-		Host:     getEnv("DB_HOST", "localhost"),
-		Port:     getEnv("DB_PORT", "5432"),
-		User:     getEnv("DB_USER", "admin"),
-		Password: getEnv("DB_PASSWORD", "password"),
-		DBName:   getEnv("DB_NAME", "gocart_db"),
-		SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+		Host:            "localhost",
+		Port:            "5432",
+		User:            "admin",
+		Password:        "password",
+		DBName:          "gocart_db",
+		SSLMode:         "disable",
+		MaxIdleConns:    10,
+		MaxOpenConns:    100,
+		ConnMaxLifetime: time.Hour,
+
+		ReplicaMaxLag:        10 * time.Second,
+		ReplicaCheckInterval: 5 * time.Second,
+		StickyWindow:         5 * time.Second,
 	}
 }
 
-func Connect(config Config) (*gorm.DB, error) {
-
-	// Log the connection attempt (hide password)
-	log.Printf("Attempting to connect to database - Host: %s, Port: %s, User: %s, DB: %s, SSL: %s",
-		config.Host, config.Port, config.User, config.DBName, config.SSLMode)
-
-	var err error
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		config.Host, config.User, config.Password, config.DBName, config.Port, config.SSLMode)
-
-	// Configure logger
-	gormLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		logger.Config{
-			SlowThreshold:             200 * time.Millisecond,
-			LogLevel:                  logger.Info,
-			IgnoreRecordNotFoundError: false,
-			Colorful:                  true,
-		},
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: gormLogger,
-	})
-	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+// Validate reports settings that would make Connect fail or misbehave.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Host == "" {
+		errs = append(errs, errors.New("host is required"))
 	}
-	sqlDB, err := db.DB()
-	if err != nil {
-		log.Fatalf("failed to get sql.DB: %v", err)
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be a number between 1 and 65535, got %q", c.Port))
 	}
-
-	// Set connection pool settings
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	// Set global DB connection
-	DB = db
-	log.Printf("Connected to PostgresSQL database at %s:%s", config.Host, config.Port)
-
-	return db, nil
-}
-
-// Migrate runs database migrations
-// Pass the models you want to migrate as parameters
-func Migrate(models ...interface{}) {
-	for _, model := range models {
-		if err := DB.AutoMigrate(model); err != nil {
-			log.Fatalf("failed to migrate model: %v", err)
+	if c.User == "" {
+		errs = append(errs, errors.New("user is required"))
+	}
+	if c.DBName == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	switch c.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("ssl_mode %q is not a valid Postgres sslmode", c.SSLMode))
+	}
+	if c.MaxOpenConns < 1 {
+		errs = append(errs, fmt.Errorf("max_open_conns must be at least 1, got %d", c.MaxOpenConns))
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("max_idle_conns must be between 0 and max_open_conns, got %d", c.MaxIdleConns))
+	}
+	if c.ConnMaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("conn_max_lifetime must not be negative, got %s", c.ConnMaxLifetime))
+	}
+	for _, replica := range c.Replicas {
+		if _, _, err := c.replicaAddress(replica); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	log.Println("Database migration completed successfully")
-}
-
-// MigrateAll automatically migrates all service models
-func MigrateAll(db *gorm.DB, models ...interface{}) error {
-	if db == nil {
-		db = DB
+	if len(c.Replicas) > 0 && c.ReplicaCheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("replica_check_interval must be positive, got %s", c.ReplicaCheckInterval))
 	}
-
-	if db == nil {
-		return errors.New("database connection not established")
+	if c.ReplicaMaxLag < 0 || c.StickyWindow < 0 {
+		errs = append(errs, errors.New("replica_max_lag and sticky_window must not be negative"))
 	}
+	return errors.Join(errs...)
+}
 
-	log.Println("Starting database migration...")
-
-	for _, model := range models {
-		if err := db.AutoMigrate(model); err != nil {
-			return fmt.Errorf("failed to migrate model: %w", err)
-		} else {
-			log.Printf("Migrated model: %T", model)
-		}
+// openPool opens a connection pool to host:port with the credentials and
+// pool settings from config. Connections are established lazily.
+func openPool(config Config, host, port string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s user=%s dbname=%s port=%s sslmode=%s",
+		host, config.User, config.DBName, port, config.SSLMode)
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+	password := config.PasswordFunc
+	if password == nil {
+		password = func() string { return config.Password }
 	}
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+		cc.Password = password()
+		return nil
+	}))
+
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	return sqlDB, nil
+}
 
-	log.Println("Database migration completed successfully")
-	return nil
+// RetryPolicy controls how ConnectWithRetry backs off between attempts.
+type RetryPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxAttempts    int // 0 retries until the context is cancelled
 }
 
-// getEnv retrieves an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
 	}
-	return value
 }
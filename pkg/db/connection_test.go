@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unreachableConfig points at a port nothing listens on so connections are
+// refused immediately.
+func unreachableConfig() Config {
+	config := DefaultConfig()
+	config.Host = "127.0.0.1"
+	config.Port = "1"
+	return config
+}
+
+func TestConnectReturnsErrorInsteadOfExiting(t *testing.T) {
+	if err := New(unreachableConfig()).Connect(context.Background()); err == nil {
+		t.Fatal("Expected an error connecting to an unreachable database")
+	}
+}
+
+func TestConnectWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxAttempts: 3}
+
+	err := New(unreachableConfig()).ConnectWithRetry(context.Background(), policy)
+	if err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Fatalf("Expected to give up after 3 attempts, got %v", err)
+	}
+}
+
+func TestConnectWithRetryStopsWhenContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+
+	err := New(unreachableConfig()).ConnectWithRetry(ctx, policy)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context deadline error, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("Expected default config to be valid, got %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Port = "not-a-port"
+	config.SSLMode = "sometimes"
+	config.MaxIdleConns = 200
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, field := range []string{"port", "ssl_mode", "max_idle_conns"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected error to mention %s, got %v", field, err)
+		}
+	}
+}
+
+func TestDatabaseBeforeConnect(t *testing.T) {
+	database := New(unreachableConfig())
+
+	if database.Gorm() != nil {
+		t.Error("Expected no GORM handle before Connect")
+	}
+	if err := database.Ping(context.Background()); err != ErrNotConnected {
+		t.Errorf("Expected ErrNotConnected from Ping, got %v", err)
+	}
+	if _, err := database.Migrate(context.Background()); err != ErrNotConnected {
+		t.Errorf("Expected ErrNotConnected from Migrate, got %v", err)
+	}
+	if err := database.Close(); err != nil {
+		t.Errorf("Expected closing an unconnected database to succeed, got %v", err)
+	}
+	if err := database.Connect(context.Background()); err == nil {
+		t.Error("Expected Connect to fail after Close")
+	}
+}
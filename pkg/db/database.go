@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"gocart/pkg/migrate"
+	"gocart/pkg/tracing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrNotConnected is returned by Database methods that need a connection
+// before Connect has succeeded.
+var ErrNotConnected = errors.New("database is not connected")
+
+// Database owns the primary connection pool, the read replicas and the
+// schema migrator for one Postgres database. Create it with New, call
+// Connect (or ConnectWithRetry) and pass it, or the *gorm.DB from Gorm, to
+// whatever needs it. Close releases every connection.
+type Database struct {
+	config Config
+
+	mu       sync.RWMutex
+	gorm     *gorm.DB
+	sql      *sql.DB
+	replicas *ReplicaRouter
+	closed   bool
+}
+
+func New(config Config) *Database {
+	return &Database{config: config}
+}
+
+// Connect opens the connection pools and verifies the primary is reachable.
+// Calling it on a connected Database is a no-op.
+func (d *Database) Connect(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errors.New("database is closed")
+	}
+	if d.gorm != nil {
+		return nil
+	}
+	config := d.config
+
+	// Log the connection attempt (hide password)
+	log.Printf("Attempting to connect to database - Host: %s, Port: %s, User: %s, DB: %s, SSL: %s",
+		config.Host, config.Port, config.User, config.DBName, config.SSLMode)
+
+	sqlDB, err := openPool(config, config.Host, config.Port)
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Configure logger
+	gormLogger := logger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags),
+		logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Info,
+			IgnoreRecordNotFoundError: false,
+			Colorful:                  true,
+		},
+	)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger:               gormLogger,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := gormDB.Use(tracing.GormPlugin{}); err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("failed to register tracing plugin: %w", err)
+	}
+
+	// Route read-only queries to replicas when any are configured
+	var router *ReplicaRouter
+	if len(config.Replicas) > 0 {
+		router, err = newReplicaRouter(config)
+		if err != nil {
+			sqlDB.Close()
+			return err
+		}
+		if err := gormDB.Use(router); err != nil {
+			router.Close()
+			sqlDB.Close()
+			return fmt.Errorf("failed to register replica router: %w", err)
+		}
+		router.start()
+	}
+
+	d.gorm, d.sql, d.replicas = gormDB, sqlDB, router
+	log.Printf("Connected to PostgresSQL database at %s:%s", config.Host, config.Port)
+	return nil
+}
+
+// ConnectWithRetry calls Connect until it succeeds, the policy runs out of
+// attempts or ctx is cancelled. The delay between attempts doubles up to
+// MaxBackoff, with jitter so replicas don't reconnect in lockstep.
+func (d *Database) ConnectWithRetry(ctx context.Context, policy RetryPolicy) error {
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.Connect(ctx)
+		if err == nil {
+			return nil
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		log.Printf("Database connection attempt %d failed: %v (retrying in %s)", attempt, err, wait.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// Gorm returns the GORM handle repositories are built on, or nil before
+// Connect succeeds.
+func (d *Database) Gorm() *gorm.DB {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.gorm
+}
+
+// SQL returns the primary connection pool, or nil before Connect succeeds.
+func (d *Database) SQL() *sql.DB {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.sql
+}
+
+// Replicas returns the read replica router, or nil when no replicas are
+// configured or the database is not connected.
+func (d *Database) Replicas() *ReplicaRouter {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.replicas
+}
+
+// Ping checks that the primary is reachable.
+func (d *Database) Ping(ctx context.Context) error {
+	sqlDB := d.SQL()
+	if sqlDB == nil {
+		return ErrNotConnected
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Migrator returns a migrator for the embedded schema migrations.
+func (d *Database) Migrator() (*migrate.Migrator, error) {
+	sqlDB := d.SQL()
+	if sqlDB == nil {
+		return nil, ErrNotConnected
+	}
+	return migrate.New(sqlDB)
+}
+
+// Migrate applies all pending schema migrations.
+func (d *Database) Migrate(ctx context.Context) ([]migrate.Migration, error) {
+	migrator, err := d.Migrator()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Up(ctx)
+}
+
+// Close stops replica health checks and closes every connection pool. It is
+// safe to call on a Database that never connected, and more than once.
+func (d *Database) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	var errs []error
+	if d.replicas != nil {
+		errs = append(errs, d.replicas.Close())
+	}
+	if d.sql != nil {
+		errs = append(errs, d.sql.Close())
+		log.Printf("Closed database connection to %s:%s", d.config.Host, d.config.Port)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,332 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"gorm.io/gorm"
+)
+
+const replicaPluginName = "gocart:replicas"
+
+// replicaLagSQL reports replication lag in seconds. A standby that has
+// replayed everything it received is not lagging even if the primary has
+// been idle; a server that is not a standby reports NULL, i.e. 0.
+const replicaLagSQL = `SELECT COALESCE(
+	CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END, 0)`
+
+type readOnlyKey struct{}
+
+// ReadOnly marks ctx so queries made with it may be served by a read replica.
+// Repositories use it for list and get methods that tolerate replication lag.
+// Queries inside a transaction, and queries from a client that wrote
+// recently (see StickyMiddleware), still go to the primary.
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+func isReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+// stickiness tracks whether the current request must read from the primary
+// to see its own writes.
+type stickiness struct {
+	recentWrite atomic.Bool // the client wrote within the sticky window
+	wrote       atomic.Bool // this request wrote
+}
+
+type stickinessKey struct{}
+
+func stickToPrimary(ctx context.Context) bool {
+	s, ok := ctx.Value(stickinessKey{}).(*stickiness)
+	return ok && (s.recentWrite.Load() || s.wrote.Load())
+}
+
+func markWrite(ctx context.Context) {
+	if s, ok := ctx.Value(stickinessKey{}).(*stickiness); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// StickyCookie remembers until when a client must read from the primary.
+const StickyCookie = "gocart_primary_until"
+
+// StickyMiddleware gives clients read-your-writes consistency. Once a request
+// writes to the database, later reads in the same request and in the
+// client's requests during window are served by the primary. The deadline is
+// kept in a cookie, so it works across replicas of the API too.
+func StickyMiddleware(window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := &stickiness{}
+			if cookie, err := r.Cookie(StickyCookie); err == nil {
+				if until, err := strconv.ParseInt(cookie.Value, 10, 64); err == nil && time.Now().UnixMilli() < until {
+					s.recentWrite.Store(true)
+				}
+			}
+
+			// The cookie has to be set before the response headers go out,
+			// which is before the handler returns.
+			var once sync.Once
+			setCookie := func() {
+				once.Do(func() {
+					if !s.wrote.Load() {
+						return
+					}
+					until := time.Now().Add(window)
+					http.SetCookie(w, &http.Cookie{
+						Name:     StickyCookie,
+						Value:    strconv.FormatInt(until.UnixMilli(), 10),
+						Path:     "/",
+						Expires:  until,
+						HttpOnly: true,
+						SameSite: http.SameSiteLaxMode,
+					})
+				})
+			}
+			wrapped := httpsnoop.Wrap(w, httpsnoop.Hooks{
+				WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+					return func(code int) {
+						setCookie()
+						next(code)
+					}
+				},
+				Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+					return func(b []byte) (int, error) {
+						setCookie()
+						return next(b)
+					}
+				},
+			})
+
+			next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), stickinessKey{}, s)))
+		})
+	}
+}
+
+// replica is one read replica connection pool and its last health check.
+type replica struct {
+	address string
+	db      *sql.DB
+
+	healthy atomic.Bool
+	mu      sync.Mutex
+	lag     time.Duration
+	lastErr error
+}
+
+// ReplicaStatus is a snapshot of a replica's health.
+type ReplicaStatus struct {
+	Address string        `json:"address"`
+	Healthy bool          `json:"healthy"`
+	Lag     time.Duration `json:"-"`
+	LagSecs float64       `json:"lag_seconds"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ReplicaRouter is a GORM plugin that sends read-only queries to healthy
+// replicas, round robin, and falls back to the primary when none is healthy.
+// Replicas are ejected when a ping fails or their lag exceeds the configured
+// maximum, and put back once a later check passes.
+type ReplicaRouter struct {
+	replicas []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	interval time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newReplicaRouter(config Config) (*ReplicaRouter, error) {
+	router := &ReplicaRouter{
+		maxLag:   config.ReplicaMaxLag,
+		interval: config.ReplicaCheckInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, address := range config.Replicas {
+		host, port, err := config.replicaAddress(address)
+		if err != nil {
+			router.closePools()
+			return nil, err
+		}
+		pool, err := openPool(config, host, port)
+		if err != nil {
+			router.closePools()
+			return nil, err
+		}
+		router.replicas = append(router.replicas, &replica{address: net.JoinHostPort(host, port), db: pool})
+	}
+	return router, nil
+}
+
+// replicaAddress splits a replica entry into host and port, defaulting the
+// port to the primary's.
+func (c Config) replicaAddress(address string) (string, string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, c.Port
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("replica %q has no host", address)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", "", fmt.Errorf("replica %q has an invalid port", address)
+	}
+	return host, port, nil
+}
+
+func (r *ReplicaRouter) Name() string {
+	return replicaPluginName
+}
+
+func (r *ReplicaRouter) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Query().Before("gorm:query").Register("gocart:replicas:route", r.route),
+		callbacks.Row().Before("gorm:row").Register("gocart:replicas:route", r.route),
+		callbacks.Create().After("gorm:create").Register("gocart:replicas:sticky", r.sticky),
+		callbacks.Update().After("gorm:update").Register("gocart:replicas:sticky", r.sticky),
+		callbacks.Delete().After("gorm:delete").Register("gocart:replicas:sticky", r.sticky),
+		callbacks.Raw().After("gorm:raw").Register("gocart:replicas:sticky", r.sticky),
+	)
+}
+
+func (r *ReplicaRouter) route(tx *gorm.DB) {
+	ctx := tx.Statement.Context
+	if !isReadOnly(ctx) || stickToPrimary(ctx) {
+		return
+	}
+	// Statements in a transaction must stay on the transaction's connection
+	if _, inTx := tx.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	if replica := r.pick(); replica != nil {
+		tx.Statement.ConnPool = replica.db
+	}
+}
+
+func (r *ReplicaRouter) sticky(tx *gorm.DB) {
+	markWrite(tx.Statement.Context)
+}
+
+// pick returns the next healthy replica, or nil to use the primary.
+func (r *ReplicaRouter) pick() *replica {
+	n := uint64(len(r.replicas))
+	start := r.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if candidate := r.replicas[(start+i)%n]; candidate.healthy.Load() {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// start checks every replica once so healthy ones are used right away, then
+// keeps checking in the background until Close.
+func (r *ReplicaRouter) start() {
+	r.checkAll()
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.checkAll()
+			}
+		}
+	}()
+}
+
+func (r *ReplicaRouter) checkAll() {
+	var wg sync.WaitGroup
+	for _, replica := range r.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.check(replica)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *ReplicaRouter) check(replica *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	var lagSeconds float64
+	err := replica.db.QueryRowContext(ctx, replicaLagSQL).Scan(&lagSeconds)
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	if err == nil && r.maxLag > 0 && lag > r.maxLag {
+		err = fmt.Errorf("replication lag %s exceeds %s", lag.Round(time.Millisecond), r.maxLag)
+	}
+
+	replica.mu.Lock()
+	replica.lag, replica.lastErr = lag, err
+	replica.mu.Unlock()
+
+	healthy := err == nil
+	if was := replica.healthy.Swap(healthy); was != healthy {
+		if healthy {
+			log.Printf("Read replica %s is healthy, routing reads to it", replica.address)
+		} else {
+			log.Printf("⚠️  Warning: Ejecting read replica %s: %v", replica.address, err)
+		}
+	}
+}
+
+// Status reports the health of every replica as of its last check.
+func (r *ReplicaRouter) Status() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0, len(r.replicas))
+	for _, replica := range r.replicas {
+		replica.mu.Lock()
+		status := ReplicaStatus{
+			Address: replica.address,
+			Healthy: replica.healthy.Load(),
+			Lag:     replica.lag,
+			LagSecs: replica.lag.Seconds(),
+		}
+		if replica.lastErr != nil {
+			status.Error = replica.lastErr.Error()
+		}
+		replica.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Close stops health checking and closes the replica pools.
+func (r *ReplicaRouter) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	select {
+	case <-r.done:
+	case <-time.After(r.interval):
+	}
+	return r.closePools()
+}
+
+func (r *ReplicaRouter) closePools() error {
+	var errs []error
+	for _, replica := range r.replicas {
+		errs = append(errs, replica.db.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// testRouter returns a router over replicas that are never dialled, with
+// the given health states.
+func testRouter(t *testing.T, healthy ...bool) *ReplicaRouter {
+	t.Helper()
+	config := unreachableConfig()
+	for range healthy {
+		config.Replicas = append(config.Replicas, "127.0.0.1:1")
+	}
+	router, err := newReplicaRouter(config)
+	if err != nil {
+		t.Fatalf("newReplicaRouter failed: %v", err)
+	}
+	t.Cleanup(func() { router.closePools() })
+	for i, h := range healthy {
+		router.replicas[i].healthy.Store(h)
+	}
+	return router
+}
+
+func TestReplicaRouterRoute(t *testing.T) {
+	router := testRouter(t, false, true)
+	primary := &sql.DB{}
+	sticky := &stickiness{}
+	sticky.wrote.Store(true)
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		pool       gorm.ConnPool
+		useReplica bool
+	}{
+		{name: "Read-only query goes to healthy replica", ctx: ReadOnly(context.Background()), pool: primary, useReplica: true},
+		{name: "Unmarked query stays on primary", ctx: context.Background(), pool: primary},
+		{name: "Query in transaction stays on primary", ctx: ReadOnly(context.Background()), pool: &sql.Tx{}},
+		{
+			name: "Client that wrote stays on primary",
+			ctx:  ReadOnly(context.WithValue(context.Background(), stickinessKey{}, sticky)),
+			pool: primary,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &gorm.DB{Statement: &gorm.Statement{Context: tt.ctx, ConnPool: tt.pool}}
+			router.route(tx)
+
+			routed := tx.Statement.ConnPool == router.replicas[1].db
+			if routed != tt.useReplica {
+				t.Errorf("Expected replica=%v, got pool %T", tt.useReplica, tx.Statement.ConnPool)
+			}
+		})
+	}
+}
+
+func TestReplicaRouterFallsBackToPrimary(t *testing.T) {
+	router := testRouter(t, false, false)
+	if replica := router.pick(); replica != nil {
+		t.Errorf("Expected no replica when all are ejected, got %s", replica.address)
+	}
+}
+
+func TestReplicaCheckEjectsUnreachableReplica(t *testing.T) {
+	router := testRouter(t, true)
+	router.interval = time.Second
+	router.checkAll()
+
+	status := router.Status()[0]
+	if status.Healthy || status.Error == "" {
+		t.Errorf("Expected unreachable replica to be ejected with an error, got %+v", status)
+	}
+}
+
+func TestStickyMiddleware(t *testing.T) {
+	middleware := StickyMiddleware(time.Minute)
+
+	t.Run("Write sets cookie", func(t *testing.T) {
+		handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			markWrite(r.Context())
+			if !stickToPrimary(r.Context()) {
+				t.Error("Expected reads after a write in the same request to use the primary")
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/products", nil))
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != StickyCookie {
+			t.Fatalf("Expected %s cookie, got %v", StickyCookie, cookies)
+		}
+	})
+
+	t.Run("Read sets no cookie", func(t *testing.T) {
+		handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("[]"))
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+		if cookies := w.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("Expected no cookie, got %v", cookies)
+		}
+	})
+
+	for name, offset := range map[string]time.Duration{"Fresh cookie sticks": time.Minute, "Expired cookie ignored": -time.Minute} {
+		t.Run(name, func(t *testing.T) {
+			var sticky bool
+			handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sticky = stickToPrimary(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.AddCookie(&http.Cookie{Name: StickyCookie, Value: strconv.FormatInt(time.Now().Add(offset).UnixMilli(), 10)})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if sticky != (offset > 0) {
+				t.Errorf("Expected sticky=%v, got %v", offset > 0, sticky)
+			}
+		})
+	}
+}
+
+func TestReplicaAddress(t *testing.T) {
+	config := DefaultConfig()
+	tests := []struct {
+		address     string
+		host, port  string
+		expectError bool
+	}{
+		{address: "replica-1", host: "replica-1", port: "5432"},
+		{address: "replica-2:6432", host: "replica-2", port: "6432"},
+		{address: "replica-3:http", expectError: true},
+		{address: ":6432", expectError: true},
+	}
+
+	for _, tt := range tests {
+		host, port, err := config.replicaAddress(tt.address)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", tt.address)
+			}
+			continue
+		}
+		if err != nil || host != tt.host || port != tt.port {
+			t.Errorf("%s: expected %s:%s, got %s:%s (%v)", tt.address, tt.host, tt.port, host, port, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type includeDeletedKey struct{}
+
+// IncludeDeleted marks ctx so repository reads also return soft-deleted
+// rows. Handlers set it for admin requests with include_deleted=true.
+func IncludeDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+// IncludesDeleted reports whether ctx was marked with IncludeDeleted.
+func IncludesDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return include
+}
+
+// Scoped returns tx bound to ctx, without the soft delete filter if ctx
+// includes deleted rows. Only use it for reads: an unscoped Delete removes
+// rows for good.
+func Scoped(ctx context.Context, tx *gorm.DB) *gorm.DB {
+	tx = tx.WithContext(ctx)
+	if IncludesDeleted(ctx) {
+		return tx.Unscoped()
+	}
+	return tx
+}
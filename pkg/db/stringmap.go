@@ -0,0 +1,45 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringMap is a string-to-string map stored as a JSON object, for columns
+// of type jsonb. A nil map is stored as {}.
+type StringMap map[string]string
+
+// Value implements driver.Valuer.
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner. NULL scans as an empty map.
+func (m *StringMap) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*m = StringMap{}
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into StringMap", src)
+	}
+	values := StringMap{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("cannot scan StringMap: %w", err)
+	}
+	*m = values
+	return nil
+}
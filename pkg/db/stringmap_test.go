@@ -0,0 +1,50 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringMap(t *testing.T) {
+	value, err := StringMap{"size": "M", "color": "Blue"}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != `{"color":"Blue","size":"M"}` {
+		t.Errorf("Expected a JSON object, got %v", value)
+	}
+	if value, _ := StringMap(nil).Value(); value != "{}" {
+		t.Errorf("Expected nil to be stored as {}, got %v", value)
+	}
+
+	tests := []struct {
+		name     string
+		src      interface{}
+		expected StringMap
+		wantErr  bool
+	}{
+		{name: "Bytes", src: []byte(`{"size":"M"}`), expected: StringMap{"size": "M"}},
+		{name: "String", src: `{"color":"Blue"}`, expected: StringMap{"color": "Blue"}},
+		{name: "NULL", src: nil, expected: StringMap{}},
+		{name: "Not an object", src: `["M"]`, wantErr: true},
+		{name: "Wrong type", src: 42, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m StringMap
+			err := m.Scan(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, m)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check statuses. A "warn" result is reported but never fails readiness.
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// CheckResult is the outcome of a single dependency check.
+type CheckResult struct {
+	Status   string                 `json:"status"`
+	Message  string                 `json:"message,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Critical bool                   `json:"critical"`
+	Duration string                 `json:"duration"`
+}
+
+// CheckFunc runs a dependency check. The context carries the probe timeout.
+type CheckFunc func(ctx context.Context) CheckResult
+
+type namedCheck struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Report is the JSON body returned by the probe endpoints.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker serves /livez and /readyz. Liveness only reports that the process
+// is able to serve HTTP; readiness runs every registered check and fails when
+// a critical check fails or the server is shutting down.
+type Checker struct {
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// AddCheck registers a readiness check. Critical checks make /readyz return
+// 503 when they fail; non-critical checks are only reported.
+func (c *Checker) AddCheck(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.checks {
+		if c.checks[i].name == name {
+			c.checks[i] = namedCheck{name: name, critical: critical, fn: fn}
+			return
+		}
+	}
+	c.checks = append(c.checks, namedCheck{name: name, critical: critical, fn: fn})
+}
+
+// SetShuttingDown flips readiness to failing so load balancers stop routing
+// new traffic while in-flight requests drain.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run executes all checks concurrently and returns the aggregated report and
+// whether the service is ready.
+func (c *Checker) Run(ctx context.Context) (Report, bool) {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			start := time.Now()
+			result := check.fn(ctx)
+			result.Critical = check.critical
+			result.Duration = time.Since(start).String()
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	ready := true
+	for i, check := range checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status == StatusFail && check.critical {
+			ready = false
+		}
+	}
+	if c.shuttingDown.Load() {
+		ready = false
+		report.Checks["shutdown"] = CheckResult{Status: StatusFail, Message: "server is shutting down", Critical: true}
+	}
+	if !ready {
+		report.Status = StatusFail
+	}
+	return report, ready
+}
+
+// Livez reports that the process is up. It deliberately does not check
+// dependencies so a database outage does not get the process restarted.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readyz reports whether the service can take traffic.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report, ready := c.Run(r.Context())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// DatabaseCheck pings the database within the probe timeout.
+func DatabaseCheck(sqlDB *sql.DB) CheckFunc {
+	return func(ctx context.Context) CheckResult {
+		if err := sqlDB.PingContext(ctx); err != nil {
+			return CheckResult{Status: StatusFail, Message: err.Error()}
+		}
+		return CheckResult{Status: StatusOK}
+	}
+}
+
+// PoolCheck reports connection pool usage and warns once the share of
+// in-use connections reaches threshold (0..1) of the configured maximum.
+func PoolCheck(sqlDB *sql.DB, threshold float64) CheckFunc {
+	return func(ctx context.Context) CheckResult {
+		stats := sqlDB.Stats()
+		result := CheckResult{
+			Status: StatusOK,
+			Details: map[string]interface{}{
+				"open":          stats.OpenConnections,
+				"in_use":        stats.InUse,
+				"idle":          stats.Idle,
+				"max_open":      stats.MaxOpenConnections,
+				"wait_count":    stats.WaitCount,
+				"wait_duration": stats.WaitDuration.String(),
+			},
+		}
+		if stats.MaxOpenConnections > 0 {
+			saturation := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+			result.Details["saturation"] = saturation
+			if saturation >= threshold {
+				result.Status = StatusWarn
+				result.Message = fmt.Sprintf("%d of %d connections in use", stats.InUse, stats.MaxOpenConnections)
+			}
+		}
+		return result
+	}
+}
+
+// MigrationsCheck fails while pending reports schema migrations that have not
+// been applied yet.
+func MigrationsCheck(pending func(ctx context.Context) (int, error)) CheckFunc {
+	return func(ctx context.Context) CheckResult {
+		count, err := pending(ctx)
+		if err != nil {
+			return CheckResult{Status: StatusFail, Message: err.Error()}
+		}
+		result := CheckResult{Status: StatusOK, Details: map[string]interface{}{"pending": count}}
+		if count > 0 {
+			result.Status = StatusFail
+			result.Message = fmt.Sprintf("%d pending migration(s)", count)
+		}
+		return result
+	}
+}
+
+// WritableDirCheck verifies that a file can be created in dir.
+func WritableDirCheck(dir string) CheckFunc {
+	return func(ctx context.Context) CheckResult {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return CheckResult{Status: StatusFail, Message: err.Error()}
+		}
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return CheckResult{Status: StatusFail, Message: err.Error()}
+		}
+		name := f.Name()
+		f.Close()
+		os.Remove(name)
+		return CheckResult{Status: StatusOK, Details: map[string]interface{}{"path": dir}}
+	}
+}
+
+// Unavailable is a check that always fails with message, used as a
+// placeholder for dependencies that are not connected yet.
+func Unavailable(message string) CheckFunc {
+	return func(ctx context.Context) CheckResult {
+		return CheckResult{Status: StatusFail, Message: message}
+	}
+}
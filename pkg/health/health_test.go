@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ok(ctx context.Context) CheckResult { return CheckResult{Status: StatusOK} }
+
+func TestReadyzStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		critical       bool
+		check          CheckFunc
+		shuttingDown   bool
+		expectedStatus int
+	}{
+		{name: "All checks pass", critical: true, check: ok, expectedStatus: http.StatusOK},
+		{name: "Critical check fails", critical: true, check: Unavailable("down"), expectedStatus: http.StatusServiceUnavailable},
+		{name: "Non-critical check fails", critical: false, check: Unavailable("down"), expectedStatus: http.StatusOK},
+		{name: "Shutting down", critical: true, check: ok, shuttingDown: true, expectedStatus: http.StatusServiceUnavailable},
+		{
+			name:     "Check exceeds timeout",
+			critical: true,
+			check: func(ctx context.Context) CheckResult {
+				<-ctx.Done()
+				return CheckResult{Status: StatusFail, Message: ctx.Err().Error()}
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(50 * time.Millisecond)
+			checker.AddCheck("dependency", tt.critical, tt.check)
+			if tt.shuttingDown {
+				checker.SetShuttingDown()
+			}
+
+			w := httptest.NewRecorder()
+			checker.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			var report Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+			if _, ok := report.Checks["dependency"]; !ok {
+				t.Errorf("Expected dependency check in report, got %+v", report.Checks)
+			}
+		})
+	}
+}
+
+func TestLivezIgnoresDependencies(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("database", true, Unavailable("down"))
+	checker.SetShuttingDown()
+
+	w := httptest.NewRecorder()
+	checker.Livez(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestAddCheckReplacesExistingCheck(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("database", true, Unavailable("not connected"))
+	checker.AddCheck("database", true, ok)
+
+	report, ready := checker.Run(context.Background())
+	if !ready || len(report.Checks) != 1 {
+		t.Errorf("Expected a single passing check, got ready=%v checks=%+v", ready, report.Checks)
+	}
+}
+
+func TestMigrationsCheck(t *testing.T) {
+	pending := MigrationsCheck(func(ctx context.Context) (int, error) { return 2, nil })
+	if result := pending(context.Background()); result.Status != StatusFail {
+		t.Errorf("Expected fail with pending migrations, got %s", result.Status)
+	}
+	upToDate := MigrationsCheck(func(ctx context.Context) (int, error) { return 0, nil })
+	if result := upToDate(context.Background()); result.Status != StatusOK {
+		t.Errorf("Expected ok without pending migrations, got %s", result.Status)
+	}
+}
+
+func TestWritableDirCheck(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads")
+	if result := WritableDirCheck(dir)(context.Background()); result.Status != StatusOK {
+		t.Errorf("Expected writable dir to pass, got %s: %s", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,76 @@
+// Package imaging checks uploaded images and generates resized renditions
+// of them.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnsupported is returned for files that aren't JPEG, PNG, GIF or WebP
+// images, whatever their name says.
+var ErrUnsupported = errors.New("unsupported image type")
+
+// ContentTypes are the image types Inspect accepts.
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// Info describes an image file.
+type Info struct {
+	// ContentType is sniffed from the file's content: image/jpeg,
+	// image/png, image/gif or image/webp.
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Extension returns the file extension for the image's type.
+func (i Info) Extension() string {
+	switch i.ContentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ""
+}
+
+// Inspect sniffs data's type and reads its dimensions from the header,
+// without decoding the pixels.
+func Inspect(data []byte) (Info, error) {
+	info := Info{ContentType: http.DetectContentType(data)}
+	switch info.ContentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return Info{}, ErrUnsupported
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, ErrUnsupported
+	}
+	info.Width, info.Height = config.Width, config.Height
+	if info.Width < 1 || info.Height < 1 {
+		return Info{}, ErrUnsupported
+	}
+	return info, nil
+}
+
+// Decode decodes a JPEG, PNG, GIF or WebP image; for animated GIFs, the
+// first frame.
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	return img, nil
+}
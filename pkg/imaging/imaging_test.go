@@ -0,0 +1,96 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	var pngData, jpegData, gifData bytes.Buffer
+	png.Encode(&pngData, img)
+	jpeg.Encode(&jpegData, img, nil)
+	gif.Encode(&gifData, img, nil)
+
+	// A lossy WebP header: RIFF, VP8 chunk, frame tag, start code, 640x480
+	lossy := []byte("RIFF\x16\x00\x00\x00WEBPVP8 \x0a\x00\x00\x00\x00\x00\x00\x9d\x01\x2a\x80\x02\xe0\x01\x00\x00")
+	// An extended WebP header with a 1920x1080 canvas
+	extended := []byte("RIFF\x16\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\x7f\x07\x00\x37\x04\x00")
+
+	tests := []struct {
+		name         string
+		data         []byte
+		expectedType string
+		width        int
+		height       int
+		expectedErr  error
+	}{
+		{name: "PNG", data: pngData.Bytes(), expectedType: "image/png", width: 40, height: 30},
+		{name: "JPEG", data: jpegData.Bytes(), expectedType: "image/jpeg", width: 40, height: 30},
+		{name: "GIF", data: gifData.Bytes(), expectedType: "image/gif", width: 40, height: 30},
+		{name: "Lossy WebP", data: lossy, expectedType: "image/webp", width: 640, height: 480},
+		{name: "Extended WebP", data: extended, expectedType: "image/webp", width: 1920, height: 1080},
+		{name: "Text", data: []byte("<?php echo 'not an image';"), expectedErr: ErrUnsupported},
+		{name: "Truncated PNG", data: pngData.Bytes()[:20], expectedErr: ErrUnsupported},
+		{name: "Zeros", data: make([]byte, 512), expectedErr: ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Inspect(tt.data)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if info.ContentType != tt.expectedType || info.Width != tt.width || info.Height != tt.height {
+				t.Errorf("Expected %s %dx%d, got %+v", tt.expectedType, tt.width, tt.height, info)
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name           string
+		width, height  int
+		maxW, maxH     int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{name: "Landscape", width: 1000, height: 500, maxW: 200, maxH: 200, expectedWidth: 200, expectedHeight: 100},
+		{name: "Portrait", width: 300, height: 900, maxW: 200, maxH: 200, expectedWidth: 66, expectedHeight: 200},
+		{name: "Already fits", width: 120, height: 80, maxW: 200, maxH: 200, expectedWidth: 120, expectedHeight: 80},
+		{name: "Very thin", width: 2000, height: 3, maxW: 100, maxH: 100, expectedWidth: 100, expectedHeight: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+			fitted := Fit(img, tt.maxW, tt.maxH)
+			if fitted.Bounds().Dx() != tt.expectedWidth || fitted.Bounds().Dy() != tt.expectedHeight {
+				t.Errorf("Expected %dx%d, got %v", tt.expectedWidth, tt.expectedHeight, fitted.Bounds())
+			}
+		})
+	}
+}
+
+func TestFitAveragesByAlpha(t *testing.T) {
+	// Opaque red beside transparent black should average to half
+	// transparent red, not a dark red
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{})
+
+	got := Fit(img, 1, 1).NRGBAAt(0, 0)
+	if got.R != 255 || got.A != 128 {
+		t.Errorf("Expected half transparent red, got %+v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit scales img down to fit within width x height, keeping its aspect
+// ratio. Each output pixel averages the source pixels it covers, which
+// suits the large reductions thumbnails need. Images that already fit are
+// copied at their own size.
+func Fit(img image.Image, width, height int) *image.NRGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := srcWidth, srcHeight
+	if dstWidth > width {
+		dstWidth, dstHeight = width, max(1, srcHeight*width/srcWidth)
+	}
+	if dstHeight > height {
+		dstWidth, dstHeight = max(1, srcWidth*height/srcHeight), height
+	}
+
+	src := toNRGBA(img)
+	if dstWidth == srcWidth && dstHeight == srcHeight {
+		return src
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*srcHeight/dstHeight, max((y+1)*srcHeight/dstHeight, y*srcHeight/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*srcWidth/dstWidth, max((x+1)*srcWidth/dstWidth, x*srcWidth/dstWidth+1)
+
+			// Average with colors weighted by alpha, so transparent
+			// pixels don't darken the edges around them
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					alpha := uint64(p[3])
+					r += uint64(p[0]) * alpha
+					g += uint64(p[1]) * alpha
+					b += uint64(p[2]) * alpha
+					a += alpha
+					n++
+				}
+			}
+			p := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			if a > 0 {
+				p[0] = uint8((r + a/2) / a)
+				p[1] = uint8((g + a/2) / a)
+				p[2] = uint8((b + a/2) / a)
+			}
+			p[3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// toNRGBA copies img into an NRGBA image with its origin at 0, 0.
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
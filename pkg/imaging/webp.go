@@ -0,0 +1,310 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"sort"
+)
+
+// The encoder below writes lossless WebP (VP8L) with the subtract-green
+// transform and Huffman-coded literals, which is enough to serve WebP
+// renditions without cgo or libwebp. It doesn't search for backward
+// references, so files are larger than cwebp's.
+
+const (
+	vp8lSignature    = 0x2f
+	vp8lMaxDimension = 1 << 14
+
+	subtractGreenTransform = 2
+
+	// Alphabet sizes of the five prefix codes: green (with length
+	// prefixes), red, blue, alpha and distance
+	greenAlphabet    = 256 + 24
+	literalAlphabet  = 256
+	distanceAlphabet = 40
+
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+// codeLengthCodeOrder is the order code length code lengths are written in.
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img to w as a lossless WebP file.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return errors.New("webp: image must be 1 to 16384 pixels on each side")
+	}
+	src := toNRGBA(img)
+
+	// After subtract-green, red and blue hold their difference from green
+	pixels := make([][4]uint8, 0, width*height)
+	alphaUsed := false
+	for i := 0; i < len(src.Pix); i += 4 {
+		r, g, b, a := src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3]
+		pixels = append(pixels, [4]uint8{g, r - g, b - g, a})
+		alphaUsed = alphaUsed || a != 0xff
+	}
+
+	var bw bitWriter
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	bw.write(boolBit(alphaUsed), 1)
+	bw.write(0, 3) // version
+
+	bw.write(1, 1) // a transform follows
+	bw.write(subtractGreenTransform, 2)
+	bw.write(0, 1) // no more transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // one set of prefix codes for the whole image
+
+	codes := make([]prefixCode, 4)
+	for channel, alphabet := range []int{greenAlphabet, literalAlphabet, literalAlphabet, literalAlphabet} {
+		counts := make([]int, alphabet)
+		for _, p := range pixels {
+			counts[p[channel]]++
+		}
+		codes[channel] = bw.writePrefixCode(counts)
+	}
+	bw.writePrefixCode(make([]int, distanceAlphabet)) // no backward references
+
+	for _, p := range pixels {
+		for channel, code := range codes {
+			code.writeSymbol(&bw, int(p[channel]))
+		}
+	}
+	data := bw.flush()
+
+	chunkSize := len(data)
+	padded := chunkSize + chunkSize&1
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+8+padded))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(chunkSize))
+	if chunkSize&1 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bitWriter packs values least significant bit first, as VP8L reads them.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(value uint32, nbits uint) {
+	w.acc |= uint64(value) << w.nbits
+	w.nbits += nbits
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode is a canonical Huffman code. Codes are stored bit-reversed,
+// ready to be written least significant bit first.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+func (c prefixCode) writeSymbol(w *bitWriter, symbol int) {
+	w.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+}
+
+// writePrefixCode writes a code for symbols with the given counts and
+// returns it. One or two symbols below 256 use the short "simple" form,
+// where a lone symbol takes no bits at all; anything else is written as
+// code lengths, themselves Huffman coded.
+func (w *bitWriter) writePrefixCode(counts []int) prefixCode {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+
+	code := prefixCode{lengths: make([]uint8, len(counts))}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		w.write(1, 1) // simple code
+		w.write(uint32(len(used)-1), 1)
+		if used[0] <= 1 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+		}
+		code.codes = canonicalCodes(code.lengths)
+		return code
+	}
+
+	code.lengths = huffmanLengths(counts, maxCodeLength)
+	code.codes = canonicalCodes(code.lengths)
+
+	lengthCounts := make([]int, len(codeLengthCodeOrder))
+	for _, length := range code.lengths {
+		lengthCounts[length]++
+	}
+	lengthCode := prefixCode{lengths: huffmanLengths(lengthCounts, maxCodeLengthCodeLength)}
+	lengthCode.codes = canonicalCodes(lengthCode.lengths)
+
+	numLengthCodes := len(codeLengthCodeOrder)
+	for numLengthCodes > 4 && lengthCode.lengths[codeLengthCodeOrder[numLengthCodes-1]] == 0 {
+		numLengthCodes--
+	}
+	w.write(0, 1) // normal code
+	w.write(uint32(numLengthCodes-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:numLengthCodes] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+
+	// Decoders read no bits for a code with a single symbol, which the
+	// length code is when every used symbol has the same length
+	single := 0
+	for _, length := range lengthCode.lengths {
+		if length > 0 {
+			single++
+		}
+	}
+	if single == 1 {
+		lengthCode.lengths = make([]uint8, len(lengthCode.lengths))
+	}
+
+	w.write(0, 1) // a length for every symbol follows
+	for _, length := range code.lengths {
+		lengthCode.writeSymbol(w, int(length))
+	}
+	return code
+}
+
+// huffmanLengths returns code lengths of at most maxLength bits for
+// symbols with the given counts; unused symbols get 0. When the optimal
+// code is too deep, rare symbols are counted as more common until it fits.
+func huffmanLengths(counts []int, maxLength int) []uint8 {
+	type node struct {
+		weight      int
+		left, right int // children, or -1 for a leaf
+		symbol      int
+	}
+
+	for minCount := 1; ; minCount *= 2 {
+		lengths := make([]uint8, len(counts))
+		var nodes []node
+		var pending []int
+		for symbol, count := range counts {
+			if count > 0 {
+				nodes = append(nodes, node{weight: max(count, minCount), left: -1, right: -1, symbol: symbol})
+				pending = append(pending, len(nodes)-1)
+			}
+		}
+		if len(pending) == 1 {
+			lengths[nodes[0].symbol] = 1
+			return lengths
+		}
+
+		for len(pending) > 1 {
+			// Lightest first; ties go to the earlier node so the result
+			// doesn't depend on sort stability
+			sort.Slice(pending, func(i, j int) bool {
+				a, b := nodes[pending[i]], nodes[pending[j]]
+				if a.weight != b.weight {
+					return a.weight < b.weight
+				}
+				return pending[i] < pending[j]
+			})
+			left, right := pending[0], pending[1]
+			nodes = append(nodes, node{weight: nodes[left].weight + nodes[right].weight, left: left, right: right})
+			pending = append(pending[2:], len(nodes)-1)
+		}
+
+		tooDeep := false
+		var walk func(index, depth int)
+		walk = func(index, depth int) {
+			n := nodes[index]
+			if n.left < 0 {
+				lengths[n.symbol] = uint8(depth)
+				tooDeep = tooDeep || depth > maxLength
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(pending[0], 0)
+		if !tooDeep {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical Huffman codes to the given lengths:
+// shorter codes first, and by symbol within a length.
+func canonicalCodes(lengths []uint8) []uint16 {
+	var lengthCount [maxCodeLength + 1]int
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCount[length]++
+		}
+	}
+	var next [maxCodeLength + 1]int
+	code := 0
+	for length := 1; length <= maxCodeLength; length++ {
+		code = (code + lengthCount[length-1]) << 1
+		next[length] = code
+	}
+
+	codes := make([]uint16, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		codes[symbol] = reverseBits(uint16(next[length]), length)
+		next[length]++
+	}
+	return codes
+}
+
+func reverseBits(code uint16, length uint8) uint16 {
+	var reversed uint16
+	for i := uint8(0); i < length; i++ {
+		reversed = reversed<<1 | code&1
+		code >>= 1
+	}
+	return reversed
+}
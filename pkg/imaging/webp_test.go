@@ -0,0 +1,122 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	solid := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range solid.Pix {
+		solid.Pix[i] = 0xff
+	}
+
+	gradient := image.NewNRGBA(image.Rect(0, 0, 61, 47))
+	for y := 0; y < 47; y++ {
+		for x := 0; x < 61; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8(x * y), A: 0xff})
+		}
+	}
+
+	// Skewed counts give deep Huffman trees that must be limited to 15 bits
+	skewed := image.NewNRGBA(image.Rect(0, 0, 256, 64))
+	for i := 0; i < 256*64; i++ {
+		value := uint8(0)
+		for bit := 0; bit < 8 && i&(1<<bit) != 0; bit++ {
+			value++
+		}
+		if i < 256 {
+			value = uint8(i)
+		}
+		skewed.Pix[i*4], skewed.Pix[i*4+1], skewed.Pix[i*4+2], skewed.Pix[i*4+3] = value, value*3, 255-value, 255
+	}
+
+	// Every green value once: all code lengths are 8, so the code length
+	// code has a single symbol
+	grays := image.NewGray(image.Rect(0, 0, 256, 1))
+	for i := range grays.Pix {
+		grays.Pix[i] = uint8(i)
+	}
+
+	translucent := image.NewNRGBA(image.Rect(0, 0, 5, 5))
+	for i := 0; i < 25; i++ {
+		translucent.Pix[i*4], translucent.Pix[i*4+3] = uint8(i*10), uint8(i*7)
+	}
+
+	offset := image.NewRGBA(image.Rect(10, 10, 14, 13))
+	for i := range offset.Pix {
+		offset.Pix[i] = uint8(i * 9)
+	}
+	for i := 3; i < len(offset.Pix); i += 4 {
+		offset.Pix[i] = 0xff
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{name: "Solid color", img: solid},
+		{name: "Gradient", img: gradient},
+		{name: "Skewed", img: skewed},
+		{name: "Every value", img: grays},
+		{name: "Translucent", img: translucent},
+		{name: "Offset bounds", img: offset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, tt.img); err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+
+			data := buf.Bytes()
+			if riffSize := binary.LittleEndian.Uint32(data[4:8]); int(riffSize)+8 != len(data) {
+				t.Errorf("Expected the RIFF size to match the file size %d, got %d", len(data), riffSize)
+			}
+			decoded, err := webp.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			want := toNRGBA(tt.img)
+			if got := toNRGBA(decoded); got.Bounds() != want.Bounds() || !bytes.Equal(got.Pix, want.Pix) {
+				t.Errorf("Expected the decoded pixels to match the source")
+			}
+
+			info, err := Inspect(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Failed to inspect: %v", err)
+			}
+			if info.ContentType != "image/webp" || info.Width != want.Bounds().Dx() || info.Height != want.Bounds().Dy() {
+				t.Errorf("Expected a %dx%d WebP, got %+v", want.Bounds().Dx(), want.Bounds().Dy(), info)
+			}
+		})
+	}
+}
+
+func TestHuffmanLengthsLimit(t *testing.T) {
+	// Fibonacci counts would need a 30-bit code without the limit
+	counts := make([]int, 32)
+	a, b := 1, 1
+	for i := range counts {
+		counts[i] = a
+		a, b = b, a+b
+	}
+
+	lengths := huffmanLengths(counts, maxCodeLength)
+	kraft := 0.0
+	for _, length := range lengths {
+		if length == 0 || length > maxCodeLength {
+			t.Fatalf("Expected every symbol to get 1 to %d bits, got %v", maxCodeLength, lengths)
+		}
+		kraft += 1 / float64(uint(1)<<length)
+	}
+	if kraft != 1 {
+		t.Errorf("Expected a complete code, got Kraft sum %v", kraft)
+	}
+}
@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogMailer writes messages to the application log instead of sending them.
+// It is the default so local development works without a mail server.
+// Token parameters in links are redacted, so the log never holds a working
+// password reset link; use a FileMailer to follow them.
+type LogMailer struct {
+	From string
+}
+
+// tokenParameter matches the value of a token query parameter.
+var tokenParameter = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	body := tokenParameter.ReplaceAllString(msg.Body, "${1}REDACTED")
+	log.Printf("📧 Mail from %s to %s: %s\n%s", m.From, msg.To, msg.Subject, body)
+	return nil
+}
+
+// FileMailer writes each message as an .eml file in Dir, where tests and
+// developers can read it or open it in a mail client.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := format(m.From, msg, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, msg.To)
+	f, err := os.CreateTemp(m.Dir, fmt.Sprintf("%s-%s-*.eml", now.UTC().Format("20060102T150405"), recipient))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Messages returns the paths of the messages written so far, oldest first.
+func (m *FileMailer) Messages() ([]string, error) {
+	return filepath.Glob(filepath.Join(m.Dir, "*.eml"))
+}
@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Supported values for Config.Backend.
+const (
+	BackendLog  = "log"
+	BackendFile = "file"
+	BackendSMTP = "smtp"
+)
+
+type Config struct {
+	Backend string `yaml:"backend" toml:"backend" env:"MAIL_BACKEND"` // log, file or smtp
+	From    string `yaml:"from" toml:"from" env:"MAIL_FROM"`
+	// Dir is where the file backend writes messages.
+	Dir string `yaml:"dir" toml:"dir" env:"MAIL_DIR"`
+
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Backend:  BackendLog,
+		From:     "GoCart <no-reply@gocart.local>",
+		Dir:      "mail",
+		SMTPPort: "587",
+	}
+}
+
+// Validate reports settings New would reject.
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Backend {
+	case BackendLog, BackendFile, BackendSMTP:
+	default:
+		errs = append(errs, fmt.Errorf("backend must be one of log, file or smtp, got %q", c.Backend))
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		errs = append(errs, fmt.Errorf("from must be an email address, got %q", c.From))
+	}
+	if c.Backend == BackendFile && c.Dir == "" {
+		errs = append(errs, errors.New("dir is required for the file backend"))
+	}
+	if c.Backend == BackendSMTP && c.SMTPHost == "" {
+		errs = append(errs, errors.New("smtp_host is required for the smtp backend"))
+	}
+	return errors.Join(errs...)
+}
+
+// New returns the mailer selected by config.Backend.
+func New(config Config) (Mailer, error) {
+	switch config.Backend {
+	case BackendLog:
+		return LogMailer{From: config.From}, nil
+	case BackendFile:
+		return &FileMailer{Dir: config.Dir, From: config.From}, nil
+	case BackendSMTP:
+		return &SMTPMailer{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.From,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", config.Backend)
+	}
+}
+
+// format renders msg as an RFC 5322 message with a quoted-printable body.
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("subject must not contain line breaks")
+	}
+
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", from},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", messageID(from)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
+	}
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(address.Address, "@"); ok {
+			domain = host
+		}
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
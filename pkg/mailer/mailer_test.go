@@ -0,0 +1,153 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	data, err := format("GoCart <no-reply@gocart.test>", Message{
+		To:      "jane@example.com",
+		Subject: "Réinitialisation",
+		Body:    "Hello\nLine two",
+	}, time.Now())
+	if err != nil {
+		t.Fatalf("format failed: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Expected a parsable message, got %v", err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "Réinitialisation" {
+		t.Errorf("Expected encoded subject to round-trip, got %q", subject)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-Id"), "@gocart.test>") {
+		t.Errorf("Expected Message-ID in the sender's domain, got %q", parsed.Header.Get("Message-Id"))
+	}
+
+	for _, msg := range []Message{
+		{To: "not an address", Subject: "Hi"},
+		{To: "jane@example.com", Subject: "Hi\r\nBcc: everyone@example.com"},
+	} {
+		if _, err := format("no-reply@gocart.test", msg, time.Now()); err == nil {
+			t.Errorf("Expected error for %+v", msg)
+		}
+	}
+}
+
+func TestLogMailerRedactsTokens(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	LogMailer{From: "no-reply@gocart.test"}.Send(context.Background(), Message{
+		To:   "jane@example.com",
+		Body: "Reset: https://shop.test/reset?token=abc123&lang=en\nVerify: https://shop.test/verify?token=def456",
+	})
+
+	if strings.Contains(logged.String(), "abc123") || strings.Contains(logged.String(), "def456") {
+		t.Errorf("Expected tokens to be redacted, got:\n%s", logged.String())
+	}
+	if !strings.Contains(logged.String(), "reset?token=REDACTED&lang=en") {
+		t.Errorf("Expected the rest of the link to be kept, got:\n%s", logged.String())
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	m := &FileMailer{Dir: t.TempDir(), From: "no-reply@gocart.test"}
+	if err := m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Verify", Body: "token=abc"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	paths, err := m.Messages()
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("Expected one message file, got %v (%v)", paths, err)
+	}
+	data, _ := os.ReadFile(paths[0])
+	if !strings.Contains(string(data), "To: jane@example.com") || !strings.Contains(string(data), "token=3Dabc") {
+		t.Errorf("Expected message with recipient and encoded body, got:\n%s", data)
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go serveSMTP(listener, received)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	m := &SMTPMailer{Host: host, Port: port, From: "GoCart <no-reply@gocart.test>", Timeout: 5 * time.Second}
+	if err := m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Reset", Body: "Hello"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	commands := <-received
+	transcript := strings.Join(commands, "\n")
+	for _, expected := range []string{"MAIL FROM:<no-reply@gocart.test>", "RCPT TO:<jane@example.com>", "Subject: Reset", "QUIT"} {
+		if !strings.Contains(transcript, expected) {
+			t.Errorf("Expected %q in SMTP transcript:\n%s", expected, transcript)
+		}
+	}
+
+	m.Username, m.Password = "user", "secret"
+	go serveSMTP(listener, received)
+	if err := m.Send(context.Background(), Message{To: "jane@example.com", Subject: "Reset"}); err == nil {
+		t.Error("Expected credentials to be refused over plain text")
+	}
+}
+
+// serveSMTP accepts one connection, answers like a server without
+// extensions and reports every line the client sent.
+func serveSMTP(listener net.Listener, received chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var lines []string
+	reader := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	inData := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		switch {
+		case inData:
+			if line == "." {
+				inData = false
+				reply("250 queued")
+			}
+		case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+			reply("250 localhost")
+		case line == "DATA":
+			inData = true
+			reply("354 go ahead")
+		case line == "QUIT":
+			reply("221 bye")
+			received <- lines
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+	received <- lines
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gocart"
+
+// Registry holds every GoCart collector. A dedicated registry (instead of the
+// prometheus default one) keeps /metrics free of collectors registered by
+// third-party packages as a side effect of being imported.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+
+	ordersCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "created_total",
+		Help:      "Total number of orders created.",
+	})
+
+	orderValue = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "value",
+		Help:      "Total amount of created orders.",
+		Buckets:   []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+	})
+
+	failedLoginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "failed_logins_total",
+		Help:      "Total number of failed login attempts by reason.",
+	}, []string{"reason"})
+
+	accountLockoutsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "account_lockouts_total",
+		Help:      "Total number of accounts locked after repeated failed logins.",
+	})
+
+	cacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Total number of cache lookups by cache name and result (hit, miss or error).",
+	}, []string{"cache", "result"})
+
+	rateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Total number of requests rejected by rate limiting, by policy.",
+	}, []string{"policy"})
+
+	purgedRowsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "purge",
+		Name:      "rows_total",
+		Help:      "Total number of soft-deleted rows removed after the retention period, by table.",
+	}, []string{"table"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpRequestsInFlight,
+		ordersCreatedTotal,
+		orderValue,
+		failedLoginsTotal,
+		accountLockoutsTotal,
+		cacheRequestsTotal,
+		rateLimitedTotal,
+		purgedRowsTotal,
+	)
+}
+
+// Handler serves the metrics in Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exposes the connection pool statistics of sqlDB
+// (open/idle/in-use connections, wait counts, ...) under the given name.
+func RegisterDB(sqlDB *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// OrderCreated records a successfully created order and its total amount.
+func OrderCreated(totalAmount float64) {
+	ordersCreatedTotal.Inc()
+	orderValue.Observe(totalAmount)
+}
+
+// LoginFailed records a rejected login attempt.
+func LoginFailed(reason string) {
+	failedLoginsTotal.WithLabelValues(reason).Inc()
+}
+
+// AccountLocked records an account locked after repeated failed logins.
+func AccountLocked() {
+	accountLockoutsTotal.Inc()
+}
+
+// CacheLookup records the result of a cache lookup: "hit", "miss" or "error".
+func CacheLookup(cache, result string) {
+	cacheRequestsTotal.WithLabelValues(cache, result).Inc()
+}
+
+// RateLimited records a request rejected by the named rate limit policy.
+func RateLimited(policy string) {
+	rateLimitedTotal.WithLabelValues(policy).Inc()
+}
+
+// RowsPurged records soft-deleted rows removed from table for good.
+func RowsPurged(table string, count int64) {
+	purgedRowsTotal.WithLabelValues(table).Add(float64(count))
+}
+
+type routeKey struct{}
+
+// routeLabel is shared between Middleware and RouteTagger through the request
+// context so the innermost matched router can report its route template.
+type routeLabel struct {
+	template string
+}
+
+// Middleware records request count, latency and in-flight requests for every
+// request passing through next. The route label is the path template set by
+// RouteTagger, so routers mounted under the main router must use RouteTagger
+// for their routes to be reported with their own templates.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		label := &routeLabel{}
+		r = r.WithContext(context.WithValue(r.Context(), routeKey{}, label))
+
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		m := httpsnoop.CaptureMetrics(next, w, r)
+
+		route := label.template
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(m.Code)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(m.Duration.Seconds())
+	})
+}
+
+// RouteTagger is a mux middleware that stores the path template of the matched
+// route (e.g. /products/{id}) for Middleware. Using templates instead of raw
+// paths keeps the label cardinality bounded.
+func RouteTagger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if label, ok := r.Context().Value(routeKey{}).(*routeLabel); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					label.template = template
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsInnermostRouteTemplate(t *testing.T) {
+	sub := mux.NewRouter()
+	sub.Use(RouteTagger)
+	sub.HandleFunc("/widgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods("GET")
+
+	main := mux.NewRouter()
+	main.Use(RouteTagger)
+	main.PathPrefix("/widgets").Handler(sub)
+
+	handler := Middleware(main)
+	for _, id := range []string{"1", "2", "3"} {
+		req := httptest.NewRequest(http.MethodGet, "/widgets/"+id, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/widgets/{id}", "418"))
+	if got != 3 {
+		t.Errorf("Expected 3 requests for /widgets/{id}, got %v", got)
+	}
+}
+
+func TestMiddlewareLabelsUnmatchedRoutes(t *testing.T) {
+	before := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "unmatched", "404"))
+
+	main := mux.NewRouter()
+	main.Use(RouteTagger)
+	req := httptest.NewRequest(http.MethodGet, "/does-not-exist", nil)
+	Middleware(main).ServeHTTP(httptest.NewRecorder(), req)
+
+	after := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "unmatched", "404"))
+	if after != before+1 {
+		t.Errorf("Expected unmatched counter to increase by 1, got %v -> %v", before, after)
+	}
+}
+
+func TestBusinessMetricsAreExposed(t *testing.T) {
+	OrderCreated(120.5)
+	LoginFailed("invalid_password")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, name := range []string{
+		"gocart_orders_created_total",
+		"gocart_orders_value_bucket",
+		`gocart_users_failed_logins_total{reason="invalid_password"}`,
+	} {
+		if !strings.Contains(body, name) {
+			t.Errorf("Expected /metrics output to contain %s", name)
+		}
+	}
+}
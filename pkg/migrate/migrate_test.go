@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"gocart/pkg/testutils"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		expectError bool
+		expected    []int64
+	}{
+		{
+			name: "Orders by version",
+			files: fstest.MapFS{
+				"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX ...")},
+				"0001_initial.up.sql":     {Data: []byte("CREATE TABLE ...")},
+				"0001_initial.down.sql":   {Data: []byte("DROP TABLE ...")},
+				"README.md":               {Data: []byte("ignored")},
+				"0002_add_index.down.sql": {Data: []byte("DROP INDEX ...")},
+			},
+			expected: []int64{1, 2},
+		},
+		{
+			name: "Duplicate version with different names",
+			files: fstest.MapFS{
+				"0001_initial.up.sql": {Data: []byte("SELECT 1")},
+				"0001_other.up.sql":   {Data: []byte("SELECT 1")},
+			},
+			expectError: true,
+		},
+		{
+			name:        "Invalid filename",
+			files:       fstest.MapFS{"initial.sql": {Data: []byte("SELECT 1")}},
+			expectError: true,
+		},
+		{
+			name:        "Missing up file",
+			files:       fstest.MapFS{"0001_initial.down.sql": {Data: []byte("SELECT 1")}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(migrations) != len(tt.expected) {
+				t.Fatalf("Expected %d migrations, got %d", len(tt.expected), len(migrations))
+			}
+			for i, version := range tt.expected {
+				if migrations[i].Version != version {
+					t.Errorf("Expected version %d at position %d, got %d", version, i, migrations[i].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	if _, err := New(nil); err != nil {
+		t.Fatalf("Embedded migrations are invalid: %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0001_initial.up.sql"), []byte("SELECT 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := Create(dir, "Add Product SKU")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "0002_add_product_sku.up.sql"),
+		filepath.Join(dir, "0002_add_product_sku.down.sql"),
+	}
+	for i, p := range expected {
+		if paths[i] != p {
+			t.Errorf("Expected %s, got %s", p, paths[i])
+		}
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Expected %s to exist: %v", p, err)
+		}
+	}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	db, cleanup := testutils.SetupTestDB(t, testutils.TestDBConfig{ServiceName: "migrate"})
+	defer cleanup()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get sql.DB: %v", err)
+	}
+	migrator, err := New(sqlDB)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || pending == 0 {
+		t.Fatalf("Expected pending migrations on an empty database, got %d (%v)", pending, err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if pending, _ := migrator.Pending(ctx); pending != 0 {
+		t.Errorf("Expected no pending migrations after Up, got %d", pending)
+	}
+	if !db.Migrator().HasTable("products") {
+		t.Error("Expected products table to exist after Up")
+	}
+
+	// Running Up again is a no-op
+	applied, err := migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected second Up to apply nothing, got %d (%v)", len(applied), err)
+	}
+
+	if _, err := migrator.Down(ctx, len(migrator.migrations)); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if db.Migrator().HasTable("products") {
+		t.Error("Expected products table to be dropped after Down")
+	}
+}
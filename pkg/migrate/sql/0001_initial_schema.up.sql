@@ -0,0 +1,51 @@
+-- Baseline schema matching what GORM AutoMigrate created before versioned
+-- migrations existed. IF NOT EXISTS lets existing databases adopt it as-is.
+
+CREATE TABLE IF NOT EXISTS products (
+    product_id  TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT,
+    price       NUMERIC NOT NULL,
+    category    TEXT,
+    image_url   TEXT
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id       TEXT PRIMARY KEY,
+    first_name    TEXT,
+    last_name     TEXT,
+    email         TEXT,
+    phone         TEXT,
+    password_hash TEXT,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS orders (
+    order_id         UUID PRIMARY KEY,
+    user_id          TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    total_amount     NUMERIC NOT NULL,
+    friendly_id      TEXT,
+    shipping_address TEXT,
+    city             TEXT,
+    zip_code         TEXT,
+    country          TEXT,
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_item_id UUID PRIMARY KEY,
+    order_id      UUID,
+    product_id    TEXT NOT NULL,
+    quantity      BIGINT NOT NULL,
+    price         NUMERIC NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL,
+    CONSTRAINT fk_orders_items FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items (order_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS login_events;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS lockout_count,
+    DROP COLUMN IF EXISTS failed_login_attempts;
@@ -0,0 +1,20 @@
+-- Failed login tracking and temporary account lockout.
+ALTER TABLE users
+    ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN lockout_count         INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until          TIMESTAMPTZ;
+
+-- Audit trail of every login attempt. user_id is empty for unknown emails.
+CREATE TABLE login_events (
+    login_event_id BIGSERIAL PRIMARY KEY,
+    user_id        TEXT NOT NULL DEFAULT '',
+    email          TEXT NOT NULL,
+    ip             TEXT NOT NULL,
+    user_agent     TEXT NOT NULL DEFAULT '',
+    success        BOOLEAN NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_login_events_user_id ON login_events (user_id, created_at);
+CREATE INDEX idx_login_events_ip ON login_events (ip, created_at);
@@ -0,0 +1,3 @@
+-- When the password last changed, by a change or a reset. Nothing issued
+-- at login is checked against it yet, since logins don't issue sessions.
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMPTZ;
@@ -0,0 +1,14 @@
+-- Soft deletion: deleted rows keep their data until purged after the
+-- retention period.
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_products_deleted_at ON products (deleted_at);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at);
+
+-- Emails only need to be unique among users that aren't deleted, so a
+-- deleted user's email can be registered again
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users (email) WHERE deleted_at IS NULL;
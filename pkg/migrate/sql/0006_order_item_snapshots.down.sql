@@ -0,0 +1,6 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS product_sku;
+ALTER TABLE order_items DROP COLUMN IF EXISTS product_image_url;
+ALTER TABLE order_items DROP COLUMN IF EXISTS product_category;
+ALTER TABLE order_items DROP COLUMN IF EXISTS product_name;
+
+ALTER TABLE products DROP COLUMN IF EXISTS sku;
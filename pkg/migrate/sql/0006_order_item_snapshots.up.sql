@@ -0,0 +1,20 @@
+-- Products get a stock keeping unit.
+ALTER TABLE products ADD COLUMN sku TEXT;
+
+-- Order items keep the product details they were ordered with, so later
+-- product edits and deletions don't rewrite order history.
+ALTER TABLE order_items ADD COLUMN product_name TEXT;
+ALTER TABLE order_items ADD COLUMN product_category TEXT;
+ALTER TABLE order_items ADD COLUMN product_image_url TEXT;
+ALTER TABLE order_items ADD COLUMN product_sku TEXT;
+
+-- Backfill from the products as they are now, the best record left of
+-- existing orders. Soft-deleted products still have their rows; items whose
+-- product was removed for good stay empty. SKUs are new, so there are none
+-- to copy.
+UPDATE order_items
+SET product_name      = products.name,
+    product_category  = products.category,
+    product_image_url = products.image_url
+FROM products
+WHERE products.product_id = order_items.product_id;
@@ -0,0 +1,7 @@
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
+
+DROP INDEX IF EXISTS idx_order_items_product_id;
+DROP INDEX IF EXISTS idx_orders_user_id;
+
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS fk_order_items_product;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS fk_orders_user;
@@ -0,0 +1,23 @@
+-- Orders must point at real users and order items at real products. Deleted
+-- users and products are only soft-deleted, so the rows stay; RESTRICT stops
+-- the purge, or anything else, from removing rows that orders still use.
+--
+-- NOT VALID skips checking existing rows, which may refer to users and
+-- products hard-deleted before soft deletion existed; new and updated rows
+-- are checked. Once those are cleaned up, run
+-- ALTER TABLE ... VALIDATE CONSTRAINT to check the rest.
+ALTER TABLE orders
+    ADD CONSTRAINT fk_orders_user FOREIGN KEY (user_id)
+    REFERENCES users (user_id) ON DELETE RESTRICT NOT VALID;
+
+ALTER TABLE order_items
+    ADD CONSTRAINT fk_order_items_product FOREIGN KEY (product_id)
+    REFERENCES products (product_id) ON DELETE RESTRICT NOT VALID;
+
+-- Foreign keys aren't indexed on the referencing side; the purge and the
+-- RESTRICT checks look rows up by these columns.
+CREATE INDEX idx_orders_user_id ON orders (user_id);
+CREATE INDEX idx_order_items_product_id ON order_items (product_id);
+
+-- Users with orders can't be removed, so the purge anonymizes them instead.
+ALTER TABLE users ADD COLUMN anonymized_at TIMESTAMPTZ;
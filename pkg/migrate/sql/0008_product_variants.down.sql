@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_order_items_variant_id;
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS product_options,
+    DROP COLUMN IF EXISTS variant_id;
+
+DROP TABLE IF EXISTS product_variants;
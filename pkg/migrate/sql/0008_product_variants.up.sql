@@ -0,0 +1,29 @@
+-- Variants are the buyable versions of a product, such as a size or color,
+-- each with its own SKU and stock and optionally its own price and image.
+CREATE TABLE product_variants (
+    variant_id TEXT PRIMARY KEY,
+    product_id TEXT NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    sku TEXT NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}',
+    price NUMERIC,
+    stock BIGINT NOT NULL DEFAULT 0,
+    image_url TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+
+-- SKUs only need to be unique among variants that aren't deleted, so a
+-- deleted variant's SKU can be reused.
+CREATE UNIQUE INDEX idx_product_variants_sku ON product_variants (sku) WHERE deleted_at IS NULL;
+CREATE INDEX idx_product_variants_product_id ON product_variants (product_id);
+CREATE INDEX idx_product_variants_deleted_at ON product_variants (deleted_at);
+
+-- Order items may pick a variant; its option values are copied like the
+-- other product details.
+ALTER TABLE order_items
+    ADD COLUMN variant_id TEXT
+        CONSTRAINT fk_order_items_variant REFERENCES product_variants (variant_id) ON DELETE RESTRICT,
+    ADD COLUMN product_options JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_order_items_variant_id ON order_items (variant_id);
@@ -0,0 +1,3 @@
+-- Free-form product details such as brand, material and weight, as a JSON
+-- object of strings. Product lists are filtered and faceted by them.
+ALTER TABLE products ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
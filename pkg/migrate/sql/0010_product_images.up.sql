@@ -0,0 +1,28 @@
+-- A gallery of images per product. The primary image's URL is kept in
+-- products.image_url for clients that only show one.
+CREATE TABLE product_images (
+    image_id TEXT PRIMARY KEY,
+    product_id TEXT NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    alt_text TEXT NOT NULL DEFAULT '',
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    content_type TEXT NOT NULL DEFAULT '',
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    renditions JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_product_images_product_id ON product_images (product_id, sort_order);
+
+-- At most one primary image per product
+CREATE UNIQUE INDEX idx_product_images_primary ON product_images (product_id) WHERE is_primary;
+
+-- Existing product images become the first, primary image of each gallery.
+-- Their type and size weren't recorded, so those stay empty.
+INSERT INTO product_images (image_id, product_id, url, is_primary, created_at, updated_at)
+SELECT gen_random_uuid()::text, product_id, image_url, TRUE, now(), now()
+FROM products
+WHERE image_url IS NOT NULL AND image_url <> '';
@@ -0,0 +1,15 @@
+-- Slots for product images uploaded directly to the blob store. A slot is
+-- deleted when its upload is confirmed, or with the uploaded file once it
+-- has expired.
+CREATE TABLE product_uploads (
+    upload_id TEXT PRIMARY KEY,
+    product_id TEXT NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_product_uploads_product_id ON product_uploads (product_id);
+CREATE INDEX idx_product_uploads_expires_at ON product_uploads (expires_at);
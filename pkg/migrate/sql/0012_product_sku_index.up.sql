@@ -0,0 +1,3 @@
+-- Bulk imports match products by SKU, so a SKU can belong to only one
+-- product that isn't deleted
+CREATE UNIQUE INDEX idx_products_sku ON products (sku) WHERE deleted_at IS NULL AND sku <> '';
@@ -0,0 +1,110 @@
+// Package patch decodes JSON Merge Patch (RFC 7396) request bodies for flat
+// resources. A member set to null clears the field, a missing member leaves
+// it unchanged and any other value replaces it.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// ContentType is the media type of a JSON merge patch. Plain
+// application/json is accepted too.
+const ContentType = "application/merge-patch+json"
+
+// ErrUnsupportedMediaType is returned by Decode for bodies that are not JSON.
+var ErrUnsupportedMediaType = errors.New("patch must be sent as " + ContentType)
+
+// Document is a decoded merge patch: the raw value of each member present.
+type Document map[string]json.RawMessage
+
+// Decode reads a merge patch from the request body. The body must be a JSON
+// object; a missing Content-Type is treated as JSON.
+func Decode(r *http.Request) (Document, error) {
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil || (mediaType != ContentType && mediaType != "application/json") {
+			return nil, ErrUnsupportedMediaType
+		}
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, errors.New("patch must be a JSON object")
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Has reports whether the patch mentions field, including as null.
+func (d Document) Has(field string) bool {
+	_, ok := d[field]
+	return ok
+}
+
+// IsNull reports whether the patch clears field.
+func (d Document) IsNull(field string) bool {
+	raw, ok := d[field]
+	return ok && bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// Value decodes the new value of field into dst, which must not be used
+// for null members. Errors name the field.
+func (d Document) Value(field string, dst interface{}) error {
+	if err := json.Unmarshal(d[field], dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("%s must be %s", field, jsonType(typeErr.Type))
+		}
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return nil
+}
+
+// jsonType names the JSON type that decodes into t, for error messages.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// Unknown returns the members that are not in allowed, sorted.
+func (d Document) Unknown(allowed ...string) []string {
+	known := make(map[string]bool, len(allowed))
+	for _, field := range allowed {
+		known[field] = true
+	}
+	var unknown []string
+	for field := range d {
+		if !known[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,62 @@
+package patch
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{name: "Merge patch", contentType: ContentType, body: `{"name":"x"}`},
+		{name: "Plain JSON with charset", contentType: "application/json; charset=utf-8", body: `{"name":"x"}`},
+		{name: "No content type", body: `{}`},
+		{name: "JSON patch is not supported", contentType: "application/json-patch+json", body: `[{"op":"remove","path":"/name"}]`, wantErr: true},
+		{name: "Not an object", contentType: ContentType, body: `["name"]`, wantErr: true},
+		{name: "Null document", contentType: ContentType, body: `null`, wantErr: true},
+		{name: "Malformed", contentType: ContentType, body: `{"name":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			_, err := Decode(req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name":"Mug","description":null,"price":"cheap","id":"1","created_at":"now"}`))
+	doc, err := Decode(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !doc.Has("description") || !doc.IsNull("description") || doc.IsNull("name") || doc.Has("category") {
+		t.Error("Expected description to be cleared, name set and category untouched")
+	}
+
+	var name string
+	if err := doc.Value("name", &name); err != nil || name != "Mug" {
+		t.Errorf("Expected name Mug, got %q (%v)", name, err)
+	}
+	var price float64
+	if err := doc.Value("price", &price); err == nil || err.Error() != "price must be a number" {
+		t.Errorf("Expected a type error naming the field, got %v", err)
+	}
+
+	if unknown := doc.Unknown("name", "description", "price"); strings.Join(unknown, ",") != "created_at,id" {
+		t.Errorf("Expected unknown members created_at and id, got %v", unknown)
+	}
+}
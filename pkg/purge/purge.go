@@ -0,0 +1,98 @@
+// Package purge permanently removes soft-deleted rows once they are older
+// than the retention period.
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gocart/pkg/metrics"
+	"log"
+	"time"
+)
+
+type Config struct {
+	// Retention is how long soft-deleted rows are kept and can be
+	// restored; 0 keeps them forever.
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"PURGE_RETENTION"`
+	// Interval is how often the purge runs.
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"PURGE_INTERVAL"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Retention: 30 * 24 * time.Hour,
+		Interval:  time.Hour,
+	}
+}
+
+// Validate reports settings Run would reject.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Retention < 0 {
+		errs = append(errs, fmt.Errorf("retention must not be negative, got %s", c.Retention))
+	}
+	if c.Retention > 0 && c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("interval must be positive, got %s", c.Interval))
+	}
+	return errors.Join(errs...)
+}
+
+// Purger permanently deletes rows soft-deleted before the given time and
+// returns how many it removed.
+type Purger interface {
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PurgerFunc adapts a function to a Purger, for repositories that purge
+// more than one table.
+type PurgerFunc func(ctx context.Context, before time.Time) (int64, error)
+
+func (f PurgerFunc) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return f(ctx, before)
+}
+
+// Target is a table to purge.
+type Target struct {
+	Table  string
+	Purger Purger
+}
+
+// Once purges every target of rows deleted before the given time, in order,
+// so rows only referenced by rows purged earlier can go in the same run. It
+// carries on past failing targets and returns their errors together.
+func Once(ctx context.Context, before time.Time, targets []Target) error {
+	var errs []error
+	for _, target := range targets {
+		count, err := target.Purger.PurgeDeleted(ctx, before)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Table, err))
+			continue
+		}
+		if count > 0 {
+			metrics.RowsPurged(target.Table, count)
+			log.Printf("🧹 Purged %d deleted row(s) from %s", count, target.Table)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run purges targets every config.Interval until ctx is done. It returns
+// immediately when config.Retention is 0.
+func Run(ctx context.Context, config Config, targets []Target) {
+	if config.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := Once(ctx, time.Now().Add(-config.Retention), targets); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Warning: Purging deleted rows failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakePurger struct {
+	count  int64
+	err    error
+	before []time.Time
+}
+
+func (f *fakePurger) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	f.before = append(f.before, before)
+	return f.count, f.err
+}
+
+func TestOnce(t *testing.T) {
+	before := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	failing := &fakePurger{err: errors.New("connection refused")}
+	orders := &fakePurger{count: 3}
+
+	err := Once(context.Background(), before, []Target{{Table: "users", Purger: failing}, {Table: "orders", Purger: orders}})
+	if err == nil || err.Error() != "users: connection refused" {
+		t.Errorf("Expected the failing table in the error, got %v", err)
+	}
+	if len(orders.before) != 1 || !orders.before[0].Equal(before) {
+		t.Errorf("Expected later targets to run after a failure, got %v", orders.before)
+	}
+}
+
+func TestPurgerFunc(t *testing.T) {
+	var called time.Time
+	purger := PurgerFunc(func(ctx context.Context, before time.Time) (int64, error) {
+		called = before
+		return 2, nil
+	})
+	before := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := Once(context.Background(), before, []Target{{Table: "product_variants", Purger: purger}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !called.Equal(before) {
+		t.Errorf("Expected the function to be called with %v, got %v", before, called)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	target := &fakePurger{}
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, Config{Retention: time.Hour, Interval: time.Millisecond}, []Target{{Table: "products", Purger: target}})
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+	if len(target.before) < 2 {
+		t.Fatalf("Expected repeated purges, got %d", len(target.before))
+	}
+	if cutoff := time.Since(target.before[0]); cutoff < time.Hour {
+		t.Errorf("Expected only rows deleted over an hour ago, got cutoff %s ago", cutoff)
+	}
+}
+
+func TestRunDisabled(t *testing.T) {
+	target := &fakePurger{}
+	Run(context.Background(), Config{}, []Target{{Table: "products", Purger: target}})
+	if len(target.before) != 0 {
+		t.Error("Expected no purge without a retention period")
+	}
+}
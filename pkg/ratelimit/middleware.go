@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocart/pkg/metrics"
+)
+
+// Limiter enforces the first matching policy on every request.
+type Limiter struct {
+	store    Store
+	policies []Policy
+
+	// TrustProxy takes the client address from X-Forwarded-For.
+	TrustProxy bool
+}
+
+func NewLimiter(store Store, policies []Policy) *Limiter {
+	return &Limiter{store: store, policies: policies}
+}
+
+// Middleware answers 429 Too Many Requests once a client has used up its
+// bucket. Every limited response carries RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, and
+// rejections a Retry-After header. Store failures let requests through.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := l.policy(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result, err := l.store.Allow(r.Context(), policy.Name+":"+l.identity(r, policy), policy.Limit)
+		if err != nil {
+			log.Printf("⚠️  Warning: Rate limit store failed, allowing request: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit.Burst, ceilSeconds(seconds(float64(policy.Limit.Burst)/policy.Limit.Rate))))
+
+		if !result.Allowed {
+			metrics.RateLimited(policy.Name)
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) policy(r *http.Request) (Policy, bool) {
+	for _, policy := range l.policies {
+		if policy.matches(r) {
+			return policy, true
+		}
+	}
+	return Policy{}, false
+}
+
+// identity returns the bucket owner for policy, "ip:<address>".
+func (l *Limiter) identity(r *http.Request, policy Policy) string {
+	return "ip:" + ClientIP(r, l.TrustProxy)
+}
+
+// ClientIP returns the address of the client that sent r. With trustProxy
+// it is taken from the last X-Forwarded-For hop, which the closest proxy
+// appended; earlier hops are whatever the client sent.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: it holds at most Burst tokens and refills Rate
+// tokens per second. Each request takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result describes the bucket after a request was counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed; zero
+	// when Allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps token buckets. Implementations must apply Allow atomically so
+// several instances sharing a store enforce one limit.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take applies one request to a bucket that held tokens and reports the
+// new token count.
+func take(limit Limit, tokens float64) (Result, float64) {
+	result := Result{Limit: limit.Burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((float64(limit.Burst) - tokens) / limit.Rate)
+	return result, tokens
+}
+
+// refill returns the tokens in a bucket that held tokens elapsed ago.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Identities a Policy can key its buckets by. Requests carry no user
+// credentials yet, so buckets are only kept per client address.
+const (
+	ByIP = "ip"
+)
+
+// Policy limits requests whose method and path match. Buckets are kept per
+// policy and identity, so the same client has separate budgets for
+// different policies.
+type Policy struct {
+	Name   string
+	Method string // "*" matches every method
+	// Path matches itself and everything below it, e.g. /users matches
+	// /users and /users/42 but not /users-export.
+	Path  string
+	Limit Limit
+	By    string // ByIP
+}
+
+// ParsePolicy parses the compact form used in configuration:
+//
+//	<name> <method> <path> <requests>/<period> <burst> ip
+//
+// for example "login POST /users/login 5/1m 5 ip". The period may omit its
+// count, as in 10/s.
+func ParsePolicy(spec string) (Policy, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 6 {
+		return Policy{}, fmt.Errorf("policy %q must have the form \"<name> <method> <path> <requests>/<period> <burst> ip\"", spec)
+	}
+	policy := Policy{Name: fields[0], Method: strings.ToUpper(fields[1]), Path: fields[2], By: fields[5]}
+
+	if !strings.HasPrefix(policy.Path, "/") {
+		return Policy{}, fmt.Errorf("policy %s: path must start with /, got %q", policy.Name, policy.Path)
+	}
+	requests, period, ok := strings.Cut(fields[3], "/")
+	count, err := strconv.Atoi(requests)
+	if !ok || err != nil || count < 1 {
+		return Policy{}, fmt.Errorf("policy %s: rate must look like 10/1s, got %q", policy.Name, fields[3])
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	window, err := time.ParseDuration(period)
+	if err != nil || window <= 0 {
+		return Policy{}, fmt.Errorf("policy %s: invalid rate period %q", policy.Name, period)
+	}
+	policy.Limit.Rate = float64(count) / window.Seconds()
+
+	if policy.Limit.Burst, err = strconv.Atoi(fields[4]); err != nil || policy.Limit.Burst < 1 {
+		return Policy{}, fmt.Errorf("policy %s: burst must be a positive number, got %q", policy.Name, fields[4])
+	}
+	if policy.By != ByIP {
+		return Policy{}, fmt.Errorf("policy %s: key must be ip, got %q", policy.Name, policy.By)
+	}
+	return policy, nil
+}
+
+func (p Policy) matches(r *http.Request) bool {
+	if p.Method != "*" && p.Method != r.Method {
+		return false
+	}
+	path := strings.TrimSuffix(p.Path, "/")
+	return r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/")
+}
+
+// Supported values for Config.Store.
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	// Store is memory (per instance) or redis, which shares buckets between
+	// instances through the server configured for the cache.
+	Store string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`
+	// Policies are checked in order and the first match applies; requests
+	// matching none are not limited. See ParsePolicy for the syntax.
+	Policies []string `yaml:"policies" toml:"policies" env:"RATE_LIMIT_POLICIES"`
+	// TrustProxy identifies clients by the last X-Forwarded-For hop instead
+	// of the connection address. Only enable it behind a proxy that sets the
+	// header, or clients can pick their own key.
+	TrustProxy bool `yaml:"trust_proxy" toml:"trust_proxy" env:"RATE_LIMIT_TRUST_PROXY"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled: true,
+		Store:   StoreMemory,
+		Policies: []string{
+			"login POST /users/login 5/1m 5 ip",
+			"products * /products 20/1s 40 ip",
+			"users * /users 10/1s 20 ip",
+			"orders * /orders 10/1s 20 ip",
+		},
+	}
+}
+
+// Validate reports settings ParsePolicies or the store would reject.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Store != StoreMemory && c.Store != StoreRedis {
+		errs = append(errs, fmt.Errorf("store must be memory or redis, got %q", c.Store))
+	}
+	if _, err := c.ParsePolicies(); err != nil {
+		errs = append(errs, fmt.Errorf("policies: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// ParsePolicies parses every configured policy.
+func (c Config) ParsePolicies() ([]Policy, error) {
+	policies := make([]Policy, 0, len(c.Policies))
+	names := make(map[string]bool)
+	for _, spec := range c.Policies {
+		policy, err := ParsePolicy(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("duplicate policy name %q", policy.Name)
+		}
+		names[policy.Name] = true
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
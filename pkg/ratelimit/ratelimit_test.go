@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// clock is a manually advanced time source.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+func newClock() *clock                   { return &clock{t: time.Unix(1_700_000_000, 0)} }
+
+// stores returns every Store implementation sharing one fake clock, the
+// Redis one backed by an embedded fake server.
+func stores(t *testing.T, c *clock) map[string]Store {
+	t.Helper()
+	memory := NewMemoryStore()
+	memory.now = c.now
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	redisStore := NewRedisStore(client, "test:")
+	redisStore.now = c.now
+
+	return map[string]Store{"memory": memory, "redis": redisStore}
+}
+
+func TestStoreTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for name, c := range map[string]*clock{"memory": newClock(), "redis": newClock()} {
+		store := stores(t, c)[name]
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				result, err := store.Allow(ctx, "key", limit)
+				if err != nil || !result.Allowed {
+					t.Fatalf("Expected request %d within burst to be allowed, got %+v (%v)", i+1, result, err)
+				}
+				if result.Remaining != 2-i {
+					t.Errorf("Expected %d remaining, got %d", 2-i, result.Remaining)
+				}
+			}
+
+			result, _ := store.Allow(ctx, "key", limit)
+			if result.Allowed || result.RetryAfter != time.Second {
+				t.Errorf("Expected rejection with 1s retry, got %+v", result)
+			}
+			if result.Reset != 3*time.Second {
+				t.Errorf("Expected bucket to refill in 3s, got %s", result.Reset)
+			}
+
+			if other, _ := store.Allow(ctx, "other", limit); !other.Allowed {
+				t.Error("Expected separate keys to have separate buckets")
+			}
+
+			c.advance(1500 * time.Millisecond)
+			if result, _ := store.Allow(ctx, "key", limit); !result.Allowed {
+				t.Errorf("Expected refilled token to be allowed, got %+v", result)
+			}
+			if result, _ := store.Allow(ctx, "key", limit); result.Allowed {
+				t.Errorf("Expected half a token not to be enough, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	c := newClock()
+	store := NewMemoryStore()
+	store.now = c.now
+
+	store.Allow(context.Background(), "idle", Limit{Rate: 1, Burst: 1})
+	c.advance(2 * sweepInterval)
+	store.Allow(context.Background(), "active", Limit{Rate: 1, Burst: 1})
+
+	if _, ok := store.buckets["idle"]; ok || len(store.buckets) != 1 {
+		t.Errorf("Expected refilled bucket to be dropped, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expected    Policy
+		expectError bool
+	}{
+		{
+			spec:     "login POST /users/login 5/1m 5 ip",
+			expected: Policy{Name: "login", Method: "POST", Path: "/users/login", Limit: Limit{Rate: 5.0 / 60, Burst: 5}, By: ByIP},
+		},
+		{
+			spec:     "products get /products 10/s 20 ip",
+			expected: Policy{Name: "products", Method: "GET", Path: "/products", Limit: Limit{Rate: 10, Burst: 20}, By: ByIP},
+		},
+		// There are no authenticated users to key by yet
+		{spec: "products GET /products 10/s 20 user", expectError: true},
+		{spec: "login POST /users/login 5/1m 5", expectError: true},
+		{spec: "login POST users/login 5/1m 5 ip", expectError: true},
+		{spec: "login POST /users/login five/1m 5 ip", expectError: true},
+		{spec: "login POST /users/login 5/soon 5 ip", expectError: true},
+		{spec: "login POST /users/login 5/1m 0 ip", expectError: true},
+		{spec: "login POST /users/login 5/1m 5 session", expectError: true},
+	}
+
+	for _, tt := range tests {
+		policy, err := ParsePolicy(tt.spec)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", tt.spec, policy)
+			}
+			continue
+		}
+		if err != nil || policy != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v (%v)", tt.spec, tt.expected, policy, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("Expected default config to be valid, got %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Store = "memcached"
+	config.Policies = append(config.Policies, "login POST /users/login 1/1s 1 ip")
+	if err := config.Validate(); err == nil {
+		t.Error("Expected error for unknown store and duplicate policy, got nil")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestMiddleware(t *testing.T) {
+	policies := []Policy{
+		{Name: "login", Method: "POST", Path: "/users/login", Limit: Limit{Rate: 1.0 / 60, Burst: 2}, By: ByIP},
+		{Name: "users", Method: "*", Path: "/users", Limit: Limit{Rate: 1, Burst: 1}, By: ByIP},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	send := func(handler http.Handler, method, path, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Rejects with headers once the burst is used", func(t *testing.T) {
+		handler := NewLimiter(NewMemoryStore(), policies).Middleware(ok)
+		for i := 0; i < 2; i++ {
+			w := send(handler, "POST", "/users/login", "10.0.0.1:1234", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected login %d to be allowed, got %d", i+1, w.Code)
+			}
+		}
+		w := send(handler, "POST", "/users/login", "10.0.0.1:5678", nil)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected 429, got %d", w.Code)
+		}
+		for header, expected := range map[string]string{
+			"Retry-After":         "60",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "0",
+			"RateLimit-Reset":     "120",
+			"RateLimit-Policy":    "2;w=120",
+		} {
+			if got := w.Header().Get(header); got != expected {
+				t.Errorf("Expected %s: %s, got %q", header, expected, got)
+			}
+		}
+
+		if w := send(handler, "POST", "/users/login", "10.0.0.2:1234", nil); w.Code != http.StatusOK {
+			t.Errorf("Expected another client to be allowed, got %d", w.Code)
+		}
+		if w := send(handler, "GET", "/users/42", "10.0.0.1:1234", nil); w.Code != http.StatusOK {
+			t.Errorf("Expected another policy to have its own budget, got %d", w.Code)
+		}
+	})
+
+	t.Run("Unmatched paths are not limited", func(t *testing.T) {
+		handler := NewLimiter(NewMemoryStore(), policies).Middleware(ok)
+		for i := 0; i < 5; i++ {
+			w := send(handler, "GET", "/users-export", "10.0.0.1:1234", nil)
+			if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+				t.Fatalf("Expected unlimited response, got %d with headers %v", w.Code, w.Header())
+			}
+		}
+	})
+
+	t.Run("Forwarded address only with trusted proxy", func(t *testing.T) {
+		forwarded := func(ip string) http.Header {
+			return http.Header{"X-Forwarded-For": {"spoofed, " + ip}}
+		}
+		for _, trust := range []bool{false, true} {
+			limiter := NewLimiter(NewMemoryStore(), policies)
+			limiter.TrustProxy = trust
+			handler := limiter.Middleware(ok)
+
+			send(handler, "GET", "/users", "192.168.0.1:1", forwarded("10.0.0.1"))
+			w := send(handler, "GET", "/users", "192.168.0.1:1", forwarded("10.0.0.2"))
+			if allowed := w.Code == http.StatusOK; allowed != trust {
+				t.Errorf("TrustProxy=%v: expected allowed=%v, got %d", trust, trust, w.Code)
+			}
+		}
+	})
+
+	t.Run("Store failure allows requests", func(t *testing.T) {
+		handler := NewLimiter(failingStore{}, policies).Middleware(ok)
+		if w := send(handler, "POST", "/users/login", "10.0.0.1:1", nil); w.Code != http.StatusOK {
+			t.Errorf("Expected request to be allowed, got %d", w.Code)
+		}
+	})
+}
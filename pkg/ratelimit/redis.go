@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps buckets on a server speaking the Redis protocol so every
+// instance enforces the same limits. A Lua script refills and takes tokens
+// atomically; the callers' clocks are used, so instances should be kept in
+// sync by NTP.
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+	now    func() time.Time
+}
+
+// tokenBucket refills the bucket at KEYS[1] and takes one token if it can.
+// ARGV: rate (tokens/s), burst, now (unix ms). Returns {allowed, tokens}
+// with tokens as a string because Lua numbers are truncated to integers.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+if now > updated then
+  tokens = math.min(burst, tokens + (now - updated) / 1000 * rate)
+  updated = now
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", updated)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// NewRedisStore stores buckets through client under keys starting with
+// prefix.
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix, now: time.Now}
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	reply, err := tokenBucket.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Rate, limit.Burst, s.now().UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	// The script already took the token; recompute the headers from what
+	// was left before it did.
+	tokens, err := strconv.ParseFloat(reply[1].(string), 64)
+	if err != nil {
+		return Result{}, err
+	}
+	if reply[0].(int64) == 1 {
+		tokens++
+	}
+	result, _ := take(limit, tokens)
+	return result, nil
+}
@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider looks up a secret by the part of a reference after "scheme://".
+type Provider interface {
+	Resolve(ctx context.Context, name string) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ctx context.Context, name string) (string, error)
+
+func (f ProviderFunc) Resolve(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// Resolver turns configuration values into secrets. A value of the form
+// "scheme://name" is looked up with the provider registered for scheme; any
+// other value is returned unchanged, so plain env values keep working.
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver returns a Resolver with the file:// provider registered.
+func NewResolver() *Resolver {
+	r := &Resolver{providers: make(map[string]Provider)}
+	r.Register("file", FileProvider{})
+	return r
+}
+
+// Register makes p responsible for references starting with scheme://.
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[scheme] = p
+}
+
+// IsReference reports whether value points at a provider rather than being
+// a literal secret.
+func (r *Resolver) IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, registered := r.providers[scheme]
+	return registered
+}
+
+// Resolve returns the secret value referenced by value.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, name, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	r.mu.RLock()
+	provider, registered := r.providers[scheme]
+	r.mu.RUnlock()
+	if !registered {
+		return value, nil
+	}
+
+	secret, err := provider.Resolve(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s:// secret: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// Secret is a resolved value that can be refreshed when the underlying
+// credential is rotated. It is safe for concurrent use.
+type Secret struct {
+	ref      string
+	resolver *Resolver
+	value    atomic.Pointer[string]
+}
+
+// Secret resolves ref and returns a handle that can be refreshed later.
+func (r *Resolver) Secret(ctx context.Context, ref string) (*Secret, error) {
+	s := &Secret{ref: ref, resolver: r}
+	if _, err := s.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Value returns the most recently resolved value.
+func (s *Secret) Value() string {
+	return *s.value.Load()
+}
+
+// Refresh re-resolves the secret and reports whether its value changed. On
+// error the previous value is kept.
+func (s *Secret) Refresh(ctx context.Context) (bool, error) {
+	value, err := s.resolver.Resolve(ctx, s.ref)
+	if err != nil {
+		return false, err
+	}
+	old := s.value.Swap(&value)
+	return old != nil && *old != value, nil
+}
+
+// Watch refreshes every secret each interval until ctx is cancelled, calling
+// onChange (if not nil) with the key of each secret whose value rotated.
+// Literal values never change, so only references are polled.
+func Watch(ctx context.Context, interval time.Duration, secrets map[string]*Secret, onChange func(key string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for key, secret := range secrets {
+			if !secret.resolver.IsReference(secret.ref) {
+				continue
+			}
+			changed, err := secret.Refresh(ctx)
+			if err != nil {
+				log.Printf("⚠️  Warning: Failed to refresh secret %s: %v", key, err)
+				continue
+			}
+			if changed {
+				log.Printf("Secret %s was rotated", key)
+				if onChange != nil {
+					onChange(key)
+				}
+			}
+		}
+	}
+}
+
+// FileProvider reads a secret from a file, as mounted by Docker or
+// Kubernetes secrets. A single trailing newline is stripped.
+// Usage: file:///run/secrets/db_password
+type FileProvider struct{}
+
+func (FileProvider) Resolve(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+// LocalProvider serves secrets from a YAML file of name: value pairs, for
+// development and tests. The file is re-read on every lookup so edits are
+// picked up like a rotation would be.
+// Usage: local://db_password
+type LocalProvider struct {
+	Path string
+}
+
+func (p LocalProvider) Resolve(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", err
+	}
+	var values map[string]string
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", p.Path, err)
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found in %s", name, p.Path)
+	}
+	return value, nil
+}
@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "db_password"), "s3cret\n")
+	writeFile(t, filepath.Join(dir, "secrets.yaml"), "db_password: from-local\n")
+
+	resolver := NewResolver()
+	resolver.Register("local", LocalProvider{Path: filepath.Join(dir, "secrets.yaml")})
+
+	tests := []struct {
+		name        string
+		value       string
+		expected    string
+		expectError bool
+	}{
+		{name: "Literal value", value: "password", expected: "password"},
+		{name: "Unregistered scheme is literal", value: "postgres://not-a-secret", expected: "postgres://not-a-secret"},
+		{name: "File reference", value: "file://" + filepath.Join(dir, "db_password"), expected: "s3cret"},
+		{name: "Local reference", value: "local://db_password", expected: "from-local"},
+		{name: "Missing file", value: "file://" + filepath.Join(dir, "missing"), expectError: true},
+		{name: "Missing local secret", value: "local://jwt_signing_key", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := resolver.Resolve(context.Background(), tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestWatchPicksUpRotatedSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	writeFile(t, path, "old")
+
+	resolver := NewResolver()
+	secret, err := resolver.Secret(context.Background(), "file://"+path)
+	if err != nil {
+		t.Fatalf("Secret failed: %v", err)
+	}
+	if secret.Value() != "old" {
+		t.Fatalf("Expected initial value %q, got %q", "old", secret.Value())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rotated := make(chan string, 1)
+	go Watch(ctx, 5*time.Millisecond, map[string]*Secret{"database.password": secret}, func(key string) {
+		rotated <- key
+	})
+
+	writeFile(t, path, "new")
+	select {
+	case key := <-rotated:
+		if key != "database.password" {
+			t.Errorf("Expected rotation of database.password, got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for rotation")
+	}
+	if secret.Value() != "new" {
+		t.Errorf("Expected rotated value %q, got %q", "new", secret.Value())
+	}
+}
+
+func TestRefreshKeepsValueOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	writeFile(t, path, "current")
+
+	secret, err := NewResolver().Secret(context.Background(), "file://"+path)
+	if err != nil {
+		t.Fatalf("Secret failed: %v", err)
+	}
+	os.Remove(path)
+
+	if _, err := secret.Refresh(context.Background()); err == nil {
+		t.Fatal("Expected refresh error for a missing file")
+	}
+	if secret.Value() != "current" {
+		t.Errorf("Expected previous value to be kept, got %q", secret.Value())
+	}
+}
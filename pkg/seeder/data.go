@@ -1,6 +1,7 @@
 package seeder
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -22,6 +23,8 @@ type ProductData struct {
 	Price       float64 `yaml:"price"`
 	Category    string  `yaml:"category"`
 	ImageURL    string  `yaml:"image_url"`
+	// Attributes are optional, e.g. brand, material and weight.
+	Attributes map[string]string `yaml:"attributes"`
 }
 
 type UserData struct {
@@ -55,14 +58,14 @@ func NewSeeder(productRepo productRepository.ProductRepository, userRepo userRep
 }
 
 // SeedAll resets and seeds both products and users with fresh test data
-func (s *SeedData) SeedAll() error {
+func (s *SeedData) SeedAll(ctx context.Context) error {
 	log.Println("🚀 Starting database reset and seeding for testing...")
 
-	if err := s.SeedProducts(); err != nil {
+	if err := s.SeedProducts(ctx); err != nil {
 		return fmt.Errorf("failed to seed products: %w", err)
 	}
 
-	if err := s.SeedUsers(); err != nil {
+	if err := s.SeedUsers(ctx); err != nil {
 		return fmt.Errorf("failed to seed users: %w", err)
 	}
 
@@ -98,6 +101,7 @@ func (s *SeedData) loadProductsFromYAML() ([]productModels.Product, error) {
 			Price:       productData.Price,
 			Category:    productData.Category,
 			ImageURL:    imageURL,
+			Attributes:  productData.Attributes,
 		}
 		products = append(products, product)
 	}
@@ -145,11 +149,11 @@ func slugify(s string) string {
 }
 
 // SeedProducts creates sample products from YAML file
-func (s *SeedData) SeedProducts() error {
+func (s *SeedData) SeedProducts(ctx context.Context) error {
 	log.Println("🔄 Resetting and seeding sample products from YAML...")
 
 	// Delete all existing products for fresh testing data
-	existingProducts, err := s.ProductRepo.ListAllProducts()
+	existingProducts, err := s.ProductRepo.ListAllProducts(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check existing products: %w", err)
 	}
@@ -157,7 +161,7 @@ func (s *SeedData) SeedProducts() error {
 	if len(existingProducts) > 0 {
 		log.Printf("🗑️  Deleting %d existing products for fresh test data...", len(existingProducts))
 		for _, product := range existingProducts {
-			if err := s.ProductRepo.DeleteProduct(product.ProductID); err != nil {
+			if err := s.ProductRepo.DeleteProduct(ctx, product.ProductID); err != nil {
 				log.Printf("⚠️  Failed to delete product %s: %v", product.Name, err)
 			}
 		}
@@ -172,7 +176,7 @@ func (s *SeedData) SeedProducts() error {
 
 	// Create all products
 	for i, product := range sampleProducts {
-		createdProduct, err := s.ProductRepo.CreateProduct(product)
+		createdProduct, err := s.ProductRepo.CreateProduct(ctx, product)
 		if err != nil {
 			log.Printf("Failed to create product %s: %v", product.Name, err)
 			continue
@@ -217,11 +221,11 @@ func (s *SeedData) loadUsersFromYAML() ([]userModels.User, error) {
 }
 
 // SeedUsers creates sample users from YAML file
-func (s *SeedData) SeedUsers() error {
+func (s *SeedData) SeedUsers(ctx context.Context) error {
 	log.Println("🔄 Resetting and seeding sample users from YAML...")
 
 	// Delete all existing users for fresh testing data
-	existingUsers, err := s.UserRepo.ListAllUsers()
+	existingUsers, err := s.UserRepo.ListAllUsers(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check existing users: %w", err)
 	}
@@ -229,7 +233,7 @@ func (s *SeedData) SeedUsers() error {
 	if len(existingUsers) > 0 {
 		log.Printf("🗑️  Deleting %d existing users for fresh test data...", len(existingUsers))
 		for _, user := range existingUsers {
-			if _, err := s.UserRepo.DeleteUser(user.UserID); err != nil {
+			if _, err := s.UserRepo.DeleteUser(ctx, user.UserID); err != nil {
 				log.Printf("⚠️  Failed to delete user %s %s: %v", user.FirstName, user.LastName, err)
 			}
 		}
@@ -244,7 +248,7 @@ func (s *SeedData) SeedUsers() error {
 
 	// Create all users
 	for i, user := range sampleUsers {
-		createdUser, err := s.UserRepo.CreateUser(user)
+		createdUser, err := s.UserRepo.CreateUser(ctx, user)
 		if err != nil {
 			log.Printf("Failed to create user %s %s: %v", user.FirstName, user.LastName, err)
 			continue
@@ -258,8 +262,8 @@ func (s *SeedData) SeedUsers() error {
 }
 
 // GetSampleProductsByCategory returns products grouped by category for display
-func (s *SeedData) GetSampleProductsByCategory() (map[string][]productModels.Product, error) {
-	products, err := s.ProductRepo.ListAllProducts()
+func (s *SeedData) GetSampleProductsByCategory(ctx context.Context) (map[string][]productModels.Product, error) {
+	products, err := s.ProductRepo.ListAllProducts(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -273,11 +277,11 @@ func (s *SeedData) GetSampleProductsByCategory() (map[string][]productModels.Pro
 }
 
 // PrintSeedingSummary prints a nice summary of seeded data
-func (s *SeedData) PrintSeedingSummary() {
+func (s *SeedData) PrintSeedingSummary(ctx context.Context) {
 	log.Println("\n=== SEEDING SUMMARY ===")
 
 	// Product summary
-	products, err := s.ProductRepo.ListAllProducts()
+	products, err := s.ProductRepo.ListAllProducts(ctx)
 	if err == nil {
 		log.Printf("Total Products: %d", len(products))
 
@@ -293,7 +297,7 @@ func (s *SeedData) PrintSeedingSummary() {
 	}
 
 	// User summary
-	users, err := s.UserRepo.ListAllUsers()
+	users, err := s.UserRepo.ListAllUsers(ctx)
 	if err == nil {
 		log.Printf("Total Users: %d", len(users))
 	}
@@ -12,6 +12,7 @@ const Icon = ({ icon: IconComponent, className }: { icon: IconType; className?:
 interface ActiveFilterTagsProps {
     searchTerm: string;
     selectedCategory: string;
+    selectedAttributes: Record<string, string[]>;
     isPriceFilterActive: boolean;
     priceRange: { min: number; max: number };
     minPrice: number;
@@ -19,6 +20,7 @@ interface ActiveFilterTagsProps {
     sortBy: string;
     onRemoveSearch: () => void;
     onRemoveCategory: () => void;
+    onRemoveAttribute: (name: string, value: string) => void;
     onRemovePriceRange: () => void;
     onRemoveSort: () => void;
     onClearAll: () => void;
@@ -27,6 +29,7 @@ interface ActiveFilterTagsProps {
 const ActiveFilterTags: React.FC<ActiveFilterTagsProps> = ({
     searchTerm,
     selectedCategory,
+    selectedAttributes,
     isPriceFilterActive,
     priceRange,
     minPrice,
@@ -34,6 +37,7 @@ const ActiveFilterTags: React.FC<ActiveFilterTagsProps> = ({
     sortBy,
     onRemoveSearch,
     onRemoveCategory,
+    onRemoveAttribute,
     onRemovePriceRange,
     onRemoveSort,
     onClearAll
@@ -46,10 +50,13 @@ const ActiveFilterTags: React.FC<ActiveFilterTagsProps> = ({
 
     const hasSearchFilter = searchTerm !== '';
     const hasCategoryFilter = selectedCategory !== '';
+    const attributeTags = Object.entries(selectedAttributes)
+        .flatMap(([name, values]) => values.map((value) => ({ name, value })));
+    const hasAttributeFilter = attributeTags.length > 0;
     const hasPriceFilter = isPriceFilterActive;
     const hasSortFilter = sortBy !== 'name-asc';
 
-    const hasAnyFilter = hasSearchFilter || hasCategoryFilter || hasPriceFilter || hasSortFilter;
+    const hasAnyFilter = hasSearchFilter || hasCategoryFilter || hasAttributeFilter || hasPriceFilter || hasSortFilter;
 
     if (!hasAnyFilter) {
         return null;
@@ -95,6 +102,20 @@ const ActiveFilterTags: React.FC<ActiveFilterTagsProps> = ({
                     </div>
                 )}
 
+                {attributeTags.map(({ name, value }) => (
+                    <div key={`${name}:${value}`} className="filter-tag filter-tag-attribute">
+                        <span className="filter-tag-label">{name}:</span>
+                        <span className="filter-tag-value">{value}</span>
+                        <button
+                            onClick={() => onRemoveAttribute(name, value)}
+                            className="filter-tag-remove"
+                            aria-label={`Remove ${name} filter`}
+                        >
+                            <Icon icon={FaTimes} />
+                        </button>
+                    </div>
+                ))}
+
                 {hasPriceFilter && (
                     <div className="filter-tag filter-tag-price">
                         <span className="filter-tag-label">Price:</span>
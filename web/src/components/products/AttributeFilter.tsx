@@ -0,0 +1,44 @@
+import React from 'react';
+import { AttributeSelection, FacetValue } from '../../services/productService';
+import './AttributeFilter.css';
+
+interface AttributeFilterProps {
+    facets: Record<string, FacetValue[]>;
+    selected: AttributeSelection;
+    onToggle: (name: string, value: string) => void;
+}
+
+const formatName = (name: string) => name.charAt(0).toUpperCase() + name.slice(1).replace(/_/g, ' ');
+
+// Lists each attribute's values with how many products have them. Counts
+// come from the server and ignore the attribute's own selection, so more
+// values of an attribute can be added to it.
+const AttributeFilter: React.FC<AttributeFilterProps> = ({ facets, selected, onToggle }) => {
+    const names = Object.keys(facets).sort();
+    if (names.length === 0) {
+        return null;
+    }
+
+    return (
+        <div className="attribute-filter">
+            {names.map((name) => (
+                <fieldset key={name} className="attribute-group">
+                    <legend className="attribute-name">{formatName(name)}</legend>
+                    {facets[name].map(({ value, count }) => (
+                        <label key={value} className="attribute-option">
+                            <input
+                                type="checkbox"
+                                checked={(selected[name] || []).includes(value)}
+                                onChange={() => onToggle(name, value)}
+                            />
+                            <span className="attribute-value">{value}</span>
+                            <span className="attribute-count">{count}</span>
+                        </label>
+                    ))}
+                </fieldset>
+            ))}
+        </div>
+    );
+};
+
+export default AttributeFilter;
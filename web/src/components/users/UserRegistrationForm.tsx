@@ -37,8 +37,8 @@ const UserRegistrationForm = ({ onSuccess, onError }: UserRegistrationFormProps)
         }
         if (!formData.password?.trim()) {
             newErrors.password = 'Password is required'
-        } else if (formData.password.length < 6) {
-            newErrors.password = 'Password must be at least 6 characters';
+        } else if (formData.password.length < 8) {
+            newErrors.password = 'Password must be at least 8 characters';
         }
 
         setErrors(newErrors);
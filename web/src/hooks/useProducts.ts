@@ -14,6 +14,7 @@ const useProducts = () => {
         price: apiProduct.price,
         category: apiProduct.category,
         imageUrl: apiProduct.image_url,
+        attributes: apiProduct.attributes,
 
     });
 
@@ -2,7 +2,6 @@ import React, { useEffect, useState } from 'react';
 import { Link } from 'react-router-dom';
 import { useAuth } from '../../context/AuthContext';
 import { orderService, Order } from '../../services/orderService';
-import { productService, ApiProduct } from '../../services/productService';
 import { FaBox } from 'react-icons/fa';
 import { IconType } from 'react-icons';
 import './OrderHistory.css';
@@ -16,7 +15,6 @@ const Icon = ({ icon: IconComponent, className }: { icon: IconType; className?:
 const OrderHistory = () => {
     const { user } = useAuth();
     const [orders, setOrders] = useState<Order[]>([]);
-    const [products, setProducts] = useState<Record<string, ApiProduct>>({});
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
 
@@ -34,7 +32,7 @@ const OrderHistory = () => {
     });
 
     useEffect(() => {
-        const fetchOrdersAndProducts = async () => {
+        const fetchOrders = async () => {
             if (!user) return;
 
             try {
@@ -44,29 +42,6 @@ const OrderHistory = () => {
                 // Sort orders by date descending
                 userOrders.sort((a, b) => new Date(b.created_at).getTime() - new Date(a.created_at).getTime());
                 setOrders(userOrders);
-
-                // Collect all unique product IDs
-                const productIds = new Set<string>();
-                userOrders.forEach(order => {
-                    order.items?.forEach((item: any) => {
-                        if (item.product_id) productIds.add(item.product_id);
-                    });
-                });
-
-                // Fetch product details
-                const productMap: Record<string, ApiProduct> = {};
-                await Promise.all(
-                    Array.from(productIds).map(async (id) => {
-                        try {
-                            const product = await productService.getProductById(id);
-                            productMap[id] = product;
-                        } catch (err) {
-                            console.error(`Failed to fetch product ${id}`, err);
-                        }
-                    })
-                );
-                setProducts(productMap);
-
             } catch (err) {
                 setError('Failed to load order history. Please try again later.');
                 console.error(err);
@@ -75,7 +50,7 @@ const OrderHistory = () => {
             }
         };
 
-        fetchOrdersAndProducts();
+        fetchOrders();
     }, [user]);
 
     if (loading) {
@@ -136,8 +111,8 @@ const OrderHistory = () => {
 
                             <div className="order-content">
                                 <div className="order-items">
-                                    {order.items?.map((item: any, index: number) => {
-                                        const product = products[item.product_id];
+                                    {order.items?.map((item, index) => {
+                                        // Items show the product as it was when ordered
                                         return (
                                             <div key={index} className="order-item-row">
                                                 <div className="item-image-placeholder">
@@ -145,9 +120,9 @@ const OrderHistory = () => {
                                                 </div>
                                                 <div className="item-details">
                                                     <span className="item-name">
-                                                        {product ? product.name : `Product ID: ${item.product_id.slice(0, 8)}...`}
+                                                        {item.product_name || `Product ID: ${item.product_id.slice(0, 8)}...`}
                                                     </span>
-                                                    {product && <span className="item-category">{product.category}</span>}
+                                                    {item.product_category && <span className="item-category">{item.product_category}</span>}
                                                     <div className="item-meta-mobile">
                                                         <span>Qty: {item.quantity}</span>
                                                     </div>
@@ -9,6 +9,8 @@ import useProducts from "../../hooks/useProducts";
 import { useFavorites } from '../../context/FavoritesContext';
 import useRecentlyViewedProducts from '../../hooks/useRecentlyViewedProducts';
 import ProductQuickViewModal from '../../components/products/ProductQuickViewModal';
+import AttributeFilter from '../../components/products/AttributeFilter';
+import { productService, AttributeSelection, FacetValue } from '../../services/productService';
 import Product from '../../types/product';
 
 import './Products.css'
@@ -40,6 +42,45 @@ const Products = () => {
     }, [tabProducts]);
 
     const [selectedCategory, setSelectedCategory] = useState<string>('');
+    const [selectedAttributes, setSelectedAttributes] = useState<AttributeSelection>({});
+    const [attributeFacets, setAttributeFacets] = useState<Record<string, FacetValue[]>>({});
+
+    // Attribute facets are counted by the server for the current category and
+    // attribute selection; they only describe the full catalog.
+    useEffect(() => {
+        if (activeTab !== 'all') {
+            setAttributeFacets({});
+            return;
+        }
+        let cancelled = false;
+        productService.getFacets(selectedCategory, selectedAttributes)
+            .then((facets) => {
+                if (!cancelled) setAttributeFacets(facets.attributes);
+            })
+            .catch((err) => {
+                console.error('Error fetching product facets: ', err);
+                if (!cancelled) setAttributeFacets({});
+            });
+        return () => {
+            cancelled = true;
+        };
+    }, [activeTab, selectedCategory, selectedAttributes, products]);
+
+    const handleToggleAttribute = (name: string, value: string) => {
+        setSelectedAttributes((prev) => {
+            const current = prev[name] || [];
+            const values = current.includes(value)
+                ? current.filter((v) => v !== value)
+                : [...current, value];
+            const next = { ...prev };
+            if (values.length > 0) {
+                next[name] = values;
+            } else {
+                delete next[name];
+            }
+            return next;
+        });
+    };
 
     // Prevent "hidden" category filtering when switching tabs (where available categories differ).
     useEffect(() => {
@@ -103,6 +144,11 @@ const Products = () => {
             filtered = filtered.filter(product => product.category === selectedCategory);
         }
 
+        // Apply attribute filters: any selected value of each attribute
+        Object.entries(selectedAttributes).forEach(([name, values]) => {
+            filtered = filtered.filter(product => values.includes(product.attributes?.[name] ?? ''));
+        });
+
         // Apply price range filter only if user has adjusted it.
         // (Do not infer "active" by comparing to min/max; priceRange state is synced in an effect.)
         if (isPriceRangeDirty) {
@@ -127,17 +173,18 @@ const Products = () => {
                     return 0;
             }
         });
-    }, [tabProducts, sortBy, searchTerm, selectedCategory, priceRange, isPriceRangeDirty]);
+    }, [tabProducts, sortBy, searchTerm, selectedCategory, selectedAttributes, priceRange, isPriceRangeDirty]);
 
     // Reset pagination when filters change
     useEffect(() => {
         setCurrentPage(1);
-    }, [searchTerm, sortBy, selectedCategory, isPriceRangeDirty, priceRange, pageSize, activeTab]);
+    }, [searchTerm, sortBy, selectedCategory, selectedAttributes, isPriceRangeDirty, priceRange, pageSize, activeTab]);
 
     // Close modal and reset filters when switching tabs
     useEffect(() => {
         setQuickViewProduct(null);
         setSelectedCategory('');
+        setSelectedAttributes({});
         setIsPriceRangeDirty(false);
     }, [activeTab]);
 
@@ -145,6 +192,7 @@ const Products = () => {
         setSearchTerm('');
         setSortBy('name-asc');
         setSelectedCategory('');
+        setSelectedAttributes({});
         setIsPriceRangeDirty(false);
         setPriceRange({ min: minPrice, max: maxPrice });
         setCurrentPage(1);
@@ -261,6 +309,12 @@ const Products = () => {
                         </div>
                     )}
 
+                    <AttributeFilter
+                        facets={attributeFacets}
+                        selected={selectedAttributes}
+                        onToggle={handleToggleAttribute}
+                    />
+
                     {tabProducts.length > 0 && (
                         <PriceRangeFilter
                             minPrice={minPrice}
@@ -275,6 +329,7 @@ const Products = () => {
                 <ActiveFilterTags
                     searchTerm={searchTerm}
                     selectedCategory={selectedCategory}
+                    selectedAttributes={selectedAttributes}
                     isPriceFilterActive={isPriceRangeDirty}
                     priceRange={effectivePriceRange}
                     minPrice={minPrice}
@@ -282,6 +337,7 @@ const Products = () => {
                     sortBy={sortBy}
                     onRemoveSearch={handleRemoveSearch}
                     onRemoveCategory={handleRemoveCategory}
+                    onRemoveAttribute={handleToggleAttribute}
                     onRemovePriceRange={handleRemovePriceRange}
                     onRemoveSort={handleRemoveSort}
                     onClearAll={handleClear}
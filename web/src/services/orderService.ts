@@ -6,6 +6,16 @@ export interface OrderItem {
     price: number;
 }
 
+// Order items as returned by the API, with the product details captured
+// when the item was ordered.
+export interface OrderItemDetails extends OrderItem {
+    order_item_id: string;
+    product_name: string;
+    product_category: string;
+    product_image_url: string;
+    product_sku: string;
+}
+
 export interface CreateOrderRequest {
     user_id: string;
     items: OrderItem[];
@@ -26,7 +36,7 @@ export interface Order {
     zip_code?: string;
     country?: string;
     created_at: string;
-    items: any[]; // We can define a more specific type if needed for viewing orders
+    items: OrderItemDetails[];
 }
 
 export const orderService = {
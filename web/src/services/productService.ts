@@ -7,8 +7,23 @@ export interface ApiProduct {
     price: number;
     category: string;
     image_url?: string;
+    attributes?: Record<string, string>;
 }
 
+export interface FacetValue {
+    value: string;
+    count: number;
+}
+
+export interface ProductFacets {
+    categories: FacetValue[];
+    attributes: Record<string, FacetValue[]>;
+}
+
+// Selected attribute values by attribute name; a product matches any of the
+// values selected for an attribute.
+export type AttributeSelection = Record<string, string[]>;
+
 export const productService = {
     async getAllProducts(): Promise<ApiProduct[]> {
         const response = await fetch(`${API_URL}/products`);
@@ -18,6 +33,21 @@ export const productService = {
         return response.json();
     },
 
+    async getFacets(category: string, attributes: AttributeSelection): Promise<ProductFacets> {
+        const params = new URLSearchParams();
+        if (category) {
+            params.append('category', category);
+        }
+        Object.entries(attributes).forEach(([name, values]) => {
+            values.forEach((value) => params.append(`attr.${name}`, value));
+        });
+        const response = await fetch(`${API_URL}/products/facets?${params.toString()}`);
+        if (!response.ok) {
+            throw new Error(`HTTP error: status ${response.status}`);
+        }
+        return response.json();
+    },
+
     async getProductById(id: string): Promise<ApiProduct> {
         const response = await fetch(`${API_URL}/products/${id}`)
         if (!response.ok) {
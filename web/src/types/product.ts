@@ -5,6 +5,7 @@ interface Product {
     price: number;
     category: string;
     imageUrl?: string;
+    attributes?: Record<string, string>;
 }
 
 export default Product;
\ No newline at end of file